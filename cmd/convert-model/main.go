@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/thyrook/partner/internal/model"
+)
+
+func main() {
+	inputPath := flag.String("input", "", "Checkpoint to convert (.gob, .bin or .safetensors)")
+	outputPath := flag.String("output", "", "Converted checkpoint; the extension selects the format (default: input with .safetensors)")
+	inspect := flag.Bool("inspect", false, "List the tensors of a .safetensors checkpoint instead of converting")
+
+	flag.Parse()
+
+	if *inputPath == "" {
+		fmt.Println("Model Checkpoint Converter")
+		fmt.Println()
+		fmt.Println("Usage:")
+		fmt.Println("  Convert a legacy gob checkpoint to named tensors:")
+		fmt.Println("    convert-model -input=data/models/chess_cnn.gob")
+		fmt.Println()
+		fmt.Println("  Convert back to the legacy format:")
+		fmt.Println("    convert-model -input=chess_cnn.safetensors -output=chess_cnn.bin")
+		fmt.Println()
+		fmt.Println("  Inspect a named-tensor checkpoint:")
+		fmt.Println("    convert-model -input=chess_cnn.safetensors -inspect")
+		fmt.Println()
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *inspect {
+		if err := inspectTensorFile(*inputPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to inspect checkpoint: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *outputPath == "" {
+		*outputPath = strings.TrimSuffix(*inputPath, filepath.Ext(*inputPath)) + model.TensorFileExt
+	}
+	if *outputPath == *inputPath {
+		fmt.Fprintln(os.Stderr, "Output must differ from the input checkpoint")
+		os.Exit(1)
+	}
+
+	metadata, err := model.ConvertCheckpoint(*inputPath, *outputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to convert checkpoint: %v\n", err)
+		os.Exit(1)
+	}
+
+	inputInfo, _ := os.Stat(*inputPath)
+	outputInfo, _ := os.Stat(*outputPath)
+	fmt.Printf("✓ Converted %s model (%v input, %s encoding)\n",
+		metadata.ModelType, metadata.InputShape, metadata.MoveEncoding)
+	if inputInfo != nil && outputInfo != nil {
+		fmt.Printf("  %s (%.2f MB) → %s (%.2f MB)\n",
+			*inputPath, float64(inputInfo.Size())/1024/1024,
+			*outputPath, float64(outputInfo.Size())/1024/1024)
+	}
+}
+
+// inspectTensorFile prints the metadata and tensors of a named-tensor checkpoint
+func inspectTensorFile(path string) error {
+	file, err := model.ReadTensorFile(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (checksum verified)\n\n", path)
+	fmt.Println("Metadata:")
+	for _, key := range []string{"format", "version", "model_type", "input_shape", "output_shape", "move_encoding", "sha256"} {
+		fmt.Printf("  %-14s %s\n", key+":", file.Metadata[key])
+	}
+
+	fmt.Println()
+	fmt.Println("Tensors:")
+	total := 0
+	for _, t := range file.Tensors {
+		fmt.Printf("  %-24s %v\n", t.Name, t.Shape)
+		total += len(t.Data)
+	}
+	fmt.Printf("\n%d tensors, %d parameters\n", len(file.Tensors), total)
+	return nil
+}
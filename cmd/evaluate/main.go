@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thyrook/partner/internal/evaluation"
+	"github.com/thyrook/partner/internal/model"
+	"github.com/thyrook/partner/internal/search"
+)
+
+func main() {
+	modelPath := flag.String("model", "", "Checkpoint to evaluate (ChessCNN or ImprovedChessCNN)")
+	epdPaths := flag.String("epd", "", "Comma-separated EPD files with bm/am opcodes, e.g. tactical suites")
+	pgnPaths := flag.String("pgn", "", "Comma-separated held-out PGN files (.pgn, .pgn.zst, .pgn.gz or .pgn.bz2)")
+	skipOpening := flag.Int("skip-opening", 0, "Skip the first N plies of each PGN game")
+	every := flag.Int("every", 1, "Keep every Nth PGN position")
+	maxPositions := flag.Int("max-positions", 0, "Maximum positions per PGN file (0 = all)")
+	playouts := flag.Int("playouts", 0, "Rank moves by MCTS visits with this many playouts (0 = raw policy)")
+	workers := flag.Int("workers", 1, "MCTS workers per position")
+	batchSize := flag.Int("batch", evaluation.DefaultConfig().BatchSize, "Positions per forward pass")
+	outputPath := flag.String("output", "", "Write the JSON report to this file (\"-\" for stdout)")
+	positions := flag.Bool("positions", false, "Include per-position results in the JSON report")
+
+	flag.Parse()
+
+	if *modelPath == "" || (*epdPaths == "" && *pgnPaths == "") {
+		fmt.Println("Offline Model Evaluation")
+		fmt.Println()
+		fmt.Println("Usage:")
+		fmt.Println("  evaluate -model=data/models/chess_cnn.gob -epd=wac.epd,sts.epd")
+		fmt.Println("  evaluate -model=data/models/chess_cnn.gob -pgn=heldout.pgn.zst -skip-opening=8 -max-positions=20000 -output=report.json")
+		fmt.Println()
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	var testPositions []evaluation.Position
+	for _, path := range splitList(*epdPaths) {
+		loaded, err := evaluation.LoadEPD(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load EPD: %v\n", err)
+			os.Exit(1)
+		}
+		testPositions = append(testPositions, loaded...)
+	}
+	pgnOptions := evaluation.PGNOptions{SkipOpening: *skipOpening, Every: *every, MaxPositions: *maxPositions}
+	for _, path := range splitList(*pgnPaths) {
+		loaded, err := evaluation.LoadPGN(path, pgnOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load PGN: %v\n", err)
+			os.Exit(1)
+		}
+		testPositions = append(testPositions, loaded...)
+	}
+	if len(testPositions) == 0 {
+		fmt.Fprintln(os.Stderr, "No test positions found")
+		os.Exit(1)
+	}
+
+	runtime, err := model.LoadRuntime(*modelPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load model: %v\n", err)
+		os.Exit(1)
+	}
+
+	var ranker evaluation.Ranker = evaluation.NewPolicyRanker(runtime)
+	rankerName := "policy"
+	if *playouts > 0 {
+		config := search.DefaultConfig()
+		config.Playouts = *playouts
+		config.Workers = *workers
+		var evaluator search.Evaluator = search.NewRuntimeEvaluator(runtime)
+		if *workers > 1 {
+			batcher := model.NewBatcher(runtime, model.BatcherConfig{MaxBatchSize: *workers, MaxWait: time.Millisecond})
+			defer batcher.Close()
+			evaluator = search.NewBatcherEvaluator(batcher)
+		}
+		ranker = evaluation.NewSearchRanker(search.NewSearcher(evaluator, config))
+		rankerName = fmt.Sprintf("mcts-%d", *playouts)
+	}
+
+	// With the report on stdout, keep stdout to the JSON
+	toStdout := *outputPath == "-"
+	if !toStdout {
+		fmt.Printf("Evaluating %s (%s) on %d positions...\n", *modelPath, runtime.Metadata().ModelType, len(testPositions))
+	}
+	start := time.Now()
+	config := evaluation.DefaultConfig()
+	config.BatchSize = *batchSize
+	config.IncludePositions = *positions
+	report, err := evaluation.Evaluate(ranker, testPositions, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Evaluation failed: %v\n", err)
+		os.Exit(1)
+	}
+	report.Model, report.ModelType, report.Ranker = *modelPath, runtime.Metadata().ModelType, rankerName
+	if !toStdout {
+		fmt.Printf("✓ Done in %v\n\n", time.Since(start).Round(time.Millisecond))
+		printReport(report)
+	}
+
+	if *outputPath != "" {
+		encoded, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode report: %v\n", err)
+			os.Exit(1)
+		}
+		encoded = append(encoded, '\n')
+		if toStdout {
+			os.Stdout.Write(encoded)
+		} else if err := os.WriteFile(*outputPath, encoded, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+			os.Exit(1)
+		} else {
+			fmt.Printf("\nReport written to %s\n", *outputPath)
+		}
+	}
+}
+
+// printReport prints the overall metrics and one table per bucket group
+func printReport(report *evaluation.Report) {
+	fmt.Printf("%-14s %9s %7s %7s %7s %7s  %s\n", "", "Positions", "Top-1", "Top-3", "Top-5", "MRR", "Avoided")
+	fmt.Println(strings.Repeat("-", 72))
+	printMetrics("Overall", report.Overall)
+	for _, group := range []struct {
+		title   string
+		buckets map[string]evaluation.Metrics
+	}{
+		{"Source", report.Sources},
+		{"Phase", report.Phases},
+		{"Pieces", report.Pieces},
+		{"Elo", report.EloBands},
+	} {
+		fmt.Printf("\n%s\n", group.title)
+		names := make([]string, 0, len(group.buckets))
+		for name := range group.buckets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			printMetrics("  "+name, group.buckets[name])
+		}
+	}
+}
+
+func printMetrics(name string, m evaluation.Metrics) {
+	avoided := "-"
+	if m.AvoidPositions > 0 {
+		avoided = fmt.Sprintf("%.1f%% of %d", m.Avoided*100, m.AvoidPositions)
+	}
+	if m.Positions == 0 {
+		fmt.Printf("%-14s %9d %7s %7s %7s %7s  %s\n", name, 0, "-", "-", "-", "-", avoided)
+		return
+	}
+	fmt.Printf("%-14s %9d %6.1f%% %6.1f%% %6.1f%% %7.3f  %s\n",
+		name, m.Positions, m.Top1*100, m.Top3*100, m.Top5*100, m.MRR, avoided)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/model"
+	"github.com/thyrook/partner/internal/onnx"
+)
+
+func main() {
+	modelPath := flag.String("model", "", "Checkpoint to export (ChessCNN or ImprovedChessCNN)")
+	outputPath := flag.String("output", "", "ONNX output path (default: model path with .onnx)")
+	verify := flag.Bool("verify", true, "Check the exported graph against the model on the starting position")
+
+	flag.Parse()
+
+	if *modelPath == "" {
+		fmt.Println("ONNX Model Exporter")
+		fmt.Println()
+		fmt.Println("Usage:")
+		fmt.Println("  export-onnx -model=data/models/chess_cnn.gob")
+		fmt.Println("  export-onnx -model=data/models/resnet.gob -output=resnet.onnx")
+		fmt.Println()
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	if *outputPath == "" {
+		*outputPath = strings.TrimSuffix(*modelPath, filepath.Ext(*modelPath)) + ".onnx"
+	}
+
+	m, err := model.LoadChessModel(*modelPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load model: %v\n", err)
+		os.Exit(1)
+	}
+	defer m.Close()
+
+	exported, err := model.ExportONNX(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export model: %v\n", err)
+		os.Exit(1)
+	}
+	if err := onnx.WriteFile(*outputPath, exported); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export model: %v\n", err)
+		os.Exit(1)
+	}
+
+	params := 0
+	for _, t := range exported.Graph.Initializers {
+		params += t.Size()
+	}
+	fmt.Printf("✓ Exported %s to %s\n", exported.Metadata["model_type"], *outputPath)
+	fmt.Printf("  Opset %d, %d nodes, %d parameters (float32)\n",
+		exported.OpsetVersion, len(exported.Graph.Nodes), params)
+	fmt.Printf("  Input:   %s [batch, %d, 8, 8]\n", model.ONNXInput, m.InputChannels())
+	fmt.Printf("  Outputs: %s, %s [batch, %d] (%s move encoding)",
+		model.ONNXLogits, model.ONNXPolicy, m.PolicySize(), m.MoveEncoding())
+	if m.HasValueHead() {
+		fmt.Printf(", %s [batch, 1]", model.ONNXValue)
+	}
+	fmt.Println()
+
+	if *verify {
+		diff, err := verifyExport(m, *outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to verify export: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("  Verified on the starting position: max policy difference %.2e\n", diff)
+	}
+}
+
+// verifyExport evaluates the written graph on the starting position and
+// returns the largest difference from the model's policy
+func verifyExport(m model.ChessModel, path string) (float64, error) {
+	exported, err := onnx.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	state, err := data.TensorizePosition(chess.StartingPosition(), m.InputChannels())
+	if err != nil {
+		return 0, err
+	}
+	probs, _, err := m.Forward(state)
+	if err != nil {
+		return 0, err
+	}
+
+	input := &onnx.Tensor{Dims: []int64{1, int64(m.InputChannels()), 8, 8}, Data: state}
+	outputs, err := onnx.Run(exported, map[string]*onnx.Tensor{model.ONNXInput: input})
+	if err != nil {
+		return 0, err
+	}
+
+	maxDiff := 0.0
+	for i, p := range probs {
+		maxDiff = math.Max(maxDiff, math.Abs(float64(outputs[model.ONNXPolicy].Data[i])-p))
+	}
+	return maxDiff, nil
+}
@@ -4,19 +4,34 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/thyrook/partner/internal/data"
 )
 
 func main() {
 	// Command line flags
-	pgnPath := flag.String("pgn", "", "Path to PGN file to ingest")
+	pgnPath := flag.String("pgn", "", "Path to PGN file to ingest (.pgn, .pgn.zst, .pgn.gz or .pgn.bz2)")
 	datasetPath := flag.String("dataset", "data/chess_dataset.db", "Path to output dataset")
 	maxGames := flag.Int("max-games", 0, "Maximum number of games to process (0 = all)")
 	maxPositions := flag.Int("max-positions", 0, "Maximum positions to extract (0 = all)")
 	verify := flag.Bool("verify", false, "Verify dataset integrity after ingestion")
 	showStats := flag.Bool("stats", false, "Show dataset statistics")
 	workers := flag.Int("workers", 4, "Number of parallel workers")
+	resume := flag.Bool("resume", false, "Continue an interrupted ingestion of the same PGN file")
+	dedup := flag.Bool("dedup", false, "Merge repeated positions into one entry whose target is the distribution of moves played")
+
+	// Filters
+	filterPath := flag.String("filter", "", "JSON file with a game filter (flags below override its fields)")
+	minElo := flag.Int("min-elo", 0, "Minimum rating of both players (0 = no limit)")
+	maxElo := flag.Int("max-elo", 0, "Maximum rating of both players (0 = no limit)")
+	timeControls := flag.String("time-controls", "", "Comma-separated time control categories to keep: bullet, blitz, rapid, classical, correspondence")
+	excludeTerminations := flag.String("exclude-terminations", "", "Comma-separated PGN Termination values to drop, e.g. \"Abandoned,Time forfeit\"")
+	minPly := flag.Int("min-ply", 0, "Minimum game length in plies")
+	maxPly := flag.Int("max-ply", 0, "Maximum game length in plies (0 = no limit)")
+	skipOpening := flag.Int("skip-opening", 0, "Skip positions in the first N plies of each game")
+	winnerOnly := flag.Bool("winner-only", false, "Only ingest moves of the side that won (drawn games are dropped)")
+	channels := flag.Int("channels", data.DefaultInputChannels, "Input planes per position: 19 (pieces + side to move, castling, en passant, halfmove clock) or 12 (pieces only)")
 
 	flag.Parse()
 
@@ -34,6 +49,12 @@ func main() {
 		fmt.Println("  Ingest PGN file:")
 		fmt.Println("    ingest-pgn -pgn=games.pgn -dataset=output.db")
 		fmt.Println()
+		fmt.Println("  Keep rated blitz and rapid games between 1800 and 2400:")
+		fmt.Println("    ingest-pgn -pgn=games.pgn -min-elo=1800 -max-elo=2400 -time-controls=blitz,rapid -exclude-terminations=Abandoned")
+		fmt.Println()
+		fmt.Println("  Resume an interrupted ingestion:")
+		fmt.Println("    ingest-pgn -pgn=lichess_db_standard_rated_2024-01.pgn.zst -dataset=output.db -resume")
+		fmt.Println()
 		fmt.Println("  Show statistics:")
 		fmt.Println("    ingest-pgn -dataset=output.db -stats")
 		fmt.Println()
@@ -41,6 +62,36 @@ func main() {
 		os.Exit(1)
 	}
 
+	filter, err := loadFilter(*filterPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load filter: %v\n", err)
+		os.Exit(1)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "min-elo":
+			filter.MinElo = *minElo
+		case "max-elo":
+			filter.MaxElo = *maxElo
+		case "time-controls":
+			filter.TimeControls = splitList(*timeControls)
+		case "exclude-terminations":
+			filter.ExcludeTerminations = splitList(*excludeTerminations)
+		case "min-ply":
+			filter.MinPly = *minPly
+		case "max-ply":
+			filter.MaxPly = *maxPly
+		case "skip-opening":
+			filter.SkipOpeningPlies = *skipOpening
+		case "winner-only":
+			filter.WinnerOnly = *winnerOnly
+		}
+	})
+	if err := filter.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid filter: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Create ingestion config
 	config := &data.IngestionConfig{
 		PGNPath:        *pgnPath,
@@ -51,6 +102,10 @@ func main() {
 		BatchSize:      100,
 		Verbose:        true,
 		WorkerPoolSize: *workers,
+		InputChannels:  *channels,
+		Resume:         *resume,
+		Filter:         filter,
+		Deduplicate:    *dedup,
 	}
 
 	// Create ingestor
@@ -58,6 +113,7 @@ func main() {
 	fmt.Printf("  PGN file: %s\n", *pgnPath)
 	fmt.Printf("  Dataset: %s\n", *datasetPath)
 	fmt.Printf("  Workers: %d\n", *workers)
+	fmt.Printf("  Input channels: %d\n", *channels)
 	fmt.Println()
 
 	ingestor, err := data.NewIngestor(config)
@@ -83,6 +139,16 @@ func main() {
 	fmt.Printf("Games processed:     %d / %d\n", stats.GamesProcessed, stats.TotalGames)
 	fmt.Printf("Positions ingested:  %d\n", stats.PositionsIngested)
 	fmt.Printf("Positions skipped:   %d\n", stats.SkippedPositions)
+	fmt.Printf("Unparseable games:   %d\n", stats.InvalidGames)
+	if *dedup {
+		fmt.Printf("Duplicates merged:   %d\n", stats.DuplicatePositions)
+	}
+	if stats.ResumedAtGame > 0 {
+		fmt.Printf("Resumed at game:     %d\n", stats.ResumedAtGame)
+	}
+	fmt.Println()
+	stats.Rejections.Fprint(os.Stdout)
+	stats.Metadata.Fprint(os.Stdout)
 	fmt.Println()
 
 	// Note: -verify flag deprecated due to database locking issues
@@ -96,6 +162,25 @@ func main() {
 	fmt.Println("Dataset ready for training!")
 }
 
+// loadFilter reads the filter file, or returns an empty filter if none is given
+func loadFilter(path string) (*data.GameFilter, error) {
+	if path == "" {
+		return &data.GameFilter{}, nil
+	}
+	return data.LoadGameFilter(path)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func showDatasetStats(datasetPath string) {
 	dataset, err := data.NewDataset(datasetPath)
 	if err != nil {
@@ -115,6 +200,22 @@ func showDatasetStats(datasetPath string) {
 	fmt.Printf("File:            %s\n", stats.FilePath)
 	fmt.Printf("Total entries:   %d\n", stats.TotalEntries)
 	fmt.Printf("File size:       %.2f MB\n", float64(stats.FileSize)/1024/1024)
+	fmt.Printf("Input channels:  %d\n", stats.InputChannels)
+	fmt.Printf("Record format:   %s\n", stats.Format)
+	if progress, err := dataset.IngestionProgress(); err == nil && progress != nil {
+		state := "interrupted (use -resume)"
+		if progress.Complete {
+			state = "complete"
+		}
+		fmt.Printf("Ingested from:   %s, %d games, %s\n", progress.Source, progress.GameIndex, state)
+	}
+	fmt.Println()
+	metadata, err := dataset.MetadataStats()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to scan metadata: %v\n", err)
+		os.Exit(1)
+	}
+	metadata.Fprint(os.Stdout)
 	fmt.Println()
 
 	// Show sample entries
@@ -133,6 +234,18 @@ func showDatasetStats(datasetPath string) {
 			fmt.Printf("  From square: %d\n", entry.FromSquare)
 			fmt.Printf("  To square:   %d\n", entry.ToSquare)
 			fmt.Printf("  Tensor size: %d\n", len(entry.StateTensor))
+			if len(entry.MoveCounts) > 0 {
+				fmt.Printf("  Visits:      %d (%d distinct moves)\n", entry.Visits(), len(entry.MoveCounts))
+			}
+			if entry.HasOutcome {
+				fmt.Printf("  Outcome:     %+.0f (side to move)\n", entry.Outcome)
+			}
+			if entry.WhiteElo > 0 || entry.BlackElo > 0 {
+				fmt.Printf("  Elo:         %d / %d\n", entry.WhiteElo, entry.BlackElo)
+			}
+			if entry.ECO != "" || entry.TimeControl != "" {
+				fmt.Printf("  ECO / TC:    %s / %s\n", entry.ECO, entry.TimeControl)
+			}
 		}
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/thyrook/partner/internal/data"
 	"github.com/thyrook/partner/internal/model"
 	"github.com/thyrook/partner/internal/vision"
 )
@@ -51,7 +52,7 @@ func main() {
 
 	// Load trained model
 	fmt.Printf("Loading model from: %s\n", *modelPath)
-	cnn, err := model.NewChessCNNForInference(*modelPath)
+	cnn, err := model.LoadChessModel(*modelPath)
 	if err != nil {
 		log.Fatalf("Failed to load model: %v", err)
 	}
@@ -76,7 +77,7 @@ func main() {
 	}
 }
 
-func analyzeSingleImage(imagePath string, config *vision.Config, cnn *model.ChessCNN, topK int, verbose bool) {
+func analyzeSingleImage(imagePath string, config *vision.Config, cnn model.ChessModel, topK int, verbose bool) {
 	fmt.Printf("\n📷 Analyzing image: %s\n", imagePath)
 
 	// Create a temporary pipeline to process the image
@@ -119,7 +120,7 @@ func analyzeSingleImage(imagePath string, config *vision.Config, cnn *model.Ches
 	}
 }
 
-func analyzeVideo(videoPath string, config *vision.Config, cnn *model.ChessCNN, topK int, verbose bool) {
+func analyzeVideo(videoPath string, config *vision.Config, cnn model.ChessModel, topK int, verbose bool) {
 	fmt.Printf("\n🎬 Analyzing video: %s\n", videoPath)
 
 	// Get video info
@@ -210,7 +211,7 @@ func analyzeVideo(videoPath string, config *vision.Config, cnn *model.ChessCNN,
 	}
 }
 
-func analyzeLive(config *vision.Config, cnn *model.ChessCNN, topK int, verbose bool) {
+func analyzeLive(config *vision.Config, cnn model.ChessModel, topK int, verbose bool) {
 	fmt.Println("\n📡 Starting live chess analysis")
 	fmt.Printf("Capture region: %d,%d (%dx%d)\n",
 		config.CaptureRegion.X, config.CaptureRegion.Y,
@@ -312,12 +313,12 @@ type MovePrediction struct {
 	ToSquare   int
 }
 
-func predictMoves(cnn *model.ChessCNN, tensor [12][8][8]float32, topK int) ([]MovePrediction, error) {
+func predictMoves(cnn model.ChessModel, tensor [12][8][8]float32, topK int) ([]MovePrediction, error) {
 	// Extract chess-specific features
 	features := model.ExtractChessFeatures(tensor)
 
 	// Get more predictions than needed for filtering
-	predictions, err := cnn.Predict(tensor, topK*3)
+	predictions, err := cnn.PredictState(data.TensorToFlatArray(tensor), topK*3)
 	if err != nil {
 		return nil, fmt.Errorf("model prediction failed: %w", err)
 	}
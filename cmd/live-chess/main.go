@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/thyrook/partner/internal/data"
 	"github.com/thyrook/partner/internal/model"
 	"github.com/thyrook/partner/internal/vision"
 )
@@ -70,23 +71,16 @@ func main() {
 	run(pipeline, cnn, tensorChan, *topK, sig)
 }
 
-func loadModel(path string) (*model.ChessCNN, error) {
+func loadModel(path string) (model.ChessModel, error) {
 	if _, err := os.Stat(path); err == nil {
-		cnn, err := model.NewChessCNN()
-		if err != nil {
-			return nil, err
-		}
-		if err := cnn.LoadModel(path); err != nil {
-			cnn.Close()
-			return nil, err
-		}
-		return cnn, nil
+		// Builds the network with the architecture and layout recorded in the checkpoint
+		return model.LoadChessModel(path)
 	}
 	log.Println("Warning: No trained model, creating new")
 	return model.NewChessCNN()
 }
 
-func run(p *vision.Pipeline, cnn *model.ChessCNN, ch <-chan vision.BoardStateTensor, topK int, sig chan os.Signal) {
+func run(p *vision.Pipeline, cnn model.ChessModel, ch <-chan vision.BoardStateTensor, topK int, sig chan os.Signal) {
 	boards := 0
 	lastTime := time.Now()
 
@@ -116,11 +110,12 @@ func run(p *vision.Pipeline, cnn *model.ChessCNN, ch <-chan vision.BoardStateTen
 				continue
 			}
 
-			preds, err := cnn.Predict(t.Tensor, topK)
+			probs, value, err := cnn.Forward(data.TensorToFlatArray(t.Tensor))
 			if err != nil {
 				log.Printf("Prediction failed: %v", err)
 				continue
 			}
+			preds := model.TopKPredictions(probs, topK)
 
 			fmt.Printf("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
 			fmt.Printf("📋 Board #%d at %s\n", boards, time.Unix(t.Timestamp, 0).Format("15:04:05"))
@@ -131,7 +126,10 @@ func run(p *vision.Pipeline, cnn *model.ChessCNN, ch <-chan vision.BoardStateTen
 				from := sq2alg(p.FromSquare)
 				to := sq2alg(p.ToSquare)
 				bar := makeBar(p.Probability, 15)
-				fmt.Printf("  %d. %s→%s %s %.1f%%\n", i+1, from, to, bar, p.Probability*100)
+				fmt.Printf("  %d. %s→%s%s %s %.1f%%\n", i+1, from, to, p.Promotion, bar, p.Probability*100)
+			}
+			if cnn.HasValueHead() {
+				fmt.Printf("\n📈 Evaluation: %+.2f (side to move)\n", value)
 			}
 			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 		}
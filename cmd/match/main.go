@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thyrook/partner/internal/match"
+	"github.com/thyrook/partner/internal/model"
+	"github.com/thyrook/partner/internal/search"
+)
+
+func main() {
+	defaults := match.DefaultConfig()
+	modelPath := flag.String("model", "", "Checkpoint to test (player A)")
+	opponent := flag.String("opponent", "material", "Checkpoint to play against, or the baseline \"random\" or \"material\" (player B)")
+	games := flag.Int("games", defaults.Games, "Games to play")
+	concurrency := flag.Int("concurrency", defaults.Concurrency, "Games played in parallel")
+	temperature := flag.Float64("temperature", 1, "Policy sampling temperature (0 plays the most likely move)")
+	openingsPath := flag.String("openings", "", "Opening book: a FEN/EPD list, or a PGN file whose games give the first -book-plies moves")
+	bookPlies := flag.Int("book-plies", 8, "Plies taken from each game of a PGN opening book")
+	maxPlies := flag.Int("max-plies", defaults.Adjudication.MaxPlies, "Adjudicate a draw after this many plies (0 = no limit)")
+	winMargin := flag.Int("win-margin", defaults.Adjudication.WinMargin, "Material lead in centipawns that wins by adjudication")
+	winPlies := flag.Int("win-plies", defaults.Adjudication.WinPlies, "Plies the material lead must be held (0 disables win adjudication)")
+	elo0 := flag.Float64("elo0", defaults.SPRT.Elo0, "SPRT null hypothesis Elo difference")
+	elo1 := flag.Float64("elo1", defaults.SPRT.Elo1, "SPRT alternative hypothesis Elo difference")
+	alpha := flag.Float64("alpha", defaults.SPRT.Alpha, "SPRT false positive rate")
+	beta := flag.Float64("beta", defaults.SPRT.Beta, "SPRT false negative rate")
+	sprtStop := flag.Bool("sprt-stop", false, "Stop the match as soon as the SPRT accepts a hypothesis")
+	pgnPath := flag.String("pgn", "match.pgn", "Write the PGN of all games to this file")
+	seed := flag.Int64("seed", 0, "Random seed of the games (0 = time based)")
+
+	flag.Parse()
+
+	if *modelPath == "" {
+		fmt.Println("Model vs Model Match")
+		fmt.Println()
+		fmt.Println("Usage:")
+		fmt.Println("  match -model=data/models/new.gob -opponent=data/models/old.gob -games=200 -openings=book.epd")
+		fmt.Println("  match -model=data/models/new.gob -opponent=random -games=50")
+		fmt.Println()
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	nameA, nameB := playerName(*modelPath), playerName(*opponent)
+	if nameA == nameB {
+		nameA, nameB = *modelPath, *opponent
+	}
+	a, closeA, err := loadPlayer(*modelPath, nameA, *temperature, *concurrency)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", *modelPath, err)
+		os.Exit(1)
+	}
+	defer closeA()
+	b, closeB, err := loadPlayer(*opponent, nameB, *temperature, *concurrency)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", *opponent, err)
+		os.Exit(1)
+	}
+	defer closeB()
+
+	config := defaults
+	config.Games = *games
+	config.Concurrency = *concurrency
+	config.Adjudication = match.Adjudication{MaxPlies: *maxPlies, WinMargin: *winMargin, WinPlies: *winPlies}
+	config.SPRT = match.SPRTConfig{Elo0: *elo0, Elo1: *elo1, Alpha: *alpha, Beta: *beta}
+	config.StopOnSPRT = *sprtStop
+	config.Seed = *seed
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+	if *openingsPath != "" {
+		config.Openings, err = match.LoadOpenings(*openingsPath, *bookPlies)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load openings: %v\n", err)
+			os.Exit(1)
+		}
+		if len(config.Openings) == 0 {
+			fmt.Fprintln(os.Stderr, "No openings found")
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Match: %s vs %s, %d games, %d in parallel\n", a.Name(), b.Name(), config.Games, config.Concurrency)
+	if len(config.Openings) > 0 {
+		fmt.Printf("Openings: %d from %s\n", len(config.Openings), *openingsPath)
+	}
+	fmt.Printf("Seed: %d\n\n", config.Seed)
+
+	// Ctrl+C ends the match early and still reports the finished games
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	done := 0
+	result, err := match.Run(ctx, a, b, config, func(game match.GameResult, r *match.Result) {
+		done++
+		fmt.Printf("Game %3d/%d  %s  %-7s %-26s %3d plies   %s: %d-%d-%d\n",
+			done, config.Games, pairing(game), game.Result, game.Termination, game.Plies,
+			r.PlayerA, r.Wins, r.Draws, r.Losses)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Match failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	printSummary(result, config.SPRT, time.Since(start))
+
+	if *pgnPath != "" {
+		var sb strings.Builder
+		for i, game := range result.Games {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(game.PGN)
+		}
+		if err := os.WriteFile(*pgnPath, []byte(sb.String()), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write PGN: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nGames written to %s\n", *pgnPath)
+	}
+}
+
+// loadPlayer creates a baseline player or a policy player for a checkpoint.
+// Parallel games share forward passes through a batcher.
+func loadPlayer(spec, name string, temperature float64, concurrency int) (match.Player, func(), error) {
+	switch spec {
+	case "random":
+		return match.RandomPlayer{}, func() {}, nil
+	case "material":
+		return match.MaterialPlayer{}, func() {}, nil
+	}
+
+	runtime, err := model.LoadRuntime(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if concurrency <= 1 {
+		return match.NewPolicyPlayer(name, search.NewRuntimeEvaluator(runtime), temperature), func() {}, nil
+	}
+	batcher := model.NewBatcher(runtime, model.BatcherConfig{MaxBatchSize: concurrency, MaxWait: time.Millisecond})
+	return match.NewPolicyPlayer(name, search.NewBatcherEvaluator(batcher), temperature), batcher.Close, nil
+}
+
+// playerName names a player after its checkpoint file
+func playerName(spec string) string {
+	return strings.TrimSuffix(filepath.Base(spec), ".gob")
+}
+
+// pairing shows which player had White
+func pairing(game match.GameResult) string {
+	if game.Index%2 == 1 {
+		return "B-A"
+	}
+	return "A-B"
+}
+
+func printSummary(result *match.Result, sprt match.SPRTConfig, elapsed time.Duration) {
+	games := len(result.Games)
+	fmt.Println()
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Printf("  %s vs %s: %d games in %v\n", result.PlayerA, result.PlayerB, games, elapsed.Round(time.Second))
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	if games == 0 {
+		fmt.Println("  No games finished")
+		return
+	}
+
+	score := float64(result.Wins) + float64(result.Draws)/2
+	fmt.Printf("  W/D/L:   %d / %d / %d\n", result.Wins, result.Draws, result.Losses)
+	fmt.Printf("  Score:   %.1f/%d (%.1f%%)\n", score, games, score/float64(games)*100)
+	elo, margin := result.Elo()
+	fmt.Printf("  Elo:     %s ± %s (95%%)\n", formatElo(elo, true), formatElo(margin, false))
+	fmt.Printf("  SPRT:    elo0=%g elo1=%g alpha=%g beta=%g\n", sprt.Elo0, sprt.Elo1, sprt.Alpha, sprt.Beta)
+	fmt.Printf("           LLR %.2f [%.2f, %.2f], %s\n", result.SPRT.LLR, result.SPRT.Lower, result.SPRT.Upper, verdictText(result.SPRT.Verdict, sprt))
+
+	terminations := make(map[string]int)
+	for _, game := range result.Games {
+		terminations[game.Termination]++
+	}
+	names := make([]string, 0, len(terminations))
+	for name := range terminations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	endings := make([]string, len(names))
+	for i, name := range names {
+		endings[i] = fmt.Sprintf("%s %d", name, terminations[name])
+	}
+	fmt.Printf("  Endings: %s\n", strings.Join(endings, ", "))
+}
+
+func formatElo(v float64, signed bool) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	case signed:
+		return fmt.Sprintf("%+.1f", v)
+	default:
+		return fmt.Sprintf("%.1f", v)
+	}
+}
+
+func verdictText(verdict string, sprt match.SPRTConfig) string {
+	switch verdict {
+	case match.SPRTAcceptH1:
+		return fmt.Sprintf("H1 accepted: A is at least %g Elo stronger", sprt.Elo1)
+	case match.SPRTAcceptH0:
+		return fmt.Sprintf("H0 accepted: A is at most %g Elo stronger", sprt.Elo0)
+	default:
+		return "inconclusive, more games needed"
+	}
+}
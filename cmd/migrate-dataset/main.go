@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/thyrook/partner/internal/data"
+)
+
+func main() {
+	inputPath := flag.String("input", "", "BoltDB dataset to migrate")
+	outputPath := flag.String("output", "", "Migrated dataset (default: replace the input, keeping it as <input>.bak)")
+	formatName := flag.String("format", string(data.DefaultRecordFormat), "Record format to convert to: compact-v1 or json")
+	keepBackup := flag.Bool("backup", true, "When replacing the input, keep the original as <input>.bak")
+
+	flag.Parse()
+
+	if *inputPath == "" {
+		fmt.Println("Dataset Record Format Migration")
+		fmt.Println()
+		fmt.Println("Usage:")
+		fmt.Println("  Convert a JSON dataset to the compact binary format in place:")
+		fmt.Println("    migrate-dataset -input=data/chess_dataset.db")
+		fmt.Println()
+		fmt.Println("  Write a JSON copy, e.g. for external tools:")
+		fmt.Println("    migrate-dataset -input=data/chess_dataset.db -output=data/chess_dataset_json.db -format=json")
+		fmt.Println()
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	format, err := data.ParseRecordFormat(*formatName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	inPlace := *outputPath == ""
+	target := *outputPath
+	if inPlace {
+		target = *inputPath + ".migrating"
+	}
+	if target == *inputPath {
+		fmt.Fprintln(os.Stderr, "Output must differ from the input dataset")
+		os.Exit(1)
+	}
+	if inPlace && *keepBackup {
+		if _, err := os.Stat(*inputPath + ".bak"); err == nil {
+			fmt.Fprintf(os.Stderr, "Backup %s.bak already exists\n", *inputPath)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Migrating %s to %s records...\n", *inputPath, format)
+	stats, err := data.MigrateDataset(*inputPath, target, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if inPlace {
+		if err := replace(*inputPath, target, *keepBackup); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to replace %s: %v\n", *inputPath, err)
+			os.Exit(1)
+		}
+		target = *inputPath
+	}
+
+	fmt.Printf("✓ Migrated %d entries to %s\n", stats.Entries, target)
+	fmt.Printf("  Records: %s → %s (%s)\n",
+		formatMB(stats.RecordBytesBefore), formatMB(stats.RecordBytesAfter), formatChange(stats.RecordReduction()))
+	if stats.Entries > 0 {
+		fmt.Printf("  Average: %.0f → %.0f bytes per entry\n",
+			float64(stats.RecordBytesBefore)/float64(stats.Entries), float64(stats.RecordBytesAfter)/float64(stats.Entries))
+	}
+	fmt.Printf("  File:    %s → %s (%s)\n",
+		formatMB(stats.FileSizeBefore), formatMB(stats.FileSizeAfter), formatChange(stats.FileReduction()))
+	if inPlace && *keepBackup {
+		fmt.Printf("  Original kept at %s.bak\n", *inputPath)
+	}
+}
+
+// replace moves the migrated dataset over the input, keeping the input as a
+// backup when asked
+func replace(inputPath, migratedPath string, keepBackup bool) error {
+	if keepBackup {
+		if err := os.Rename(inputPath, inputPath+".bak"); err != nil {
+			os.Remove(migratedPath)
+			return err
+		}
+	}
+	return os.Rename(migratedPath, inputPath)
+}
+
+func formatMB(bytes int64) string {
+	return fmt.Sprintf("%.2f MB", float64(bytes)/1024/1024)
+}
+
+func formatChange(reduction float64) string {
+	if reduction >= 0 {
+		return fmt.Sprintf("%.1f%% smaller", reduction*100)
+	}
+	return fmt.Sprintf("%.1f%% larger", -reduction*100)
+}
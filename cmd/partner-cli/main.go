@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,8 +10,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/notnil/chess"
 	"github.com/thyrook/partner/internal/data"
 	"github.com/thyrook/partner/internal/model"
+	"github.com/thyrook/partner/internal/search"
 	"github.com/thyrook/partner/internal/storage"
 	"go.etcd.io/bbolt"
 )
@@ -30,10 +33,12 @@ const (
 )
 
 type CLI struct {
-	model            *model.ChessCNN
+	model            model.ChessModel
 	observationStore *storage.ObservationStore
 	modelPath        string
 	datasetPath      string
+	registryDir      string
+	architecture     model.Architecture
 	running          bool
 }
 
@@ -42,9 +47,11 @@ func main() {
 	fmt.Println()
 
 	cli := &CLI{
-		modelPath:   "data/models/chess_cnn.gob",
-		datasetPath: "data/positions.db",
-		running:     true,
+		modelPath:    "data/models/chess_cnn.gob",
+		datasetPath:  "data/positions.db",
+		registryDir:  "data/models/registry",
+		architecture: model.DefaultArchitecture,
+		running:      true,
 	}
 
 	// Show main menu
@@ -144,6 +151,7 @@ func (c *CLI) trainingMenu() {
 		fmt.Println("4. Custom training")
 		fmt.Println("5. Resume training")
 		fmt.Println("6. View training history")
+		fmt.Println("7. Checkpoint registry")
 		fmt.Println("0. Back to main menu")
 		fmt.Println(strings.Repeat("-", 60))
 		fmt.Print("\nSelect option: ")
@@ -164,6 +172,8 @@ func (c *CLI) trainingMenu() {
 			c.resumeTraining()
 		case "6":
 			c.viewTrainingHistory()
+		case "7":
+			c.registryMenu()
 		case "0":
 			return
 		default:
@@ -184,6 +194,7 @@ func (c *CLI) inferenceMenu() {
 		fmt.Println("3. Test inference on custom FEN")
 		fmt.Println("4. Batch inference")
 		fmt.Println("5. Model performance test")
+		fmt.Println("6. Search custom FEN (MCTS)")
 		fmt.Println("0. Back to main menu")
 		fmt.Println(strings.Repeat("-", 60))
 		fmt.Print("\nSelect option: ")
@@ -202,6 +213,8 @@ func (c *CLI) inferenceMenu() {
 			c.batchInference()
 		case "5":
 			c.performanceTest()
+		case "6":
+			c.searchCustomFEN()
 		case "0":
 			return
 		default:
@@ -265,10 +278,14 @@ func (c *CLI) configMenu() {
 		fmt.Printf("Current Settings:\n")
 		fmt.Printf("  Model path:   %s\n", c.modelPath)
 		fmt.Printf("  Dataset path: %s\n", c.datasetPath)
+		fmt.Printf("  Architecture: %s\n", c.architecture)
+		fmt.Printf("  Registry:     %s\n", c.registryDir)
 		fmt.Println(strings.Repeat("-", 60))
 		fmt.Println("1. Change model path")
 		fmt.Println("2. Change dataset path")
-		fmt.Println("3. Reset to defaults")
+		fmt.Println("3. Change architecture")
+		fmt.Println("4. Change registry directory")
+		fmt.Println("5. Reset to defaults")
 		fmt.Println("0. Back to main menu")
 		fmt.Println(strings.Repeat("-", 60))
 		fmt.Print("\nSelect option: ")
@@ -282,8 +299,14 @@ func (c *CLI) configMenu() {
 		case "2":
 			c.changeDatasetPath(reader)
 		case "3":
+			c.changeArchitecture(reader)
+		case "4":
+			c.changeRegistryDir(reader)
+		case "5":
 			c.modelPath = "data/models/chess_cnn.gob"
 			c.datasetPath = "data/positions.db"
+			c.registryDir = "data/models/registry"
+			c.architecture = model.DefaultArchitecture
 			fmt.Println("✓ Reset to defaults")
 		case "0":
 			return
@@ -314,11 +337,17 @@ MODEL TRAINING:
 - Standard (50 epochs): Balanced training
 - Full (100 epochs): Production training
 - Custom: Configure all hyperparameters
+- Registry: Every saved checkpoint is kept with its metrics and
+  lineage; list, promote, diff and prune them
 
 INFERENCE:
 - Test on random positions from dataset
 - Test on custom FEN strings
 - Batch inference for performance testing
+- Performance test with optional int8 quantization:
+  agreement and speedup against the float model
+- MCTS search on custom FEN strings: moves ranked by
+  visit count instead of raw probability
 
 TIPS:
 - Start with a small dataset (1000 games) for testing
@@ -359,6 +388,13 @@ func (c *CLI) showDatasetStats() {
 	fmt.Printf("Total positions:  %d\n", count)
 	fmt.Printf("File size:        %.2f MB\n", float64(stats.FileSize)/1024/1024)
 	fmt.Printf("Avg bytes/entry:  %.1f bytes\n", float64(stats.FileSize)/float64(count))
+	fmt.Printf("Record format:    %s\n", stats.Format)
+	fmt.Println(strings.Repeat("-", 60))
+	if metadata, err := dataset.MetadataStats(); err != nil {
+		fmt.Printf("Failed to scan metadata: %v\n", err)
+	} else {
+		metadata.Fprint(os.Stdout)
+	}
 	fmt.Println(strings.Repeat("-", 60))
 
 	// Sample some positions to show distribution
@@ -656,8 +692,6 @@ func (c *CLI) trainModel(epochs int, preset string) {
 		Epochs:            epochs,
 		BatchSize:         64,
 		LearningRate:      0.001,
-		LRDecayRate:       0.95,
-		LRDecaySteps:      2,
 		GradientClipMax:   5.0,
 		ValidationSplit:   0.15,
 		EarlyStopPatience: 10,
@@ -667,7 +701,11 @@ func (c *CLI) trainModel(epochs int, preset string) {
 		WeightDecay:       0.0001,
 		SaveInterval:      5,
 		SavePath:          c.modelPath,
+		StatePath:         c.modelPath + ".state",
+		RegistryDir:       c.registryDir,
 		Verbose:           true,
+		InputChannels:     datasetInputChannels(dataset),
+		Architecture:      c.architecture,
 	}
 
 	// Adjust for preset
@@ -684,6 +722,7 @@ func (c *CLI) trainModel(epochs int, preset string) {
 	fmt.Println("\n" + strings.Repeat("-", 60))
 	fmt.Println("Training Configuration:")
 	fmt.Printf("  Epochs:          %d\n", config.Epochs)
+	fmt.Printf("  Architecture:    %s\n", config.Architecture)
 	fmt.Printf("  Batch size:      %d\n", config.BatchSize)
 	fmt.Printf("  Learning rate:   %.6f\n", config.LearningRate)
 	fmt.Printf("  Validation:      %.0f%%\n", config.ValidationSplit*100)
@@ -782,8 +821,6 @@ func (c *CLI) customTraining() {
 		Epochs:            epochs,
 		BatchSize:         batchSize,
 		LearningRate:      lr,
-		LRDecayRate:       0.95,
-		LRDecaySteps:      2,
 		GradientClipMax:   5.0,
 		ValidationSplit:   valSplit,
 		EarlyStopPatience: 10,
@@ -793,7 +830,11 @@ func (c *CLI) customTraining() {
 		WeightDecay:       0.0001,
 		SaveInterval:      5,
 		SavePath:          c.modelPath,
+		StatePath:         c.modelPath + ".state",
+		RegistryDir:       c.registryDir,
 		Verbose:           true,
+		InputChannels:     datasetInputChannels(dataset),
+		Architecture:      c.architecture,
 	}
 
 	trainer, err := model.NewTrainer(config)
@@ -833,6 +874,14 @@ func (c *CLI) resumeTraining() {
 		return
 	}
 
+	// A training state continues the run exactly where it stopped
+	statePath := c.modelPath + ".state"
+	if _, err := os.Stat(statePath); err == nil {
+		c.resumeFromState(statePath, epochs)
+		return
+	}
+	fmt.Printf("No training state found at %s; restarting from the saved weights\n", statePath)
+
 	fmt.Print("Learning rate (default 0.001): ")
 	lrStr, _ := reader.ReadString('\n')
 	lrStr = strings.TrimSpace(lrStr)
@@ -865,21 +914,34 @@ func (c *CLI) resumeTraining() {
 	}
 	fmt.Printf("Dataset size: %d positions\n", stats.TotalEntries)
 
+	// The checkpoint determines the architecture to resume
+	metadata, err := model.ReadModelMetadata(c.modelPath)
+	if err != nil {
+		fmt.Printf("Failed to read model: %v\n", err)
+		return
+	}
+	arch, err := metadata.Architecture()
+	if err != nil {
+		fmt.Printf("Failed to read model: %v\n", err)
+		return
+	}
+
 	// Create training config to resume training
-	// The trainer will create a new model and load the checkpoint automatically
 	config := &model.TrainingConfig{
 		Epochs:          epochs,
 		BatchSize:       64,
 		LearningRate:    learningRate,
-		LRDecayRate:     0.95,
-		LRDecaySteps:    2,
 		GradientClipMax: 5.0,
 		Verbose:         true,
 		SaveInterval:    5,
 		SavePath:        c.modelPath,
+		StatePath:       statePath,
+		RegistryDir:     c.registryDir,
 		ValidationSplit: 0.1,
 		ShuffleBatches:  true,
 		WeightDecay:     0.0001,
+		InputChannels:   stats.InputChannels,
+		Architecture:    arch,
 	}
 
 	// Continue training
@@ -891,6 +953,10 @@ func (c *CLI) resumeTraining() {
 		fmt.Printf("Failed to create trainer: %v\n", err)
 		return
 	}
+	if err := trainer.GetModel().LoadModel(c.modelPath); err != nil {
+		fmt.Printf("Failed to load model weights: %v\n", err)
+		return
+	}
 
 	err = trainer.Train(dataset)
 	if err != nil {
@@ -901,6 +967,49 @@ func (c *CLI) resumeTraining() {
 	fmt.Println("✓ Training resumed and completed!")
 }
 
+// resumeFromState continues the run saved in a training state for more epochs
+func (c *CLI) resumeFromState(statePath string, epochs int) {
+	state, err := model.LoadTrainingState(statePath)
+	if err != nil {
+		fmt.Printf("Failed to load training state: %v\n", err)
+		return
+	}
+
+	if _, err := os.Stat(c.datasetPath); err != nil {
+		fmt.Printf("Dataset not found: %s\n", c.datasetPath)
+		return
+	}
+	dataset, err := data.NewDataset(c.datasetPath)
+	if err != nil {
+		fmt.Printf("Failed to load dataset: %v\n", err)
+		return
+	}
+	defer dataset.Close()
+
+	state.Config.Epochs = state.Epoch + epochs
+	state.Config.SavePath = c.modelPath
+	state.Config.StatePath = statePath
+	state.Config.Verbose = true
+
+	fmt.Printf("\nResuming %s run after epoch %d for %d more epochs (seed %d)...\n",
+		state.Config.Architecture, state.Epoch, epochs, state.Seed)
+
+	trainer, err := model.NewTrainerFromState(state)
+	if err != nil {
+		fmt.Printf("Failed to restore trainer: %v\n", err)
+		return
+	}
+	defer trainer.Close()
+	defer trainer.GetModel().Close()
+
+	if err := trainer.Train(dataset); err != nil {
+		fmt.Printf("Training failed: %v\n", err)
+		return
+	}
+
+	fmt.Println("✓ Training resumed and completed!")
+}
+
 func (c *CLI) viewTrainingHistory() {
 	fmt.Println("\nTraining History")
 	fmt.Println(strings.Repeat("-", 60))
@@ -979,15 +1088,17 @@ func (c *CLI) loadModel() {
 		return
 	}
 
-	model, err := model.NewChessCNNForInference(c.modelPath)
+	loaded, err := model.LoadChessModel(c.modelPath)
 	if err != nil {
 		fmt.Printf("Failed to load model: %v\n", err)
 		return
 	}
-	defer model.Close()
 
-	c.model = model
-	fmt.Println("✓ Model loaded successfully")
+	if c.model != nil {
+		c.model.Close()
+	}
+	c.model = loaded
+	fmt.Printf("✓ Model loaded successfully (%s)\n", loaded.Architecture())
 }
 
 func (c *CLI) testRandomPosition() {
@@ -1019,11 +1130,6 @@ func (c *CLI) testRandomPosition() {
 	}
 
 	entry := entries[0]
-	boardTensor, err := data.FlatArrayToTensor(entry.StateTensor)
-	if err != nil {
-		fmt.Printf("Failed to convert tensor: %v\n", err)
-		return
-	}
 
 	fmt.Println("\n" + strings.Repeat("-", 60))
 	fmt.Printf("Testing position from game: %s (move %d)\n", entry.GameID, entry.MoveNumber)
@@ -1033,22 +1139,25 @@ func (c *CLI) testRandomPosition() {
 	fmt.Println(strings.Repeat("-", 60))
 
 	// Run inference
-	predictions, err := c.model.Predict(boardTensor, 5)
+	predictions, err := c.model.PredictState(entry.StateTensor, 5)
 	if err != nil {
 		fmt.Printf("Inference failed: %v\n", err)
 		return
 	}
 
+	expectedIdx, _ := entry.MoveIndex(c.model.MoveEncoding())
+
 	fmt.Println("\nTop 5 predictions:")
 	for i, pred := range predictions {
 		marker := "  "
-		if pred.FromSquare == entry.FromSquare && pred.ToSquare == entry.ToSquare {
+		if pred.MoveIndex == expectedIdx {
 			marker = "✓ "
 		}
-		fmt.Printf("%s%d. %s → %s  (%.2f%%)\n",
+		fmt.Printf("%s%d. %s → %s%s  (%.2f%%)\n",
 			marker, i+1,
 			squareToAlgebraic(pred.FromSquare),
 			squareToAlgebraic(pred.ToSquare),
+			pred.Promotion,
 			pred.Probability*100)
 	}
 	fmt.Println(strings.Repeat("-", 60))
@@ -1077,20 +1186,22 @@ func (c *CLI) testCustomFEN() {
 		return
 	}
 
-	// Parse FEN and convert to board state
-	boardState, err := parseFENToState(fenInput)
+	// Parse FEN into the model's input format (side to move, castling, en passant)
+	pos, err := parseFEN(fenInput)
+	if err != nil {
+		fmt.Printf("Invalid FEN string: %v\n", err)
+		return
+	}
+	stateTensor, err := data.TensorizePosition(pos, c.model.InputChannels())
 	if err != nil {
 		fmt.Printf("Invalid FEN string: %v\n", err)
 		return
 	}
-
-	// Convert simple state to 12-channel tensor
-	boardTensor := convertStateTo12Channel(boardState)
 
 	// Run inference
 	fmt.Println("\n🔍 Running inference...")
 	startTime := time.Now()
-	predictions, err := c.model.Predict(boardTensor, 5)
+	predictions, err := c.model.PredictState(stateTensor, 5)
 	latency := time.Since(startTime)
 
 	if err != nil {
@@ -1111,7 +1222,7 @@ func (c *CLI) testCustomFEN() {
 
 		fmt.Printf("%-4d %-8s %6.2f%%      %s\n",
 			i+1,
-			moveIndexToAlgebraic(pred.MoveIndex),
+			moveUCI(pos, pred.MoveIndex),
 			pred.Probability*100,
 			bar)
 	}
@@ -1120,121 +1231,96 @@ func (c *CLI) testCustomFEN() {
 	fmt.Printf("Inference time: %v\n", latency)
 }
 
-// parseFENToState converts a FEN string to a board state tensor
-func parseFENToState(fen string) ([]float64, error) {
-	parts := strings.Fields(fen)
-	if len(parts) < 1 {
-		return nil, fmt.Errorf("invalid FEN format")
-	}
-
-	boardPart := parts[0]
-	state := make([]float64, 64)
-
-	// Parse board position
-	rank := 0
-	file := 0
+func (c *CLI) searchCustomFEN() {
+	reader := bufio.NewReader(os.Stdin)
 
-	for _, ch := range boardPart {
-		if ch == '/' {
-			rank++
-			file = 0
-			continue
-		}
+	if c.model == nil {
+		fmt.Println("No model loaded. Please load a model first")
+		return
+	}
 
-		if ch >= '1' && ch <= '8' {
-			// Empty squares
-			emptyCount := int(ch - '0')
-			file += emptyCount
-			continue
-		}
+	fmt.Println("\n🌲 MCTS Search")
+	fmt.Println(strings.Repeat("-", 60))
+	fmt.Print("\nFEN string (or 'q' to cancel): ")
+	fenInput, _ := reader.ReadString('\n')
+	fenInput = strings.TrimSpace(fenInput)
+	if fenInput == "q" || fenInput == "" {
+		fmt.Println("Cancelled")
+		return
+	}
+	opt, err := chess.FEN(fenInput)
+	if err != nil {
+		fmt.Printf("Invalid FEN string: %v\n", err)
+		return
+	}
+	pos := chess.NewGame(opt).Position()
 
-		if rank >= 8 || file >= 8 {
-			return nil, fmt.Errorf("invalid board position")
-		}
+	config := search.DefaultConfig()
+	config.Workers = 4
+	fmt.Printf("Playouts [%d]: ", config.Playouts)
+	playoutsInput, _ := reader.ReadString('\n')
+	if playouts, err := strconv.Atoi(strings.TrimSpace(playoutsInput)); err == nil && playouts > 0 {
+		config.Playouts = playouts
+	}
 
-		// Map piece to value
-		pieceValue := 0.0
-		switch ch {
-		case 'P':
-			pieceValue = 1.0
-		case 'N':
-			pieceValue = 2.0
-		case 'B':
-			pieceValue = 3.0
-		case 'R':
-			pieceValue = 4.0
-		case 'Q':
-			pieceValue = 5.0
-		case 'K':
-			pieceValue = 6.0
-		case 'p':
-			pieceValue = -1.0
-		case 'n':
-			pieceValue = -2.0
-		case 'b':
-			pieceValue = -3.0
-		case 'r':
-			pieceValue = -4.0
-		case 'q':
-			pieceValue = -5.0
-		case 'k':
-			pieceValue = -6.0
-		default:
-			return nil, fmt.Errorf("invalid piece character: %c", ch)
-		}
+	runtime, err := model.NewRuntime(c.model)
+	if err != nil {
+		fmt.Printf("Failed to prepare model: %v\n", err)
+		return
+	}
+	batcher := model.NewBatcher(runtime, model.DefaultBatcherConfig())
+	defer batcher.Close()
+	evaluator := search.NewBatcherEvaluator(batcher)
+	if !evaluator.HasValueHead() {
+		fmt.Println("Model has no value head; positions are scored by material")
+	}
 
-		idx := rank*8 + file
-		state[idx] = pieceValue
-		file++
+	fmt.Println("\n🔍 Searching...")
+	result, err := search.NewSearcher(evaluator, config).Search(context.Background(), pos)
+	if err != nil {
+		fmt.Printf("Search failed: %v\n", err)
+		return
 	}
 
-	return state, nil
+	fmt.Println(strings.Repeat("-", 60))
+	fmt.Printf("%-4s %-8s %-8s %-8s %-7s %-7s %s\n", "Rank", "Move", "Visits", "Share", "Value", "Prior", "PV")
+	fmt.Println(strings.Repeat("-", 60))
+	for i := 0; i < 5 && i < len(result.Moves); i++ {
+		move := result.Moves[i]
+		fmt.Printf("%-4d %-8s %-8d %5.1f%%   %+.3f  %5.1f%%  %s\n",
+			i+1, move.Move, move.Visits, move.Share*100, move.Value, move.Prior*100,
+			strings.Join(move.PV, " "))
+	}
+	fmt.Println(strings.Repeat("-", 60))
+	fmt.Printf("%d playouts, %d nodes, depth %d in %v\n",
+		result.Playouts, result.Nodes, result.Depth, result.Elapsed.Round(time.Millisecond))
 }
 
-// moveIndexToAlgebraic converts move index to algebraic notation (simplified)
-func moveIndexToAlgebraic(moveIndex int) string {
-	// Decode move index (simplified: from_square * 64 + to_square)
-	fromSquare := moveIndex / 64
-	toSquare := moveIndex % 64
-
-	fromFile := fromSquare % 8
-	fromRank := fromSquare / 8
-	toFile := toSquare % 8
-	toRank := toSquare / 8
-
-	from := fmt.Sprintf("%c%d", 'a'+fromFile, fromRank+1)
-	to := fmt.Sprintf("%c%d", 'a'+toFile, toRank+1)
-
-	return from + to
+// parseFEN parses a FEN string into a position
+func parseFEN(fen string) (*chess.Position, error) {
+	opt, err := chess.FEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(opt).Position(), nil
 }
 
-// convertStateTo12Channel converts simple board state to 12-channel tensor
-func convertStateTo12Channel(state []float64) [12][8][8]float32 {
-	var tensor [12][8][8]float32
-
-	for i := 0; i < 64; i++ {
-		rank := i / 8
-		file := i % 8
-		piece := state[i]
-
-		// Map piece values to channels (0-5 for white, 6-11 for black)
-		// P=1, N=2, B=3, R=4, Q=5, K=6 (white positive, black negative)
-		if piece > 0 {
-			// White pieces
-			channel := int(piece) - 1
-			if channel >= 0 && channel < 6 {
-				tensor[channel][rank][file] = 1.0
-			}
-		} else if piece < 0 {
-			// Black pieces
-			channel := int(-piece) + 5
-			if channel >= 6 && channel < 12 {
-				tensor[channel][rank][file] = 1.0
-			}
-		}
+// datasetInputChannels returns the dataset's state tensor format, falling back to the default
+func datasetInputChannels(dataset *data.Dataset) int {
+	channels, err := dataset.InputChannels()
+	if err != nil {
+		return data.DefaultInputChannels
 	}
+	return channels
+}
 
-	return tensor
+// moveUCI converts a move index to UCI notation, resolving it against the
+// position so queen promotions carry their piece
+func moveUCI(pos *chess.Position, moveIndex int) string {
+	if move, err := data.MoveFromIndex(pos, moveIndex); err == nil {
+		return move.String()
+	}
+	return data.MoveIndexToUCI(moveIndex)
 }
 
 func (c *CLI) batchInference() {
@@ -1281,13 +1367,9 @@ func (c *CLI) batchInference() {
 		}
 
 		entry := entries[0]
-		boardTensor, err := data.FlatArrayToTensor(entry.StateTensor)
-		if err != nil {
-			continue
-		}
 
 		startTime := time.Now()
-		predictions, err := c.model.Predict(boardTensor, 5)
+		predictions, err := c.model.PredictState(entry.StateTensor, 5)
 		totalTime += time.Since(startTime)
 
 		if err != nil {
@@ -1295,8 +1377,9 @@ func (c *CLI) batchInference() {
 		}
 
 		// Check if actual move is in predictions
+		expectedIdx, _ := entry.MoveIndex(c.model.MoveEncoding())
 		for j, pred := range predictions {
-			if pred.FromSquare == entry.FromSquare && pred.ToSquare == entry.ToSquare {
+			if pred.MoveIndex == expectedIdx {
 				if j == 0 {
 					correct++
 				}
@@ -1352,6 +1435,10 @@ func (c *CLI) performanceTest() {
 	includeLoading, _ := reader.ReadString('\n')
 	includeLoadingTime := strings.ToLower(strings.TrimSpace(includeLoading)) == "y"
 
+	fmt.Print("Compare with int8 quantized model? (y/n, default n): ")
+	compareInput, _ := reader.ReadString('\n')
+	compareQuantized := strings.ToLower(strings.TrimSpace(compareInput)) == "y"
+
 	// Generate random test positions
 	fmt.Printf("\nGenerating %d random test positions...\n", iterations)
 	testPositions := make([][12][8][8]float32, iterations)
@@ -1365,7 +1452,7 @@ func (c *CLI) performanceTest() {
 
 	// Warm-up runs
 	for i := 0; i < 5; i++ {
-		c.model.Predict(testPositions[0], 5)
+		c.model.PredictState(data.TensorToFlatArray(testPositions[0]), 5)
 	}
 
 	// Actual performance test
@@ -1382,7 +1469,7 @@ func (c *CLI) performanceTest() {
 		}
 
 		inferStart := time.Now()
-		_, err := c.model.Predict(pos, 5)
+		_, err := c.model.PredictState(data.TensorToFlatArray(pos), 5)
 		inferTime := time.Since(inferStart)
 
 		if err == nil {
@@ -1429,6 +1516,14 @@ func (c *CLI) performanceTest() {
 	fmt.Printf("Model size:           ~%.2f MB\n", float64(estimateModelSize())/1024/1024)
 	fmt.Printf("Test data size:       ~%.2f MB\n", float64(iterations*12*8*8*4)/1024/1024)
 	fmt.Println(strings.Repeat("-", 60))
+
+	if compareQuantized {
+		states := make([][]float32, len(testPositions))
+		for i, pos := range testPositions {
+			states[i] = data.TensorToFlatArray(pos)
+		}
+		c.quantizedComparison(states)
+	}
 }
 
 // generateRandomPosition creates a random board position for testing
@@ -1480,6 +1575,23 @@ func (c *CLI) changeModelPath(reader *bufio.Reader) {
 	}
 }
 
+func (c *CLI) changeArchitecture(reader *bufio.Reader) {
+	fmt.Print("\nEnter architecture (cnn, resnet): ")
+	name, _ := reader.ReadString('\n')
+	name = strings.TrimSpace(name)
+
+	if name != "" {
+		arch, err := model.ParseArchitecture(name)
+		if err != nil {
+			fmt.Printf("Invalid architecture: %v\n", err)
+			return
+		}
+
+		c.architecture = arch
+		fmt.Printf("✓ Architecture updated: %s\n", c.architecture)
+	}
+}
+
 func (c *CLI) changeDatasetPath(reader *bufio.Reader) {
 	fmt.Print("\nEnter new dataset path: ")
 	path, _ := reader.ReadString('\n')
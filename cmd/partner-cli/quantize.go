@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/model"
+)
+
+// calibrationPositions is the number of dataset positions used to calibrate
+// the int8 activation scales
+const calibrationPositions = 64
+
+// quantizedComparison compares the loaded model with its int8 quantized
+// version on held-out dataset positions, falling back to the given states
+// without a dataset. The quantized checkpoint is kept next to the model and
+// recalibrated when the model is newer.
+func (c *CLI) quantizedComparison(fallback [][]float32) {
+	fmt.Println("\n🔢 Int8 Quantization")
+	fmt.Println(strings.Repeat("-", 60))
+
+	calibration, states := c.datasetSample(len(fallback))
+	source := "held-out dataset positions"
+	if len(states) == 0 {
+		fmt.Println("⚠️  No held-out dataset positions, comparing on the random test positions")
+		fmt.Println("   They are not chess positions, so agreement on them says little about real play")
+		states = fallback
+		source = "random test positions"
+	}
+
+	quantized, err := c.quantizedModel(calibration, fallback)
+	if err != nil {
+		fmt.Printf("Failed to quantize model: %v\n", err)
+		return
+	}
+
+	report, err := model.CompareQuantized(c.model, quantized, states)
+	if err != nil {
+		fmt.Printf("Failed to compare models: %v\n", err)
+		return
+	}
+
+	params := 0
+	for _, w := range c.model.Learnables() {
+		params += w.Shape().TotalSize()
+	}
+
+	fmt.Println(strings.Repeat("-", 60))
+	fmt.Println("QUANTIZATION RESULTS")
+	fmt.Println(strings.Repeat("-", 60))
+	fmt.Printf("Positions compared:   %d %s\n", report.Positions, source)
+	fmt.Printf("Top-1 agreement:      %.2f%%\n", report.Top1Agreement*100)
+	fmt.Printf("Top-5 agreement:      %.2f%%\n", report.Top5Agreement*100)
+	fmt.Printf("Float64 latency:      %v\n", report.FloatLatency)
+	fmt.Printf("Int8 latency:         %v\n", report.QuantizedLatency)
+	fmt.Printf("Speedup:              %.2fx\n", report.Speedup())
+	fmt.Printf("Weights:              %.2f MB → %.2f MB\n",
+		float64(params*8)/1024/1024, float64(quantized.Size())/1024/1024)
+	fmt.Println(strings.Repeat("-", 60))
+}
+
+// quantizedModel loads the quantized checkpoint of the current model, or
+// calibrates a new one on the dataset samples (falling back to the fallback
+// states without a dataset) and saves it
+func (c *CLI) quantizedModel(samples, fallback [][]float32) (*model.QuantizedModel, error) {
+	path := c.modelPath + ".int8"
+	if c.quantizedCheckpointCurrent(path) {
+		quantized, err := model.LoadQuantizedModel(path)
+		if err == nil && quantized.Metadata.ModelType == c.model.Metadata().ModelType &&
+			quantized.MoveEncoding() == c.model.MoveEncoding() && quantized.InputChannels() == c.model.InputChannels() {
+			fmt.Printf("Loaded quantized checkpoint %s (calibrated on %d positions)\n", path, quantized.Calibration)
+			return quantized, nil
+		}
+	}
+
+	if len(samples) == 0 {
+		fmt.Println("⚠️  No dataset available, calibrating on the test positions")
+		samples = fallback
+		if len(samples) > calibrationPositions {
+			samples = samples[:calibrationPositions]
+		}
+	}
+
+	fmt.Printf("Calibrating int8 scales on %d positions...\n", len(samples))
+	quantized, err := model.Quantize(c.model, samples)
+	if err != nil {
+		return nil, err
+	}
+	if err := quantized.Save(path); err != nil {
+		fmt.Printf("⚠️  Failed to save quantized checkpoint: %v\n", err)
+	} else {
+		fmt.Printf("✓ Quantized checkpoint saved to %s\n", path)
+	}
+	return quantized, nil
+}
+
+// quantizedCheckpointCurrent reports whether a quantized checkpoint exists
+// and is at least as new as the model checkpoint
+func (c *CLI) quantizedCheckpointCurrent(path string) bool {
+	quantizedInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	modelInfo, err := os.Stat(c.modelPath)
+	if err != nil {
+		return false
+	}
+	return !quantizedInfo.ModTime().Before(modelInfo.ModTime())
+}
+
+// datasetSample returns calibrationPositions states spread evenly over the
+// dataset for calibration, and up to heldOut states spread evenly over the
+// remaining entries to compare the quantized model on
+func (c *CLI) datasetSample(heldOut int) (calibration, held [][]float32) {
+	if _, err := os.Stat(c.datasetPath); err != nil {
+		return nil, nil
+	}
+	dataset, err := data.NewDataset(c.datasetPath)
+	if err != nil {
+		return nil, nil
+	}
+	defer dataset.Close()
+
+	count, err := dataset.Count()
+	if err != nil || count == 0 {
+		return nil, nil
+	}
+	load := func(index int) []float32 {
+		entries, err := dataset.LoadBatch(index, 1)
+		if err != nil || len(entries) == 0 {
+			return nil
+		}
+		return entries[0].StateTensor
+	}
+
+	n := min(calibrationPositions, count)
+	used := make([]int, n)
+	for i := range used {
+		used[i] = i * count / n
+		if state := load(used[i]); state != nil {
+			calibration = append(calibration, state)
+		}
+	}
+
+	// The i-th entry not used for calibration: step over the calibration
+	// indices, which are sorted, at or before it
+	rest := count - n
+	heldOut = min(heldOut, rest)
+	for i := 0; i < heldOut; i++ {
+		index := i * rest / heldOut
+		for _, u := range used {
+			if u <= index {
+				index++
+			}
+		}
+		if state := load(index); state != nil {
+			held = append(held, state)
+		}
+	}
+	return calibration, held
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thyrook/partner/internal/model"
+)
+
+func (c *CLI) registryMenu() {
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		fmt.Println("\n" + strings.Repeat("-", 60))
+		fmt.Println("CHECKPOINT REGISTRY")
+		fmt.Println(strings.Repeat("-", 60))
+		fmt.Printf("Registry: %s\n", c.registryDir)
+		fmt.Println("1. List checkpoints")
+		fmt.Println("2. Promote checkpoint to best")
+		fmt.Println("3. Diff checkpoint metadata")
+		fmt.Println("4. Prune checkpoints")
+		fmt.Println("5. Copy checkpoint to model path")
+		fmt.Println("0. Back to training menu")
+		fmt.Println(strings.Repeat("-", 60))
+		fmt.Print("\nSelect option: ")
+
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+
+		switch input {
+		case "1":
+			c.listCheckpoints()
+		case "2":
+			c.promoteCheckpoint(reader)
+		case "3":
+			c.diffCheckpoints(reader)
+		case "4":
+			c.pruneCheckpoints(reader)
+		case "5":
+			c.copyCheckpoint(reader)
+		case "0":
+			return
+		default:
+			fmt.Println("Invalid option")
+		}
+	}
+}
+
+// openRegistry opens the configured registry, reporting failures to the user
+func (c *CLI) openRegistry() *model.Registry {
+	registry, err := model.OpenRegistry(c.registryDir)
+	if err != nil {
+		fmt.Printf("Failed to open registry: %v\n", err)
+		return nil
+	}
+	return registry
+}
+
+func (c *CLI) listCheckpoints() {
+	registry := c.openRegistry()
+	if registry == nil {
+		return
+	}
+
+	checkpoints := registry.Checkpoints()
+	if len(checkpoints) == 0 {
+		fmt.Println("\nNo checkpoints registered yet")
+		fmt.Println("Checkpoints are registered whenever training saves the model")
+		return
+	}
+
+	fmt.Printf("\n%-11s %5s %10s %9s %10s %9s  %-11s %-16s %s\n",
+		"ID", "Epoch", "Train loss", "Train acc", "Val loss", "Val acc", "Parent", "Created", "")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, record := range checkpoints {
+		var tags []string
+		if record.ID == registry.Best() {
+			tags = append(tags, model.RefBest)
+		}
+		if record.ID == registry.Latest() {
+			tags = append(tags, model.RefLatest)
+		}
+		parent := record.Parent
+		if parent == "" {
+			parent = "-"
+		}
+		fmt.Printf("%-11s %5d %10.4f %8.2f%% %10.4f %8.2f%%  %-11s %-16s %s\n",
+			record.ID, record.Epoch,
+			record.TrainLoss, record.TrainAccuracy*100,
+			record.ValLoss, record.ValAccuracy*100,
+			parent, record.CreatedAt.Format("2006-01-02 15:04"), strings.Join(tags, ", "))
+	}
+	fmt.Printf("\n%d checkpoint(s)\n", len(checkpoints))
+}
+
+func (c *CLI) promoteCheckpoint(reader *bufio.Reader) {
+	registry := c.openRegistry()
+	if registry == nil {
+		return
+	}
+
+	fmt.Print("\nCheckpoint to promote (ID or latest): ")
+	ref, _ := reader.ReadString('\n')
+	ref = strings.TrimSpace(ref)
+
+	if err := registry.Promote(ref); err != nil {
+		fmt.Printf("Failed to promote checkpoint: %v\n", err)
+		return
+	}
+	fmt.Printf("✓ %s is now the best checkpoint\n", registry.Best())
+}
+
+func (c *CLI) diffCheckpoints(reader *bufio.Reader) {
+	registry := c.openRegistry()
+	if registry == nil {
+		return
+	}
+
+	fmt.Print("\nFirst checkpoint (ID, best or latest): ")
+	refA, _ := reader.ReadString('\n')
+	fmt.Print("Second checkpoint (ID, best or latest): ")
+	refB, _ := reader.ReadString('\n')
+	refA, refB = strings.TrimSpace(refA), strings.TrimSpace(refB)
+
+	diffs, err := registry.DiffMetadata(refA, refB)
+	if err != nil {
+		fmt.Printf("Failed to diff checkpoints: %v\n", err)
+		return
+	}
+	if len(diffs) == 0 {
+		fmt.Println("\nThe checkpoints have identical metadata")
+		return
+	}
+
+	fmt.Printf("\n%-28s %-30s %s\n", "Field", refA, refB)
+	fmt.Println(strings.Repeat("-", 90))
+	for _, d := range diffs {
+		fmt.Printf("%-28s %-30s %s\n", d.Field, d.A, d.B)
+	}
+}
+
+func (c *CLI) pruneCheckpoints(reader *bufio.Reader) {
+	registry := c.openRegistry()
+	if registry == nil {
+		return
+	}
+
+	fmt.Print("\nNumber of most recent checkpoints to keep (best and latest are always kept): ")
+	keepStr, _ := reader.ReadString('\n')
+	keep, err := strconv.Atoi(strings.TrimSpace(keepStr))
+	if err != nil || keep < 0 {
+		fmt.Println("Invalid number")
+		return
+	}
+
+	fmt.Print("Delete the other checkpoint files? (y/n): ")
+	confirm, _ := reader.ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(confirm)) != "y" {
+		fmt.Println("Cancelled")
+		return
+	}
+
+	pruned, err := registry.Prune(keep)
+	if err != nil {
+		fmt.Printf("Failed to prune checkpoints: %v\n", err)
+		return
+	}
+	for _, record := range pruned {
+		fmt.Printf("  Deleted %s (epoch %d)\n", record.ID, record.Epoch)
+	}
+	fmt.Printf("✓ Pruned %d checkpoint(s), %d kept\n", len(pruned), len(registry.Checkpoints()))
+}
+
+// copyCheckpoint copies a registered checkpoint to the current model path
+func (c *CLI) copyCheckpoint(reader *bufio.Reader) {
+	registry := c.openRegistry()
+	if registry == nil {
+		return
+	}
+
+	fmt.Print("\nCheckpoint to copy (ID, best or latest): ")
+	ref, _ := reader.ReadString('\n')
+	ref = strings.TrimSpace(ref)
+
+	record, err := registry.Get(ref)
+	if err != nil {
+		fmt.Printf("Failed to find checkpoint: %v\n", err)
+		return
+	}
+
+	if _, err := os.Stat(c.modelPath); err == nil {
+		fmt.Printf("Overwrite %s? (y/n): ", c.modelPath)
+		confirm, _ := reader.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(confirm)) != "y" {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+
+	content, err := os.ReadFile(registry.Path(record))
+	if err != nil {
+		fmt.Printf("Failed to read checkpoint: %v\n", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.modelPath), 0755); err != nil {
+		fmt.Printf("Failed to create model directory: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(c.modelPath, content, 0644); err != nil {
+		fmt.Printf("Failed to write model: %v\n", err)
+		return
+	}
+
+	c.architecture = record.Config.Architecture
+	fmt.Printf("✓ %s (epoch %d) copied to %s\n", record.ID, record.Epoch, c.modelPath)
+}
+
+func (c *CLI) changeRegistryDir(reader *bufio.Reader) {
+	fmt.Print("\nEnter new registry directory: ")
+	dir, _ := reader.ReadString('\n')
+	dir = strings.TrimSpace(dir)
+
+	if dir != "" {
+		c.registryDir = filepath.Clean(dir)
+		fmt.Printf("✓ Registry directory updated: %s\n", c.registryDir)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thyrook/partner/internal/server"
+)
+
+func main() {
+	config := server.DefaultConfig()
+	flag.StringVar(&config.Addr, "addr", config.Addr, "Listen address")
+	flag.StringVar(&config.ModelPath, "model", config.ModelPath, "Checkpoint to serve (ChessCNN or ImprovedChessCNN)")
+	flag.IntVar(&config.DefaultTopK, "top-k", config.DefaultTopK, "Moves returned when a request has no top_k")
+	flag.IntVar(&config.MaxTopK, "max-top-k", config.MaxTopK, "Largest top_k accepted")
+	flag.IntVar(&config.MaxBatchPositions, "max-batch", config.MaxBatchPositions, "Largest number of positions in a batch request")
+	flag.Float64Var(&config.ConfidenceThreshold, "confidence", config.ConfidenceThreshold, "Confidence below which explanations flag the top move")
+	flag.IntVar(&config.Batcher.MaxBatchSize, "batch-size", config.Batcher.MaxBatchSize, "Largest batch of concurrent requests per forward pass")
+	flag.DurationVar(&config.Batcher.MaxWait, "batch-wait", config.Batcher.MaxWait, "Longest wait for a batch to fill")
+	flag.IntVar(&config.Batcher.Workers, "workers", config.Batcher.Workers, "Batches evaluated concurrently")
+	flag.Parse()
+
+	fmt.Println("╔═══════════════════════════════════════════════════════════╗")
+	fmt.Println("║  P.A.R.T.N.E.R Analysis Server                            ║")
+	fmt.Println("╚═══════════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	fmt.Printf("Loading model: %s\n", config.ModelPath)
+	s, err := server.NewServer(config)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	defer s.Close()
+
+	httpServer := &http.Server{Addr: config.Addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	fmt.Printf("✅ Listening on http://%s\n", config.Addr)
+	fmt.Println()
+	fmt.Println("Endpoints:")
+	fmt.Println("  POST /api/analyze         {\"fen\": ...} or {\"pgn\": ..., \"ply\": N}, optional \"top_k\"")
+	fmt.Println("  POST /api/analyze/batch   {\"positions\": [...]}")
+	fmt.Println("  GET  /api/model           Loaded model")
+	fmt.Println("  POST /api/model/reload    {\"path\": ...} (or send SIGHUP to reload the current path)")
+	fmt.Println("  GET  /api/health          Status and batching statistics")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for received := range sig {
+		if received != syscall.SIGHUP {
+			break
+		}
+		if info, err := s.Reload(""); err != nil {
+			log.Printf("Reload failed: %v", err)
+		} else {
+			log.Printf("Reloaded %s (%s)", info.Path, info.ModelType)
+		}
+	}
+
+	fmt.Println("\nShutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown failed: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/thyrook/partner/internal/uci"
+)
+
+func main() {
+	options := uci.DefaultOptions()
+	flag.StringVar(&options.ModelPath, "model", options.ModelPath, "Checkpoint to play with (ChessCNN or ImprovedChessCNN)")
+	flag.Float64Var(&options.Temperature, "temperature", options.Temperature, "Policy sampling temperature (0 plays the most likely move)")
+	flag.IntVar(&options.TopK, "top-k", options.TopK, "Policy moves considered as candidates")
+	flag.BoolVar(&options.ValueSearch, "value-search", options.ValueSearch, "Score the candidates with the value head")
+	flag.IntVar(&options.Playouts, "playouts", options.Playouts, "MCTS playouts per move (0 disables the tree search)")
+	flag.IntVar(&options.Threads, "threads", options.Threads, "MCTS workers")
+	flag.Parse()
+
+	// stdout carries the protocol; the GUI reads diagnostics from stderr
+	if err := uci.NewEngine(options, os.Stdout).Run(os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read commands: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/thyrook/partner/internal/data"
 	"github.com/thyrook/partner/internal/model"
@@ -18,16 +19,42 @@ func main() {
 	learningRate := flag.Float64("lr", 0.001, "Learning rate")
 	loadModel := flag.Bool("load", false, "Load existing model before training")
 	testMode := flag.Bool("test", false, "Test mode: just run inference on a sample")
+	archName := flag.String("arch", "cnn", "Model architecture: cnn or resnet (residual network with value head)")
+	valueWeight := flag.Float64("value-weight", 1.0, "Weight of the value loss for architectures with a value head")
+	labelSmoothing := flag.Float64("label-smoothing", 0, "Fraction of a uniform distribution mixed into policy targets (0 = off)")
+	teacherPath := flag.String("teacher", "", "Teacher checkpoint to distill from (any architecture)")
+	distillTemperature := flag.Float64("distill-temperature", model.DefaultDistillTemperature, "Temperature softening the teacher policy")
+	distillWeight := flag.Float64("distill-weight", model.DefaultDistillWeight, "Share of the policy target taken from the teacher")
+	legalOnly := flag.Bool("legal-only", false, "Compute the policy loss over legal moves only")
+	statePath := flag.String("state", "", "Path of the resumable training state saved with the model (default: <model>.state)")
+	resumePath := flag.String("resume", "", "Resume the run saved in this training state (-epochs sets the new total)")
+	registryDir := flag.String("registry", "", "Checkpoint registry directory keeping every saved checkpoint (default: none)")
+	parent := flag.String("parent", "", "Registry ID of the checkpoint the run starts from, recorded as lineage")
+	seed := flag.Int64("seed", 0, "Seed of the initial weights, split, shuffling and augmentation (0 = time based)")
+	workers := flag.Int("workers", 0, "Background data loader workers (0 = load batches on the training goroutine)")
+	prefetch := flag.Int("prefetch", 0, "Batches the data loader keeps ready ahead of training (0 = twice the workers)")
 
 	flag.Parse()
 
+	if *statePath == "" {
+		*statePath = *modelPath + ".state"
+	}
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	arch, err := model.ParseArchitecture(*archName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Println("Chess CNN Training Tool")
 	fmt.Println("=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=")
 	fmt.Println()
 
 	// Test mode: just create model and run inference
 	if *testMode {
-		runTestMode(*modelPath, *loadModel)
+		runTestMode(*modelPath, *loadModel, arch)
 		return
 	}
 
@@ -49,6 +76,7 @@ func main() {
 
 	fmt.Printf("Dataset entries: %d\n", stats.TotalEntries)
 	fmt.Printf("Dataset size: %.2f MB\n", float64(stats.FileSize)/1024/1024)
+	fmt.Printf("Record format: %s\n", stats.Format)
 	fmt.Println()
 
 	if stats.TotalEntries == 0 {
@@ -57,42 +85,126 @@ func main() {
 	}
 
 	// Configure training
-	config := &model.TrainingConfig{
-		Epochs:          *epochs,
-		BatchSize:       *batchSize,
-		LearningRate:    *learningRate,
-		LRDecayRate:     0.95,
-		LRDecaySteps:    2,
-		GradientClipMax: 5.0,
-		Verbose:         true,
-		SaveInterval:    2,
-		SavePath:        *modelPath,
+	var config *model.TrainingConfig
+	var resumeState *model.TrainingState
+	if *resumePath != "" {
+		// The saved run's config is kept; only the epoch total and paths can change
+		fmt.Printf("Resuming training state from: %s\n", *resumePath)
+		resumeState, err = model.LoadTrainingState(*resumePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load training state: %v\n", err)
+			os.Exit(1)
+		}
+		config = &resumeState.Config
+		if setFlags["epochs"] {
+			config.Epochs = *epochs
+		}
+		if setFlags["model"] {
+			config.SavePath = *modelPath
+		}
+		if setFlags["model"] || setFlags["state"] {
+			config.StatePath = *statePath
+		}
+		if setFlags["registry"] {
+			config.RegistryDir = *registryDir
+		}
+		// Loading in the background changes the speed, not the results
+		if setFlags["workers"] {
+			config.NumWorkers = *workers
+		}
+		if setFlags["prefetch"] {
+			config.PrefetchDepth = *prefetch
+		}
+		config.Verbose = true
+		fmt.Printf("Completed epochs: %d of %d (seed %d)\n", resumeState.Epoch, config.Epochs, resumeState.Seed)
+	} else {
+		config = &model.TrainingConfig{
+			Epochs:          *epochs,
+			BatchSize:       *batchSize,
+			LearningRate:    *learningRate,
+			GradientClipMax: 5.0,
+			Verbose:         true,
+			SaveInterval:    2,
+			SavePath:        *modelPath,
+			StatePath:       *statePath,
+			InputChannels:   stats.InputChannels,
+			Architecture:    arch,
+			ValueLossWeight: *valueWeight,
+			LabelSmoothing:  *labelSmoothing,
+
+			TeacherPath:        *teacherPath,
+			DistillTemperature: *distillTemperature,
+			DistillWeight:      *distillWeight,
+
+			LegalMovesOnly: *legalOnly,
+
+			RegistryDir:      *registryDir,
+			ParentCheckpoint: *parent,
+
+			Seed: *seed,
+
+			NumWorkers:    *workers,
+			PrefetchDepth: *prefetch,
+		}
 	}
 
 	fmt.Println()
 	fmt.Println("Training Configuration:")
+	fmt.Printf("  Architecture:    %s\n", config.Architecture)
 	fmt.Printf("  Epochs:          %d\n", config.Epochs)
 	fmt.Printf("  Batch size:      %d\n", config.BatchSize)
+	fmt.Printf("  Input channels:  %d\n", config.InputChannels)
 	fmt.Printf("  Learning rate:   %.6f\n", config.LearningRate)
-	fmt.Printf("  LR decay:        %.2f every %d epochs\n", config.LRDecayRate, config.LRDecaySteps)
+	fmt.Printf("  LR schedule:     cosine, %d warmup epochs\n", config.WarmupEpochs)
 	fmt.Printf("  Gradient clip:   %.1f\n", config.GradientClipMax)
+	if config.Architecture == model.ArchitectureResNet {
+		fmt.Printf("  Value weight:    %.2f\n", config.ValueLossWeight)
+	}
+	if config.LabelSmoothing > 0 {
+		fmt.Printf("  Label smoothing: %.3f\n", config.LabelSmoothing)
+	}
+	if config.LegalMovesOnly {
+		fmt.Println("  Policy loss:     legal moves only")
+	}
+	if config.TeacherPath != "" {
+		fmt.Printf("  Teacher:         %s (T=%.2f, weight %.2f)\n", config.TeacherPath, config.DistillTemperature, config.DistillWeight)
+	}
+	if config.NumWorkers > 0 {
+		depth := config.PrefetchDepth
+		if depth <= 0 {
+			depth = 2 * config.NumWorkers
+		}
+		fmt.Printf("  Data loader:     %d workers, %d batches ahead\n", config.NumWorkers, depth)
+	}
 	fmt.Printf("  Save interval:   %d epochs\n", config.SaveInterval)
 	fmt.Printf("  Model path:      %s\n", config.SavePath)
+	fmt.Printf("  State path:      %s\n", config.StatePath)
+	if config.RegistryDir != "" {
+		fmt.Printf("  Registry:        %s\n", config.RegistryDir)
+	}
 	fmt.Println()
 
 	// Create trainer (creates model with batch size from config)
-	fmt.Println("Creating Chess CNN model and trainer...")
-	trainer, err := model.NewTrainer(config)
+	fmt.Printf("Creating %s model and trainer...\n", config.Architecture)
+	var trainer *model.Trainer
+	if resumeState != nil {
+		trainer, err = model.NewTrainerFromState(resumeState)
+	} else {
+		trainer, err = model.NewTrainer(config)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create trainer: %v\n", err)
 		os.Exit(1)
 	}
 
+	defer trainer.Close()
+	fmt.Printf("Seed: %d (pass -seed %d to repeat this run)\n", trainer.Seed(), trainer.Seed())
+
 	cnnModel := trainer.GetModel()
 	defer cnnModel.Close()
 
-	// Load existing model if requested
-	if *loadModel {
+	// Load existing model if requested (a resumed state already holds the weights)
+	if *loadModel && resumeState == nil {
 		if _, err := os.Stat(*modelPath); err == nil {
 			fmt.Printf("Loading existing model from: %s\n", *modelPath)
 			if err := cnnModel.LoadModel(*modelPath); err != nil {
@@ -111,12 +223,17 @@ func main() {
 	fmt.Println()
 
 	err = trainer.TrainWithCallback(dataset, func(metrics model.TrainingMetrics) {
-		fmt.Printf("Epoch %d/%d - Loss: %.4f, Accuracy: %.2f%%, LR: %.6f, Time: %v\n",
+		fmt.Printf("Epoch %d/%d - Loss: %.4f, Accuracy: %.2f%%, LR: %.6f, Time: %v, Loader stall: %v\n",
 			metrics.Epoch, config.Epochs,
 			metrics.Loss,
 			metrics.Accuracy*100,
 			metrics.LearningRate,
-			metrics.Duration)
+			metrics.Duration,
+			metrics.LoaderStall.Round(time.Millisecond))
+		if config.TeacherPath != "" {
+			fmt.Printf("  Val Loss: %.4f, Val Accuracy: %.2f%%, Teacher Agreement: %.2f%%\n",
+				metrics.ValLoss, metrics.ValAccuracy*100, metrics.TeacherAgreement*100)
+		}
 	})
 
 	if err != nil {
@@ -127,7 +244,7 @@ func main() {
 	fmt.Println()
 	fmt.Println("=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=" + "=")
 	fmt.Println("Training completed successfully!")
-	fmt.Printf("Model saved to: %s\n", *modelPath)
+	fmt.Printf("Model saved to: %s\n", config.SavePath)
 
 	// Show final metrics
 	metrics := trainer.GetMetrics()
@@ -143,37 +260,37 @@ func main() {
 	// Test inference with a separate inference model
 	fmt.Println()
 	fmt.Println("Running inference test...")
-	testInferenceWithCheckpoint(*modelPath, dataset)
+	testInferenceWithCheckpoint(config.SavePath, dataset)
 }
 
-func runTestMode(modelPath string, loadModel bool) {
+func runTestMode(modelPath string, loadModel bool, arch model.Architecture) {
 	fmt.Println("Test Mode: Model compilation and inference check")
 	fmt.Println()
 
-	// Create model
-	fmt.Println("Creating Chess CNN model...")
-	cnnModel, err := model.NewChessCNN()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create model: %v\n", err)
-		os.Exit(1)
-	}
-	defer cnnModel.Close()
-
-	fmt.Println("✓ Model created successfully")
-
-	// Load model if requested
-	if loadModel {
-		if _, err := os.Stat(modelPath); err == nil {
-			fmt.Printf("Loading model from: %s\n", modelPath)
-			if err := cnnModel.LoadModel(modelPath); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to load model: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Println("✓ Model loaded successfully")
-		} else {
+	// Load model if requested (the checkpoint determines the architecture and input format)
+	var cnnModel model.ChessModel
+	var err error
+	if _, statErr := os.Stat(modelPath); loadModel && statErr == nil {
+		fmt.Printf("Loading model from: %s\n", modelPath)
+		cnnModel, err = model.LoadChessModel(modelPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load model: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✓ Model loaded successfully")
+	} else {
+		if loadModel {
 			fmt.Println("⚠ No model found, using random initialization")
 		}
+		fmt.Printf("Creating %s model...\n", arch)
+		cnnModel, err = model.NewChessModel(arch, model.DefaultCNNConfig())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create model: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✓ Model created successfully")
 	}
+	defer cnnModel.Close()
 
 	// Create a test board state
 	fmt.Println()
@@ -196,13 +313,17 @@ func runTestMode(modelPath string, loadModel bool) {
 	boardTensor[9][0][7] = 1.0
 
 	// Run prediction
-	predictions, err := cnnModel.Predict(boardTensor, 5)
+	probs, value, err := cnnModel.Forward(data.TensorToFlatArray(boardTensor))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Prediction failed: %v\n", err)
 		os.Exit(1)
 	}
+	predictions := model.TopKPredictions(probs, 5)
 
 	fmt.Println("✓ Forward pass successful")
+	if cnnModel.HasValueHead() {
+		fmt.Printf("Value: %+.4f\n", value)
+	}
 	fmt.Println()
 	fmt.Println("Top 5 predictions:")
 	for i, pred := range predictions {
@@ -211,8 +332,8 @@ func runTestMode(modelPath string, loadModel bool) {
 		toFile := rune('a' + (pred.ToSquare % 8))
 		toRank := (pred.ToSquare / 8) + 1
 
-		fmt.Printf("  %d. %c%d → %c%d  (prob: %.4f%%)\n",
-			i+1, fromFile, fromRank, toFile, toRank, pred.Probability*100)
+		fmt.Printf("  %d. %c%d → %c%d%s  (prob: %.4f%%)\n",
+			i+1, fromFile, fromRank, toFile, toRank, pred.Promotion, pred.Probability*100)
 	}
 
 	fmt.Println()
@@ -228,7 +349,7 @@ func testInferenceWithCheckpoint(modelPath string, dataset *data.Dataset) {
 
 	// Create inference model with batch size 1 and load checkpoint
 	fmt.Println("Loading model for inference...")
-	inferenceModel, err := model.NewChessCNNForInference(modelPath)
+	inferenceModel, err := model.LoadChessModel(modelPath)
 	if err != nil {
 		fmt.Printf("⚠ Failed to create inference model: %v\n", err)
 		return
@@ -244,25 +365,27 @@ func testInferenceWithCheckpoint(modelPath string, dataset *data.Dataset) {
 
 	entry := entries[0]
 
-	// Convert to tensor
-	tensor, err := data.FlatArrayToTensor(entry.StateTensor)
-	if err != nil {
-		fmt.Printf("⚠ Failed to convert sample: %v\n", err)
-		return
-	}
-
 	// Run prediction
-	predictions, err := inferenceModel.Predict(tensor, 3)
+	probs, value, err := inferenceModel.Forward(entry.StateTensor)
 	if err != nil {
 		fmt.Printf("⚠ Inference failed: %v\n", err)
 		return
 	}
+	predictions := model.TopKPredictions(probs, 3)
 
 	fmt.Printf("Sample from game: %s, move #%d\n", entry.GameID, entry.MoveNumber)
 	fmt.Printf("Actual move: %d → %d\n", entry.FromSquare, entry.ToSquare)
+	if inferenceModel.HasValueHead() {
+		if entry.HasOutcome {
+			fmt.Printf("Value: %+.4f (game outcome %+.0f)\n", value, entry.Outcome)
+		} else {
+			fmt.Printf("Value: %+.4f\n", value)
+		}
+	}
 	fmt.Println()
 	fmt.Println("Top 3 predictions:")
 
+	expectedIdx, _ := entry.MoveIndex(inferenceModel.MoveEncoding())
 	for i, pred := range predictions {
 		fromFile := rune('a' + (pred.FromSquare % 8))
 		fromRank := (pred.FromSquare / 8) + 1
@@ -270,12 +393,12 @@ func testInferenceWithCheckpoint(modelPath string, dataset *data.Dataset) {
 		toRank := (pred.ToSquare / 8) + 1
 
 		marker := "  "
-		if pred.FromSquare == entry.FromSquare && pred.ToSquare == entry.ToSquare {
+		if pred.MoveIndex == expectedIdx {
 			marker = "✓ "
 		}
 
-		fmt.Printf("%s%d. %c%d → %c%d  (prob: %.4f%%)\n",
-			marker, i+1, fromFile, fromRank, toFile, toRank, pred.Probability*100)
+		fmt.Printf("%s%d. %c%d → %c%d%s  (prob: %.4f%%)\n",
+			marker, i+1, fromFile, fromRank, toFile, toRank, pred.Promotion, pred.Probability*100)
 	}
 
 	fmt.Println()
@@ -1,13 +1,15 @@
 module github.com/thyrook/partner
 
-go 1.21
+go 1.22
 
 require (
 	github.com/kbinani/screenshot v0.0.0-20210720154843-7d3a670d8329
+	github.com/klauspost/compress v1.18.0
 	github.com/notnil/chess v1.10.0
 	go.etcd.io/bbolt v1.3.8
 	go.uber.org/zap v1.26.0
 	gocv.io/x/gocv v0.31.0
+	google.golang.org/protobuf v1.28.1
 	gorgonia.org/gorgonia v0.9.17
 	gorgonia.org/tensor v0.9.24
 )
@@ -32,7 +34,6 @@ require (
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gonum.org/v1/gonum v0.12.0 // indirect
-	google.golang.org/protobuf v1.28.1 // indirect
 	gorgonia.org/cu v0.9.4 // indirect
 	gorgonia.org/dawson v1.2.0 // indirect
 	gorgonia.org/vecf32 v0.9.0 // indirect
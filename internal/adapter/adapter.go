@@ -170,7 +170,7 @@ type GameAdapter interface {
 	// GetActionDimensions returns the tensor dimensions for this game's actions.
 	//
 	// Examples:
-	// - Chess: [4096] (64 from × 64 to squares)
+	// - Chess: [4240] (64 from × 64 to squares, plus 144 underpromotion slots)
 	// - Racing: [3] (steering, throttle, brake)
 	// - Discrete: [10] (10 possible actions)
 	GetActionDimensions() []int
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/thyrook/partner/internal/data"
 	"gorgonia.org/tensor"
 )
 
@@ -11,36 +12,64 @@ import (
 type ChessAdapter struct {
 	*BaseAdapter
 	lastState  [12][8][8]float32
+	lastAux    data.AuxState
 	lastAction interface{}
+
+	inputChannels int
+	moveEncoding  data.MoveEncoding
 }
 
-// NewChessAdapter creates a new chess adapter
+// NewChessAdapter creates a new chess adapter using the default input format and move encoding
 func NewChessAdapter() *ChessAdapter {
-	// Chess state: 12 channels (6 piece types × 2 colors) × 8×8 board
-	stateDims := []int{12, 8, 8}
-	// Chess action: 4096 possible moves (64 from × 64 to squares)
-	actionDims := []int{4096}
+	return NewChessAdapterWithFormat(data.DefaultInputChannels, data.DefaultMoveEncoding)
+}
+
+// NewChessAdapterWithFormat creates a chess adapter for the given input channels and move encoding
+func NewChessAdapterWithFormat(inputChannels int, encoding data.MoveEncoding) *ChessAdapter {
+	// Chess state: 12 piece planes (6 piece types × 2 colors), optionally followed by
+	// 7 auxiliary planes (side to move, castling, en passant, halfmove clock) × 8×8 board
+	stateDims := []int{inputChannels, 8, 8}
+	// Chess action: 64 from × 64 to squares, plus underpromotions if encoded
+	actionDims := []int{encoding.Size()}
 
 	return &ChessAdapter{
-		BaseAdapter: NewBaseAdapter("chess", stateDims, actionDims),
+		BaseAdapter:   NewBaseAdapter("chess", stateDims, actionDims),
+		inputChannels: inputChannels,
+		moveEncoding:  encoding,
 	}
 }
 
 // EncodeState converts chess board state to tensor
-// Accepts: [12][8][8]float32 (piece planes), FEN string, or map[string]interface{}
+// Accepts: [12][8][8]float32 (piece planes), flat []float32 state, FEN string, or map[string]interface{}.
+// Inputs without side to move or castling information use data.DefaultAuxState.
 func (c *ChessAdapter) EncodeState(frame interface{}) (tensor.Tensor, error) {
 	switch state := frame.(type) {
 	case [12][8][8]float32:
-		// Already in correct format
-		return c.encodeBoardTensor(state)
+		// Piece planes only
+		return c.encodeBoardTensor(state, data.DefaultAuxState())
+
+	case []float32:
+		// Flat 12- or 19-channel state (e.g. a dataset entry)
+		flat, err := data.ExpandInputChannels(state, c.inputChannels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode state: %w", err)
+		}
+		return c.encodeFlatState(flat), nil
 
 	case string:
-		// FEN string
+		// FEN string; the full form also carries side to move, castling and en passant
+		if len(strings.Fields(state)) >= 4 {
+			pos, err := c.ParseFullFEN(state)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse FEN: %w", err)
+			}
+			return c.encodeBoardTensor(pos.Board, pos.AuxState())
+		}
 		board, err := c.parseFEN(state)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse FEN: %w", err)
 		}
-		return c.encodeBoardTensor(board)
+		return c.encodeBoardTensor(board, data.DefaultAuxState())
 
 	case map[string]interface{}:
 		// Generic board representation
@@ -48,7 +77,7 @@ func (c *ChessAdapter) EncodeState(frame interface{}) (tensor.Tensor, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse board: %w", err)
 		}
-		return c.encodeBoardTensor(board)
+		return c.encodeBoardTensor(board, data.DefaultAuxState())
 
 	default:
 		return nil, fmt.Errorf("unsupported state type: %T", frame)
@@ -56,9 +85,10 @@ func (c *ChessAdapter) EncodeState(frame interface{}) (tensor.Tensor, error) {
 }
 
 // EncodeAction converts chess move to tensor
-// Accepts: string ("e2e4"), map with from/to, or struct with FromSquare/ToSquare
+// Accepts: string ("e2e4", "e7e8n"), map with from/to, or struct with FromSquare/ToSquare
 func (c *ChessAdapter) EncodeAction(action interface{}) (tensor.Tensor, error) {
 	var fromSquare, toSquare int
+	var promotion string
 	var err error
 
 	switch act := action.(type) {
@@ -68,6 +98,10 @@ func (c *ChessAdapter) EncodeAction(action interface{}) (tensor.Tensor, error) {
 		if err != nil {
 			return nil, err
 		}
+		act = strings.ToLower(strings.ReplaceAll(act, "-", ""))
+		if len(act) > 4 {
+			promotion = act[4:]
+		}
 
 	case map[string]interface{}:
 		// Parse from map
@@ -94,49 +128,63 @@ func (c *ChessAdapter) EncodeAction(action interface{}) (tensor.Tensor, error) {
 		return nil, fmt.Errorf("invalid squares: from=%d, to=%d", fromSquare, toSquare)
 	}
 
+	promo, err := data.ParsePromotion(promotion)
+	if err != nil {
+		return nil, err
+	}
+
 	// Encode as one-hot vector
-	moveIndex := fromSquare*64 + toSquare
-	data := make([]float64, 4096)
-	data[moveIndex] = 1.0
+	moveIndex, err := c.moveEncoding.EncodeMoveIndex(fromSquare, toSquare, promo)
+	if err != nil {
+		return nil, err
+	}
+	probs := make([]float64, c.moveEncoding.Size())
+	probs[moveIndex] = 1.0
 
 	return tensor.New(
-		tensor.WithShape(4096),
-		tensor.WithBacking(data),
+		tensor.WithShape(len(probs)),
+		tensor.WithBacking(probs),
 	), nil
 }
 
 // DecodeAction converts network prediction to chess move
 func (c *ChessAdapter) DecodeAction(pred tensor.Tensor) (interface{}, error) {
-	// Pred should be a 4096-dim probability distribution
+	// Pred should be a probability distribution over a known move encoding
 	shape := pred.Shape()
-	if len(shape) != 1 || shape[0] != 4096 {
-		return nil, fmt.Errorf("invalid prediction shape: %v (expected [4096])", shape)
+	if len(shape) != 1 {
+		return nil, fmt.Errorf("invalid prediction shape: %v (expected [%d])", shape, c.moveEncoding.Size())
+	}
+	if _, err := data.MoveEncodingForSize(shape[0]); err != nil {
+		return nil, fmt.Errorf("invalid prediction shape: %v: %w", shape, err)
 	}
 
 	// Get data
-	data := pred.Data().([]float64)
+	probs := pred.Data().([]float64)
 
 	// Find highest probability move
 	maxIdx := 0
-	maxProb := data[0]
-	for i := 1; i < len(data); i++ {
-		if data[i] > maxProb {
-			maxProb = data[i]
+	maxProb := probs[0]
+	for i := 1; i < len(probs); i++ {
+		if probs[i] > maxProb {
+			maxProb = probs[i]
 			maxIdx = i
 		}
 	}
 
 	// Decode move index
-	fromSquare := maxIdx / 64
-	toSquare := maxIdx % 64
+	fromSquare, toSquare, promo, err := data.DecodeMoveIndex(maxIdx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Convert to algebraic notation
-	move := squareToAlgebraic(fromSquare) + squareToAlgebraic(toSquare)
+	move := squareToAlgebraic(fromSquare) + squareToAlgebraic(toSquare) + data.PromotionToString(promo)
 
 	return map[string]interface{}{
 		"move":        move,
 		"from_square": fromSquare,
 		"to_square":   toSquare,
+		"promotion":   data.PromotionToString(promo),
 		"probability": maxProb,
 	}, nil
 }
@@ -151,7 +199,7 @@ func (c *ChessAdapter) Feedback(correctAction interface{}) error {
 
 	// Store as experience if we have a previous state
 	if c.lastAction != nil {
-		stateTensor, err := c.encodeBoardTensor(c.lastState)
+		stateTensor, err := c.encodeBoardTensor(c.lastState, c.lastAux)
 		if err != nil {
 			return fmt.Errorf("failed to encode state: %w", err)
 		}
@@ -206,26 +254,31 @@ func (c *ChessAdapter) ValidateState(frame interface{}) error {
 
 // Helper functions
 
-func (c *ChessAdapter) encodeBoardTensor(board [12][8][8]float32) (tensor.Tensor, error) {
+func (c *ChessAdapter) encodeBoardTensor(board [12][8][8]float32, aux data.AuxState) (tensor.Tensor, error) {
 	// Store for feedback
 	c.lastState = board
+	c.lastAux = aux
 
-	// Convert to flat array
-	data := make([]float64, 12*8*8)
-	idx := 0
-	for ch := 0; ch < 12; ch++ {
-		for r := 0; r < 8; r++ {
-			for f := 0; f < 8; f++ {
-				data[idx] = float64(board[ch][r][f])
-				idx++
-			}
-		}
+	// Convert to flat array, appending auxiliary planes for the extended format
+	flat := data.TensorToFlatArray(board)
+	if c.inputChannels == data.NumExtendedChannels {
+		flat = data.AppendAuxPlanes(flat, aux)
+	}
+
+	return c.encodeFlatState(flat), nil
+}
+
+// encodeFlatState wraps a flat state in a [C, 8, 8] tensor
+func (c *ChessAdapter) encodeFlatState(flat []float32) tensor.Tensor {
+	values := make([]float64, len(flat))
+	for i, v := range flat {
+		values[i] = float64(v)
 	}
 
 	return tensor.New(
-		tensor.WithShape(12, 8, 8),
-		tensor.WithBacking(data),
-	), nil
+		tensor.WithShape(len(flat)/64, 8, 8),
+		tensor.WithBacking(values),
+	)
 }
 
 func (c *ChessAdapter) parseFEN(fen string) ([12][8][8]float32, error) {
@@ -448,6 +501,39 @@ func (c *ChessAdapter) ParseFullFEN(fen string) (*ChessPosition, error) {
 	return pos, nil
 }
 
+// AuxState returns the side to move, castling, en-passant and halfmove state
+// in the form used by the auxiliary input planes
+func (pos *ChessPosition) AuxState() data.AuxState {
+	castling := ""
+	if pos.CastlingRights.WhiteKingSide {
+		castling += "K"
+	}
+	if pos.CastlingRights.WhiteQueenSide {
+		castling += "Q"
+	}
+	if pos.CastlingRights.BlackKingSide {
+		castling += "k"
+	}
+	if pos.CastlingRights.BlackQueenSide {
+		castling += "q"
+	}
+	if castling == "" {
+		castling = "-"
+	}
+
+	enPassantFile := -1
+	if pos.EnPassantSquare >= 0 {
+		enPassantFile = pos.EnPassantSquare % 8
+	}
+
+	return data.AuxState{
+		WhiteToMove:   pos.WhiteToMove,
+		Castling:      castling,
+		EnPassantFile: enPassantFile,
+		HalfmoveClock: pos.HalfMoveClock,
+	}
+}
+
 // ToFEN converts a ChessPosition back to FEN string
 func (pos *ChessPosition) ToFEN() string {
 	var fen strings.Builder
@@ -688,7 +774,7 @@ func (c *ChessAdapter) IsMoveLegal(board [12][8][8]float32, fromSquare, toSquare
 
 // GetTopKMoves returns the top K moves from a prediction with legal move filtering
 func (c *ChessAdapter) GetTopKMoves(pred tensor.Tensor, board [12][8][8]float32, k int) []MoveConfidence {
-	data := pred.Data().([]float64)
+	probs := pred.Data().([]float64)
 
 	// Collect all moves with their probabilities
 	type moveProb struct {
@@ -696,20 +782,24 @@ func (c *ChessAdapter) GetTopKMoves(pred tensor.Tensor, board [12][8][8]float32,
 		prob  float64
 		from  int
 		to    int
+		promo string
 	}
 
-	moves := make([]moveProb, 0, 4096)
-	for i := 0; i < 4096; i++ {
-		if data[i] > 0.001 { // Filter out very low probabilities
-			from := i / 64
-			to := i % 64
+	moves := make([]moveProb, 0, len(probs))
+	for i := 0; i < len(probs); i++ {
+		if probs[i] > 0.001 { // Filter out very low probabilities
+			from, to, promo, err := data.DecodeMoveIndex(i)
+			if err != nil {
+				continue
+			}
 			legal, _ := c.IsMoveLegal(board, from, to)
 			if legal {
 				moves = append(moves, moveProb{
 					index: i,
-					prob:  data[i],
+					prob:  probs[i],
 					from:  from,
 					to:    to,
+					promo: data.PromotionToString(promo),
 				})
 			}
 		}
@@ -730,7 +820,7 @@ func (c *ChessAdapter) GetTopKMoves(pred tensor.Tensor, board [12][8][8]float32,
 	// Extract top K
 	topK := make([]MoveConfidence, 0, k)
 	for i := 0; i < len(moves) && i < k; i++ {
-		move := squareToAlgebraic(moves[i].from) + squareToAlgebraic(moves[i].to)
+		move := squareToAlgebraic(moves[i].from) + squareToAlgebraic(moves[i].to) + moves[i].promo
 		topK = append(topK, MoveConfidence{
 			Move:       move,
 			FromSquare: moves[i].from,
@@ -9,13 +9,15 @@ import (
 
 	"gorgonia.org/tensor"
 
+	"github.com/thyrook/partner/internal/data"
 	"github.com/thyrook/partner/internal/model"
 )
 
 type InferenceEngine struct {
-	model   *model.ChessCNN
-	adapter GameAdapter
-	mu      sync.RWMutex
+	batcher  *model.Batcher  // Groups concurrent predictions; mu guards replacing it
+	inflight *sync.WaitGroup // Predictions using batcher, waited for before it is closed
+	adapter  GameAdapter
+	mu       sync.RWMutex
 
 	// Configuration
 	config InferenceConfig
@@ -31,11 +33,12 @@ type InferenceEngine struct {
 
 type InferenceConfig struct {
 	// Model settings
-	ModelPath   string  `json:"model_path"`
-	BatchSize   int     `json:"batch_size"`
-	MaxCacheAge int     `json:"max_cache_age_sec"` // Cache predictions for repeated states
-	EnableCache bool    `json:"enable_cache"`
-	Temperature float64 `json:"temperature"` // For softmax temperature scaling
+	ModelPath      string  `json:"model_path"`
+	BatchSize      int     `json:"batch_size"`        // Largest batch of concurrent predictions
+	BatchTimeoutMs int     `json:"batch_timeout_ms"`  // Longest wait for a batch to fill
+	MaxCacheAge    int     `json:"max_cache_age_sec"` // Cache predictions for repeated states
+	EnableCache    bool    `json:"enable_cache"`
+	Temperature    float64 `json:"temperature"` // For softmax temperature scaling
 
 	// Performance
 	NumWorkers       int  `json:"num_workers"`       // Parallel inference workers
@@ -56,6 +59,17 @@ type InferenceStats struct {
 	MaxInferenceTimeMs float64       `json:"max_inference_time_ms"`
 	ThroughputPerSec   float64       `json:"throughput_per_sec"`
 	LastUpdateTime     time.Time     `json:"last_update_time"`
+
+	// Batching, from the model.Batcher
+	Batches            int64         `json:"batches"`
+	BatchSizeHistogram map[int]int64 `json:"batch_size_histogram"` // Number of batches of each size
+	AvgBatchSize       float64       `json:"avg_batch_size"`
+	QueueDepth         int           `json:"queue_depth"` // Predictions waiting for a batch
+	MaxQueueDepth      int           `json:"max_queue_depth"`
+	AvgQueueWaitMs     float64       `json:"avg_queue_wait_ms"`
+	LatencyP50Ms       float64       `json:"latency_p50_ms"` // Model latency percentiles of recent predictions
+	LatencyP95Ms       float64       `json:"latency_p95_ms"`
+	LatencyP99Ms       float64       `json:"latency_p99_ms"`
 }
 
 type CachedPrediction struct {
@@ -85,6 +99,7 @@ func DefaultInferenceConfig() InferenceConfig {
 	return InferenceConfig{
 		ModelPath:        "data/models/chess_cnn.gob",
 		BatchSize:        32,
+		BatchTimeoutMs:   2,
 		MaxCacheAge:      300, // 5 minutes
 		EnableCache:      true,
 		Temperature:      1.0, // No scaling
@@ -116,24 +131,38 @@ func NewInferenceEngine(adapter GameAdapter, config InferenceConfig) (*Inference
 
 func (ie *InferenceEngine) LoadModel(modelPath string) error {
 	ie.mu.Lock()
-	defer ie.mu.Unlock()
 
-	// Create model for inference (batch size 1)
-	loadedModel, err := model.NewChessCNNForInference(modelPath)
+	// The checkpoint selects the architecture
+	runtime, err := model.LoadRuntime(modelPath)
 	if err != nil {
+		ie.mu.Unlock()
 		return fmt.Errorf("failed to load model: %w", err)
 	}
 
-	ie.model = loadedModel
+	previous, drained := ie.batcher, ie.inflight
+	ie.batcher = model.NewBatcher(runtime, model.BatcherConfig{
+		MaxBatchSize: ie.config.BatchSize,
+		MaxWait:      time.Duration(ie.config.BatchTimeoutMs) * time.Millisecond,
+		Workers:      ie.config.NumWorkers,
+	})
+	ie.inflight = &sync.WaitGroup{}
 	ie.config.ModelPath = modelPath
 
 	// Run warmup if configured
 	if ie.config.WarmupIterations > 0 {
-		if err := ie.warmup(); err != nil {
-			return fmt.Errorf("warmup failed: %w", err)
-		}
+		err = ie.warmup()
 	}
+	ie.mu.Unlock()
 
+	// Predictions that started on the previous model finish on it. New ones
+	// only see the new batcher, so nothing joins drained once it is swapped.
+	if previous != nil {
+		drained.Wait()
+		previous.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("warmup failed: %w", err)
+	}
 	return nil
 }
 
@@ -142,7 +171,7 @@ func (ie *InferenceEngine) Predict(ctx context.Context, state interface{}) (*Pre
 
 	// Check if model is loaded
 	ie.mu.RLock()
-	if ie.model == nil {
+	if ie.batcher == nil {
 		ie.mu.RUnlock()
 		return nil, fmt.Errorf("model not loaded")
 	}
@@ -183,7 +212,7 @@ func (ie *InferenceEngine) Predict(ctx context.Context, state interface{}) (*Pre
 	errorChan := make(chan error, 1)
 
 	go func() {
-		result, err := ie.runInference(stateTensor, startTime)
+		result, err := ie.runInference(ctx, stateTensor, startTime)
 		if err != nil {
 			errorChan <- err
 			return
@@ -214,7 +243,8 @@ func (ie *InferenceEngine) Predict(ctx context.Context, state interface{}) (*Pre
 	}
 }
 
-// PredictBatch performs inference on multiple states efficiently
+// PredictBatch performs inference on multiple states concurrently so that
+// the batcher can run them through the model together
 func (ie *InferenceEngine) PredictBatch(ctx context.Context, states []interface{}) ([]*PredictionResult, error) {
 	if len(states) == 0 {
 		return nil, fmt.Errorf("no states provided")
@@ -223,11 +253,14 @@ func (ie *InferenceEngine) PredictBatch(ctx context.Context, states []interface{
 	results := make([]*PredictionResult, len(states))
 	errors := make([]error, len(states))
 
-	// Use worker pool for parallel processing
+	// Enough workers to fill a batch for every batcher worker
 	numWorkers := ie.config.NumWorkers
 	if numWorkers <= 0 {
 		numWorkers = 1
 	}
+	if ie.config.BatchSize > 1 {
+		numWorkers *= ie.config.BatchSize
+	}
 	if numWorkers > len(states) {
 		numWorkers = len(states)
 	}
@@ -272,43 +305,62 @@ func (ie *InferenceEngine) PredictBatch(ctx context.Context, states []interface{
 	return results, firstError
 }
 
-// runInference performs the actual model inference
-func (ie *InferenceEngine) runInference(stateTensor tensor.Tensor, startTime time.Time) (*PredictionResult, error) {
+// acquireBatcher returns the current batcher for one prediction. Predictions
+// wait for their batch without holding the lock, so a reload closes the
+// batcher only after every acquired one is released.
+func (ie *InferenceEngine) acquireBatcher() (*model.Batcher, float64, func(), error) {
 	ie.mu.RLock()
 	defer ie.mu.RUnlock()
+	if ie.batcher == nil {
+		return nil, 0, nil, fmt.Errorf("model not loaded")
+	}
+	inflight := ie.inflight
+	inflight.Add(1)
+	return ie.batcher, ie.config.Temperature, inflight.Done, nil
+}
 
-	// Convert tensor to [12][8][8]float32 format expected by ChessCNN
-	boardTensor, err := ie.tensorToBoardArray(stateTensor)
+// runInference performs the actual model inference
+func (ie *InferenceEngine) runInference(ctx context.Context, stateTensor tensor.Tensor, startTime time.Time) (*PredictionResult, error) {
+	batcher, temperature, release, err := ie.acquireBatcher()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	runtime := batcher.Runtime()
+
+	// Convert tensor to the flat state format expected by the model
+	state, err := ie.tensorToState(stateTensor)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert tensor: %w", err)
 	}
 
-	// Run model prediction
-	predictions, err := ie.model.Predict(boardTensor, 10) // Get top 10 moves
+	// Run model prediction with illegal moves masked before the softmax
+	probs, value, err := batcher.ForwardLegal(ctx, state, nil)
 	if err != nil {
 		return nil, fmt.Errorf("model prediction failed: %w", err)
 	}
+	predictions := model.TopKPredictions(probs, 10) // Get top 10 moves
 
 	if len(predictions) == 0 {
 		return nil, fmt.Errorf("no predictions returned from model")
 	}
 
 	// Apply temperature scaling to probabilities if configured
-	if ie.config.Temperature != 1.0 {
-		predictions = ie.applyTemperatureToMoves(predictions, ie.config.Temperature)
+	if temperature != 1.0 {
+		predictions = ie.applyTemperatureToMoves(predictions, temperature)
 	}
 
 	// Get top move
 	topMove := predictions[0]
 
 	// Convert to output tensor format for adapter
-	outputProbs := make([]float64, 4096)
+	outputProbs := make([]float64, runtime.PolicySize())
 	for _, pred := range predictions {
 		outputProbs[pred.MoveIndex] = pred.Probability
 	}
 
 	outputTensor := tensor.New(
-		tensor.WithShape(4096),
+		tensor.WithShape(len(outputProbs)),
 		tensor.WithBacking(outputProbs),
 	)
 
@@ -318,11 +370,12 @@ func (ie *InferenceEngine) runInference(stateTensor tensor.Tensor, startTime tim
 		return nil, fmt.Errorf("failed to decode action: %w", err)
 	}
 
-	// Build top-K actions
+	// Build top-K actions, naming queen promotions from the board
+	board, _ := data.BoardFromState(state)
 	topK := make([]ActionConfidence, 0, len(predictions))
 	for i, pred := range predictions {
 		topK = append(topK, ActionConfidence{
-			Action:     fmt.Sprintf("%s%s", squareToAlg(pred.FromSquare), squareToAlg(pred.ToSquare)),
+			Action:     data.BoardMoveUCI(board, pred.MoveIndex),
 			Confidence: pred.Probability,
 			Index:      pred.MoveIndex,
 		})
@@ -344,6 +397,9 @@ func (ie *InferenceEngine) runInference(stateTensor tensor.Tensor, startTime tim
 			"move_index":  topMove.MoveIndex,
 		},
 	}
+	if runtime.HasValueHead() {
+		result.Metadata["value"] = value
+	}
 
 	return result, nil
 }
@@ -362,7 +418,7 @@ func (ie *InferenceEngine) warmup() error {
 
 	// Run warmup iterations
 	for i := 0; i < ie.config.WarmupIterations; i++ {
-		_, err := ie.model.Predict(dummyBoard, 3)
+		_, err := ie.batcher.Runtime().PredictState(data.TensorToFlatArray(dummyBoard), 3)
 		if err != nil {
 			return fmt.Errorf("warmup iteration %d failed: %w", i+1, err)
 		}
@@ -371,42 +427,36 @@ func (ie *InferenceEngine) warmup() error {
 	return nil
 }
 
-// tensorToBoardArray converts a tensor to [12][8][8]float32 board representation
-func (ie *InferenceEngine) tensorToBoardArray(t tensor.Tensor) ([12][8][8]float32, error) {
-	var board [12][8][8]float32
-
+// tensorToState converts a [C, 8, 8] or [batch, C, 8, 8] tensor to a flat state
+// tensor, where C is 12 (piece planes) or 19 (piece and auxiliary planes)
+func (ie *InferenceEngine) tensorToState(t tensor.Tensor) ([]float32, error) {
 	shape := t.Shape()
-	data := t.Data().([]float64)
+	values := t.Data().([]float64)
 
 	// Handle different input shapes
 	var channels, height, width int
 
 	if len(shape) == 3 {
-		// Shape: [12, 8, 8]
+		// Shape: [C, 8, 8]
 		channels, height, width = shape[0], shape[1], shape[2]
 	} else if len(shape) == 4 {
-		// Shape: [batch, 12, 8, 8] - take first item
+		// Shape: [batch, C, 8, 8] - take first item
 		channels, height, width = shape[1], shape[2], shape[3]
 	} else {
-		return board, fmt.Errorf("unsupported tensor shape: %v", shape)
+		return nil, fmt.Errorf("unsupported tensor shape: %v", shape)
 	}
 
-	if channels != 12 || height != 8 || width != 8 {
-		return board, fmt.Errorf("expected [12, 8, 8] dimensions, got [%d, %d, %d]", channels, height, width)
+	if !data.ValidInputChannels(channels) || height != 8 || width != 8 {
+		return nil, fmt.Errorf("expected [12, 8, 8] or [19, 8, 8] dimensions, got [%d, %d, %d]", channels, height, width)
 	}
 
 	// Copy data
-	idx := 0
-	for c := 0; c < 12; c++ {
-		for h := 0; h < 8; h++ {
-			for w := 0; w < 8; w++ {
-				board[c][h][w] = float32(data[idx])
-				idx++
-			}
-		}
+	state := make([]float32, channels*height*width)
+	for i := range state {
+		state[i] = float32(values[i])
 	}
 
-	return board, nil
+	return state, nil
 }
 
 // applyTemperatureToMoves applies temperature scaling to move probabilities
@@ -436,16 +486,6 @@ func (ie *InferenceEngine) applyTemperatureToMoves(moves []model.MovePrediction,
 	return scaled
 }
 
-// squareToAlg converts square index (0-63) to algebraic notation
-func squareToAlg(square int) string {
-	if square < 0 || square >= 64 {
-		return "??"
-	}
-	file := square % 8
-	rank := square / 8
-	return string(rune('a'+file)) + string(rune('1'+rank))
-}
-
 // generateCacheKey generates a cache key from state
 func (ie *InferenceEngine) generateCacheKey(state interface{}) string {
 	// Simple string representation for now
@@ -553,7 +593,26 @@ func (ie *InferenceEngine) updateStats(latency time.Duration, success bool, from
 func (ie *InferenceEngine) GetStats() InferenceStats {
 	ie.mu.RLock()
 	defer ie.mu.RUnlock()
-	return ie.stats
+
+	stats := ie.stats
+	if ie.batcher == nil {
+		return stats
+	}
+	batch := ie.batcher.Stats()
+	stats.Batches = batch.Batches
+	stats.BatchSizeHistogram = batch.BatchSizes
+	stats.AvgBatchSize = batch.AvgBatchSize
+	stats.QueueDepth = batch.QueueDepth
+	stats.MaxQueueDepth = batch.MaxQueueDepth
+	stats.AvgQueueWaitMs = durationMs(batch.AvgQueueWait)
+	stats.LatencyP50Ms = durationMs(batch.P50Latency)
+	stats.LatencyP95Ms = durationMs(batch.P95Latency)
+	stats.LatencyP99Ms = durationMs(batch.P99Latency)
+	return stats
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000.0
 }
 
 // ResetStats resets performance statistics
@@ -565,6 +624,9 @@ func (ie *InferenceEngine) ResetStats() {
 		MinInferenceTimeMs: 999999.0,
 		LastUpdateTime:     time.Now(),
 	}
+	if ie.batcher != nil {
+		ie.batcher.ResetStats()
+	}
 }
 
 // ClearCache clears the prediction cache
@@ -602,11 +664,13 @@ func (ie *InferenceEngine) GetCacheStats() map[string]interface{} {
 // Close cleans up resources
 func (ie *InferenceEngine) Close() error {
 	ie.mu.Lock()
-	defer ie.mu.Unlock()
+	previous, drained := ie.batcher, ie.inflight
+	ie.batcher, ie.inflight = nil, nil
+	ie.mu.Unlock()
 
-	if ie.model != nil {
-		ie.model.Close()
-		ie.model = nil
+	if previous != nil {
+		drained.Wait()
+		previous.Close()
 	}
 
 	ie.ClearCache()
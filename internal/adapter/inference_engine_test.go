@@ -0,0 +1,101 @@
+package adapter
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thyrook/partner/internal/model"
+)
+
+func TestInferenceEngineReloadUnderLoad(t *testing.T) {
+	m, err := model.NewChessModel(model.ArchitectureCNN, model.DefaultCNNConfig())
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "model.gob")
+	if err := m.SaveModel(path); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+	m.Close()
+
+	config := DefaultInferenceConfig()
+	config.EnableCache = false
+	config.WarmupIterations = 0
+	config.BatchTimeoutMs = 5
+	engine, err := NewInferenceEngine(NewChessAdapter(), config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.LoadModel(path); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+
+	// A prediction that took the batcher before a reload still runs on it
+	batcher, _, release, err := engine.acquireBatcher()
+	if err != nil {
+		t.Fatalf("Failed to acquire batcher: %v", err)
+	}
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- engine.LoadModel(path) }()
+	for swapped := false; !swapped; time.Sleep(time.Millisecond) {
+		engine.mu.RLock()
+		swapped = engine.batcher != batcher
+		engine.mu.RUnlock()
+	}
+	select {
+	case err := <-reloaded:
+		t.Fatalf("Reload returned before the prediction finished: %v", err)
+	default:
+	}
+	state := make([]float32, batcher.Runtime().InputChannels()*64)
+	if _, _, err := batcher.ForwardLegal(context.Background(), state, nil); err != nil {
+		t.Errorf("In-flight prediction failed during reload: %v", err)
+	}
+	release()
+	if err := <-reloaded; err != nil {
+		t.Fatalf("Failed to reload model: %v", err)
+	}
+
+	// Concurrent predictions keep succeeding across reloads
+	fen := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	stop := make(chan struct{})
+	errs := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := engine.Predict(context.Background(), fen); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := engine.LoadModel(path); err != nil {
+			t.Fatalf("Reload %d failed: %v", i, err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Prediction failed during reload: %v", err)
+	}
+
+	if stats := engine.GetStats(); stats.FailedInfers != 0 || stats.SuccessfulInfers == 0 {
+		t.Errorf("Stats after reloads: %d successful, %d failed", stats.SuccessfulInfers, stats.FailedInfers)
+	}
+}
@@ -78,46 +78,186 @@ func InvertColors(tensor [12][8][8]float32, fromSquare, toSquare int) ([12][8][8
 	return inverted, newFromSquare, newToSquare
 }
 
+// auxPlane returns the flat 8x8 plane of an auxiliary channel
+func auxPlane(aux []float32, channel int) []float32 {
+	offset := (channel - NumChannels) * BoardSize * BoardSize
+	return aux[offset : offset+BoardSize*BoardSize]
+}
+
+// hasCastlingRights reports whether any castling plane is set
+func hasCastlingRights(aux []float32) bool {
+	if aux == nil {
+		return false
+	}
+	for c := WhiteKingsideChannel; c <= BlackQueensideChannel; c++ {
+		if auxPlane(aux, c)[0] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// flipAuxHorizontal mirrors the auxiliary planes left-to-right
+func flipAuxHorizontal(aux []float32) []float32 {
+	if aux == nil {
+		return nil
+	}
+	flipped := make([]float32, len(aux))
+	for i := 0; i < len(aux); i += BoardSize {
+		for f := 0; f < BoardSize; f++ {
+			flipped[i+BoardSize-1-f] = aux[i+f]
+		}
+	}
+	return flipped
+}
+
+// invertAuxColors swaps side to move and castling rights between colors.
+// En-passant and halfmove planes are constant along ranks, so they are unchanged.
+func invertAuxColors(aux []float32) []float32 {
+	if aux == nil {
+		return nil
+	}
+	inverted := make([]float32, len(aux))
+	copy(inverted, aux)
+
+	side := auxPlane(inverted, SideToMoveChannel)
+	for i := range side {
+		side[i] = 1 - side[i]
+	}
+	copy(auxPlane(inverted, WhiteKingsideChannel), auxPlane(aux, BlackKingsideChannel))
+	copy(auxPlane(inverted, WhiteQueensideChannel), auxPlane(aux, BlackQueensideChannel))
+	copy(auxPlane(inverted, BlackKingsideChannel), auxPlane(aux, WhiteKingsideChannel))
+	copy(auxPlane(inverted, BlackQueensideChannel), auxPlane(aux, WhiteQueensideChannel))
+
+	return inverted
+}
+
 // AugmentEntry applies random augmentations to a single data entry
 func AugmentEntry(entry *DataEntry, config AugmentationConfig) *DataEntry {
+	return AugmentEntryRand(entry, config, nil)
+}
+
+// AugmentEntryRand is AugmentEntry drawing from rng, so augmentation can be
+// reproduced from a seed. A nil rng uses the global source.
+func AugmentEntryRand(entry *DataEntry, config AugmentationConfig, rng *rand.Rand) *DataEntry {
 	if !config.Enabled {
 		return entry
 	}
 
+	// Split off auxiliary planes of extended entries
+	pieces := entry.StateTensor
+	var aux []float32
+	if len(entry.StateTensor) == NumExtendedChannels*BoardSize*BoardSize {
+		pieces = entry.StateTensor[:NumChannels*BoardSize*BoardSize]
+		aux = entry.StateTensor[len(pieces):]
+	}
+
 	// Convert flat array to tensor
-	tensor, err := FlatArrayToTensor(entry.StateTensor)
+	tensor, err := FlatArrayToTensor(pieces)
 	if err != nil {
 		return entry // Return original on error
 	}
 
 	fromSquare := entry.FromSquare
 	toSquare := entry.ToSquare
+	moveCounts := entry.MoveCounts
+	policy := entry.Policy
 
-	// Apply horizontal flip
-	if rand.Float64() < config.HorizontalFlipProb {
+	randFloat := rand.Float64
+	if rng != nil {
+		randFloat = rng.Float64
+	}
+
+	// Apply horizontal flip (a mirrored position with castling rights is not legal)
+	if randFloat() < config.HorizontalFlipProb && !hasCastlingRights(aux) {
 		tensor, fromSquare, toSquare = FlipHorizontal(tensor, fromSquare, toSquare)
+		aux = flipAuxHorizontal(aux)
+		moveCounts = mapMoveCounts(moveCounts, mirrorFile)
+		policy = mapPolicy(policy, mirrorFile)
 	}
 
 	// Apply color inversion
-	if rand.Float64() < config.ColorInvertProb {
+	if randFloat() < config.ColorInvertProb {
 		tensor, fromSquare, toSquare = InvertColors(tensor, fromSquare, toSquare)
+		aux = invertAuxColors(aux)
+		moveCounts = mapMoveCounts(moveCounts, mirrorRank)
+		policy = mapPolicy(policy, mirrorRank)
 	}
 
 	// Convert back to flat array
 	flatTensor := TensorToFlatArray(tensor)
+	flatTensor = append(flatTensor, aux...)
 
 	return &DataEntry{
 		StateTensor: flatTensor,
 		FromSquare:  fromSquare,
 		ToSquare:    toSquare,
+		Promotion:   entry.Promotion,
 		GameID:      entry.GameID,
 		MoveNumber:  entry.MoveNumber,
+		Outcome:     entry.Outcome, // Relative to the side to move, so unchanged by color inversion
+		HasOutcome:  entry.HasOutcome,
+		WhiteElo:    entry.WhiteElo,
+		BlackElo:    entry.BlackElo,
+		ECO:         entry.ECO,
+		TimeControl: entry.TimeControl,
+		MoveCounts:  moveCounts, // PositionHash is dropped: it describes the original position
+		Policy:      policy,
+	}
+}
+
+// mirrorFile maps a square to its mirror image across the d/e file boundary
+func mirrorFile(square int) int {
+	return square/8*8 + (7 - square%8)
+}
+
+// mirrorRank maps a square to its mirror image across the 4th/5th rank boundary
+func mirrorRank(square int) int {
+	return (7-square/8)*8 + square%8
+}
+
+// mapMoveCounts returns a copy of counts with both squares of each move mapped
+func mapMoveCounts(counts []MoveCount, mapSquare func(int) int) []MoveCount {
+	if counts == nil {
+		return nil
+	}
+	mapped := make([]MoveCount, len(counts))
+	for i, mc := range counts {
+		mc.FromSquare, mc.ToSquare = mapSquare(mc.FromSquare), mapSquare(mc.ToSquare)
+		mapped[i] = mc
+	}
+	return mapped
+}
+
+// mapPolicy returns a copy of a sparse policy target with each move's squares
+// mapped. Moves whose index cannot be decoded or re-encoded are dropped.
+func mapPolicy(policy []PolicyProb, mapSquare func(int) int) []PolicyProb {
+	if policy == nil {
+		return nil
 	}
+	mapped := make([]PolicyProb, 0, len(policy))
+	for _, p := range policy {
+		from, to, promo, err := DecodeMoveIndex(p.Index)
+		if err != nil {
+			continue
+		}
+		idx, err := MoveEncodingUnderpromotion.EncodeMoveIndex(mapSquare(from), mapSquare(to), promo)
+		if err != nil {
+			continue
+		}
+		mapped = append(mapped, PolicyProb{Index: idx, Prob: p.Prob})
+	}
+	return mapped
 }
 
 // AugmentBatch applies augmentation to a batch of entries
 // Returns original entries plus augmented versions
 func AugmentBatch(entries []*DataEntry, config AugmentationConfig) []*DataEntry {
+	return AugmentBatchRand(entries, config, nil)
+}
+
+// AugmentBatchRand is AugmentBatch drawing from rng (nil = global source)
+func AugmentBatchRand(entries []*DataEntry, config AugmentationConfig, rng *rand.Rand) []*DataEntry {
 	if !config.Enabled {
 		return entries
 	}
@@ -129,7 +269,7 @@ func AugmentBatch(entries []*DataEntry, config AugmentationConfig) []*DataEntry
 		augmented = append(augmented, entry)
 
 		// Add augmented version
-		augmentedEntry := AugmentEntry(entry, config)
+		augmentedEntry := AugmentEntryRand(entry, config, rng)
 		if augmentedEntry != entry { // Only add if actually augmented
 			augmented = append(augmented, augmentedEntry)
 		}
@@ -1,27 +1,73 @@
 package data
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/notnil/chess"
 	bolt "go.etcd.io/bbolt"
 )
 
 const (
 	// DefaultBucketName is the default bucket name for chess positions
 	DefaultBucketName = "chess_positions"
+
+	// MetadataBucketName is the bucket holding dataset-level metadata such as
+	// ingestion progress
+	MetadataBucketName = "metadata"
+
+	// PositionIndexBucketName maps Zobrist hashes to entry keys for
+	// deduplicated ingestion
+	PositionIndexBucketName = "position_index"
 )
 
 // DataEntry represents a single training example
 type DataEntry struct {
-	StateTensor []float32 `json:"state_tensor"` // Flat array of [12][8][8] tensor
-	FromSquare  int       `json:"from_square"`  // Move from square (0-63)
-	ToSquare    int       `json:"to_square"`    // Move to square (0-63)
-	GameID      string    `json:"game_id"`      // Optional: game identifier
-	MoveNumber  int       `json:"move_number"`  // Optional: move number in game
+	StateTensor []float32 `json:"state_tensor"`           // Flat array of [12][8][8] or [19][8][8] tensor
+	FromSquare  int       `json:"from_square"`            // Move from square (0-63)
+	ToSquare    int       `json:"to_square"`              // Move to square (0-63)
+	Promotion   string    `json:"promotion,omitempty"`    // Promotion piece ("q", "r", "b", "n"), empty if none
+	GameID      string    `json:"game_id"`                // Optional: game identifier
+	MoveNumber  int       `json:"move_number"`            // Optional: move number in game
+	Outcome     float32   `json:"outcome,omitempty"`      // Game result for the side to move: 1 win, 0 draw, -1 loss
+	HasOutcome  bool      `json:"has_outcome,omitempty"`  // False for unfinished games and older datasets
+	WhiteElo    int       `json:"white_elo,omitempty"`    // White rating from the PGN header, 0 if unknown
+	BlackElo    int       `json:"black_elo,omitempty"`    // Black rating from the PGN header, 0 if unknown
+	ECO         string    `json:"eco,omitempty"`          // Opening code from the PGN header
+	TimeControl string    `json:"time_control,omitempty"` // PGN TimeControl tag, e.g. "300+3"
+
+	PositionHash uint64       `json:"position_hash,omitempty"` // Zobrist hash of the position (see ZobristHash)
+	MoveCounts   []MoveCount  `json:"move_counts,omitempty"`   // Moves played from a deduplicated position
+	Policy       []PolicyProb `json:"policy,omitempty"`        // Sparse policy target, e.g. from a teacher model
+}
+
+// SetGameInfo copies the game's result (for the side to move), ratings, ECO
+// code and time control onto the entry
+func (e *DataEntry) SetGameInfo(info GameInfo, turn chess.Color) {
+	e.Outcome, e.HasOutcome = OutcomeValue(info.Outcome, turn)
+	e.WhiteElo = info.WhiteElo
+	e.BlackElo = info.BlackElo
+	e.ECO = info.ECO
+	e.TimeControl = info.TimeControl
+}
+
+// InputChannels returns the number of channels in the entry's state tensor
+func (e *DataEntry) InputChannels() (int, error) {
+	return InputChannelsForLength(len(e.StateTensor))
+}
+
+// MoveIndex returns the policy index of the entry's move under the given encoding
+func (e *DataEntry) MoveIndex(encoding MoveEncoding) (int, error) {
+	promo, err := ParsePromotion(e.Promotion)
+	if err != nil {
+		return 0, err
+	}
+	return encoding.EncodeMoveIndex(e.FromSquare, e.ToSquare, promo)
 }
 
 // Dataset manages the on-disk chess dataset using BoltDB
@@ -29,6 +75,7 @@ type Dataset struct {
 	db         *bolt.DB
 	bucketName string
 	path       string
+	format     RecordFormat // Format of new entries, detected from the first one
 	mu         sync.RWMutex
 }
 
@@ -61,9 +108,39 @@ func NewDataset(path string) (*Dataset, error) {
 		return nil, fmt.Errorf("failed to create bucket: %w", err)
 	}
 
+	// Entries are added in the format of the stored ones, so datasets
+	// written as JSON stay JSON until migrated (see MigrateDataset)
+	err = db.View(func(tx *bolt.Tx) error {
+		ds.format, err = detectRecordFormat(tx.Bucket([]byte(ds.bucketName)))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return ds, nil
 }
 
+// detectRecordFormat returns the format of the first entry in bucket, or
+// DefaultRecordFormat if it is empty
+func detectRecordFormat(bucket *bolt.Bucket) (RecordFormat, error) {
+	_, v := bucket.Cursor().First()
+	if v == nil {
+		return DefaultRecordFormat, nil
+	}
+	format, err := recordFormatOf(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect record format: %w", err)
+	}
+	return format, nil
+}
+
+// Format returns the record format new entries are stored in
+func (ds *Dataset) Format() RecordFormat {
+	return ds.format
+}
+
 // Close closes the dataset
 func (ds *Dataset) Close() error {
 	ds.mu.Lock()
@@ -86,14 +163,18 @@ func (ds *Dataset) Add(entry *DataEntry) error {
 			return fmt.Errorf("bucket not found")
 		}
 
+		if err := checkInputFormat(bucket, []*DataEntry{entry}); err != nil {
+			return err
+		}
+
 		// Get next ID
 		id, _ := bucket.NextSequence()
 		key := []byte(fmt.Sprintf("%020d", id))
 
 		// Serialize entry
-		value, err := json.Marshal(entry)
+		value, err := encodeEntry(entry, ds.format)
 		if err != nil {
-			return fmt.Errorf("failed to marshal entry: %w", err)
+			return err
 		}
 
 		return bucket.Put(key, value)
@@ -102,31 +183,186 @@ func (ds *Dataset) Add(entry *DataEntry) error {
 
 // AddBatch adds multiple entries in a single transaction
 func (ds *Dataset) AddBatch(entries []*DataEntry) error {
+	_, err := ds.addBatch(entries, nil, false)
+	return err
+}
+
+// addBatch adds entries and stores metadata values in a single transaction,
+// so metadata such as ingestion progress always matches the stored entries.
+// With dedup set, entries whose position is already stored are merged into
+// the existing entry; the number merged is returned.
+func (ds *Dataset) addBatch(entries []*DataEntry, metadata map[string]interface{}, dedup bool) (int, error) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	return ds.db.Update(func(tx *bolt.Tx) error {
+	merged := 0
+	err := ds.db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(ds.bucketName))
 		if bucket == nil {
 			return fmt.Errorf("bucket not found")
 		}
 
+		for key, value := range metadata {
+			if err := putMetadata(tx, key, value); err != nil {
+				return err
+			}
+		}
+
+		if err := checkInputFormat(bucket, entries); err != nil {
+			return err
+		}
+
+		var index *bolt.Bucket
+		if dedup {
+			var err error
+			if index, err = tx.CreateBucketIfNotExists([]byte(PositionIndexBucketName)); err != nil {
+				return fmt.Errorf("failed to create position index: %w", err)
+			}
+		}
+
 		for _, entry := range entries {
+			if index != nil && entry.PositionHash != 0 {
+				ok, err := mergeEntry(bucket, index, entry)
+				if err != nil {
+					return err
+				}
+				if ok {
+					merged++
+					continue
+				}
+			}
+
 			id, _ := bucket.NextSequence()
 			key := []byte(fmt.Sprintf("%020d", id))
 
-			value, err := json.Marshal(entry)
+			value, err := encodeEntry(entry, ds.format)
 			if err != nil {
-				return fmt.Errorf("failed to marshal entry: %w", err)
+				return err
 			}
 
 			if err := bucket.Put(key, value); err != nil {
 				return err
 			}
+			if index != nil && entry.PositionHash != 0 {
+				if err := index.Put(hashKey(entry.PositionHash), key); err != nil {
+					return err
+				}
+			}
 		}
 
 		return nil
 	})
+
+	return merged, err
+}
+
+// SetMetadata stores a JSON-encoded dataset-level value under key
+func (ds *Dataset) SetMetadata(key string, value interface{}) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		return putMetadata(tx, key, value)
+	})
+}
+
+// GetMetadata decodes the value stored under key into value. It returns false
+// if the key has not been set.
+func (ds *Dataset) GetMetadata(key string, value interface{}) (bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	found := false
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(MetadataBucketName))
+		if bucket == nil {
+			return nil
+		}
+
+		v := bucket.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+
+		found = true
+		if err := json.Unmarshal(v, value); err != nil {
+			return fmt.Errorf("failed to unmarshal metadata %q: %w", key, err)
+		}
+		return nil
+	})
+
+	return found, err
+}
+
+// putMetadata writes a metadata value within a transaction
+func putMetadata(tx *bolt.Tx, key string, value interface{}) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(MetadataBucketName))
+	if err != nil {
+		return fmt.Errorf("failed to create metadata bucket: %w", err)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata %q: %w", key, err)
+	}
+
+	return bucket.Put([]byte(key), encoded)
+}
+
+// checkInputFormat ensures new entries don't mix 12-channel and extended state tensors.
+// Malformed tensors are left for VerifyIntegrity to report.
+func checkInputFormat(bucket *bolt.Bucket, entries []*DataEntry) error {
+	expected := 0
+	if _, v := bucket.Cursor().First(); v != nil {
+		if first, err := decodeEntry(v); err == nil {
+			expected, _ = first.InputChannels()
+		}
+	}
+
+	for i, entry := range entries {
+		channels, err := entry.InputChannels()
+		if err != nil {
+			continue
+		}
+		if expected == 0 {
+			expected = channels
+		}
+		if channels != expected {
+			return fmt.Errorf("entry %d has %d input channels, dataset uses %d", i, channels, expected)
+		}
+	}
+
+	return nil
+}
+
+// InputChannels returns the state tensor format of the dataset.
+// Empty datasets report DefaultInputChannels.
+func (ds *Dataset) InputChannels() (int, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	channels := DefaultInputChannels
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(ds.bucketName))
+		if bucket == nil {
+			return fmt.Errorf("bucket not found")
+		}
+
+		_, v := bucket.Cursor().First()
+		if v == nil {
+			return nil
+		}
+
+		entry, err := decodeEntry(v)
+		if err != nil {
+			return err
+		}
+
+		channels, err = entry.InputChannels()
+		return err
+	})
+
+	return channels, err
 }
 
 // Count returns the number of entries in the dataset
@@ -179,12 +415,12 @@ func (ds *Dataset) LoadBatch(offset, n int) ([]*DataEntry, error) {
 		// Load n entries
 		loaded := 0
 		for k != nil && loaded < n {
-			var entry DataEntry
-			if err := json.Unmarshal(v, &entry); err != nil {
-				return fmt.Errorf("failed to unmarshal entry: %w", err)
+			entry, err := decodeEntry(v)
+			if err != nil {
+				return err
 			}
 
-			entries = append(entries, &entry)
+			entries = append(entries, entry)
 			loaded++
 
 			k, v = cursor.Next()
@@ -223,15 +459,14 @@ func (ds *Dataset) VerifyIntegrity() error {
 		return bucket.ForEach(func(k, v []byte) error {
 			totalEntries++
 
-			var entry DataEntry
-			if err := json.Unmarshal(v, &entry); err != nil {
+			entry, err := decodeEntry(v)
+			if err != nil {
 				errors++
 				return nil // Continue checking other entries
 			}
 
 			// Verify tensor dimensions
-			expectedLen := NumChannels * BoardSize * BoardSize
-			if len(entry.StateTensor) != expectedLen {
+			if _, err := entry.InputChannels(); err != nil {
 				errors++
 				return nil
 			}
@@ -246,8 +481,8 @@ func (ds *Dataset) VerifyIntegrity() error {
 				return nil
 			}
 
-			// Reconstruct tensor and validate
-			tensor, err := FlatArrayToTensor(entry.StateTensor)
+			// Reconstruct piece planes and validate
+			tensor, err := FlatArrayToTensor(entry.StateTensor[:NumChannels*BoardSize*BoardSize])
 			if err != nil {
 				errors++
 				return nil
@@ -303,15 +538,14 @@ func (ds *Dataset) QuickVerifyIntegrity(sampleRate float64) error {
 
 			sampledEntries++
 
-			var entry DataEntry
-			if err := json.Unmarshal(v, &entry); err != nil {
+			entry, err := decodeEntry(v)
+			if err != nil {
 				errors++
 				return nil
 			}
 
 			// Verify tensor dimensions
-			expectedLen := NumChannels * BoardSize * BoardSize
-			if len(entry.StateTensor) != expectedLen {
+			if _, err := entry.InputChannels(); err != nil {
 				errors++
 				return nil
 			}
@@ -326,12 +560,6 @@ func (ds *Dataset) QuickVerifyIntegrity(sampleRate float64) error {
 				return nil
 			}
 
-			// Quick tensor validation (just check dimensions)
-			if len(entry.StateTensor) != 768 {
-				errors++
-				return nil
-			}
-
 			return nil
 		})
 	})
@@ -351,7 +579,7 @@ func (ds *Dataset) QuickVerifyIntegrity(sampleRate float64) error {
 	return nil
 }
 
-// Clear removes all entries from the dataset
+// Clear removes all entries, metadata and the position index from the dataset
 func (ds *Dataset) Clear() error {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
@@ -360,9 +588,39 @@ func (ds *Dataset) Clear() error {
 		if err := tx.DeleteBucket([]byte(ds.bucketName)); err != nil {
 			return err
 		}
-		_, err := tx.CreateBucket([]byte(ds.bucketName))
+		for _, name := range []string{MetadataBucketName, PositionIndexBucketName} {
+			if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket([]byte(ds.bucketName)); err != nil {
+			return err
+		}
+		ds.format = DefaultRecordFormat
+		return nil
+	})
+}
+
+// Path returns the path of the dataset file
+func (ds *Dataset) Path() string {
+	return ds.path
+}
+
+// Hash returns the hex SHA-256 of a consistent snapshot of the dataset file,
+// identifying the exact data a model was trained on
+func (ds *Dataset) Hash() (string, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	h := sha256.New()
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(h)
 		return err
 	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash dataset: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 // GetStats returns statistics about the dataset
@@ -377,16 +635,52 @@ func (ds *Dataset) GetStats() (*DatasetStats, error) {
 		return nil, err
 	}
 
+	channels, err := ds.InputChannels()
+	if err != nil {
+		return nil, err
+	}
+
 	return &DatasetStats{
-		TotalEntries: count,
-		FilePath:     ds.path,
-		FileSize:     fileInfo.Size(),
+		TotalEntries:  count,
+		FilePath:      ds.path,
+		FileSize:      fileInfo.Size(),
+		InputChannels: channels,
+		Format:        ds.format,
 	}, nil
 }
 
+// MetadataStats scans the dataset and returns the distributions of game
+// outcome, rating, ECO code and time control. Every entry is decoded, so
+// unlike GetStats this is proportional to the dataset size.
+func (ds *Dataset) MetadataStats() (*MetadataStats, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	stats := NewMetadataStats()
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(ds.bucketName))
+		if bucket == nil {
+			return fmt.Errorf("bucket not found")
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			entry, err := decodeMetadata(v)
+			if err != nil {
+				return fmt.Errorf("entry %s: %w", k, err)
+			}
+			stats.Add(entry)
+			return nil
+		})
+	})
+
+	return stats, err
+}
+
 // DatasetStats contains statistics about the dataset
 type DatasetStats struct {
-	TotalEntries int
-	FilePath     string
-	FileSize     int64
+	TotalEntries  int
+	FilePath      string
+	FileSize      int64
+	InputChannels int
+	Format        RecordFormat
 }
@@ -265,6 +265,65 @@ func TestGetStats(t *testing.T) {
 	if stats.FileSize <= 0 {
 		t.Error("Expected positive file size")
 	}
+
+	// Entries without game metadata are counted as unknown
+	metadata, err := ds.MetadataStats()
+	if err != nil {
+		t.Fatalf("Failed to get metadata stats: %v", err)
+	}
+	if metadata.Outcomes["unknown"] != 5 || metadata.TimeControls[TimeControlUnknown] != 5 {
+		t.Errorf("Unexpected metadata distributions: %+v", metadata)
+	}
+}
+
+func TestDatasetMetadataStats(t *testing.T) {
+	ds, err := NewDataset(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+	defer ds.Close()
+
+	info := GameInfo{Outcome: chess.WhiteWon, WhiteElo: 2450, BlackElo: 2390, ECO: "C42", TimeControl: "180+2"}
+	entries := make([]*DataEntry, 4)
+	for i := range entries {
+		entries[i] = &DataEntry{StateTensor: make([]float32, NumChannels*BoardSize*BoardSize)}
+		turn := chess.White
+		if i%2 == 1 {
+			turn = chess.Black
+		}
+		entries[i].SetGameInfo(info, turn)
+	}
+
+	if err := ds.AddBatch(entries); err != nil {
+		t.Fatalf("Failed to add batch: %v", err)
+	}
+
+	// Metadata survives the round trip
+	loaded, err := ds.LoadBatch(1, 1)
+	if err != nil || len(loaded) != 1 {
+		t.Fatalf("Failed to load entry: %v", err)
+	}
+	if got := loaded[0]; !got.HasOutcome || got.Outcome != -1 || got.WhiteElo != 2450 || got.ECO != "C42" || got.TimeControl != "180+2" {
+		t.Errorf("Unexpected loaded entry metadata: %+v", got)
+	}
+
+	m, err := ds.MetadataStats()
+	if err != nil {
+		t.Fatalf("Failed to get metadata stats: %v", err)
+	}
+
+	if m.Outcomes["win"] != 2 || m.Outcomes["loss"] != 2 {
+		t.Errorf("Outcomes = %v; want 2 wins, 2 losses", m.Outcomes)
+	}
+	if m.EloBands["2400-2599"] != 4 {
+		t.Errorf("EloBands = %v; want 4 in 2400-2599", m.EloBands)
+	}
+	if m.ECOGroups["C"] != 4 {
+		t.Errorf("ECOGroups = %v; want 4 in C", m.ECOGroups)
+	}
+	if m.TimeControls[TimeControlBlitz] != 4 {
+		t.Errorf("TimeControls = %v; want 4 blitz", m.TimeControls)
+	}
 }
 
 func TestClear(t *testing.T) {
@@ -340,3 +399,45 @@ func TestLoadBatchBeyondEnd(t *testing.T) {
 		t.Errorf("Expected 2 entries (all remaining), got %d", len(batch))
 	}
 }
+
+func TestDatasetInputChannels(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	ds, err := NewDataset(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+	defer ds.Close()
+
+	entry := &DataEntry{
+		StateTensor: make([]float32, NumExtendedChannels*BoardSize*BoardSize),
+		FromSquare:  12,
+		ToSquare:    28,
+	}
+	if err := ds.Add(entry); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	channels, err := ds.InputChannels()
+	if err != nil {
+		t.Fatalf("Failed to get input channels: %v", err)
+	}
+	if channels != NumExtendedChannels {
+		t.Errorf("Expected %d channels, got %d", NumExtendedChannels, channels)
+	}
+
+	// Mixing formats is rejected
+	legacy := &DataEntry{
+		StateTensor: make([]float32, NumChannels*BoardSize*BoardSize),
+		FromSquare:  12,
+		ToSquare:    28,
+	}
+	if err := ds.AddBatch([]*DataEntry{legacy}); err == nil {
+		t.Error("Expected error adding 12-channel entry to extended dataset")
+	}
+
+	if err := ds.VerifyIntegrity(); err != nil {
+		t.Errorf("Integrity check failed: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MoveCount is the number of times a move was played from a deduplicated position
+type MoveCount struct {
+	FromSquare int    `json:"from"`
+	ToSquare   int    `json:"to"`
+	Promotion  string `json:"promotion,omitempty"`
+	Count      int    `json:"count"`
+}
+
+// Visits returns the number of occurrences merged into the entry (1 for
+// entries that were never deduplicated)
+func (e *DataEntry) Visits() int {
+	if len(e.MoveCounts) == 0 {
+		return 1
+	}
+	visits := 0
+	for _, mc := range e.MoveCounts {
+		visits += mc.Count
+	}
+	return visits
+}
+
+// moveCounts returns the entry's move counts, treating a plain entry as a
+// single visit of its move
+func (e *DataEntry) moveCounts() []MoveCount {
+	if len(e.MoveCounts) > 0 {
+		return e.MoveCounts
+	}
+	return []MoveCount{{FromSquare: e.FromSquare, ToSquare: e.ToSquare, Promotion: e.Promotion, Count: 1}}
+}
+
+// Merge adds the occurrences of other, an entry for the same position, to the
+// entry's move counts. The outcome becomes the visit-weighted mean and the
+// label becomes the most played move.
+func (e *DataEntry) Merge(other *DataEntry) {
+	visits, otherVisits := e.Visits(), other.Visits()
+
+	counts := append([]MoveCount(nil), e.moveCounts()...)
+	for _, mc := range other.moveCounts() {
+		found := false
+		for i := range counts {
+			if counts[i].FromSquare == mc.FromSquare && counts[i].ToSquare == mc.ToSquare && counts[i].Promotion == mc.Promotion {
+				counts[i].Count += mc.Count
+				found = true
+				break
+			}
+		}
+		if !found {
+			counts = append(counts, mc)
+		}
+	}
+	e.MoveCounts = counts
+
+	switch {
+	case e.HasOutcome && other.HasOutcome:
+		e.Outcome = (e.Outcome*float32(visits) + other.Outcome*float32(otherVisits)) / float32(visits+otherVisits)
+	case other.HasOutcome:
+		e.Outcome, e.HasOutcome = other.Outcome, true
+	}
+
+	// The first most played move wins ties, so the label only changes when
+	// another move overtakes it
+	best := counts[0]
+	for _, mc := range counts[1:] {
+		if mc.Count > best.Count {
+			best = mc
+		}
+	}
+	e.FromSquare, e.ToSquare, e.Promotion = best.FromSquare, best.ToSquare, best.Promotion
+}
+
+// hashKey encodes a Zobrist hash as a position index key
+func hashKey(hash uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, hash)
+	return key
+}
+
+// mergeEntry merges entry into the stored entry for the same position, if
+// the position index has one. It reports whether the entry was merged.
+func mergeEntry(bucket, index *bolt.Bucket, entry *DataEntry) (bool, error) {
+	key := index.Get(hashKey(entry.PositionHash))
+	if key == nil {
+		return false, nil
+	}
+	value := bucket.Get(key)
+	if value == nil {
+		// Stale index after the entry was removed
+		return false, nil
+	}
+
+	// The merged entry keeps the stored entry's format
+	format, err := recordFormatOf(value)
+	if err != nil {
+		return false, fmt.Errorf("entry %s: %w", key, err)
+	}
+	stored, err := decodeEntry(value)
+	if err != nil {
+		return false, fmt.Errorf("entry %s: %w", key, err)
+	}
+	stored.Merge(entry)
+
+	updated, err := encodeEntry(stored, format)
+	if err != nil {
+		return false, err
+	}
+	// Keys from Get are only valid for the transaction; copy before Put
+	return true, bucket.Put(append([]byte(nil), key...), updated)
+}
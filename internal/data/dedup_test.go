@@ -0,0 +1,145 @@
+package data
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestZobristHash(t *testing.T) {
+	play := func(moves ...string) *chess.Position {
+		game := chess.NewGame()
+		for _, m := range moves {
+			if err := game.MoveStr(m); err != nil {
+				t.Fatalf("Failed to make move %s: %v", m, err)
+			}
+		}
+		return game.Position()
+	}
+
+	// Transpositions hash identically regardless of move counters
+	a := ZobristHash(play("Nf3", "Nf6", "g3"))
+	b := ZobristHash(play("g3", "Nf6", "Nf3"))
+	if a != b {
+		t.Errorf("Transposed positions hash differently: %x vs %x", a, b)
+	}
+
+	// Side to move and castling rights are part of the position
+	if ZobristHash(play("Nf3", "Nf6", "Ng1", "Ng8")) != ZobristHash(play()) {
+		t.Error("Expected knight shuffle to return to the starting hash")
+	}
+	if ZobristHash(play("Nf3")) == ZobristHash(play("Nf3", "Nf6", "Ng1")) {
+		t.Error("Expected different hashes for different side to move")
+	}
+	if ZobristHash(play("e4", "e5", "Ke2", "Ke7", "Ke1", "Ke8")) == ZobristHash(play("e4", "e5")) {
+		t.Error("Expected lost castling rights to change the hash")
+	}
+}
+
+func TestDataEntryMerge(t *testing.T) {
+	entry := &DataEntry{FromSquare: 12, ToSquare: 28, Outcome: 1, HasOutcome: true}
+	entry.Merge(&DataEntry{FromSquare: 11, ToSquare: 27, Outcome: -1, HasOutcome: true})
+	entry.Merge(&DataEntry{FromSquare: 11, ToSquare: 27})
+	entry.Merge(&DataEntry{FromSquare: 11, ToSquare: 27, Outcome: 0, HasOutcome: true})
+
+	if entry.Visits() != 4 || len(entry.MoveCounts) != 2 {
+		t.Fatalf("Visits = %d with %d moves, want 4 with 2", entry.Visits(), len(entry.MoveCounts))
+	}
+
+	// The most played move becomes the label
+	if entry.FromSquare != 11 || entry.ToSquare != 27 {
+		t.Errorf("Label = %d->%d, want 11->27", entry.FromSquare, entry.ToSquare)
+	}
+
+	target, err := entry.PolicyTarget(MoveEncodingUnderpromotion)
+	if err != nil {
+		t.Fatalf("PolicyTarget failed: %v", err)
+	}
+	if math.Abs(float64(target[12*64+28])-0.25) > 1e-6 || math.Abs(float64(target[11*64+27])-0.75) > 1e-6 {
+		t.Errorf("Unexpected target: %v", target)
+	}
+
+	// Plain entries have a one-hot target
+	plain := &DataEntry{FromSquare: 52, ToSquare: 60, Promotion: "n"}
+	target, err = plain.PolicyTarget(MoveEncodingUnderpromotion)
+	if err != nil || len(target) != 1 {
+		t.Fatalf("PolicyTarget for plain entry = %v, %v", target, err)
+	}
+	idx, _ := plain.MoveIndex(MoveEncodingUnderpromotion)
+	if target[idx] != 1 {
+		t.Errorf("Plain target = %v, want 1 at %d", target, idx)
+	}
+}
+
+func TestIngestDeduplicate(t *testing.T) {
+	pgn := `[Event "A"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 1-0
+
+[Event "B"]
+[Result "0-1"]
+
+1. e4 c5 0-1
+
+[Event "C"]
+[Result "1-0"]
+
+1. d4 d5 1-0
+`
+	dir := t.TempDir()
+	pgnPath := filepath.Join(dir, "games.pgn")
+	if err := os.WriteFile(pgnPath, []byte(pgn), 0644); err != nil {
+		t.Fatalf("Failed to write PGN: %v", err)
+	}
+
+	config := DefaultIngestionConfig(pgnPath, filepath.Join(dir, "dataset.db"))
+	config.Verbose = false
+	config.BatchSize = 2
+	config.Deduplicate = true
+
+	ingestor, err := NewIngestor(config)
+	if err != nil {
+		t.Fatalf("Failed to create ingestor: %v", err)
+	}
+	stats, err := ingestor.Ingest()
+	ingestor.Close()
+	if err != nil {
+		t.Fatalf("Ingestion failed: %v", err)
+	}
+
+	// The start position occurs 3 times and the position after 1. e4 twice
+	if stats.PositionsIngested != 7 || stats.DuplicatePositions != 3 {
+		t.Fatalf("Ingested %d positions with %d duplicates, want 7 and 3", stats.PositionsIngested, stats.DuplicatePositions)
+	}
+
+	dataset, err := NewDataset(config.DatasetPath)
+	if err != nil {
+		t.Fatalf("Failed to open dataset: %v", err)
+	}
+	defer dataset.Close()
+
+	entries, err := dataset.LoadAll()
+	if err != nil {
+		t.Fatalf("Failed to load entries: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Dataset has %d entries, want 4", len(entries))
+	}
+
+	start := entries[0]
+	if start.Visits() != 3 || len(start.MoveCounts) != 2 {
+		t.Errorf("Start position: %d visits, moves %+v", start.Visits(), start.MoveCounts)
+	}
+	// e4 was played twice from the start position
+	if start.FromSquare != 12 || start.ToSquare != 28 {
+		t.Errorf("Start position label = %d->%d, want e2e4", start.FromSquare, start.ToSquare)
+	}
+	// Value target is the mean result for white: win, loss, win
+	if !start.HasOutcome || math.Abs(float64(start.Outcome)-1.0/3) > 1e-6 {
+		t.Errorf("Start position outcome = %v, want 1/3", start.Outcome)
+	}
+}
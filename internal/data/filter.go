@@ -0,0 +1,164 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Filter names used as keys in RejectionStats
+const (
+	FilterElo         = "elo"
+	FilterTimeControl = "time_control"
+	FilterTermination = "termination"
+	FilterPly         = "ply"
+	FilterDecisive    = "decisive"   // Winner-only ingestion of a drawn or unfinished game
+	FilterOpening     = "opening"    // Position within the skipped opening plies
+	FilterLoserMove   = "loser_move" // Move played by the losing side
+)
+
+// GameFilter declares which games and positions are ingested. Zero values
+// disable the corresponding filter. It can be loaded from JSON with
+// LoadGameFilter.
+type GameFilter struct {
+	MinElo              int      `json:"min_elo"`              // Both players rated at least this; unrated games are rejected
+	MaxElo              int      `json:"max_elo"`              // Both players rated at most this
+	TimeControls        []string `json:"time_controls"`        // Allowed categories (see TimeControlCategory)
+	ExcludeTerminations []string `json:"exclude_terminations"` // PGN Termination values to reject, e.g. "Abandoned"
+	MinPly              int      `json:"min_ply"`              // Minimum game length in plies
+	MaxPly              int      `json:"max_ply"`              // Maximum game length in plies
+	SkipOpeningPlies    int      `json:"skip_opening_plies"`   // Positions before this ply are not ingested
+	WinnerOnly          bool     `json:"winner_only"`          // Only ingest moves of the side that won
+}
+
+// LoadGameFilter reads a filter from a JSON file
+func LoadGameFilter(path string) (*GameFilter, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter: %w", err)
+	}
+
+	var filter GameFilter
+	if err := json.Unmarshal(content, &filter); err != nil {
+		return nil, fmt.Errorf("failed to parse filter: %w", err)
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// Validate checks the filter for unknown time controls and empty ranges
+func (f *GameFilter) Validate() error {
+	for _, tc := range f.TimeControls {
+		switch strings.ToLower(strings.TrimSpace(tc)) {
+		case TimeControlBullet, TimeControlBlitz, TimeControlRapid, TimeControlClassical,
+			TimeControlCorrespondence, TimeControlUnknown:
+		default:
+			return fmt.Errorf("unknown time control category: %q", tc)
+		}
+	}
+	if f.MaxElo > 0 && f.MinElo > f.MaxElo {
+		return fmt.Errorf("min Elo %d is above max Elo %d", f.MinElo, f.MaxElo)
+	}
+	if f.MaxPly > 0 && f.MinPly > f.MaxPly {
+		return fmt.Errorf("min ply %d is above max ply %d", f.MinPly, f.MaxPly)
+	}
+	return nil
+}
+
+// RejectGame returns the name of the first filter the game fails, or "" if
+// the game is accepted
+func (f *GameFilter) RejectGame(game *chess.Game, info GameInfo) string {
+	if f == nil {
+		return ""
+	}
+
+	if f.MinElo > 0 && (info.WhiteElo < f.MinElo || info.BlackElo < f.MinElo) {
+		return FilterElo
+	}
+	if f.MaxElo > 0 && (info.WhiteElo > f.MaxElo || info.BlackElo > f.MaxElo) {
+		return FilterElo
+	}
+
+	if len(f.TimeControls) > 0 && !containsFold(f.TimeControls, TimeControlCategory(info.TimeControl)) {
+		return FilterTimeControl
+	}
+
+	if len(f.ExcludeTerminations) > 0 && containsFold(f.ExcludeTerminations, tagValue(game, "Termination")) {
+		return FilterTermination
+	}
+
+	plies := len(game.Moves())
+	if plies < f.MinPly || (f.MaxPly > 0 && plies > f.MaxPly) {
+		return FilterPly
+	}
+
+	if f.WinnerOnly && info.Outcome != chess.WhiteWon && info.Outcome != chess.BlackWon {
+		return FilterDecisive
+	}
+
+	return ""
+}
+
+// RejectPosition returns the name of the filter excluding the position at
+// the given ply, or "" if the position is accepted
+func (f *GameFilter) RejectPosition(ply int, turn chess.Color, outcome chess.Outcome) string {
+	if f == nil {
+		return ""
+	}
+
+	if ply < f.SkipOpeningPlies {
+		return FilterOpening
+	}
+	if f.WinnerOnly {
+		winner := chess.White
+		if outcome == chess.BlackWon {
+			winner = chess.Black
+		}
+		if turn != winner {
+			return FilterLoserMove
+		}
+	}
+
+	return ""
+}
+
+// containsFold reports whether values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RejectionStats counts games and positions rejected by each filter
+type RejectionStats struct {
+	Games     map[string]int
+	Positions map[string]int
+}
+
+// NewRejectionStats creates empty rejection counts
+func NewRejectionStats() *RejectionStats {
+	return &RejectionStats{
+		Games:     make(map[string]int),
+		Positions: make(map[string]int),
+	}
+}
+
+// Fprint writes the rejection counts, omitting empty tables
+func (s *RejectionStats) Fprint(w io.Writer) {
+	if len(s.Games) > 0 {
+		printDistribution(w, "Rejected games", s.Games)
+	}
+	if len(s.Positions) > 0 {
+		printDistribution(w, "Rejected positions", s.Positions)
+	}
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestGameFilterRejectGame(t *testing.T) {
+	pgn := `[Event "Rated Blitz game"]
+[WhiteElo "1850"]
+[BlackElo "2010"]
+[TimeControl "300+0"]
+[Termination "Time forfeit"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+`
+	games, err := NewPGNParser("").ParsePGNReader(strings.NewReader(pgn))
+	if err != nil || len(games) != 1 {
+		t.Fatalf("Failed to parse PGN: %v (%d games)", err, len(games))
+	}
+	game := games[0]
+	info := ParseGameInfo(game)
+
+	tests := []struct {
+		name     string
+		filter   *GameFilter
+		expected string
+	}{
+		{"nil filter", nil, ""},
+		{"empty filter", &GameFilter{}, ""},
+		{"min elo", &GameFilter{MinElo: 1900}, FilterElo},
+		{"max elo", &GameFilter{MaxElo: 2000}, FilterElo},
+		{"elo range", &GameFilter{MinElo: 1800, MaxElo: 2100}, ""},
+		{"time control", &GameFilter{TimeControls: []string{TimeControlRapid}}, FilterTimeControl},
+		{"time control allowed", &GameFilter{TimeControls: []string{"Blitz"}}, ""},
+		{"termination", &GameFilter{ExcludeTerminations: []string{"abandoned", "time forfeit"}}, FilterTermination},
+		{"min ply", &GameFilter{MinPly: 5}, FilterPly},
+		{"max ply", &GameFilter{MaxPly: 3}, FilterPly},
+		{"winner only", &GameFilter{WinnerOnly: true}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.RejectGame(game, info); got != tt.expected {
+			t.Errorf("%s: RejectGame() = %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+
+	info.Outcome = chess.Draw
+	if got := (&GameFilter{WinnerOnly: true}).RejectGame(game, info); got != FilterDecisive {
+		t.Errorf("Winner-only filter on a draw: RejectGame() = %q, want %q", got, FilterDecisive)
+	}
+}
+
+func TestGameFilterRejectPosition(t *testing.T) {
+	filter := &GameFilter{SkipOpeningPlies: 2, WinnerOnly: true}
+
+	tests := []struct {
+		ply      int
+		turn     chess.Color
+		expected string
+	}{
+		{0, chess.White, FilterOpening},
+		{1, chess.Black, FilterOpening},
+		{2, chess.White, FilterLoserMove},
+		{3, chess.Black, ""},
+	}
+
+	for _, tt := range tests {
+		if got := filter.RejectPosition(tt.ply, tt.turn, chess.BlackWon); got != tt.expected {
+			t.Errorf("RejectPosition(%d, %v) = %q, want %q", tt.ply, tt.turn, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadGameFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.json")
+	content := `{"min_elo": 2000, "time_controls": ["blitz", "rapid"], "skip_opening_plies": 8, "winner_only": true}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write filter: %v", err)
+	}
+
+	filter, err := LoadGameFilter(path)
+	if err != nil {
+		t.Fatalf("Failed to load filter: %v", err)
+	}
+	if filter.MinElo != 2000 || len(filter.TimeControls) != 2 || filter.SkipOpeningPlies != 8 || !filter.WinnerOnly {
+		t.Errorf("Unexpected filter: %+v", filter)
+	}
+
+	if err := (&GameFilter{TimeControls: []string{"hyperbullet"}}).Validate(); err == nil {
+		t.Error("Expected error for unknown time control")
+	}
+	if err := (&GameFilter{MinPly: 40, MaxPly: 20}).Validate(); err == nil {
+		t.Error("Expected error for empty ply range")
+	}
+}
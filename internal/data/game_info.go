@@ -0,0 +1,197 @@
+package data
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Time control categories, using Lichess thresholds on the estimated game
+// duration (base time + 40 × increment)
+const (
+	TimeControlBullet         = "bullet"
+	TimeControlBlitz          = "blitz"
+	TimeControlRapid          = "rapid"
+	TimeControlClassical      = "classical"
+	TimeControlCorrespondence = "correspondence"
+	TimeControlUnknown        = "unknown"
+)
+
+// GameInfo holds the PGN header fields stored with every position of a game
+type GameInfo struct {
+	Outcome     chess.Outcome
+	WhiteElo    int    // 0 if unrated or missing
+	BlackElo    int    // 0 if unrated or missing
+	ECO         string // Opening code, e.g. "C42"
+	TimeControl string // PGN TimeControl tag, e.g. "300+3"
+}
+
+// ParseGameInfo reads the result, ratings, ECO code and time control of a game
+func ParseGameInfo(game *chess.Game) GameInfo {
+	if game == nil {
+		return GameInfo{Outcome: chess.NoOutcome}
+	}
+	return GameInfo{
+		Outcome:     GameOutcome(game),
+		WhiteElo:    parseElo(tagValue(game, "WhiteElo")),
+		BlackElo:    parseElo(tagValue(game, "BlackElo")),
+		ECO:         normalizeTag(tagValue(game, "ECO")),
+		TimeControl: normalizeTag(tagValue(game, "TimeControl")),
+	}
+}
+
+// tagValue returns a PGN header value, or "" if the tag is missing
+func tagValue(game *chess.Game, key string) string {
+	if tag := game.GetTagPair(key); tag != nil {
+		return strings.TrimSpace(tag.Value)
+	}
+	return ""
+}
+
+// normalizeTag maps the PGN placeholder "?" to an empty value
+func normalizeTag(value string) string {
+	if value == "?" {
+		return ""
+	}
+	return value
+}
+
+// parseElo converts a rating tag to an integer, returning 0 for "?" or "-"
+func parseElo(value string) int {
+	elo, err := strconv.Atoi(value)
+	if err != nil || elo < 0 {
+		return 0
+	}
+	return elo
+}
+
+// TimeControlCategory classifies a PGN TimeControl tag ("300+3", "40/7200", "-")
+func TimeControlCategory(timeControl string) string {
+	switch timeControl {
+	case "", "?":
+		return TimeControlUnknown
+	case "-":
+		return TimeControlCorrespondence
+	}
+
+	// Multi-period controls ("40/7200:3600") are classified by their first period
+	period := strings.Split(timeControl, ":")[0]
+	if i := strings.Index(period, "/"); i >= 0 {
+		period = period[i+1:]
+	}
+
+	baseStr, incStr, _ := strings.Cut(period, "+")
+	base, err := strconv.Atoi(baseStr)
+	if err != nil {
+		return TimeControlUnknown
+	}
+	increment := 0
+	if incStr != "" {
+		if increment, err = strconv.Atoi(incStr); err != nil {
+			return TimeControlUnknown
+		}
+	}
+
+	switch estimated := base + 40*increment; {
+	case estimated < 180:
+		return TimeControlBullet
+	case estimated < 480:
+		return TimeControlBlitz
+	case estimated < 1500:
+		return TimeControlRapid
+	default:
+		return TimeControlClassical
+	}
+}
+
+// MetadataStats holds distributions of the game metadata stored with each position
+type MetadataStats struct {
+	Outcomes     map[string]int // "win", "draw", "loss" for the side to move, or "unknown"
+	EloBands     map[string]int // Average rating of both players in 200-point bands
+	ECOGroups    map[string]int // ECO volume ("A".."E") or "unknown"
+	TimeControls map[string]int // Time control category (see TimeControlCategory)
+}
+
+// NewMetadataStats creates empty distributions
+func NewMetadataStats() *MetadataStats {
+	return &MetadataStats{
+		Outcomes:     make(map[string]int),
+		EloBands:     make(map[string]int),
+		ECOGroups:    make(map[string]int),
+		TimeControls: make(map[string]int),
+	}
+}
+
+// Add counts one entry in each distribution
+func (s *MetadataStats) Add(entry *DataEntry) {
+	s.Outcomes[outcomeLabel(entry)]++
+	s.EloBands[eloBand(entry.WhiteElo, entry.BlackElo)]++
+	s.ECOGroups[ecoGroup(entry.ECO)]++
+	s.TimeControls[TimeControlCategory(entry.TimeControl)]++
+}
+
+// Fprint writes the distributions as an indented table
+func (s *MetadataStats) Fprint(w io.Writer) {
+	printDistribution(w, "Outcome (side to move)", s.Outcomes)
+	printDistribution(w, "Average Elo", s.EloBands)
+	printDistribution(w, "ECO", s.ECOGroups)
+	printDistribution(w, "Time control", s.TimeControls)
+}
+
+// printDistribution writes one distribution sorted by key
+func printDistribution(w io.Writer, title string, counts map[string]int) {
+	total := 0
+	keys := make([]string, 0, len(counts))
+	for k, n := range counts {
+		keys = append(keys, k)
+		total += n
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %-16s %8d  (%5.1f%%)\n", k, counts[k], 100*float64(counts[k])/float64(total))
+	}
+}
+
+// outcomeLabel names the entry's game result from the side to move's perspective
+func outcomeLabel(entry *DataEntry) string {
+	switch {
+	case !entry.HasOutcome:
+		return "unknown"
+	case entry.Outcome > 0:
+		return "win"
+	case entry.Outcome < 0:
+		return "loss"
+	default:
+		return "draw"
+	}
+}
+
+// eloBand returns the 200-point band of the players' average rating
+func eloBand(whiteElo, blackElo int) string {
+	if whiteElo == 0 || blackElo == 0 {
+		return "unknown"
+	}
+	avg := (whiteElo + blackElo) / 2
+	switch {
+	case avg < 1000:
+		return "<1000"
+	case avg >= 2600:
+		return "2600+"
+	}
+	low := avg / 200 * 200
+	return fmt.Sprintf("%d-%d", low, low+199)
+}
+
+// ecoGroup returns the ECO volume letter
+func ecoGroup(eco string) string {
+	if eco == "" || eco[0] < 'A' || eco[0] > 'E' {
+		return "unknown"
+	}
+	return eco[:1]
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestTimeControlCategory(t *testing.T) {
+	tests := []struct {
+		timeControl string
+		expected    string
+	}{
+		{"60+0", TimeControlBullet},
+		{"120+1", TimeControlBullet},
+		{"180+2", TimeControlBlitz},
+		{"300+0", TimeControlBlitz},
+		{"600+5", TimeControlRapid},
+		{"1800+30", TimeControlClassical},
+		{"40/7200:3600", TimeControlClassical},
+		{"-", TimeControlCorrespondence},
+		{"", TimeControlUnknown},
+		{"?", TimeControlUnknown},
+		{"blitz", TimeControlUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := TimeControlCategory(tt.timeControl); got != tt.expected {
+			t.Errorf("TimeControlCategory(%q) = %s, want %s", tt.timeControl, got, tt.expected)
+		}
+	}
+}
+
+func TestParseGameInfo(t *testing.T) {
+	pgn := `[Event "Rated Blitz game"]
+[WhiteElo "1850"]
+[BlackElo "?"]
+[ECO "B01"]
+[TimeControl "300+3"]
+[Result "1/2-1/2"]
+
+1. e4 d5 1/2-1/2
+`
+	games, err := NewPGNParser("").ParsePGNReader(strings.NewReader(pgn))
+	if err != nil || len(games) != 1 {
+		t.Fatalf("Failed to parse PGN: %v (%d games)", err, len(games))
+	}
+
+	info := ParseGameInfo(games[0])
+	expected := GameInfo{Outcome: chess.Draw, WhiteElo: 1850, BlackElo: 0, ECO: "B01", TimeControl: "300+3"}
+	if info != expected {
+		t.Errorf("ParseGameInfo() = %+v, want %+v", info, expected)
+	}
+
+	entry := &DataEntry{}
+	entry.SetGameInfo(info, chess.Black)
+	if !entry.HasOutcome || entry.Outcome != 0 {
+		t.Errorf("Expected known draw outcome, got %v (known: %v)", entry.Outcome, entry.HasOutcome)
+	}
+}
+
+func TestMetadataStats(t *testing.T) {
+	stats := NewMetadataStats()
+	stats.Add(&DataEntry{HasOutcome: true, Outcome: 1, WhiteElo: 900, BlackElo: 950, ECO: "A00", TimeControl: "60+0"})
+	stats.Add(&DataEntry{HasOutcome: true, Outcome: 0, WhiteElo: 2700, BlackElo: 2650, ECO: "E97"})
+	stats.Add(&DataEntry{WhiteElo: 1500, ECO: "?"})
+
+	tests := []struct {
+		name     string
+		counts   map[string]int
+		key      string
+		expected int
+	}{
+		{"outcome win", stats.Outcomes, "win", 1},
+		{"outcome draw", stats.Outcomes, "draw", 1},
+		{"outcome unknown", stats.Outcomes, "unknown", 1},
+		{"elo low", stats.EloBands, "<1000", 1},
+		{"elo high", stats.EloBands, "2600+", 1},
+		{"elo one side missing", stats.EloBands, "unknown", 1},
+		{"eco A", stats.ECOGroups, "A", 1},
+		{"eco unknown", stats.ECOGroups, "unknown", 1},
+		{"bullet", stats.TimeControls, TimeControlBullet, 1},
+		{"tc unknown", stats.TimeControls, TimeControlUnknown, 2},
+	}
+
+	for _, tt := range tests {
+		if got := tt.counts[tt.key]; got != tt.expected {
+			t.Errorf("%s: count[%q] = %d, want %d", tt.name, tt.key, got, tt.expected)
+		}
+	}
+}
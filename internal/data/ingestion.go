@@ -4,19 +4,23 @@ import (
 	"fmt"
 	"path/filepath"
 	"sync"
-	"sync/atomic"
 )
 
 // IngestionConfig holds configuration for PGN ingestion
 type IngestionConfig struct {
-	PGNPath        string // Path to PGN file or directory
-	DatasetPath    string // Path to output dataset
-	MaxGames       int    // Maximum number of games to process (0 = all)
-	MaxPositions   int    // Maximum positions to extract (0 = all)
-	SkipInvalid    bool   // Skip invalid positions instead of failing
-	BatchSize      int    // Number of entries to batch before writing
-	Verbose        bool   // Print progress information
-	WorkerPoolSize int    // Number of parallel workers (0 = sequential)
+	PGNPath        string      // Path to PGN file (.pgn, .pgn.zst, .pgn.gz or .pgn.bz2)
+	DatasetPath    string      // Path to output dataset
+	MaxGames       int         // Maximum number of games to process (0 = all)
+	MaxPositions   int         // Maximum positions to extract (0 = all)
+	SkipInvalid    bool        // Skip invalid positions instead of failing
+	BatchSize      int         // Number of entries to batch before writing
+	Verbose        bool        // Print progress information
+	WorkerPoolSize int         // Number of parallel workers (0 = sequential)
+	InputChannels  int         // State tensor format: NumChannels or NumExtendedChannels
+	QueueSize      int         // Games read ahead of the dataset writer (0 = 4 per worker)
+	Resume         bool        // Continue from the progress stored in the dataset
+	Filter         *GameFilter // Games and positions to ingest (nil = all)
+	Deduplicate    bool        // Merge repeated positions into one entry with move counts
 }
 
 // DefaultIngestionConfig returns a config with sensible defaults
@@ -30,6 +34,7 @@ func DefaultIngestionConfig(pgnPath, datasetPath string) *IngestionConfig {
 		BatchSize:      100,
 		Verbose:        true,
 		WorkerPoolSize: 4,
+		InputChannels:  DefaultInputChannels,
 	}
 }
 
@@ -57,193 +62,375 @@ func (ing *Ingestor) Close() error {
 	return ing.dataset.Close()
 }
 
-// Ingest processes PGN files and populates the dataset
+// IngestionProgressKey is the dataset metadata key holding IngestionProgress
+const IngestionProgressKey = "ingestion_progress"
+
+// IngestionProgress records how far a PGN file has been ingested. It is
+// written in the same transaction as each batch, so it always points just
+// past the last game whose positions are in the dataset.
+type IngestionProgress struct {
+	Source            string `json:"source"`             // PGN file being ingested
+	GameIndex         int    `json:"game_index"`         // Index of the next game to read
+	ByteOffset        int64  `json:"byte_offset"`        // Uncompressed offset of the next game
+	PositionsIngested int    `json:"positions_ingested"` // Positions written from this file
+	GameEntries       int    `json:"game_entries"`       // Positions of the next game already written, when MaxPositions stopped inside it
+	Complete          bool   `json:"complete"`           // The whole file has been ingested
+}
+
+// IngestionProgress returns the stored ingestion progress, or nil if the
+// dataset has none
+func (ds *Dataset) IngestionProgress() (*IngestionProgress, error) {
+	var progress IngestionProgress
+	found, err := ds.GetMetadata(IngestionProgressKey, &progress)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// ingestJob is a game queued for a worker, numbered in file order
+type ingestJob struct {
+	seq  int
+	game PGNGame
+}
+
+// ingestResult holds the entries a worker extracted from one game
+type ingestResult struct {
+	ingestJob
+	entries           []*DataEntry
+	skipped           int            // Invalid positions (or whole games) skipped
+	rejectedGame      string         // Filter rejecting the whole game, if any
+	rejectedPositions map[string]int // Positions rejected per filter
+	err               error
+}
+
+// Ingest streams games from the PGN file through a pool of workers and writes
+// their positions to the dataset in file order. At most QueueSize games are
+// read ahead of the writer, so memory use does not grow with the file size.
 func (ing *Ingestor) Ingest() (*IngestionStats, error) {
-	stats := &IngestionStats{}
+	stats := &IngestionStats{Metadata: NewMetadataStats(), Rejections: NewRejectionStats()}
 
-	// Parse PGN file
-	parser := NewPGNParser(ing.config.PGNPath)
-	games, err := parser.ParsePGN()
-	if err != nil {
-		return stats, fmt.Errorf("failed to parse PGN: %w", err)
+	if ing.config.Filter != nil {
+		if err := ing.config.Filter.Validate(); err != nil {
+			return stats, fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+	if ing.config.InputChannels == 0 {
+		ing.config.InputChannels = DefaultInputChannels
+	}
+	if !ValidInputChannels(ing.config.InputChannels) {
+		return stats, fmt.Errorf("unsupported input channels: %d", ing.config.InputChannels)
 	}
 
-	stats.TotalGames = len(games)
+	stream, err := OpenPGNStream(ing.config.PGNPath)
+	if err != nil {
+		return stats, fmt.Errorf("failed to open PGN: %w", err)
+	}
+	defer stream.Close()
 
-	if ing.config.Verbose {
-		fmt.Printf("Parsed %d games from %s\n", len(games), filepath.Base(ing.config.PGNPath))
+	progress, err := ing.startProgress(stream)
+	if err != nil {
+		return stats, err
 	}
+	stats.ResumedAtGame = progress.GameIndex
 
-	// Limit games if configured
-	if ing.config.MaxGames > 0 && len(games) > ing.config.MaxGames {
-		games = games[:ing.config.MaxGames]
+	if progress.Complete {
 		if ing.config.Verbose {
-			fmt.Printf("Limited to %d games\n", ing.config.MaxGames)
+			fmt.Printf("%s has already been ingested (%d positions)\n", filepath.Base(ing.config.PGNPath), progress.PositionsIngested)
 		}
+		return stats, nil
+	}
+	if ing.config.Verbose && progress.GameIndex > 0 {
+		fmt.Printf("Resuming %s at game %d\n", filepath.Base(ing.config.PGNPath), progress.GameIndex)
 	}
 
-	// Process games in batches
-	var batchMu sync.Mutex
-	var currentBatch []*DataEntry
-	var positionsProcessed int32
-
-	// Worker function
-	processGame := func(gameIdx int) error {
-		game := games[gameIdx]
-		gameID := fmt.Sprintf("game_%d", gameIdx)
+	workers := ing.config.WorkerPoolSize
+	if workers < 1 {
+		workers = 1
+	}
+	queueSize := ing.config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 4 * workers
+	}
 
-		positions, err := ExtractPositions(game)
-		if err != nil {
-			if ing.config.SkipInvalid {
-				if ing.config.Verbose {
-					fmt.Printf("Skipping game %d: %v\n", gameIdx, err)
-				}
-				atomic.AddInt32(&stats.SkippedPositions, 1)
-				return nil
+	// A token is taken for every game read and returned once the writer has
+	// consumed it, which bounds the games held in memory
+	tokens := make(chan struct{}, queueSize)
+	jobs := make(chan ingestJob, queueSize)
+	results := make(chan ingestResult, queueSize)
+	done := make(chan struct{})
+
+	// Reader: stream games until the end of the file, MaxGames or a stop
+	var readErr error
+	exhausted := false
+	go func() {
+		defer close(jobs)
+		for seq := 0; ing.config.MaxGames <= 0 || seq < ing.config.MaxGames; seq++ {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+			if !stream.Next() {
+				readErr = stream.Err()
+				exhausted = readErr == nil
+				return
+			}
+			jobs <- ingestJob{seq: seq, game: stream.Game()}
+		}
+	}()
+
+	// Workers: convert games to entries
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- ing.processGame(job)
 			}
-			return fmt.Errorf("failed to extract positions from game %d: %w", gameIdx, err)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Writer: reorder results and write them in batches with the progress
+	var batch []*DataEntry
+	var stopErr error
+	stopped := false
+	stop := func() {
+		if !stopped {
+			stopped = true
+			close(done)
+		}
+	}
+	write := func() error {
+		progress.PositionsIngested += len(batch)
+		merged, err := ing.dataset.addBatch(batch, map[string]interface{}{IngestionProgressKey: progress}, ing.config.Deduplicate)
+		if err != nil {
+			return fmt.Errorf("failed to add batch: %w", err)
+		}
+		stats.DuplicatePositions += int32(merged)
+
+		before := stats.PositionsIngested
+		stats.PositionsIngested += int32(len(batch))
+		if ing.config.Verbose && stats.PositionsIngested/1000 > before/1000 {
+			fmt.Printf("Ingested %d positions...\n", stats.PositionsIngested)
 		}
+		batch = nil
+		return nil
+	}
 
-		if len(positions) == 0 {
-			// Skip empty games
-			return nil
+	pending := make(map[int]ingestResult)
+	next := 0
+	positions := 0
+	for result := range results {
+		if stopped {
+			continue
 		}
+		pending[result.seq] = result
 
-		for moveNum, pos := range positions {
-			// Check max positions limit
-			if ing.config.MaxPositions > 0 && int(atomic.LoadInt32(&positionsProcessed)) >= ing.config.MaxPositions {
+		for !stopped {
+			r, ok := pending[next]
+			if !ok {
 				break
 			}
+			delete(pending, next)
+			next++
+			<-tokens
 
-			// Tensorize board
-			tensor, err := TensorizeBoard(pos.Board)
-			if err != nil {
-				if ing.config.SkipInvalid {
-					atomic.AddInt32(&stats.SkippedPositions, 1)
-					continue
-				}
-				return fmt.Errorf("failed to tensorize board: %w", err)
+			if r.err != nil {
+				stopErr = r.err
+				stop()
+				break
 			}
 
-			// Encode move
-			fromSquare, toSquare, err := EncodeMoveLabel(pos.Move)
-			if err != nil {
-				if ing.config.SkipInvalid {
-					atomic.AddInt32(&stats.SkippedPositions, 1)
-					continue
+			stats.TotalGames++
+			stats.SkippedPositions += int32(r.skipped)
+			if r.rejectedGame != "" {
+				stats.Rejections.Games[r.rejectedGame]++
+			}
+			for filter, n := range r.rejectedPositions {
+				stats.Rejections.Positions[filter] += n
+			}
+			// A run stopped inside this game already wrote its first positions
+			written := min(progress.GameEntries, len(r.entries))
+			r.entries = r.entries[written:]
+			progress.GameEntries = 0
+
+			partial := false
+			if ing.config.MaxPositions > 0 && positions+len(r.entries) >= ing.config.MaxPositions {
+				if keep := ing.config.MaxPositions - positions; keep < len(r.entries) {
+					r.entries = r.entries[:keep]
+					progress.GameEntries = written + keep
+					partial = true
 				}
-				return fmt.Errorf("failed to encode move: %w", err)
-			}
-
-			// Create entry
-			entry := &DataEntry{
-				StateTensor: TensorToFlatArray(tensor),
-				FromSquare:  fromSquare,
-				ToSquare:    toSquare,
-				GameID:      gameID,
-				MoveNumber:  moveNum,
-			}
-
-			// Add to batch
-			batchMu.Lock()
-			currentBatch = append(currentBatch, entry)
-			batchLen := len(currentBatch)
-			batchMu.Unlock()
-
-			atomic.AddInt32(&positionsProcessed, 1)
-
-			// Write batch if full
-			if batchLen >= ing.config.BatchSize {
-				batchMu.Lock()
-				if len(currentBatch) >= ing.config.BatchSize {
-					toWrite := currentBatch[:ing.config.BatchSize]
-					currentBatch = currentBatch[ing.config.BatchSize:]
-					batchMu.Unlock()
-
-					if err := ing.dataset.AddBatch(toWrite); err != nil {
-						return fmt.Errorf("failed to add batch: %w", err)
-					}
-					atomic.AddInt32(&stats.PositionsIngested, int32(len(toWrite)))
-
-					if ing.config.Verbose && atomic.LoadInt32(&stats.PositionsIngested)%1000 == 0 {
-						fmt.Printf("Ingested %d positions...\n", atomic.LoadInt32(&stats.PositionsIngested))
-					}
-				} else {
-					batchMu.Unlock()
+				stop()
+			}
+			for _, entry := range r.entries {
+				stats.Metadata.Add(entry)
+			}
+			if len(r.entries) > 0 {
+				stats.GamesProcessed++
+			}
+			positions += len(r.entries)
+			batch = append(batch, r.entries...)
+
+			// Only move past a game once all of its positions are written, so
+			// a resumed run continues inside a game that was cut short
+			if !partial {
+				progress.GameIndex = r.game.Index + 1
+				progress.ByteOffset = r.game.Offset
+			}
+
+			if len(batch) >= ing.config.BatchSize {
+				if err := write(); err != nil {
+					stopErr = err
+					stop()
 				}
 			}
 		}
+	}
+	stats.InvalidGames = stream.Invalid()
 
-		atomic.AddInt32(&stats.GamesProcessed, 1)
-		return nil
+	if stopErr != nil {
+		return stats, stopErr
 	}
 
-	// Process games (sequential or parallel)
-	if ing.config.WorkerPoolSize <= 1 {
-		// Sequential processing
-		for i := range games {
-			if err := processGame(i); err != nil {
-				return stats, err
-			}
-		}
-	} else {
-		// Parallel processing
-		var wg sync.WaitGroup
-		semaphore := make(chan struct{}, ing.config.WorkerPoolSize)
-		errChan := make(chan error, 1)
+	// Write the remaining batch, marking the file complete if it was read to the end
+	progress.Complete = exhausted && !stopped
+	if err := write(); err != nil {
+		return stats, fmt.Errorf("failed to write final batch: %w", err)
+	}
+	if readErr != nil {
+		return stats, readErr
+	}
 
-		for i := range games {
-			wg.Add(1)
-			go func(idx int) {
-				defer wg.Done()
+	if ing.config.Verbose {
+		fmt.Printf("\nIngestion complete:\n")
+		fmt.Printf("  Games processed: %d/%d\n", stats.GamesProcessed, stats.TotalGames)
+		fmt.Printf("  Positions ingested: %d\n", stats.PositionsIngested)
+		fmt.Printf("  Positions skipped: %d\n", stats.SkippedPositions)
+		fmt.Printf("  Unparseable games: %d\n", stats.InvalidGames)
+		if ing.config.Deduplicate {
+			fmt.Printf("  Duplicates merged: %d\n", stats.DuplicatePositions)
+		}
+	}
 
-				semaphore <- struct{}{}
-				defer func() { <-semaphore }()
+	return stats, nil
+}
 
-				if err := processGame(idx); err != nil {
-					select {
-					case errChan <- err:
-					default:
-					}
+// startProgress returns the progress to continue from, positioning the stream
+// after the last ingested game when resuming
+func (ing *Ingestor) startProgress(stream *PGNStream) (*IngestionProgress, error) {
+	if ing.config.Resume {
+		stored, err := ing.dataset.IngestionProgress()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ingestion progress: %w", err)
+		}
+		if stored != nil {
+			if filepath.Base(stored.Source) != filepath.Base(ing.config.PGNPath) {
+				return nil, fmt.Errorf("cannot resume: dataset was being ingested from %s, not %s", stored.Source, ing.config.PGNPath)
+			}
+			if !stored.Complete {
+				if err := stream.SkipTo(stored.ByteOffset, stored.GameIndex); err != nil {
+					return nil, fmt.Errorf("cannot resume: %w", err)
 				}
-			}(i)
+			}
+			return stored, nil
 		}
+	}
 
-		wg.Wait()
-		close(errChan)
+	return &IngestionProgress{Source: ing.config.PGNPath}, nil
+}
 
-		if err := <-errChan; err != nil {
-			return stats, err
-		}
+// processGame extracts the training entries of one game that pass the
+// configured filter
+func (ing *Ingestor) processGame(job ingestJob) ingestResult {
+	result := ingestResult{ingestJob: job}
+	game := job.game
+	gameID := fmt.Sprintf("game_%d", game.Index)
+	info := ParseGameInfo(game.Game)
+	filter := ing.config.Filter
+
+	if result.rejectedGame = filter.RejectGame(game.Game, info); result.rejectedGame != "" {
+		return result
 	}
 
-	// Write remaining batch
-	batchMu.Lock()
-	if len(currentBatch) > 0 {
-		if err := ing.dataset.AddBatch(currentBatch); err != nil {
-			batchMu.Unlock()
-			return stats, fmt.Errorf("failed to write final batch: %w", err)
+	positions, err := ExtractPositions(game.Game)
+	if err != nil {
+		if ing.config.SkipInvalid {
+			if ing.config.Verbose {
+				fmt.Printf("Skipping game %d: %v\n", game.Index, err)
+			}
+			result.skipped = 1
+			return result
 		}
-		atomic.AddInt32(&stats.PositionsIngested, int32(len(currentBatch)))
+		result.err = fmt.Errorf("failed to extract positions from game %d: %w", game.Index, err)
+		return result
 	}
-	batchMu.Unlock()
 
-	stats.PositionsIngested = positionsProcessed
+	result.entries = make([]*DataEntry, 0, len(positions))
+	for moveNum, pos := range positions {
+		if reason := filter.RejectPosition(moveNum, pos.Position.Turn(), info.Outcome); reason != "" {
+			if result.rejectedPositions == nil {
+				result.rejectedPositions = make(map[string]int)
+			}
+			result.rejectedPositions[reason]++
+			continue
+		}
 
-	if ing.config.Verbose {
-		fmt.Printf("\nIngestion complete:\n")
-		fmt.Printf("  Games processed: %d/%d\n", stats.GamesProcessed, stats.TotalGames)
-		fmt.Printf("  Positions ingested: %d\n", stats.PositionsIngested)
-		fmt.Printf("  Positions skipped: %d\n", stats.SkippedPositions)
+		// Tensorize position
+		stateTensor, err := TensorizePosition(pos.Position, ing.config.InputChannels)
+		if err != nil {
+			if ing.config.SkipInvalid {
+				result.skipped++
+				continue
+			}
+			result.err = fmt.Errorf("failed to tensorize board: %w", err)
+			return result
+		}
+
+		// Encode move
+		fromSquare, toSquare, err := EncodeMoveLabel(pos.Move)
+		if err != nil {
+			if ing.config.SkipInvalid {
+				result.skipped++
+				continue
+			}
+			result.err = fmt.Errorf("failed to encode move: %w", err)
+			return result
+		}
+
+		// Create entry
+		entry := &DataEntry{
+			StateTensor: stateTensor,
+			FromSquare:  fromSquare,
+			ToSquare:    toSquare,
+			Promotion:   EncodeMovePromotion(pos.Move),
+			GameID:      gameID,
+			MoveNumber:  moveNum,
+
+			PositionHash: ZobristHash(pos.Position),
+		}
+		entry.SetGameInfo(info, pos.Position.Turn())
+		result.entries = append(result.entries, entry)
 	}
 
-	return stats, nil
+	return result
 }
 
 // IngestionStats contains statistics about the ingestion process
 type IngestionStats struct {
-	TotalGames        int
-	GamesProcessed    int32
-	PositionsIngested int32
-	SkippedPositions  int32
+	TotalGames         int // Games read in this run
+	GamesProcessed     int32
+	PositionsIngested  int32
+	SkippedPositions   int32
+	DuplicatePositions int32           // Positions merged into an existing entry (Deduplicate)
+	InvalidGames       int             // Games that could not be parsed
+	ResumedAtGame      int             // Game index the run started from
+	Metadata           *MetadataStats  // Distributions over the positions written
+	Rejections         *RejectionStats // Games and positions rejected by the filter
 }
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIngestResume(t *testing.T) {
+	dir := t.TempDir()
+	pgnPath := filepath.Join(dir, "games.pgn")
+	if err := os.WriteFile(pgnPath, []byte(streamTestPGN), 0644); err != nil {
+		t.Fatalf("Failed to write PGN: %v", err)
+	}
+
+	config := DefaultIngestionConfig(pgnPath, filepath.Join(dir, "dataset.db"))
+	config.Verbose = false
+	config.BatchSize = 3
+	config.MaxGames = 1
+
+	ingest := func() *IngestionStats {
+		ingestor, err := NewIngestor(config)
+		if err != nil {
+			t.Fatalf("Failed to create ingestor: %v", err)
+		}
+		defer ingestor.Close()
+
+		stats, err := ingestor.Ingest()
+		if err != nil {
+			t.Fatalf("Ingestion failed: %v", err)
+		}
+		return stats
+	}
+
+	// Interrupted run: only the first game (7 plies)
+	if stats := ingest(); stats.PositionsIngested != 7 {
+		t.Fatalf("First run ingested %d positions, want 7", stats.PositionsIngested)
+	}
+
+	// Resumed run picks up after the first game and reaches the end of the file
+	config.MaxGames = 0
+	config.Resume = true
+	stats := ingest()
+	if stats.ResumedAtGame != 1 || stats.PositionsIngested != 2+4 || stats.InvalidGames != 1 {
+		t.Fatalf("Resumed run: %+v", stats)
+	}
+
+	dataset, err := NewDataset(config.DatasetPath)
+	if err != nil {
+		t.Fatalf("Failed to open dataset: %v", err)
+	}
+	defer dataset.Close()
+
+	entries, err := dataset.LoadAll()
+	if err != nil {
+		t.Fatalf("Failed to load entries: %v", err)
+	}
+	if len(entries) != 13 {
+		t.Fatalf("Dataset has %d entries, want 13", len(entries))
+	}
+	if entries[0].GameID != "game_0" || entries[7].GameID != "game_2" || entries[12].GameID != "game_3" {
+		t.Errorf("Unexpected game order: %s, %s, %s", entries[0].GameID, entries[7].GameID, entries[12].GameID)
+	}
+
+	progress, err := dataset.IngestionProgress()
+	if err != nil || progress == nil {
+		t.Fatalf("Failed to read progress: %v", err)
+	}
+	if !progress.Complete || progress.PositionsIngested != 13 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+}
+
+func TestIngestResumeInsideGame(t *testing.T) {
+	dir := t.TempDir()
+	pgnPath := filepath.Join(dir, "games.pgn")
+	if err := os.WriteFile(pgnPath, []byte(streamTestPGN), 0644); err != nil {
+		t.Fatalf("Failed to write PGN: %v", err)
+	}
+
+	ingest := func(datasetPath string, maxPositions int, resume bool) *IngestionStats {
+		config := DefaultIngestionConfig(pgnPath, datasetPath)
+		config.Verbose = false
+		config.BatchSize = 2
+		config.MaxPositions = maxPositions
+		config.Resume = resume
+
+		ingestor, err := NewIngestor(config)
+		if err != nil {
+			t.Fatalf("Failed to create ingestor: %v", err)
+		}
+		defer ingestor.Close()
+
+		stats, err := ingestor.Ingest()
+		if err != nil {
+			t.Fatalf("Ingestion failed: %v", err)
+		}
+		return stats
+	}
+	load := func(path string) []*DataEntry {
+		dataset, err := NewDataset(path)
+		if err != nil {
+			t.Fatalf("Failed to open dataset: %v", err)
+		}
+		defer dataset.Close()
+		entries, err := dataset.LoadAll()
+		if err != nil {
+			t.Fatalf("Failed to load entries: %v", err)
+		}
+		return entries
+	}
+
+	fullPath := filepath.Join(dir, "full.db")
+	ingest(fullPath, 0, false)
+	want := load(fullPath)
+
+	// Two runs stop inside the 7-ply first game, the last one finishes the file
+	path := filepath.Join(dir, "dataset.db")
+	for i, run := range []struct{ maxPositions, ingested int }{{5, 5}, {1, 1}, {0, 1 + 2 + 4}} {
+		stats := ingest(path, run.maxPositions, i > 0)
+		if stats.PositionsIngested != int32(run.ingested) || stats.ResumedAtGame != 0 {
+			t.Fatalf("Run %d: %+v", i, stats)
+		}
+	}
+
+	if got := load(path); !reflect.DeepEqual(got, want) {
+		t.Errorf("Resumed ingestion has %d entries, want the %d of a single run", len(got), len(want))
+	}
+}
+
+func TestIngestFilter(t *testing.T) {
+	dir := t.TempDir()
+	pgnPath := filepath.Join(dir, "games.pgn")
+	if err := os.WriteFile(pgnPath, []byte(streamTestPGN), 0644); err != nil {
+		t.Fatalf("Failed to write PGN: %v", err)
+	}
+
+	config := DefaultIngestionConfig(pgnPath, filepath.Join(dir, "dataset.db"))
+	config.Verbose = false
+	config.Filter = &GameFilter{MinPly: 3, SkipOpeningPlies: 2, WinnerOnly: true}
+
+	ingestor, err := NewIngestor(config)
+	if err != nil {
+		t.Fatalf("Failed to create ingestor: %v", err)
+	}
+	defer ingestor.Close()
+
+	stats, err := ingestor.Ingest()
+	if err != nil {
+		t.Fatalf("Ingestion failed: %v", err)
+	}
+
+	// Game 3 is too short, game 1 (white won, 7 plies) keeps plies 2, 4, 6 and
+	// game 4 (black won, 4 plies) keeps ply 3
+	if stats.PositionsIngested != 4 {
+		t.Errorf("Ingested %d positions, want 4", stats.PositionsIngested)
+	}
+	if stats.Rejections.Games[FilterPly] != 1 {
+		t.Errorf("Rejected games = %v, want 1 by %s", stats.Rejections.Games, FilterPly)
+	}
+	if stats.Rejections.Positions[FilterOpening] != 4 || stats.Rejections.Positions[FilterLoserMove] != 3 {
+		t.Errorf("Rejected positions = %v", stats.Rejections.Positions)
+	}
+}
@@ -0,0 +1,220 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// channelPieces maps state tensor channels back to pieces (inverse of PieceToChannel)
+var channelPieces = [NumChannels]chess.Piece{
+	chess.WhitePawn, chess.WhiteKnight, chess.WhiteBishop, chess.WhiteRook, chess.WhiteQueen, chess.WhiteKing,
+	chess.BlackPawn, chess.BlackKnight, chess.BlackBishop, chess.BlackRook, chess.BlackQueen, chess.BlackKing,
+}
+
+// BoardFromState rebuilds the piece placement of a flat 12- or 19-channel state tensor
+func BoardFromState(state []float32) (*chess.Board, error) {
+	if _, err := InputChannelsForLength(len(state)); err != nil {
+		return nil, err
+	}
+
+	pieces := make(map[chess.Square]chess.Piece)
+	for c, piece := range channelPieces {
+		for rank := 0; rank < BoardSize; rank++ {
+			for file := 0; file < BoardSize; file++ {
+				if state[c*64+rank*8+file] <= 0 {
+					continue
+				}
+				square := chess.Square((7-rank)*8 + file) // Row 0 is the eighth rank
+				if _, taken := pieces[square]; taken {
+					return nil, fmt.Errorf("square %s holds more than one piece", square)
+				}
+				pieces[square] = piece
+			}
+		}
+	}
+
+	return chess.NewBoard(pieces), nil
+}
+
+// AuxStateFromState reads the auxiliary planes of a flat state tensor.
+// 12-channel states carry no auxiliary planes and return DefaultAuxState.
+func AuxStateFromState(state []float32) (AuxState, error) {
+	channels, err := InputChannelsForLength(len(state))
+	if err != nil {
+		return AuxState{}, err
+	}
+	if channels == NumChannels {
+		return DefaultAuxState(), nil
+	}
+
+	plane := func(channel int) []float32 {
+		return state[channel*64 : (channel+1)*64]
+	}
+
+	aux := AuxState{
+		WhiteToMove:   plane(SideToMoveChannel)[0] > 0.5,
+		EnPassantFile: -1,
+		HalfmoveClock: int(math.Round(float64(plane(HalfmoveClockChannel)[0]) * 100)),
+	}
+
+	castling := ""
+	for _, right := range []struct {
+		channel int
+		symbol  string
+	}{
+		{WhiteKingsideChannel, "K"},
+		{WhiteQueensideChannel, "Q"},
+		{BlackKingsideChannel, "k"},
+		{BlackQueensideChannel, "q"},
+	} {
+		if plane(right.channel)[0] > 0.5 {
+			castling += right.symbol
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	aux.Castling = castling
+
+	for file := 0; file < BoardSize; file++ {
+		if plane(EnPassantChannel)[file] > 0.5 {
+			aux.EnPassantFile = file
+			break
+		}
+	}
+
+	return aux, nil
+}
+
+// PositionFromState rebuilds a position from a flat state tensor so legal
+// moves can be generated for it. 12-channel states are read with
+// DefaultAuxState (white to move, no castling or en-passant rights).
+// Castling rights whose king or rook has left its home square are dropped.
+func PositionFromState(state []float32) (*chess.Position, error) {
+	board, err := BoardFromState(state)
+	if err != nil {
+		return nil, err
+	}
+	aux, err := AuxStateFromState(state)
+	if err != nil {
+		return nil, err
+	}
+	return NewPosition(board, aux)
+}
+
+// NewPosition combines a piece placement with the auxiliary state into a position
+func NewPosition(board *chess.Board, aux AuxState) (*chess.Position, error) {
+	turn, epRank := "w", "6"
+	if !aux.WhiteToMove {
+		turn, epRank = "b", "3"
+	}
+
+	enPassant := "-"
+	if aux.EnPassantFile >= 0 && aux.EnPassantFile < BoardSize {
+		enPassant = string(rune('a'+aux.EnPassantFile)) + epRank
+	}
+
+	fen := fmt.Sprintf("%s %s %s %s %d 1", board.String(), turn,
+		castlingForBoard(board, aux.Castling), enPassant, aux.HalfmoveClock)
+
+	var pos chess.Position
+	if err := pos.UnmarshalText([]byte(fen)); err != nil {
+		return nil, fmt.Errorf("invalid position %q: %w", fen, err)
+	}
+	return &pos, nil
+}
+
+// castlingForBoard keeps the castling rights whose king and rook are still on
+// their home squares, so move generation never castles with missing pieces
+func castlingForBoard(board *chess.Board, castling string) string {
+	kept := ""
+	for _, right := range []struct {
+		symbol     string
+		king, rook chess.Square
+		color      chess.Color
+	}{
+		{"K", chess.E1, chess.H1, chess.White},
+		{"Q", chess.E1, chess.A1, chess.White},
+		{"k", chess.E8, chess.H8, chess.Black},
+		{"q", chess.E8, chess.A8, chess.Black},
+	} {
+		if !strings.Contains(castling, right.symbol) {
+			continue
+		}
+		king, rook := board.Piece(right.king), board.Piece(right.rook)
+		if king.Type() == chess.King && king.Color() == right.color &&
+			rook.Type() == chess.Rook && rook.Color() == right.color {
+			kept += right.symbol
+		}
+	}
+	if kept == "" {
+		return "-"
+	}
+	return kept
+}
+
+// LegalMoveIndices returns the policy indices of the position's legal moves
+// under the given encoding. Under MoveEncodingFromTo all promotions of a pawn
+// share one index, which is listed once.
+func LegalMoveIndices(pos *chess.Position, encoding MoveEncoding) []int {
+	moves := pos.ValidMoves()
+	indices := make([]int, 0, len(moves))
+	seen := make(map[int]bool, len(moves))
+	for _, m := range moves {
+		index, err := encoding.EncodeMoveIndex(int(m.S1()), int(m.S2()), m.Promo())
+		if err != nil || seen[index] {
+			continue
+		}
+		seen[index] = true
+		indices = append(indices, index)
+	}
+	return indices
+}
+
+// LegalMoveMask returns a policy-sized mask that is true at the indices of
+// the position's legal moves
+func LegalMoveMask(pos *chess.Position, encoding MoveEncoding) []bool {
+	mask := make([]bool, encoding.Size())
+	for _, index := range LegalMoveIndices(pos, encoding) {
+		mask[index] = true
+	}
+	return mask
+}
+
+// StateLegalMoveIndices returns the policy indices of the legal moves of a
+// flat state tensor. Piece planes alone do not record the side to move or
+// castling rights, so for 12-channel states the legal moves of either side
+// are returned, castling wherever the king and rook are on their home squares.
+func StateLegalMoveIndices(state []float32, encoding MoveEncoding) ([]int, error) {
+	channels, err := InputChannelsForLength(len(state))
+	if err != nil {
+		return nil, err
+	}
+	if channels != NumChannels {
+		pos, err := PositionFromState(state)
+		if err != nil {
+			return nil, err
+		}
+		return LegalMoveIndices(pos, encoding), nil
+	}
+
+	board, err := BoardFromState(state)
+	if err != nil {
+		return nil, err
+	}
+	var indices []int
+	for _, whiteToMove := range []bool{true, false} {
+		aux := DefaultAuxState()
+		aux.WhiteToMove = whiteToMove
+		aux.Castling = "KQkq" // NewPosition drops the rights the board rules out
+		pos, err := NewPosition(board, aux)
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, LegalMoveIndices(pos, encoding)...)
+	}
+	return indices, nil
+}
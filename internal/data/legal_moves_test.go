@@ -0,0 +1,118 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestPositionFromState(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want string // FEN without the move counters
+	}{
+		{"starting position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", ""},
+		{"black to move with en passant", "rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKB1R b Kq e3 7 3", ""},
+		{"castling right without rook", "4k2r/8/8/8/8/8/8/4K2R w Kq - 0 1", "4k2r/8/8/8/8/8/8/4K2R w K -"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fen, err := chess.FEN(tt.fen)
+			if err != nil {
+				t.Fatalf("Failed to parse FEN: %v", err)
+			}
+			state, err := TensorizePosition(chess.NewGame(fen).Position(), NumExtendedChannels)
+			if err != nil {
+				t.Fatalf("Failed to tensorize position: %v", err)
+			}
+
+			pos, err := PositionFromState(state)
+			if err != nil {
+				t.Fatalf("Failed to rebuild position: %v", err)
+			}
+
+			want := tt.want
+			if want == "" {
+				want = strings.Join(strings.Fields(tt.fen)[:4], " ")
+			}
+			if got := strings.Join(strings.Fields(pos.String())[:4], " "); got != want {
+				t.Errorf("Rebuilt position %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestStateLegalMoveIndices(t *testing.T) {
+	start := chess.StartingPosition()
+
+	extended, err := TensorizePosition(start, NumExtendedChannels)
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	indices, err := StateLegalMoveIndices(extended, DefaultMoveEncoding)
+	if err != nil {
+		t.Fatalf("Failed to generate legal moves: %v", err)
+	}
+	if len(indices) != 20 {
+		t.Errorf("Starting position has %d legal moves, want 20", len(indices))
+	}
+
+	// Piece planes alone allow either side's moves
+	pieces, err := TensorizePosition(start, NumChannels)
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	if indices, err = StateLegalMoveIndices(pieces, DefaultMoveEncoding); err != nil || len(indices) != 40 {
+		t.Errorf("12-channel starting position has %d legal moves (err %v), want 40", len(indices), err)
+	}
+
+	// Castling is allowed wherever the king and rook are on their home squares
+	fen, err := chess.FEN("r3k2r/8/8/8/8/8/7R/R3K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	if pieces, err = TensorizePosition(chess.NewGame(fen).Position(), NumChannels); err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	if indices, err = StateLegalMoveIndices(pieces, DefaultMoveEncoding); err != nil {
+		t.Fatalf("Failed to generate legal moves: %v", err)
+	}
+	legal := make(map[int]bool, len(indices))
+	for _, index := range indices {
+		legal[index] = true
+	}
+	for _, castle := range []struct {
+		from, to chess.Square
+		want     bool
+	}{
+		{chess.E1, chess.C1, true},
+		{chess.E1, chess.G1, false},
+		{chess.E8, chess.C8, true},
+		{chess.E8, chess.G8, true},
+	} {
+		if got := legal[int(castle.from)*64+int(castle.to)]; got != castle.want {
+			t.Errorf("Castling %s%s legal = %v, want %v", castle.from, castle.to, got, castle.want)
+		}
+	}
+
+	// Promotions collapse onto one index under the from/to encoding
+	fen, err = chess.FEN("8/4P3/8/8/8/8/k7/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	pos := chess.NewGame(fen).Position()
+	if got, want := len(LegalMoveIndices(pos, MoveEncodingUnderpromotion)), len(pos.ValidMoves()); got != want {
+		t.Errorf("Underpromotion encoding has %d legal indices, want %d", got, want)
+	}
+	if got, want := len(LegalMoveIndices(pos, MoveEncodingFromTo)), len(pos.ValidMoves())-3; got != want {
+		t.Errorf("From/to encoding has %d legal indices, want %d", got, want)
+	}
+
+	mask := LegalMoveMask(pos, MoveEncodingUnderpromotion)
+	if !mask[int(chess.E7)*64+int(chess.E8)] {
+		t.Error("Queen promotion e7e8 missing from the legal move mask")
+	}
+}
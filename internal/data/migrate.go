@@ -0,0 +1,137 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// migrateBatchSize is the number of records written per transaction while
+// migrating, bounding the memory of a migration of a large dataset
+const migrateBatchSize = 10000
+
+// MigrationStats reports the sizes of a dataset before and after MigrateDataset
+type MigrationStats struct {
+	Entries           int
+	Format            RecordFormat // Format the entries were converted to
+	RecordBytesBefore int64        // Total size of the entry records
+	RecordBytesAfter  int64
+	FileSizeBefore    int64
+	FileSizeAfter     int64
+}
+
+// RecordReduction returns the fraction by which the entry records shrank
+func (s *MigrationStats) RecordReduction() float64 {
+	return reduction(s.RecordBytesBefore, s.RecordBytesAfter)
+}
+
+// FileReduction returns the fraction by which the dataset file shrank
+func (s *MigrationStats) FileReduction() float64 {
+	return reduction(s.FileSizeBefore, s.FileSizeAfter)
+}
+
+func reduction(before, after int64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return 1 - float64(after)/float64(before)
+}
+
+// MigrateDataset writes a copy of the dataset at srcPath to dstPath with every
+// entry converted to format. Keys are kept, so the position index stays valid,
+// and metadata is copied as is. dstPath must not exist; the source is only
+// read.
+func MigrateDataset(srcPath, dstPath string, format RecordFormat) (*MigrationStats, error) {
+	if !format.Valid() {
+		return nil, fmt.Errorf("unknown record format %q", format)
+	}
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		return nil, fmt.Errorf("%s already exists", dstPath)
+	}
+
+	src, err := bolt.Open(srcPath, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := bolt.Open(dstPath, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dstPath, err)
+	}
+
+	stats := &MigrationStats{Format: format, FileSizeBefore: srcInfo.Size()}
+	err = src.View(func(srcTx *bolt.Tx) error {
+		return srcTx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			return migrateBucket(dst, name, bucket, string(name) == DefaultBucketName, stats)
+		})
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+		return nil, fmt.Errorf("failed to migrate dataset: %w", err)
+	}
+
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		return nil, err
+	}
+	stats.FileSizeAfter = dstInfo.Size()
+	return stats, nil
+}
+
+// migrateBucket copies a bucket into dst in batches, converting the records
+// of the entry bucket to stats.Format
+func migrateBucket(dst *bolt.DB, name []byte, bucket *bolt.Bucket, entries bool, stats *MigrationStats) error {
+	cursor := bucket.Cursor()
+	k, v := cursor.First()
+	for {
+		err := dst.Update(func(tx *bolt.Tx) error {
+			out, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			// Keys arrive in order, so pages can be filled completely
+			out.FillPercent = 1.0
+			// New entries must not reuse the keys of copied ones
+			if err := out.SetSequence(bucket.Sequence()); err != nil {
+				return err
+			}
+
+			for n := 0; k != nil && n < migrateBatchSize; n++ {
+				if v == nil {
+					return fmt.Errorf("bucket %s: nested buckets are not supported", name)
+				}
+				value := v
+				if entries {
+					entry, err := decodeEntry(v)
+					if err != nil {
+						return fmt.Errorf("entry %s: %w", k, err)
+					}
+					if value, err = encodeEntry(entry, stats.Format); err != nil {
+						return err
+					}
+					stats.Entries++
+					stats.RecordBytesBefore += int64(len(v))
+					stats.RecordBytesAfter += int64(len(value))
+				}
+				if err := out.Put(k, value); err != nil {
+					return err
+				}
+				k, v = cursor.Next()
+			}
+			return nil
+		})
+		if err != nil || k == nil {
+			return err
+		}
+	}
+}
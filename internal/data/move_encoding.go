@@ -0,0 +1,272 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// MoveEncoding identifies the layout of the policy vector a model predicts.
+// Encodings are versioned so checkpoints can record which one they were trained with.
+type MoveEncoding string
+
+const (
+	// MoveEncodingFromTo is the original 64x64 from/to layout (4096 slots).
+	// Promotions cannot be distinguished and are assumed to be queen promotions.
+	MoveEncodingFromTo MoveEncoding = "fromto-4096"
+
+	// MoveEncodingUnderpromotion extends the from/to layout with 144 extra slots
+	// for knight, bishop and rook promotions (4240 slots). Queen promotions keep
+	// their plain from/to index, so the first 4096 slots match MoveEncodingFromTo.
+	MoveEncodingUnderpromotion MoveEncoding = "fromto-underpromo-4240"
+
+	// DefaultMoveEncoding is used for newly created models
+	DefaultMoveEncoding = MoveEncodingUnderpromotion
+)
+
+const (
+	// FromToPolicySize is the number of plain from/to move slots
+	FromToPolicySize = 64 * 64
+
+	// underpromotionSlots = 2 sides × 8 files × 3 directions × 3 pieces
+	underpromotionSlots = 2 * 8 * 3 * 3
+)
+
+// underpromotionPieces lists the pieces with dedicated policy slots, in slot order
+var underpromotionPieces = [3]chess.PieceType{chess.Knight, chess.Bishop, chess.Rook}
+
+// Size returns the length of the policy vector for this encoding
+func (e MoveEncoding) Size() int {
+	switch e {
+	case MoveEncodingUnderpromotion:
+		return FromToPolicySize + underpromotionSlots
+	default:
+		return FromToPolicySize
+	}
+}
+
+// Valid reports whether the encoding is known
+func (e MoveEncoding) Valid() bool {
+	return e == MoveEncodingFromTo || e == MoveEncodingUnderpromotion
+}
+
+// MoveEncodingForSize returns the encoding whose policy vector has the given length
+func MoveEncodingForSize(size int) (MoveEncoding, error) {
+	switch size {
+	case MoveEncodingFromTo.Size():
+		return MoveEncodingFromTo, nil
+	case MoveEncodingUnderpromotion.Size():
+		return MoveEncodingUnderpromotion, nil
+	default:
+		return "", fmt.Errorf("no move encoding with policy size %d", size)
+	}
+}
+
+// EncodeMoveIndex maps a move to its policy index under this encoding.
+// promo is chess.NoPieceType for non-promotions. Queen promotions, and all
+// promotions under MoveEncodingFromTo, use the plain from*64+to index.
+func (e MoveEncoding) EncodeMoveIndex(fromSquare, toSquare int, promo chess.PieceType) (int, error) {
+	if fromSquare < 0 || fromSquare >= 64 || toSquare < 0 || toSquare >= 64 {
+		return 0, fmt.Errorf("invalid squares: from=%d, to=%d", fromSquare, toSquare)
+	}
+
+	if e != MoveEncodingUnderpromotion || promo == chess.NoPieceType || promo == chess.Queen {
+		return fromSquare*64 + toSquare, nil
+	}
+
+	pieceIdx := -1
+	for i, p := range underpromotionPieces {
+		if p == promo {
+			pieceIdx = i
+		}
+	}
+	if pieceIdx < 0 {
+		return 0, fmt.Errorf("invalid promotion piece: %v", promo)
+	}
+
+	fromRank, fromFile := fromSquare/8, fromSquare%8
+	toRank, toFile := toSquare/8, toSquare%8
+
+	var side int
+	switch {
+	case fromRank == 6 && toRank == 7:
+		side = 0 // White
+	case fromRank == 1 && toRank == 0:
+		side = 1 // Black
+	default:
+		return 0, fmt.Errorf("not a promotion move: from=%d, to=%d", fromSquare, toSquare)
+	}
+
+	dir := toFile - fromFile + 1 // 0 = capture left, 1 = push, 2 = capture right
+	if dir < 0 || dir > 2 {
+		return 0, fmt.Errorf("not a promotion move: from=%d, to=%d", fromSquare, toSquare)
+	}
+
+	return FromToPolicySize + ((side*8+fromFile)*3+dir)*3 + pieceIdx, nil
+}
+
+// DecodeMoveIndex converts a policy index back to (from, to, promotion).
+// Plain from/to indices decode with chess.NoPieceType; callers that need a
+// playable move should use MoveFromIndex to resolve queen promotions.
+func DecodeMoveIndex(index int) (int, int, chess.PieceType, error) {
+	if index < 0 || index >= MoveEncodingUnderpromotion.Size() {
+		return 0, 0, chess.NoPieceType, fmt.Errorf("invalid move index: %d", index)
+	}
+
+	if index < FromToPolicySize {
+		return index / 64, index % 64, chess.NoPieceType, nil
+	}
+
+	slot := index - FromToPolicySize
+	pieceIdx := slot % 3
+	dir := (slot / 3) % 3
+	fromFile := (slot / 9) % 8
+	side := slot / 72
+
+	fromRank, toRank := 6, 7
+	if side == 1 {
+		fromRank, toRank = 1, 0
+	}
+
+	toFile := fromFile + dir - 1
+	if toFile < 0 || toFile > 7 {
+		return 0, 0, chess.NoPieceType, fmt.Errorf("move index %d leaves the board", index)
+	}
+
+	return fromRank*8 + fromFile, toRank*8 + toFile, underpromotionPieces[pieceIdx], nil
+}
+
+// MoveFromIndex resolves a policy index to a legal move in the given position.
+// A plain from/to index for a pawn reaching the last rank resolves to the queen promotion.
+func MoveFromIndex(pos *chess.Position, index int) (*chess.Move, error) {
+	if pos == nil {
+		return nil, fmt.Errorf("position is nil")
+	}
+
+	from, to, promo, err := DecodeMoveIndex(index)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range pos.ValidMoves() {
+		if int(m.S1()) != from || int(m.S2()) != to {
+			continue
+		}
+		if m.Promo() == promo || (promo == chess.NoPieceType && m.Promo() == chess.Queen) {
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("move index %d (%s) is not legal in this position", index, MoveIndexToUCI(index))
+}
+
+// EncodeMovePromotion returns the promotion piece of a move as a UCI suffix ("", "q", "r", "b", "n")
+func EncodeMovePromotion(move *chess.Move) string {
+	if move == nil {
+		return ""
+	}
+	return PromotionToString(move.Promo())
+}
+
+// PromotionToString converts a promotion piece type to its UCI suffix
+func PromotionToString(promo chess.PieceType) string {
+	switch promo {
+	case chess.Queen:
+		return "q"
+	case chess.Rook:
+		return "r"
+	case chess.Bishop:
+		return "b"
+	case chess.Knight:
+		return "n"
+	default:
+		return ""
+	}
+}
+
+// ParsePromotion converts a UCI promotion suffix to a piece type
+func ParsePromotion(s string) (chess.PieceType, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return chess.NoPieceType, nil
+	case "q":
+		return chess.Queen, nil
+	case "r":
+		return chess.Rook, nil
+	case "b":
+		return chess.Bishop, nil
+	case "n":
+		return chess.Knight, nil
+	default:
+		return chess.NoPieceType, fmt.Errorf("invalid promotion piece: %q", s)
+	}
+}
+
+// MoveIndexToUCI formats a policy index in UCI notation (e.g. "e2e4", "e7e8n").
+// A plain from/to index carries no promotion piece, so a queen promotion is
+// formatted as "e7e8"; callers holding a position should resolve the index
+// with MoveFromIndex, or BoardMoveUCI with only the piece placement.
+func MoveIndexToUCI(index int) string {
+	from, to, promo, err := DecodeMoveIndex(index)
+	if err != nil {
+		return "????"
+	}
+	return squareName(from) + squareName(to) + PromotionToString(promo)
+}
+
+// BoardMoveUCI formats a policy index in UCI notation for a piece placement.
+// A plain from/to index that moves a pawn onto the last rank is the queen
+// promotion and gets "q".
+func BoardMoveUCI(board *chess.Board, index int) string {
+	uci := MoveIndexToUCI(index)
+	from, to, promo, err := DecodeMoveIndex(index)
+	if err != nil || promo != chess.NoPieceType || board == nil {
+		return uci
+	}
+	if board.Piece(chess.Square(from)).Type() == chess.Pawn && (to/8 == 7 || to/8 == 0) {
+		uci += "q"
+	}
+	return uci
+}
+
+// ParseUCIMove parses UCI move text (e.g. "e2e4", "e7e8n") into squares and promotion
+func ParseUCIMove(move string) (int, int, chess.PieceType, error) {
+	if len(move) != 4 && len(move) != 5 {
+		return 0, 0, chess.NoPieceType, fmt.Errorf("invalid move format: %s", move)
+	}
+
+	from, err := parseSquareName(move[0:2])
+	if err != nil {
+		return 0, 0, chess.NoPieceType, fmt.Errorf("invalid move coordinates: %s", move)
+	}
+	to, err := parseSquareName(move[2:4])
+	if err != nil {
+		return 0, 0, chess.NoPieceType, fmt.Errorf("invalid move coordinates: %s", move)
+	}
+
+	promo, err := ParsePromotion(move[4:])
+	if err != nil {
+		return 0, 0, chess.NoPieceType, err
+	}
+
+	return from, to, promo, nil
+}
+
+// squareName converts a square index (a1 = 0) to algebraic notation
+func squareName(square int) string {
+	return fmt.Sprintf("%c%d", 'a'+square%8, square/8+1)
+}
+
+// parseSquareName converts algebraic notation to a square index (a1 = 0)
+func parseSquareName(name string) (int, error) {
+	if len(name) != 2 {
+		return 0, fmt.Errorf("invalid square: %s", name)
+	}
+	file := int(name[0] - 'a')
+	rank := int(name[1] - '1')
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return 0, fmt.Errorf("invalid square: %s", name)
+	}
+	return rank*8 + file, nil
+}
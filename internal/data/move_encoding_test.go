@@ -0,0 +1,157 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestMoveEncodingSize(t *testing.T) {
+	if MoveEncodingFromTo.Size() != 4096 {
+		t.Errorf("MoveEncodingFromTo.Size() = %d, want 4096", MoveEncodingFromTo.Size())
+	}
+	if MoveEncodingUnderpromotion.Size() != 4240 {
+		t.Errorf("MoveEncodingUnderpromotion.Size() = %d, want 4240", MoveEncodingUnderpromotion.Size())
+	}
+
+	for _, enc := range []MoveEncoding{MoveEncodingFromTo, MoveEncodingUnderpromotion} {
+		got, err := MoveEncodingForSize(enc.Size())
+		if err != nil || got != enc {
+			t.Errorf("MoveEncodingForSize(%d) = %q, %v; want %q", enc.Size(), got, err, enc)
+		}
+	}
+
+	if _, err := MoveEncodingForSize(100); err == nil {
+		t.Error("Expected error for unknown policy size")
+	}
+}
+
+func TestMoveIndexRoundTrip(t *testing.T) {
+	tests := []struct {
+		uci      string
+		encoding MoveEncoding
+		expected string // Decoded UCI
+	}{
+		{"e2e4", MoveEncodingUnderpromotion, "e2e4"},
+		{"e7e8q", MoveEncodingUnderpromotion, "e7e8"},
+		{"e7e8n", MoveEncodingUnderpromotion, "e7e8n"},
+		{"a7b8b", MoveEncodingUnderpromotion, "a7b8b"},
+		{"h2g1r", MoveEncodingUnderpromotion, "h2g1r"},
+		{"e7e8n", MoveEncodingFromTo, "e7e8"},
+	}
+
+	for _, tt := range tests {
+		from, to, promo, err := ParseUCIMove(tt.uci)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tt.uci, err)
+		}
+
+		index, err := tt.encoding.EncodeMoveIndex(from, to, promo)
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", tt.uci, err)
+		}
+		if index >= tt.encoding.Size() {
+			t.Errorf("%s: index %d out of range for %s", tt.uci, index, tt.encoding)
+		}
+
+		if got := MoveIndexToUCI(index); got != tt.expected {
+			t.Errorf("MoveIndexToUCI(%d) = %s, want %s", index, got, tt.expected)
+		}
+	}
+}
+
+func TestUnderpromotionIndicesUnique(t *testing.T) {
+	seen := make(map[int]bool)
+	for index := FromToPolicySize; index < MoveEncodingUnderpromotion.Size(); index++ {
+		from, to, promo, err := DecodeMoveIndex(index)
+		if err != nil {
+			continue // Captures off the board edge
+		}
+
+		encoded, err := MoveEncodingUnderpromotion.EncodeMoveIndex(from, to, promo)
+		if err != nil {
+			t.Fatalf("Failed to re-encode index %d: %v", index, err)
+		}
+		if encoded != index {
+			t.Errorf("Index %d re-encoded as %d", index, encoded)
+		}
+		if seen[encoded] {
+			t.Errorf("Duplicate index %d", encoded)
+		}
+		seen[encoded] = true
+	}
+
+	// 2 sides × (8 pushes + 14 captures) × 3 pieces
+	if len(seen) != 132 {
+		t.Errorf("Expected 132 reachable underpromotion slots, got %d", len(seen))
+	}
+}
+
+func TestMoveFromIndex(t *testing.T) {
+	fen, err := chess.FEN("8/4P3/8/8/8/8/k7/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	pos := chess.NewGame(fen).Position()
+
+	from, to, _, _ := ParseUCIMove("e7e8")
+
+	// Plain from/to index resolves to the queen promotion
+	move, err := MoveFromIndex(pos, from*64+to)
+	if err != nil {
+		t.Fatalf("Failed to resolve move: %v", err)
+	}
+	if move.Promo() != chess.Queen {
+		t.Errorf("Expected queen promotion, got %v", move.Promo())
+	}
+
+	index, err := MoveEncodingUnderpromotion.EncodeMoveIndex(from, to, chess.Knight)
+	if err != nil {
+		t.Fatalf("Failed to encode underpromotion: %v", err)
+	}
+	move, err = MoveFromIndex(pos, index)
+	if err != nil {
+		t.Fatalf("Failed to resolve underpromotion: %v", err)
+	}
+	if move.Promo() != chess.Knight {
+		t.Errorf("Expected knight promotion, got %v", move.Promo())
+	}
+
+	// e2e4 is not legal here
+	if _, err := MoveFromIndex(pos, 12*64+28); err == nil {
+		t.Error("Expected error for illegal move")
+	}
+}
+
+func TestBoardMoveUCI(t *testing.T) {
+	// Pawns on e7 and c2 next to a white rook on d7 and the black king on b2
+	fen, err := chess.FEN("7k/3RP3/8/8/8/8/1kp5/7K b - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	board := chess.NewGame(fen).Position().Board()
+
+	knight, _ := MoveEncodingUnderpromotion.EncodeMoveIndex(52, 60, chess.Knight)
+	tests := []struct {
+		uci      string
+		index    int
+		expected string
+	}{
+		{"e7e8", 52*64 + 60, "e7e8q"},
+		{"c2c1", 10*64 + 2, "c2c1q"},
+		{"e7e8n", knight, "e7e8n"},
+		// Other pieces reaching the last rank do not promote
+		{"d7d8", 51*64 + 59, "d7d8"},
+		{"d7e8", 51*64 + 60, "d7e8"},
+		{"b2b1", 9*64 + 1, "b2b1"},
+	}
+
+	for _, tt := range tests {
+		if got := BoardMoveUCI(board, tt.index); got != tt.expected {
+			t.Errorf("BoardMoveUCI(%s) = %s, want %s", tt.uci, got, tt.expected)
+		}
+		if got := MoveIndexToUCI(tt.index); got != tt.uci {
+			t.Errorf("MoveIndexToUCI(%s) = %s, want the plain move", tt.uci, got)
+		}
+	}
+}
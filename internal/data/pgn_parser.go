@@ -19,46 +19,40 @@ func NewPGNParser(filepath string) *PGNParser {
 	}
 }
 
+// ParsePGN reads all games from the parser's file into memory. Large
+// databases should be read game by game with OpenPGNStream instead.
 func (p *PGNParser) ParsePGN() ([]*chess.Game, error) {
-	file, err := os.Open(p.filepath)
+	stream, err := OpenPGNStream(p.filepath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open PGN file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	defer stream.Close()
 
-	return p.ParsePGNReader(file)
+	return collectGames(stream)
 }
 
 func (p *PGNParser) ParsePGNReader(reader io.Reader) ([]*chess.Game, error) {
-	var games []*chess.Game
+	return collectGames(NewPGNStream(reader))
+}
 
-	scanner := chess.NewScanner(reader)
-	gameCount := 0
+// collectGames reads the remaining games of a stream, dropping games without moves
+func collectGames(stream *PGNStream) ([]*chess.Game, error) {
+	var games []*chess.Game
 
-	for scanner.Scan() {
-		gameCount++
-		game := scanner.Next()
-		if game != nil {
-			// Validate the game has moves
-			if len(game.Moves()) > 0 {
-				games = append(games, game)
-			}
+	for stream.Next() {
+		// Validate the game has moves
+		if game := stream.Game().Game; len(game.Moves()) > 0 {
+			games = append(games, game)
 		}
 	}
+	if err := stream.Err(); err != nil {
+		return games, err
+	}
 
-	// EOF is expected at end of file, not an error
-	// Be very lenient with parsing errors - extract what we can
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		// If we got some games, return them despite the error
-		if len(games) > 0 {
-			fmt.Printf("Warning: PGN parsing stopped at game %d due to errors\n", gameCount)
-			fmt.Printf("Successfully extracted %d valid games\n", len(games))
-			return games, nil
-		}
-		// Even if we got no games, it might just be a bad format
-		// Return empty list instead of failing
-		fmt.Printf("Warning: Could not parse any games from PGN (error at game %d)\n", gameCount)
-		return games, nil // Return empty list, not error
+	// Be lenient with parsing errors - extract what we can
+	if stream.Invalid() > 0 {
+		fmt.Printf("Warning: skipped %d games that could not be parsed\n", stream.Invalid())
+		fmt.Printf("Successfully extracted %d valid games\n", len(games))
 	}
 
 	return games, nil
@@ -84,6 +78,9 @@ func ExtractPositions(game *chess.Game) ([]*ChessPosition, error) {
 		return positions, nil
 	}
 
+	// Game result from the PGN, used as the value target
+	outcome := GameOutcome(game)
+
 	// Replay the game to get all positions
 	tempGame := chess.NewGame()
 	for i, move := range moves {
@@ -91,9 +88,13 @@ func ExtractPositions(game *chess.Game) ([]*ChessPosition, error) {
 		pos := tempGame.Position()
 
 		// Store the position and move
+		value, hasOutcome := OutcomeValue(outcome, pos.Turn())
 		positions = append(positions, &ChessPosition{
-			Board: pos.Board(),
-			Move:  move,
+			Board:      pos.Board(),
+			Position:   pos,
+			Move:       move,
+			Outcome:    value,
+			HasOutcome: hasOutcome,
 		})
 
 		// Apply the move
@@ -112,8 +113,49 @@ func ExtractPositions(game *chess.Game) ([]*ChessPosition, error) {
 
 // ChessPosition represents a chess position and the move played from it
 type ChessPosition struct {
-	Board *chess.Board
-	Move  *chess.Move
+	Board      *chess.Board
+	Position   *chess.Position // Full position (side to move, castling, en passant)
+	Move       *chess.Move
+	Outcome    float32 // Game result for the side to move: 1 win, 0 draw, -1 loss
+	HasOutcome bool    // False if the game has no result
+}
+
+// GameOutcome returns the result of a game, falling back to the PGN Result
+// header when the move text does not end with a result token
+func GameOutcome(game *chess.Game) chess.Outcome {
+	if game == nil {
+		return chess.NoOutcome
+	}
+	if outcome := game.Outcome(); outcome != chess.NoOutcome {
+		return outcome
+	}
+	if tag := game.GetTagPair("Result"); tag != nil {
+		switch outcome := chess.Outcome(strings.TrimSpace(tag.Value)); outcome {
+		case chess.WhiteWon, chess.BlackWon, chess.Draw:
+			return outcome
+		}
+	}
+	return chess.NoOutcome
+}
+
+// OutcomeValue converts a game result to a value target from the perspective
+// of the given side to move. It returns false for games without a result.
+func OutcomeValue(outcome chess.Outcome, turn chess.Color) (float32, bool) {
+	var white float32
+	switch outcome {
+	case chess.WhiteWon:
+		white = 1
+	case chess.BlackWon:
+		white = -1
+	case chess.Draw:
+		white = 0
+	default:
+		return 0, false
+	}
+	if turn == chess.Black {
+		return -white, true
+	}
+	return white, true
 }
 
 // ValidatePGN checks if a PGN file is valid without fully parsing it
@@ -65,6 +65,56 @@ func TestExtractPositions(t *testing.T) {
 	}
 }
 
+func TestExtractPositionsOutcome(t *testing.T) {
+	pgn := `[Event "Test"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+`
+	games, err := NewPGNParser("").ParsePGNReader(strings.NewReader(pgn))
+	if err != nil || len(games) != 1 {
+		t.Fatalf("Failed to parse PGN: %v (%d games)", err, len(games))
+	}
+
+	positions, err := ExtractPositions(games[0])
+	if err != nil {
+		t.Fatalf("Failed to extract positions: %v", err)
+	}
+
+	// Black won: white to move loses, black to move wins
+	expected := []float32{-1, 1, -1, 1}
+	if len(positions) != len(expected) {
+		t.Fatalf("Expected %d positions, got %d", len(expected), len(positions))
+	}
+	for i, pos := range positions {
+		if !pos.HasOutcome || pos.Outcome != expected[i] {
+			t.Errorf("Position %d: outcome = %v (known: %v), want %v", i, pos.Outcome, pos.HasOutcome, expected[i])
+		}
+	}
+}
+
+func TestOutcomeValue(t *testing.T) {
+	tests := []struct {
+		outcome  chess.Outcome
+		turn     chess.Color
+		expected float32
+		known    bool
+	}{
+		{chess.WhiteWon, chess.White, 1, true},
+		{chess.WhiteWon, chess.Black, -1, true},
+		{chess.BlackWon, chess.Black, 1, true},
+		{chess.Draw, chess.White, 0, true},
+		{chess.NoOutcome, chess.White, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, known := OutcomeValue(tt.outcome, tt.turn)
+		if got != tt.expected || known != tt.known {
+			t.Errorf("OutcomeValue(%s, %v) = %v, %v; want %v, %v", tt.outcome, tt.turn, got, known, tt.expected, tt.known)
+		}
+	}
+}
+
 func TestExtractPositionsNilGame(t *testing.T) {
 	_, err := ExtractPositions(nil)
 	if err == nil {
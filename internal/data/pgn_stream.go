@@ -0,0 +1,218 @@
+package data
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/notnil/chess"
+)
+
+// PGNGame is a game read from a PGN stream
+type PGNGame struct {
+	Game   *chess.Game
+	Index  int   // Position of the game in the file, starting at 0
+	Offset int64 // Uncompressed byte offset just past the game
+}
+
+// PGNStream reads games one at a time from a (possibly compressed) PGN file,
+// so databases larger than memory can be ingested. Games that fail to decode
+// are skipped and counted rather than ending the stream.
+type PGNStream struct {
+	reader  *bufio.Reader
+	closers []io.Closer
+	file    *os.File // Uncompressed input, which can seek; nil otherwise
+	offset  int64    // Uncompressed bytes consumed
+	index   int      // Index of the next game
+	game    PGNGame
+	err     error
+	invalid int
+}
+
+// OpenPGNStream opens a PGN file for streaming. Files ending in .zst, .gz or
+// .bz2 are decompressed on the fly.
+func OpenPGNStream(path string) (*PGNStream, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PGN file: %w", err)
+	}
+
+	stream := &PGNStream{closers: []io.Closer{file}}
+	var reader io.Reader = file
+
+	switch {
+	case strings.HasSuffix(path, ".zst"):
+		decoder, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		stream.closers = append(stream.closers, decoder.IOReadCloser())
+		reader = decoder
+	case strings.HasSuffix(path, ".gz"):
+		decoder, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		stream.closers = append(stream.closers, decoder)
+		reader = decoder
+	case strings.HasSuffix(path, ".bz2"):
+		reader = bzip2.NewReader(file)
+	default:
+		stream.file = file
+	}
+
+	stream.reader = bufio.NewReaderSize(reader, 1<<20)
+	return stream, nil
+}
+
+// NewPGNStream creates a stream over uncompressed PGN text
+func NewPGNStream(r io.Reader) *PGNStream {
+	return &PGNStream{reader: bufio.NewReader(r)}
+}
+
+// SkipTo advances the stream to a game boundary previously reported by
+// PGNGame.Offset, so an interrupted ingestion can continue. Uncompressed files
+// seek directly; compressed input is decompressed and discarded up to offset.
+func (s *PGNStream) SkipTo(offset int64, index int) error {
+	if offset < s.offset {
+		return fmt.Errorf("cannot skip backwards from offset %d to %d", s.offset, offset)
+	}
+
+	if s.file != nil && s.offset == 0 {
+		if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to offset %d: %w", offset, err)
+		}
+		s.reader.Reset(s.file)
+	} else if _, err := io.CopyN(io.Discard, s.reader, offset-s.offset); err != nil {
+		return fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+	}
+
+	s.offset = offset
+	s.index = index
+	return nil
+}
+
+// Next reads the next game. It returns false at the end of the input or on a
+// read error, which is then reported by Err.
+func (s *PGNStream) Next() bool {
+	if s.err != nil {
+		return false
+	}
+
+	for {
+		text, err := s.readGame()
+		if err != nil && err != io.EOF {
+			s.err = fmt.Errorf("failed to read PGN at offset %d: %w", s.offset, err)
+			return false
+		}
+		if text == "" {
+			s.err = err
+			return false
+		}
+
+		index := s.index
+		s.index++
+
+		game, decodeErr := decodeGame(text)
+		if decodeErr != nil {
+			s.invalid++
+			if err == io.EOF {
+				s.err = err
+				return false
+			}
+			continue
+		}
+
+		s.game = PGNGame{Game: game, Index: index, Offset: s.offset}
+		if err == io.EOF {
+			// Report the final game; the next call returns false
+			s.err = err
+		}
+		return true
+	}
+}
+
+// Game returns the game read by the last call to Next
+func (s *PGNStream) Game() PGNGame {
+	return s.game
+}
+
+// Err returns the first read error, or nil at a clean end of input
+func (s *PGNStream) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// Invalid returns the number of games that could not be decoded
+func (s *PGNStream) Invalid() int {
+	return s.invalid
+}
+
+// Close closes the decompressor and the underlying file
+func (s *PGNStream) Close() error {
+	var firstErr error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.closers = nil
+	return firstErr
+}
+
+// readGame returns the text of the next game: its tag pairs, if any, followed
+// by the move text, which ends at the first blank line. It returns io.EOF with
+// the final game (or an empty string) at the end of the input.
+func (s *PGNStream) readGame() (string, error) {
+	var sb strings.Builder
+	inTags, inMoves := false, false
+
+	for {
+		raw, err := s.reader.ReadString('\n')
+		s.offset += int64(len(raw))
+
+		line := strings.TrimSpace(raw)
+		switch {
+		case inMoves:
+			if line == "" {
+				return sb.String(), err
+			}
+			sb.WriteString(line + "\n")
+		case inTags:
+			// Any line other than a tag pair starts the move text
+			if line != "" && !strings.HasPrefix(line, "[") {
+				inMoves = true
+			}
+			sb.WriteString(line + "\n")
+		case strings.HasPrefix(line, "["):
+			inTags = true
+			sb.WriteString(line + "\n")
+		case line != "":
+			// Move text without tag pairs
+			inMoves = true
+			sb.WriteString(line + "\n")
+		}
+
+		if err != nil {
+			return sb.String(), err
+		}
+	}
+}
+
+// decodeGame parses the PGN text of a single game
+func decodeGame(text string) (*chess.Game, error) {
+	pgn, err := chess.PGN(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(pgn), nil
+}
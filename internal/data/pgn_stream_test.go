@@ -0,0 +1,134 @@
+package data
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const streamTestPGN = `[Event "Game 1"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+
+[Event "Broken"]
+[Result "*"]
+
+1. e4 e4 *
+
+[Event "Game 3"]
+[Result "1/2-1/2"]
+
+1. d4 d5 1/2-1/2
+
+[Event "Game 4"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+`
+
+func TestPGNStream(t *testing.T) {
+	stream := NewPGNStream(strings.NewReader(streamTestPGN))
+
+	var games []PGNGame
+	for stream.Next() {
+		games = append(games, stream.Game())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	if len(games) != 3 || stream.Invalid() != 1 {
+		t.Fatalf("Read %d games with %d invalid; want 3 and 1", len(games), stream.Invalid())
+	}
+
+	// Indices count the unparseable game, and offsets point at the next game
+	expectedIndex := []int{0, 2, 3}
+	for i, game := range games {
+		if game.Index != expectedIndex[i] {
+			t.Errorf("Game %d: index = %d, want %d", i, game.Index, expectedIndex[i])
+		}
+	}
+	if rest := streamTestPGN[games[1].Offset:]; !strings.HasPrefix(rest, `[Event "Game 4"]`) {
+		t.Errorf("Offset after game 3 points at %q", rest[:20])
+	}
+	if games[2].Offset != int64(len(streamTestPGN)) {
+		t.Errorf("Final offset = %d, want %d", games[2].Offset, len(streamTestPGN))
+	}
+}
+
+func TestPGNStreamWithoutTags(t *testing.T) {
+	stream := NewPGNStream(strings.NewReader("1. e4 e5 2. Nf3 *\n\n[Event \"Tagged\"]\n\n1. d4 *\n\n1. c4 c5 1/2-1/2\n"))
+
+	var plies []int
+	for stream.Next() {
+		plies = append(plies, len(stream.Game().Game.Moves()))
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(plies) != 3 || plies[0] != 3 || plies[1] != 1 || plies[2] != 2 || stream.Invalid() != 0 {
+		t.Errorf("Read games with %v plies and %d invalid; want [3 1 2] and 0", plies, stream.Invalid())
+	}
+}
+
+func TestOpenPGNStreamCompressed(t *testing.T) {
+	dir := t.TempDir()
+
+	gzPath := filepath.Join(dir, "games.pgn.gz")
+	f, err := os.Create(gzPath)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(streamTestPGN))
+	gz.Close()
+	f.Close()
+
+	zstPath := filepath.Join(dir, "games.pgn.zst")
+	f, err = os.Create(zstPath)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatalf("Failed to create zstd writer: %v", err)
+	}
+	zw.Write([]byte(streamTestPGN))
+	zw.Close()
+	f.Close()
+
+	plainPath := filepath.Join(dir, "games.pgn")
+	if err := os.WriteFile(plainPath, []byte(streamTestPGN), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, path := range []string{plainPath, gzPath, zstPath} {
+		stream, err := OpenPGNStream(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+
+		// Skip the first two games, as when resuming
+		if err := stream.SkipTo(int64(strings.Index(streamTestPGN, `[Event "Game 3"]`)), 2); err != nil {
+			t.Fatalf("SkipTo failed for %s: %v", path, err)
+		}
+
+		var events []string
+		for stream.Next() {
+			events = append(events, stream.Game().Game.GetTagPair("Event").Value)
+		}
+		if err := stream.Err(); err != nil {
+			t.Errorf("Stream failed for %s: %v", path, err)
+		}
+		stream.Close()
+
+		if strings.Join(events, ",") != "Game 3,Game 4" {
+			t.Errorf("%s: read %v after SkipTo; want [Game 3 Game 4]", filepath.Base(path), events)
+		}
+	}
+}
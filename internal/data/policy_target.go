@@ -0,0 +1,81 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PolicyProb is one move of a sparse policy target. Indices use
+// MoveEncodingUnderpromotion, whose first 4096 slots match MoveEncodingFromTo.
+type PolicyProb struct {
+	Index int     `json:"i"`
+	Prob  float32 `json:"p"`
+}
+
+// SetPolicy stores a sparse policy target, dropping zero probabilities.
+// Moves are sorted by index so entries serialize deterministically.
+func (e *DataEntry) SetPolicy(target map[int]float32) {
+	e.Policy = make([]PolicyProb, 0, len(target))
+	for idx, p := range target {
+		if p > 0 {
+			e.Policy = append(e.Policy, PolicyProb{Index: idx, Prob: p})
+		}
+	}
+	sort.Slice(e.Policy, func(i, j int) bool { return e.Policy[i].Index < e.Policy[j].Index })
+}
+
+// PolicyTarget returns the normalized target probability of each policy index
+// under the given encoding. The explicit Policy takes precedence, then the
+// visit distribution of deduplicated entries, then a one-hot target for the
+// entry's move.
+func (e *DataEntry) PolicyTarget(encoding MoveEncoding) (map[int]float32, error) {
+	target := make(map[int]float32)
+
+	if len(e.Policy) > 0 {
+		for _, p := range e.Policy {
+			idx, err := ConvertMoveIndex(p.Index, encoding)
+			if err != nil {
+				return nil, err
+			}
+			target[idx] += p.Prob
+		}
+	} else {
+		for _, mc := range e.moveCounts() {
+			promo, err := ParsePromotion(mc.Promotion)
+			if err != nil {
+				return nil, err
+			}
+			idx, err := encoding.EncodeMoveIndex(mc.FromSquare, mc.ToSquare, promo)
+			if err != nil {
+				return nil, err
+			}
+			target[idx] += float32(mc.Count)
+		}
+	}
+
+	var total float32
+	for _, p := range target {
+		total += p
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("entry has an empty policy target")
+	}
+	for idx := range target {
+		target[idx] /= total
+	}
+	return target, nil
+}
+
+// ConvertMoveIndex maps a policy index of either encoding to the given
+// encoding. Under MoveEncodingFromTo underpromotions collapse onto their
+// from/to slot.
+func ConvertMoveIndex(index int, encoding MoveEncoding) (int, error) {
+	if index >= 0 && index < encoding.Size() {
+		return index, nil
+	}
+	from, to, promo, err := DecodeMoveIndex(index)
+	if err != nil {
+		return 0, err
+	}
+	return encoding.EncodeMoveIndex(from, to, promo)
+}
@@ -0,0 +1,58 @@
+package data
+
+import (
+	"math"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestPolicyTarget(t *testing.T) {
+	// e7e8=N (underpromotion slot) and e7e8=Q (plain slot), plus d7d8
+	knight, err := MoveEncodingUnderpromotion.EncodeMoveIndex(52, 60, chess.Knight)
+	if err != nil {
+		t.Fatalf("Failed to encode move: %v", err)
+	}
+	queen := 52*64 + 60
+	other := 51*64 + 59
+
+	entry := &DataEntry{FromSquare: 52, ToSquare: 60}
+	entry.SetPolicy(map[int]float32{knight: 0.2, queen: 0.4, other: 0.2, 100: 0})
+
+	if len(entry.Policy) != 3 || entry.Policy[0].Index > entry.Policy[1].Index {
+		t.Fatalf("SetPolicy stored %+v", entry.Policy)
+	}
+
+	tests := []struct {
+		encoding MoveEncoding
+		expected map[int]float32
+	}{
+		// Normalized from a total of 0.8
+		{MoveEncodingUnderpromotion, map[int]float32{knight: 0.25, queen: 0.5, other: 0.25}},
+		// The underpromotion collapses onto its from/to slot
+		{MoveEncodingFromTo, map[int]float32{queen: 0.75, other: 0.25}},
+	}
+
+	for _, tt := range tests {
+		target, err := entry.PolicyTarget(tt.encoding)
+		if err != nil {
+			t.Fatalf("PolicyTarget(%s) failed: %v", tt.encoding, err)
+		}
+		if len(target) != len(tt.expected) {
+			t.Errorf("PolicyTarget(%s) = %v, want %v", tt.encoding, target, tt.expected)
+			continue
+		}
+		for idx, p := range tt.expected {
+			if math.Abs(float64(target[idx]-p)) > 1e-6 {
+				t.Errorf("PolicyTarget(%s)[%d] = %v, want %v", tt.encoding, idx, target[idx], p)
+			}
+		}
+	}
+
+	// Color inversion maps the white underpromotion to the black one on the same file
+	inverted := mapPolicy(entry.Policy, mirrorRank)
+	from, to, promo, err := DecodeMoveIndex(inverted[len(inverted)-1].Index)
+	if err != nil || from != 12 || to != 4 || PromotionToString(promo) != "n" {
+		t.Errorf("Inverted underpromotion = %d->%d=%v (%v), want e2e1=n", from, to, promo, err)
+	}
+}
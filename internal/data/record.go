@@ -0,0 +1,599 @@
+package data
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// RecordFormat identifies how entries are serialized in a dataset. A dataset
+// detects its format from its first entry, and every entry records its own
+// format, so datasets written before the compact format still load.
+type RecordFormat string
+
+const (
+	// RecordFormatJSON stores each entry as JSON, with the state tensor as a
+	// float array
+	RecordFormatJSON RecordFormat = "json"
+
+	// RecordFormatCompactV1 stores the position as an occupancy bitboard with
+	// a 4-bit piece code per occupied square, the auxiliary state in two
+	// bytes and a varint, and the move and metadata as varints (see
+	// encodeCompact). State tensors are rebuilt when entries are loaded.
+	RecordFormatCompactV1 RecordFormat = "compact-v1"
+
+	// DefaultRecordFormat is used for new datasets
+	DefaultRecordFormat = RecordFormatCompactV1
+)
+
+// compactVersion1 is the first byte of a RecordFormatCompactV1 record. JSON
+// records start with '{'.
+const compactVersion1 = 1
+
+// Compact record flags
+const (
+	compactExtended     = 1 << iota // The state has the auxiliary planes
+	compactRawState                 // The state is stored as float32s, not pieces
+	compactHasOutcome               // HasOutcome is set
+	compactOutcome                  // An outcome value follows
+	compactPositionHash             // A position hash follows
+)
+
+// Auxiliary state byte of a compact record
+const (
+	auxWhiteToMove = 1 << iota
+	auxWhiteKingside
+	auxWhiteQueenside
+	auxBlackKingside
+	auxBlackQueenside
+)
+
+// castlingBits pairs the castling symbols with their auxiliary state bits
+var castlingBits = []struct {
+	symbol string
+	bit    byte
+}{
+	{"K", auxWhiteKingside},
+	{"Q", auxWhiteQueenside},
+	{"k", auxBlackKingside},
+	{"q", auxBlackQueenside},
+}
+
+// Valid reports whether the record format is known
+func (f RecordFormat) Valid() bool {
+	return f == RecordFormatJSON || f == RecordFormatCompactV1
+}
+
+// ParseRecordFormat returns the record format with the given name
+func ParseRecordFormat(name string) (RecordFormat, error) {
+	format := RecordFormat(name)
+	if !format.Valid() {
+		return "", fmt.Errorf("unknown record format %q (want %s or %s)", name, RecordFormatCompactV1, RecordFormatJSON)
+	}
+	return format, nil
+}
+
+// recordFormatOf detects the format of a stored record
+func recordFormatOf(value []byte) (RecordFormat, error) {
+	switch {
+	case len(value) == 0:
+		return "", fmt.Errorf("empty record")
+	case value[0] == '{':
+		return RecordFormatJSON, nil
+	case value[0] == compactVersion1:
+		return RecordFormatCompactV1, nil
+	default:
+		return "", fmt.Errorf("unknown record format version %d", value[0])
+	}
+}
+
+// encodeEntry serializes an entry in the given format
+func encodeEntry(entry *DataEntry, format RecordFormat) ([]byte, error) {
+	switch format {
+	case RecordFormatJSON:
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal entry: %w", err)
+		}
+		return value, nil
+	case RecordFormatCompactV1:
+		return encodeCompact(entry), nil
+	default:
+		return nil, fmt.Errorf("unknown record format %q", format)
+	}
+}
+
+// decodeEntry deserializes a record of any format
+func decodeEntry(value []byte) (*DataEntry, error) {
+	return decodeRecord(value, true)
+}
+
+// decodeMetadata deserializes the game metadata of a record (outcome,
+// ratings, ECO code and time control), skipping the state tensor
+func decodeMetadata(value []byte) (*DataEntry, error) {
+	return decodeRecord(value, false)
+}
+
+// decodeRecord deserializes a record, rebuilding the state tensor only when
+// withState is set
+func decodeRecord(value []byte, withState bool) (*DataEntry, error) {
+	format, err := recordFormatOf(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == RecordFormatJSON {
+		if !withState {
+			return decodeJSONMetadata(value)
+		}
+		var entry DataEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal entry: %w", err)
+		}
+		return &entry, nil
+	}
+
+	r := &recordReader{buf: value[1:]}
+	entry := decodeCompact(r, withState)
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to decode entry: %w", r.err)
+	}
+	if len(r.buf) != 0 {
+		return nil, fmt.Errorf("failed to decode entry: %d trailing bytes", len(r.buf))
+	}
+	return entry, nil
+}
+
+// decodeJSONMetadata decodes only the metadata fields of a JSON record, so
+// the state tensor's float array is skipped
+func decodeJSONMetadata(value []byte) (*DataEntry, error) {
+	var entry struct {
+		Outcome     float32 `json:"outcome"`
+		HasOutcome  bool    `json:"has_outcome"`
+		WhiteElo    int     `json:"white_elo"`
+		BlackElo    int     `json:"black_elo"`
+		ECO         string  `json:"eco"`
+		TimeControl string  `json:"time_control"`
+	}
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entry: %w", err)
+	}
+	return &DataEntry{
+		Outcome:     entry.Outcome,
+		HasOutcome:  entry.HasOutcome,
+		WhiteElo:    entry.WhiteElo,
+		BlackElo:    entry.BlackElo,
+		ECO:         entry.ECO,
+		TimeControl: entry.TimeControl,
+	}, nil
+}
+
+// encodeCompact writes a RecordFormatCompactV1 record:
+//
+//	byte     version (1)
+//	byte     flags
+//	state    pieces: uint64 occupancy (bit = square, a1 = 0), then a 4-bit
+//	         channel per occupied square in square order, low nibble first;
+//	         followed for extended states by the auxiliary byte (side to
+//	         move, castling rights), uvarint en-passant file + 1 (0 = none)
+//	         and uvarint halfmove clock.
+//	         Or with compactRawState: uvarint length and float32s.
+//	varint   from square, to square; string promotion
+//	string   game ID; varint move number, white Elo, black Elo
+//	string   ECO, time control
+//	float32  outcome (compactOutcome); uint64 position hash (compactPositionHash)
+//	uvarint  move count entries: varint from, to; string promotion; varint count
+//	uvarint  policy entries: varint index; float32 probability
+//
+// Strings are a uvarint length and bytes, fixed-size values little-endian.
+// States that pieces and auxiliary state cannot reproduce exactly, such as
+// malformed tensors, are stored raw, so the encoding is always lossless.
+func encodeCompact(entry *DataEntry) []byte {
+	w := &recordWriter{buf: make([]byte, 0, 64)}
+	w.putByte(compactVersion1)
+
+	var flags byte
+	pieces, aux, packed := packState(entry.StateTensor)
+	if !packed {
+		flags |= compactRawState
+	} else if aux != nil {
+		flags |= compactExtended
+	}
+	if entry.HasOutcome {
+		flags |= compactHasOutcome
+	}
+	if entry.Outcome != 0 {
+		flags |= compactOutcome
+	}
+	if entry.PositionHash != 0 {
+		flags |= compactPositionHash
+	}
+	w.putByte(flags)
+
+	if packed {
+		writePieces(w, pieces)
+		if aux != nil {
+			writeAux(w, *aux)
+		}
+	} else {
+		w.putUvarint(uint64(len(entry.StateTensor)))
+		for _, v := range entry.StateTensor {
+			w.putFloat32(v)
+		}
+	}
+
+	w.putVarint(entry.FromSquare)
+	w.putVarint(entry.ToSquare)
+	w.putString(entry.Promotion)
+	w.putString(entry.GameID)
+	w.putVarint(entry.MoveNumber)
+	w.putVarint(entry.WhiteElo)
+	w.putVarint(entry.BlackElo)
+	w.putString(entry.ECO)
+	w.putString(entry.TimeControl)
+	if flags&compactOutcome != 0 {
+		w.putFloat32(entry.Outcome)
+	}
+	if flags&compactPositionHash != 0 {
+		w.putUint64(entry.PositionHash)
+	}
+
+	w.putUvarint(uint64(len(entry.MoveCounts)))
+	for _, mc := range entry.MoveCounts {
+		w.putVarint(mc.FromSquare)
+		w.putVarint(mc.ToSquare)
+		w.putString(mc.Promotion)
+		w.putVarint(mc.Count)
+	}
+	w.putUvarint(uint64(len(entry.Policy)))
+	for _, p := range entry.Policy {
+		w.putVarint(p.Index)
+		w.putFloat32(p.Prob)
+	}
+
+	return w.buf
+}
+
+// decodeCompact reads a RecordFormatCompactV1 record after its version byte
+func decodeCompact(r *recordReader, withState bool) *DataEntry {
+	entry := &DataEntry{}
+	flags := r.readByte()
+
+	if flags&compactRawState != 0 {
+		n := r.readUvarint()
+		if n > uint64(len(r.buf)/4) {
+			r.fail("state length %d exceeds record", n)
+			return entry
+		}
+		if !withState {
+			r.readBytes(int(n) * 4)
+		} else if n > 0 {
+			entry.StateTensor = make([]float32, n)
+			for i := range entry.StateTensor {
+				entry.StateTensor[i] = r.readFloat32()
+			}
+		}
+	} else {
+		pieces := readPieces(r)
+		var aux *AuxState
+		if flags&compactExtended != 0 {
+			a := readAux(r)
+			aux = &a
+		}
+		if withState && r.err == nil {
+			entry.StateTensor = unpackState(pieces, aux)
+		}
+	}
+
+	entry.FromSquare = r.readVarint()
+	entry.ToSquare = r.readVarint()
+	entry.Promotion = r.readString()
+	entry.GameID = r.readString()
+	entry.MoveNumber = r.readVarint()
+	entry.WhiteElo = r.readVarint()
+	entry.BlackElo = r.readVarint()
+	entry.ECO = r.readString()
+	entry.TimeControl = r.readString()
+	entry.HasOutcome = flags&compactHasOutcome != 0
+	if flags&compactOutcome != 0 {
+		entry.Outcome = r.readFloat32()
+	}
+	if flags&compactPositionHash != 0 {
+		entry.PositionHash = r.readUint64()
+	}
+
+	if n := r.count(); n > 0 {
+		entry.MoveCounts = make([]MoveCount, n)
+		for i := range entry.MoveCounts {
+			mc := &entry.MoveCounts[i]
+			mc.FromSquare = r.readVarint()
+			mc.ToSquare = r.readVarint()
+			mc.Promotion = r.readString()
+			mc.Count = r.readVarint()
+		}
+	}
+	if n := r.count(); n > 0 {
+		entry.Policy = make([]PolicyProb, n)
+		for i := range entry.Policy {
+			entry.Policy[i].Index = r.readVarint()
+			entry.Policy[i].Prob = r.readFloat32()
+		}
+	}
+
+	return entry
+}
+
+// packState reduces a state tensor to the channel of each square (-1 for
+// empty) and, for extended states, the auxiliary state. It reports false if
+// unpacking them would not give back exactly the same tensor.
+func packState(state []float32) ([64]int8, *AuxState, bool) {
+	var pieces [64]int8
+	channels, err := InputChannelsForLength(len(state))
+	if err != nil {
+		return pieces, nil, false
+	}
+
+	for i := range pieces {
+		pieces[i] = -1
+	}
+	for c := 0; c < NumChannels; c++ {
+		for i, v := range state[c*64 : (c+1)*64] {
+			if v == 0 {
+				continue
+			}
+			square := (7-i/8)*8 + i%8
+			if v != 1 || pieces[square] >= 0 {
+				return pieces, nil, false
+			}
+			pieces[square] = int8(c)
+		}
+	}
+
+	var aux *AuxState
+	if channels == NumExtendedChannels {
+		a, err := AuxStateFromState(state)
+		if err != nil || a.HalfmoveClock < 0 {
+			return pieces, nil, false
+		}
+		aux = &a
+		// The auxiliary planes are uniform (or one file for en passant), so
+		// anything else only round-trips raw
+		planes := unpackState(pieces, aux)[NumChannels*64:]
+		for i, v := range state[NumChannels*64:] {
+			if planes[i] != v {
+				return pieces, nil, false
+			}
+		}
+	}
+
+	return pieces, aux, true
+}
+
+// unpackState rebuilds a state tensor from the channel of each square and the
+// auxiliary state (nil for 12-channel states)
+func unpackState(pieces [64]int8, aux *AuxState) []float32 {
+	channels := NumChannels
+	if aux != nil {
+		channels = NumExtendedChannels
+	}
+	state := make([]float32, channels*64)
+	for square, c := range pieces {
+		if c >= 0 {
+			rank, file := 7-square/8, square%8 // Row 0 is the eighth rank
+			state[int(c)*64+rank*8+file] = 1
+		}
+	}
+	if aux != nil {
+		planes := aux.Planes()
+		offset := NumChannels * 64
+		for c := range planes {
+			for r := range planes[c] {
+				offset += copy(state[offset:], planes[c][r][:])
+			}
+		}
+	}
+	return state
+}
+
+func writePieces(w *recordWriter, pieces [64]int8) {
+	var occupancy uint64
+	for square, c := range pieces {
+		if c >= 0 {
+			occupancy |= 1 << square
+		}
+	}
+	w.putUint64(occupancy)
+
+	var nibble byte
+	odd := false
+	for _, c := range pieces {
+		if c < 0 {
+			continue
+		}
+		if odd {
+			w.putByte(nibble | byte(c)<<4)
+		} else {
+			nibble = byte(c)
+		}
+		odd = !odd
+	}
+	if odd {
+		w.putByte(nibble)
+	}
+}
+
+func readPieces(r *recordReader) [64]int8 {
+	var pieces [64]int8
+	occupancy := r.readUint64()
+	packed := r.readBytes((bits.OnesCount64(occupancy) + 1) / 2)
+	n := 0
+	for square := range pieces {
+		pieces[square] = -1
+		if occupancy&(1<<square) == 0 || r.err != nil {
+			continue
+		}
+		c := packed[n/2] >> (4 * (n % 2)) & 0x0f
+		if c >= NumChannels {
+			r.fail("invalid piece channel %d", c)
+			continue
+		}
+		pieces[square] = int8(c)
+		n++
+	}
+	return pieces
+}
+
+func writeAux(w *recordWriter, aux AuxState) {
+	var b byte
+	if aux.WhiteToMove {
+		b |= auxWhiteToMove
+	}
+	for _, right := range castlingBits {
+		if strings.Contains(aux.Castling, right.symbol) {
+			b |= right.bit
+		}
+	}
+	w.putByte(b)
+	w.putUvarint(uint64(aux.EnPassantFile + 1))
+	w.putUvarint(uint64(aux.HalfmoveClock))
+}
+
+func readAux(r *recordReader) AuxState {
+	b := r.readByte()
+	aux := AuxState{
+		WhiteToMove:   b&auxWhiteToMove != 0,
+		EnPassantFile: int(r.readUvarint()) - 1,
+		HalfmoveClock: int(r.readUvarint()),
+	}
+	for _, right := range castlingBits {
+		if b&right.bit != 0 {
+			aux.Castling += right.symbol
+		}
+	}
+	if aux.Castling == "" {
+		aux.Castling = "-"
+	}
+	return aux
+}
+
+// recordWriter appends the fields of a compact record
+type recordWriter struct {
+	buf []byte
+}
+
+func (w *recordWriter) putByte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *recordWriter) putUvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *recordWriter) putVarint(v int) {
+	w.buf = binary.AppendVarint(w.buf, int64(v))
+}
+
+func (w *recordWriter) putUint64(v uint64) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
+
+func (w *recordWriter) putFloat32(v float32) {
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(v))
+}
+
+func (w *recordWriter) putString(s string) {
+	w.putUvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// recordReader consumes the fields of a compact record. The first error
+// sticks; later reads return zero values.
+type recordReader struct {
+	buf []byte
+	err error
+}
+
+func (r *recordReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+	r.buf = nil
+}
+
+func (r *recordReader) readBytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.buf) {
+		r.fail("record truncated")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *recordReader) readByte() byte {
+	if b := r.readBytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *recordReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *recordReader) readVarint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return int(v)
+}
+
+// count reads a slice length, checking it against the bytes left
+func (r *recordReader) count() int {
+	n := r.readUvarint()
+	if n > uint64(len(r.buf)) {
+		r.fail("count %d exceeds record", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *recordReader) readUint64() uint64 {
+	if b := r.readBytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *recordReader) readFloat32() float32 {
+	if b := r.readBytes(4); b != nil {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *recordReader) readString() string {
+	n := r.count()
+	return string(r.readBytes(n))
+}
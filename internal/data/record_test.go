@@ -0,0 +1,232 @@
+package data
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/notnil/chess"
+	bolt "go.etcd.io/bbolt"
+)
+
+// recordPosition plays moves from the starting position
+func recordPosition(t *testing.T, moves ...string) *chess.Position {
+	t.Helper()
+	game := chess.NewGame()
+	for _, m := range moves {
+		if err := game.MoveStr(m); err != nil {
+			t.Fatalf("Failed to make move %s: %v", m, err)
+		}
+	}
+	return game.Position()
+}
+
+func recordState(t *testing.T, pos *chess.Position, channels int) []float32 {
+	t.Helper()
+	state, err := TensorizePosition(pos, channels)
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	return state
+}
+
+func TestCompactRecordRoundTrip(t *testing.T) {
+	// En passant is possible on f6, and White has lost the queenside castling right
+	enPassant := recordPosition(t, "a4", "h6", "Ra3", "h5", "Ra1", "h4", "e4", "a6", "e5", "f5")
+
+	pieces := recordState(t, recordPosition(t, "e4"), NumChannels)
+	capture := AppendAuxPlanes(pieces, DefaultAuxState())
+	longClock := AppendAuxPlanes(pieces, AuxState{WhiteToMove: false, Castling: "kq", EnPassantFile: -1, HalfmoveClock: 150})
+	halves := recordState(t, chess.StartingPosition(), NumExtendedChannels)
+	halves[100] = 0.5
+	twoPieces := recordState(t, chess.StartingPosition(), NumChannels)
+	twoPieces[64*3] = 1 // A white rook on a8, which holds a black rook
+
+	tests := []struct {
+		name  string
+		entry *DataEntry
+		raw   bool
+	}{
+		{"extended position", &DataEntry{
+			StateTensor:  recordState(t, enPassant, NumExtendedChannels),
+			FromSquare:   int(chess.E5),
+			ToSquare:     int(chess.F6),
+			GameID:       "lichess:abc123",
+			MoveNumber:   11,
+			Outcome:      -1,
+			HasOutcome:   true,
+			WhiteElo:     2412,
+			BlackElo:     2398,
+			ECO:          "B01",
+			TimeControl:  "300+3",
+			PositionHash: ZobristHash(enPassant),
+			MoveCounts:   []MoveCount{{FromSquare: 36, ToSquare: 45, Count: 3}, {FromSquare: 48, ToSquare: 56, Promotion: "n", Count: 1}},
+			Policy:       []PolicyProb{{Index: 7, Prob: 0.25}, {Index: 4100, Prob: 0.75}},
+		}, false},
+		{"piece planes", &DataEntry{StateTensor: pieces, FromSquare: 52, ToSquare: 36, MoveNumber: 1}, false},
+		{"board capture", &DataEntry{StateTensor: capture, FromSquare: 12, ToSquare: 28, Promotion: "q"}, false},
+		{"clamped halfmove clock", &DataEntry{StateTensor: longClock, HasOutcome: true}, false},
+		{"fractional values", &DataEntry{StateTensor: halves, FromSquare: 1, ToSquare: 18}, true},
+		{"two pieces on a square", &DataEntry{StateTensor: twoPieces}, true},
+		{"no state", &DataEntry{FromSquare: -1, ToSquare: 64}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := encodeEntry(tt.entry, RecordFormatCompactV1)
+			if err != nil {
+				t.Fatalf("Failed to encode entry: %v", err)
+			}
+			if raw := value[1]&compactRawState != 0; raw != tt.raw {
+				t.Errorf("State stored raw: %v, want %v", raw, tt.raw)
+			}
+
+			decoded, err := decodeEntry(value)
+			if err != nil {
+				t.Fatalf("Failed to decode entry: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.entry) {
+				t.Errorf("Decoded entry differs:\ngot  %+v\nwant %+v", decoded, tt.entry)
+			}
+
+			metadata, err := decodeMetadata(value)
+			if err != nil {
+				t.Fatalf("Failed to decode metadata: %v", err)
+			}
+			if metadata.StateTensor != nil || metadata.ECO != tt.entry.ECO || metadata.WhiteElo != tt.entry.WhiteElo {
+				t.Errorf("Metadata decoded as %+v", metadata)
+			}
+
+			encoded, _ := json.Marshal(tt.entry)
+			if !tt.raw && len(value)*10 > len(encoded) {
+				t.Errorf("Compact record is %d bytes, JSON %d", len(value), len(encoded))
+			}
+		})
+	}
+}
+
+func TestDecodeRecordErrors(t *testing.T) {
+	entry := &DataEntry{StateTensor: recordState(t, chess.StartingPosition(), NumExtendedChannels), GameID: "g1"}
+	value := encodeCompact(entry)
+
+	for name, record := range map[string][]byte{
+		"empty":          {},
+		"unknown format": append([]byte{7}, value[1:]...),
+		"truncated":      value[:len(value)-2],
+		"trailing bytes": append(append([]byte(nil), value...), 0),
+		"bad JSON":       []byte(`{"state_tensor": [`),
+	} {
+		if _, err := decodeEntry(record); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMigrateDataset(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "source.db")
+
+	ds, err := NewDataset(srcPath)
+	if err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+	if ds.Format() != DefaultRecordFormat {
+		t.Errorf("New dataset uses %s, want %s", ds.Format(), DefaultRecordFormat)
+	}
+	game := chess.NewGame()
+	var want []*DataEntry
+	for _, move := range []string{"e4", "c5", "Nf3", "d6", "d4", "cxd4", "Nxd4", "Nf6", "Nc3", "a6"} {
+		pos := game.Position()
+		if err := game.MoveStr(move); err != nil {
+			t.Fatalf("Failed to play %s: %v", move, err)
+		}
+		played := game.Moves()[len(game.Moves())-1]
+		entry := &DataEntry{
+			StateTensor:  recordState(t, pos, NumExtendedChannels),
+			FromSquare:   int(played.S1()),
+			ToSquare:     int(played.S2()),
+			GameID:       "game1",
+			MoveNumber:   len(want) + 1,
+			PositionHash: ZobristHash(pos),
+		}
+		want = append(want, entry)
+	}
+	if _, err := ds.addBatch(want, nil, true); err != nil {
+		t.Fatalf("Failed to add entries: %v", err)
+	}
+	if err := ds.SetMetadata("source", "test.pgn"); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	ds.Close()
+
+	check := func(path string, format RecordFormat) *Dataset {
+		t.Helper()
+		ds, err := NewDataset(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		t.Cleanup(func() { ds.Close() })
+		if ds.Format() != format {
+			t.Errorf("%s detected as %s, want %s", path, ds.Format(), format)
+		}
+		got, err := ds.LoadAll()
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", path, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s entries differ after migration", path)
+		}
+		var source string
+		if ok, err := ds.GetMetadata("source", &source); !ok || err != nil || source != "test.pgn" {
+			t.Errorf("%s metadata: %q, %v, %v", path, source, ok, err)
+		}
+		return ds
+	}
+
+	jsonPath := filepath.Join(dir, "json.db")
+	toJSON, err := MigrateDataset(srcPath, jsonPath, RecordFormatJSON)
+	if err != nil {
+		t.Fatalf("Failed to migrate to JSON: %v", err)
+	}
+	if toJSON.Entries != len(want) || toJSON.RecordBytesAfter <= toJSON.RecordBytesBefore {
+		t.Errorf("Migration to JSON: %+v", toJSON)
+	}
+	legacy := check(jsonPath, RecordFormatJSON)
+
+	// Entries added to a JSON dataset stay JSON, deduplicated ones included
+	more := &DataEntry{StateTensor: want[0].StateTensor, FromSquare: 11, ToSquare: 27, PositionHash: want[0].PositionHash}
+	if _, err := legacy.addBatch([]*DataEntry{more}, nil, true); err != nil {
+		t.Fatalf("Failed to add to JSON dataset: %v", err)
+	}
+	if err := legacy.Add(&DataEntry{StateTensor: want[1].StateTensor}); err != nil {
+		t.Fatalf("Failed to add to JSON dataset: %v", err)
+	}
+	if err := legacy.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(DefaultBucketName)).ForEach(func(k, v []byte) error {
+			if format, _ := recordFormatOf(v); format != RecordFormatJSON {
+				t.Errorf("Entry %s stored as %s", k, format)
+			}
+			return nil
+		})
+	}); err != nil {
+		t.Fatalf("Failed to scan dataset: %v", err)
+	}
+	legacy.Close()
+
+	compactPath := filepath.Join(dir, "compact.db")
+	stats, err := MigrateDataset(jsonPath, compactPath, RecordFormatCompactV1)
+	if err != nil {
+		t.Fatalf("Failed to migrate to compact: %v", err)
+	}
+	if stats.Entries != len(want)+1 || stats.RecordReduction() < 0.9 || stats.FileSizeAfter <= 0 {
+		t.Errorf("Migration to compact: %+v, records %.1f%% smaller", stats, stats.RecordReduction()*100)
+	}
+	want[0].Merge(more)
+	want = append(want, &DataEntry{StateTensor: want[1].StateTensor})
+	check(compactPath, RecordFormatCompactV1)
+
+	if _, err := MigrateDataset(jsonPath, compactPath, RecordFormatCompactV1); err == nil {
+		t.Error("Expected an error migrating onto an existing file")
+	}
+}
@@ -2,6 +2,8 @@ package data
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/notnil/chess"
 )
@@ -12,6 +14,38 @@ const (
 	BoardSize   = 8
 )
 
+// Extended input format: the 12 piece planes followed by auxiliary planes
+// describing the parts of the position that piece placement cannot show
+const (
+	NumAuxChannels      = 7
+	NumExtendedChannels = NumChannels + NumAuxChannels
+
+	SideToMoveChannel     = 12 // All ones when white is to move
+	WhiteKingsideChannel  = 13 // All ones while white may castle kingside
+	WhiteQueensideChannel = 14 // All ones while white may castle queenside
+	BlackKingsideChannel  = 15 // All ones while black may castle kingside
+	BlackQueensideChannel = 16 // All ones while black may castle queenside
+	EnPassantChannel      = 17 // Ones on the file of the en-passant target square
+	HalfmoveClockChannel  = 18 // Halfmove clock / 100, clamped to 1
+
+	// DefaultInputChannels is the input format used for new datasets and models
+	DefaultInputChannels = NumExtendedChannels
+)
+
+// ValidInputChannels reports whether channels is a supported input format
+func ValidInputChannels(channels int) bool {
+	return channels == NumChannels || channels == NumExtendedChannels
+}
+
+// InputChannelsForLength returns the input format of a flat state tensor
+func InputChannelsForLength(length int) (int, error) {
+	planeSize := BoardSize * BoardSize
+	if length%planeSize != 0 || !ValidInputChannels(length/planeSize) {
+		return 0, fmt.Errorf("invalid state tensor length: %d", length)
+	}
+	return length / planeSize, nil
+}
+
 // PieceToChannel maps piece types to channel indices
 // Channels 0-5: White pieces (Pawn, Knight, Bishop, Rook, Queen, King)
 // Channels 6-11: Black pieces (Pawn, Knight, Bishop, Rook, Queen, King)
@@ -71,6 +105,128 @@ func TensorizeBoard(board *chess.Board) ([NumChannels][BoardSize][BoardSize]floa
 	return tensor, nil
 }
 
+// AuxState holds the parts of a position encoded in the auxiliary planes
+type AuxState struct {
+	WhiteToMove   bool
+	Castling      string // FEN castling field, e.g. "KQkq" or "-"
+	EnPassantFile int    // File of the en-passant target square (0-7), -1 if none
+	HalfmoveClock int
+}
+
+// DefaultAuxState is used when only piece placement is known (e.g. board captures):
+// white to move, no castling or en-passant rights
+func DefaultAuxState() AuxState {
+	return AuxState{WhiteToMove: true, Castling: "-", EnPassantFile: -1}
+}
+
+// AuxStateFromPosition extracts the auxiliary state of a position
+func AuxStateFromPosition(pos *chess.Position) AuxState {
+	aux := AuxState{
+		WhiteToMove:   pos.Turn() == chess.White,
+		Castling:      pos.CastleRights().String(),
+		EnPassantFile: -1,
+		HalfmoveClock: pos.HalfMoveClock(),
+	}
+	if sq := pos.EnPassantSquare(); sq != chess.NoSquare {
+		aux.EnPassantFile = int(sq.File())
+	}
+	return aux
+}
+
+// Planes encodes the auxiliary state as [7][8][8] planes
+func (a AuxState) Planes() [NumAuxChannels][BoardSize][BoardSize]float32 {
+	var planes [NumAuxChannels][BoardSize][BoardSize]float32
+
+	fill := func(channel int, value float32) {
+		for r := 0; r < BoardSize; r++ {
+			for f := 0; f < BoardSize; f++ {
+				planes[channel-NumChannels][r][f] = value
+			}
+		}
+	}
+
+	if a.WhiteToMove {
+		fill(SideToMoveChannel, 1.0)
+	}
+	if strings.Contains(a.Castling, "K") {
+		fill(WhiteKingsideChannel, 1.0)
+	}
+	if strings.Contains(a.Castling, "Q") {
+		fill(WhiteQueensideChannel, 1.0)
+	}
+	if strings.Contains(a.Castling, "k") {
+		fill(BlackKingsideChannel, 1.0)
+	}
+	if strings.Contains(a.Castling, "q") {
+		fill(BlackQueensideChannel, 1.0)
+	}
+	if a.EnPassantFile >= 0 && a.EnPassantFile < BoardSize {
+		for r := 0; r < BoardSize; r++ {
+			planes[EnPassantChannel-NumChannels][r][a.EnPassantFile] = 1.0
+		}
+	}
+	fill(HalfmoveClockChannel, float32(math.Min(float64(a.HalfmoveClock)/100.0, 1.0)))
+
+	return planes
+}
+
+// AppendAuxPlanes appends the auxiliary planes to a flat 12-channel state tensor
+func AppendAuxPlanes(flat []float32, aux AuxState) []float32 {
+	out := make([]float32, 0, NumExtendedChannels*BoardSize*BoardSize)
+	out = append(out, flat...)
+
+	planes := aux.Planes()
+	for c := 0; c < NumAuxChannels; c++ {
+		for r := 0; r < BoardSize; r++ {
+			out = append(out, planes[c][r][:]...)
+		}
+	}
+	return out
+}
+
+// ExpandInputChannels converts a flat state tensor to the requested input format.
+// 12-channel states are extended with DefaultAuxState; extended states are
+// truncated to their piece planes when 12 channels are requested.
+func ExpandInputChannels(flat []float32, channels int) ([]float32, error) {
+	have, err := InputChannelsForLength(len(flat))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case have == channels:
+		return flat, nil
+	case channels == NumChannels:
+		return flat[:NumChannels*BoardSize*BoardSize], nil
+	case channels == NumExtendedChannels:
+		return AppendAuxPlanes(flat, DefaultAuxState()), nil
+	default:
+		return nil, fmt.Errorf("unsupported input channels: %d", channels)
+	}
+}
+
+// TensorizePosition converts a position to a flat state tensor with the given
+// number of channels (NumChannels or NumExtendedChannels)
+func TensorizePosition(pos *chess.Position, channels int) ([]float32, error) {
+	if pos == nil {
+		return nil, fmt.Errorf("position is nil")
+	}
+	if !ValidInputChannels(channels) {
+		return nil, fmt.Errorf("unsupported input channels: %d", channels)
+	}
+
+	tensor, err := TensorizeBoard(pos.Board())
+	if err != nil {
+		return nil, err
+	}
+
+	flat := TensorToFlatArray(tensor)
+	if channels == NumChannels {
+		return flat, nil
+	}
+	return AppendAuxPlanes(flat, AuxStateFromPosition(pos)), nil
+}
+
 // EncodeMoveLabel converts a chess move to a pair of square indices (from, to)
 // Returns (fromSquare, toSquare) where each is in range [0, 63]
 func EncodeMoveLabel(move *chess.Move) (int, int, error) {
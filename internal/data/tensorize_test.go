@@ -277,3 +277,83 @@ func TestRoundTripTensorConversion(t *testing.T) {
 		}
 	}
 }
+
+func TestTensorizePositionAuxPlanes(t *testing.T) {
+	fen, err := chess.FEN("rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKB1R b Kq e3 7 3")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	pos := chess.NewGame(fen).Position()
+
+	flat, err := TensorizePosition(pos, NumExtendedChannels)
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	if len(flat) != NumExtendedChannels*BoardSize*BoardSize {
+		t.Fatalf("Expected length %d, got %d", NumExtendedChannels*BoardSize*BoardSize, len(flat))
+	}
+
+	at := func(channel, rank, file int) float32 {
+		return flat[(channel*BoardSize+rank)*BoardSize+file]
+	}
+
+	tests := []struct {
+		name     string
+		channel  int
+		file     int
+		expected float32
+	}{
+		{"black to move", SideToMoveChannel, 0, 0.0},
+		{"white kingside", WhiteKingsideChannel, 0, 1.0},
+		{"white queenside", WhiteQueensideChannel, 0, 0.0},
+		{"black kingside", BlackKingsideChannel, 0, 0.0},
+		{"black queenside", BlackQueensideChannel, 0, 1.0},
+		{"en passant e-file", EnPassantChannel, 4, 1.0},
+		{"no en passant d-file", EnPassantChannel, 3, 0.0},
+		{"halfmove clock", HalfmoveClockChannel, 0, 0.07},
+	}
+
+	for _, tt := range tests {
+		for rank := 0; rank < BoardSize; rank++ {
+			if got := at(tt.channel, rank, tt.file); got != tt.expected {
+				t.Errorf("%s: plane %d [%d][%d] = %f, want %f", tt.name, tt.channel, rank, tt.file, got, tt.expected)
+				break
+			}
+		}
+	}
+
+	// Piece planes match the 12-channel format
+	pieces, err := TensorizePosition(pos, NumChannels)
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	for i := range pieces {
+		if pieces[i] != flat[i] {
+			t.Fatalf("Piece planes differ at index %d", i)
+		}
+	}
+}
+
+func TestExpandInputChannels(t *testing.T) {
+	pieces := make([]float32, NumChannels*BoardSize*BoardSize)
+
+	extended, err := ExpandInputChannels(pieces, NumExtendedChannels)
+	if err != nil {
+		t.Fatalf("Failed to expand: %v", err)
+	}
+	if channels, _ := InputChannelsForLength(len(extended)); channels != NumExtendedChannels {
+		t.Errorf("Expected %d channels, got %d", NumExtendedChannels, channels)
+	}
+
+	truncated, err := ExpandInputChannels(extended, NumChannels)
+	if err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	if len(truncated) != len(pieces) {
+		t.Errorf("Expected length %d, got %d", len(pieces), len(truncated))
+	}
+
+	if _, err := ExpandInputChannels(make([]float32, 100), NumChannels); err == nil {
+		t.Error("Expected error for invalid state length")
+	}
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"github.com/notnil/chess"
+)
+
+// zobristKeys holds the random keys XORed into a Zobrist hash. They are
+// generated from a fixed seed so hashes are stable across runs and datasets.
+var zobristKeys = newZobristKeys(0x9E3779B97F4A7C15)
+
+type zobristTable struct {
+	pieces    [NumChannels][64]uint64
+	blackMove uint64
+	castling  [4]uint64 // K, Q, k, q
+	enPassant [BoardSize]uint64
+}
+
+// newZobristKeys fills a key table using the splitmix64 generator
+func newZobristKeys(seed uint64) *zobristTable {
+	next := func() uint64 {
+		seed += 0x9E3779B97F4A7C15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		return z ^ (z >> 31)
+	}
+
+	table := &zobristTable{}
+	for c := range table.pieces {
+		for sq := range table.pieces[c] {
+			table.pieces[c][sq] = next()
+		}
+	}
+	table.blackMove = next()
+	for i := range table.castling {
+		table.castling[i] = next()
+	}
+	for i := range table.enPassant {
+		table.enPassant[i] = next()
+	}
+	return table
+}
+
+// ZobristHash returns a 64-bit hash of the position's pieces, side to move,
+// castling rights and en-passant file. Move counters are ignored, so the same
+// position reached by different move orders hashes identically.
+func ZobristHash(pos *chess.Position) uint64 {
+	var hash uint64
+	for sq, piece := range pos.Board().SquareMap() {
+		if channel := PieceToChannel(piece); channel >= 0 {
+			hash ^= zobristKeys.pieces[channel][sq]
+		}
+	}
+
+	if pos.Turn() == chess.Black {
+		hash ^= zobristKeys.blackMove
+	}
+
+	rights := pos.CastleRights()
+	for i, right := range []struct {
+		color chess.Color
+		side  chess.Side
+	}{
+		{chess.White, chess.KingSide},
+		{chess.White, chess.QueenSide},
+		{chess.Black, chess.KingSide},
+		{chess.Black, chess.QueenSide},
+	} {
+		if rights.CanCastle(right.color, right.side) {
+			hash ^= zobristKeys.castling[i]
+		}
+	}
+
+	if sq := pos.EnPassantSquare(); sq != chess.NoSquare {
+		hash ^= zobristKeys.enPassant[sq.File()]
+	}
+
+	return hash
+}
@@ -1,13 +1,17 @@
 package decision
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/notnil/chess"
 	"go.uber.org/zap"
 
+	"github.com/thyrook/partner/internal/data"
 	"github.com/thyrook/partner/internal/model"
+	"github.com/thyrook/partner/internal/search"
 	"github.com/thyrook/partner/internal/vision"
 )
 
@@ -18,6 +22,10 @@ type RankedMove struct {
 	MoveIndex   int
 	Explanation string
 	Category    string // "Excellent", "Good", "Fair", "Risky"
+
+	// Search statistics, set when the move was ranked by RankSearch
+	Visits int
+	Value  float64 // Mean search value for the side to move
 }
 
 type DecisionEngine struct {
@@ -28,6 +36,12 @@ type DecisionEngine struct {
 	logger              *zap.Logger
 	mu                  sync.RWMutex
 
+	// Current game position; when set, illegal moves are masked out
+	position *chess.Position
+
+	// When set and the position is known, decisions come from a tree search
+	searcher *search.Searcher
+
 	// Statistics
 	totalDecisions     int
 	successfulCaptures int
@@ -85,9 +99,26 @@ func (de *DecisionEngine) MakeDecision() (*Decision, error) {
 	de.successfulCaptures++
 	de.mu.Unlock()
 
-	// Run inference with timing
+	// Run inference (or the search) with timing
+	de.mu.RLock()
+	pos, searcher := de.position, de.searcher
+	de.mu.RUnlock()
+
+	var rankedMoves []RankedMove
 	inferStart := time.Now()
-	predictions, err := de.model.Predict(boardState.Grid)
+	if searcher != nil && pos != nil {
+		var result *search.Result
+		result, err = searcher.Search(context.Background(), pos)
+		if err == nil {
+			rankedMoves = de.RankSearch(result, pos, de.topK)
+		}
+	} else {
+		var predictions []float64
+		predictions, err = de.model.Predict(boardState.Grid)
+		if err == nil {
+			rankedMoves = de.RankPolicy(predictions, pos, de.topK)
+		}
+	}
 	inferDuration := time.Since(inferStart)
 
 	de.mu.Lock()
@@ -99,9 +130,6 @@ func (de *DecisionEngine) MakeDecision() (*Decision, error) {
 		return nil, fmt.Errorf("inference failed: %w", err)
 	}
 
-	// Rank and select moves
-	rankedMoves := de.rankMoves(predictions)
-
 	if len(rankedMoves) == 0 {
 		return nil, fmt.Errorf("no valid moves found")
 	}
@@ -169,17 +197,63 @@ func (de *DecisionEngine) captureBoardWithFallback() (*vision.BoardState, error)
 	return nil, fmt.Errorf("all capture attempts failed: %w", lastErr)
 }
 
+// SetPosition sets the position decisions are made for. The captured board
+// cannot show side to move, castling or en-passant rights, so ranking only
+// masks illegal moves when the position is known. Pass nil to disable masking.
+func (de *DecisionEngine) SetPosition(pos *chess.Position) {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	de.position = pos
+}
+
+// SetSearcher makes MakeDecision rank moves by a tree search from the
+// position set with SetPosition instead of by a single forward pass. Pass
+// nil to rank the raw policy again.
+func (de *DecisionEngine) SetSearcher(searcher *search.Searcher) {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	de.searcher = searcher
+}
+
 func (de *DecisionEngine) rankMoves(predictions []float64) []RankedMove {
+	de.mu.RLock()
+	pos := de.position
+	de.mu.RUnlock()
+	return de.RankPolicy(predictions, pos, de.topK)
+}
+
+// RankPolicy ranks the top K moves of a policy computed for pos, with the
+// same explanations and categories as MakeDecision. Unlike SetPosition the
+// position only applies to this call, so concurrent callers can rank
+// different positions. pos may be nil when it is unknown.
+func (de *DecisionEngine) RankPolicy(predictions []float64, pos *chess.Position, topK int) []RankedMove {
+	// Restrict the policy to legal moves when the position is known
+	legal := model.LegalMask(pos, len(predictions))
+	if legal != nil {
+		predictions = model.MaskPolicy(predictions, legal)
+	}
+	board := positionGrid(pos)
+
 	// Get top K moves from model
-	topMoves := model.GetTopKMoves(predictions, de.topK)
+	topMoves := model.GetTopKMoves(predictions, topK)
 
 	rankedMoves := make([]RankedMove, 0, len(topMoves))
 
 	for i, moveScore := range topMoves {
+		if legal != nil && moveScore.Score == 0 {
+			break // Fewer legal moves than K
+		}
 		move := model.DecodeMove(moveScore.MoveIndex)
 
 		// Detect patterns for this move
-		patterns := de.detectMovePatterns(move, predictions)
+		patterns := de.detectMovePatterns(move, board)
+
+		// Resolve the index so queen promotions carry their piece
+		if pos != nil {
+			if resolved, err := data.MoveFromIndex(pos, moveScore.MoveIndex); err == nil {
+				move = resolved.String()
+			}
+		}
 
 		// Generate comprehensive explanation with pattern awareness
 		explanation := de.generateRichExplanation(moveScore.Score, i+1, move, patterns)
@@ -200,6 +274,56 @@ func (de *DecisionEngine) rankMoves(predictions []float64) []RankedMove {
 	return rankedMoves
 }
 
+// RankSearch ranks the top K moves of a search by visit count. The
+// confidence of a move is its share of the playouts, so the explanations and
+// categories read as they do for RankPolicy.
+func (de *DecisionEngine) RankSearch(result *search.Result, pos *chess.Position, topK int) []RankedMove {
+	board := positionGrid(pos)
+	rankedMoves := make([]RankedMove, 0, topK)
+	for i, stat := range result.Moves {
+		if i >= topK {
+			break
+		}
+		patterns := de.detectMovePatterns(stat.Move, board)
+		explanation := de.generateRichExplanation(stat.Share, i+1, stat.Move, patterns)
+		explanation += fmt.Sprintf("(%d/%d playouts, value %+.2f) ", stat.Visits, result.Playouts, stat.Value)
+
+		moveIndex, err := model.EncodeMove(stat.Move)
+		if err != nil {
+			moveIndex = -1
+		}
+
+		rankedMoves = append(rankedMoves, RankedMove{
+			Move:        stat.Move,
+			Confidence:  stat.Share,
+			Rank:        i + 1,
+			MoveIndex:   moveIndex,
+			Explanation: explanation,
+			Category:    de.CategorizeMove(stat.Share, patterns),
+			Visits:      stat.Visits,
+			Value:       stat.Value,
+		})
+	}
+	return rankedMoves
+}
+
+// positionGrid returns the board as 64 values (a1 = 0) holding the piece
+// type, positive for white and negative for black, or nil without a position
+func positionGrid(pos *chess.Position) []float64 {
+	if pos == nil {
+		return nil
+	}
+	grid := make([]float64, 64)
+	for sq, piece := range pos.Board().SquareMap() {
+		value := float64(piece.Type())
+		if piece.Color() == chess.Black {
+			value = -value
+		}
+		grid[int(sq)] = value
+	}
+	return grid
+}
+
 func (de *DecisionEngine) generateRichExplanation(confidence float64, rank int, move string, patterns []string) string {
 	explanation := ""
 
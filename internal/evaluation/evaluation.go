@@ -0,0 +1,342 @@
+package evaluation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/model"
+	"github.com/thyrook/partner/internal/search"
+)
+
+// Ranker orders the legal moves of positions, best first, in UCI notation
+type Ranker interface {
+	Rank(positions []*chess.Position) ([][]string, error)
+}
+
+// PolicyRanker ranks moves by the policy of one forward pass
+type PolicyRanker struct {
+	runtime *model.Runtime
+}
+
+// NewPolicyRanker creates a ranker for a model runtime
+func NewPolicyRanker(r *model.Runtime) *PolicyRanker {
+	return &PolicyRanker{runtime: r}
+}
+
+// Rank implements Ranker. The positions are evaluated in one batch.
+func (p *PolicyRanker) Rank(positions []*chess.Position) ([][]string, error) {
+	states := make([][]float32, len(positions))
+	logits := make([][]float64, len(positions))
+	for i, pos := range positions {
+		state, err := data.TensorizePosition(pos, p.runtime.InputChannels())
+		if err != nil {
+			return nil, fmt.Errorf("failed to tensorize position: %w", err)
+		}
+		states[i] = state
+		logits[i] = make([]float64, p.runtime.PolicySize())
+	}
+	if err := p.runtime.LogitsBatch(states, logits, nil); err != nil {
+		return nil, err
+	}
+
+	encoding := p.runtime.MoveEncoding()
+	rankings := make([][]string, len(positions))
+	for i, pos := range positions {
+		moves := pos.ValidMoves()
+		scores := make([]float64, len(moves))
+		for j, move := range moves {
+			index, err := encoding.EncodeMoveIndex(int(move.S1()), int(move.S2()), move.Promo())
+			if err != nil {
+				return nil, err
+			}
+			scores[j] = logits[i][index]
+		}
+		rankings[i] = rankByScore(moves, scores)
+	}
+	return rankings, nil
+}
+
+// SearchRanker ranks moves by the visit counts of a tree search
+type SearchRanker struct {
+	searcher *search.Searcher
+}
+
+// NewSearchRanker creates a ranker that searches every position
+func NewSearchRanker(searcher *search.Searcher) *SearchRanker {
+	return &SearchRanker{searcher: searcher}
+}
+
+// Rank implements Ranker
+func (s *SearchRanker) Rank(positions []*chess.Position) ([][]string, error) {
+	rankings := make([][]string, len(positions))
+	for i, pos := range positions {
+		result, err := s.searcher.Search(context.Background(), pos)
+		if err != nil {
+			return nil, err
+		}
+		for _, move := range result.Moves {
+			rankings[i] = append(rankings[i], move.Move)
+		}
+	}
+	return rankings, nil
+}
+
+// rankByScore sorts moves by descending score; ties keep the move order
+func rankByScore(moves []*chess.Move, scores []float64) []string {
+	order := make([]int, len(moves))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	ranking := make([]string, len(moves))
+	for i, j := range order {
+		ranking[i] = moves[j].String()
+	}
+	return ranking
+}
+
+// Metrics summarizes the results of a set of positions. Accuracy and MRR
+// cover positions with best moves; Avoided covers positions with moves to
+// avoid.
+type Metrics struct {
+	Positions      int     `json:"positions"`
+	Top1           float64 `json:"top1"`
+	Top3           float64 `json:"top3"`
+	Top5           float64 `json:"top5"`
+	MRR            float64 `json:"mrr"` // Mean reciprocal rank of the best move
+	AvoidPositions int     `json:"avoid_positions,omitempty"`
+	Avoided        float64 `json:"avoided,omitempty"` // Fraction whose top move is not one to avoid
+}
+
+// PositionResult is the outcome of one position
+type PositionResult struct {
+	ID      string `json:"id"`
+	Rank    int    `json:"rank,omitempty"` // Rank of the best move, 0 without one
+	Top     string `json:"top"`            // Top ranked move
+	Correct bool   `json:"correct"`        // Top move is a best move and not one to avoid
+}
+
+// Report is the evaluation of a model. Maps are keyed by bucket name, so
+// reports of two checkpoints can be diffed line by line.
+type Report struct {
+	Model     string             `json:"model"`
+	ModelType string             `json:"model_type,omitempty"`
+	Ranker    string             `json:"ranker"`
+	Overall   Metrics            `json:"overall"`
+	Sources   map[string]Metrics `json:"sources"`
+	Phases    map[string]Metrics `json:"phases"`
+	Pieces    map[string]Metrics `json:"pieces"`
+	EloBands  map[string]Metrics `json:"elo_bands"`
+	Results   []PositionResult   `json:"results,omitempty"`
+}
+
+// Config controls an evaluation
+type Config struct {
+	BatchSize        int  // Positions ranked per call
+	IncludePositions bool // Add per-position results to the report
+}
+
+// DefaultConfig returns the default evaluation configuration
+func DefaultConfig() Config {
+	return Config{BatchSize: 64}
+}
+
+// accumulator sums the results of positions for one Metrics
+type accumulator struct {
+	positions, top1, top3, top5 int
+	reciprocal                  float64
+	avoidPositions, avoided     int
+}
+
+func (a *accumulator) add(p Position, result PositionResult) {
+	if len(p.Best) > 0 {
+		a.positions++
+		if result.Rank == 1 {
+			a.top1++
+		}
+		if result.Rank <= 3 {
+			a.top3++
+		}
+		if result.Rank <= 5 {
+			a.top5++
+		}
+		a.reciprocal += 1 / float64(result.Rank)
+	}
+	if len(p.Avoid) > 0 {
+		a.avoidPositions++
+		if !contains(p.Avoid, result.Top) {
+			a.avoided++
+		}
+	}
+}
+
+func (a *accumulator) metrics() Metrics {
+	m := Metrics{Positions: a.positions, AvoidPositions: a.avoidPositions}
+	if a.positions > 0 {
+		n := float64(a.positions)
+		m.Top1, m.Top3, m.Top5 = float64(a.top1)/n, float64(a.top3)/n, float64(a.top5)/n
+		m.MRR = a.reciprocal / n
+	}
+	if a.avoidPositions > 0 {
+		m.Avoided = float64(a.avoided) / float64(a.avoidPositions)
+	}
+	return m
+}
+
+// Evaluate ranks the moves of every position and reports how often the best
+// moves come out on top, overall and by source, game phase, piece count and
+// Elo band of the side to move
+func Evaluate(ranker Ranker, positions []Position, config Config) (*Report, error) {
+	if config.BatchSize < 1 {
+		config.BatchSize = DefaultConfig().BatchSize
+	}
+
+	var overall accumulator
+	buckets := map[string]map[string]*accumulator{
+		"sources": {}, "phases": {}, "pieces": {}, "elo": {},
+	}
+	bucket := func(group, name string) *accumulator {
+		if buckets[group][name] == nil {
+			buckets[group][name] = &accumulator{}
+		}
+		return buckets[group][name]
+	}
+
+	report := &Report{}
+	for start := 0; start < len(positions); start += config.BatchSize {
+		batch := positions[start:min(start+config.BatchSize, len(positions))]
+		boards := make([]*chess.Position, len(batch))
+		for i, p := range batch {
+			boards[i] = p.Position
+		}
+		rankings, err := ranker.Rank(boards)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rank positions: %w", err)
+		}
+
+		for i, p := range batch {
+			result := score(p, rankings[i])
+			overall.add(p, result)
+			for group, name := range map[string]string{
+				"sources": p.Source,
+				"phases":  Phase(p.Position),
+				"pieces":  PieceBucket(p.Position),
+				"elo":     EloBand(p.Elo),
+			} {
+				bucket(group, name).add(p, result)
+			}
+			if config.IncludePositions {
+				report.Results = append(report.Results, result)
+			}
+		}
+	}
+
+	report.Overall = overall.metrics()
+	metrics := func(group string) map[string]Metrics {
+		out := make(map[string]Metrics, len(buckets[group]))
+		for name, acc := range buckets[group] {
+			out[name] = acc.metrics()
+		}
+		return out
+	}
+	report.Sources, report.Phases = metrics("sources"), metrics("phases")
+	report.Pieces, report.EloBands = metrics("pieces"), metrics("elo")
+	return report, nil
+}
+
+// score finds the rank of the position's best moves in a ranking and
+// whether the top move is correct
+func score(p Position, ranking []string) PositionResult {
+	result := PositionResult{ID: p.ID}
+	if len(ranking) > 0 {
+		result.Top = ranking[0]
+	}
+	if len(p.Best) > 0 {
+		result.Rank = len(ranking) + 1 // A best move missing from the ranking ranks last
+		for rank, move := range ranking {
+			if contains(p.Best, move) {
+				result.Rank = rank + 1
+				break
+			}
+		}
+	}
+	result.Correct = (len(p.Best) == 0 || result.Rank == 1) && !contains(p.Avoid, result.Top)
+	return result
+}
+
+func contains(moves []string, move string) bool {
+	for _, m := range moves {
+		if m == move {
+			return true
+		}
+	}
+	return false
+}
+
+// Phase classifies a position as opening, middlegame or endgame. Phase
+// material counts 1 for a minor piece, 2 for a rook and 4 for a queen (24 in
+// the starting position): openings are the first 10 moves with at least 20
+// of it left, endgames have at most 8 left. EPD records without a move
+// number count as move 1.
+func Phase(pos *chess.Position) string {
+	weights := map[chess.PieceType]int{chess.Knight: 1, chess.Bishop: 1, chess.Rook: 2, chess.Queen: 4}
+	material := 0
+	for _, piece := range pos.Board().SquareMap() {
+		material += weights[piece.Type()]
+	}
+	switch {
+	case material <= 8:
+		return "endgame"
+	case material >= 20 && fullMoveNumber(pos) <= 10:
+		return "opening"
+	default:
+		return "middlegame"
+	}
+}
+
+// fullMoveNumber reads the move number from the position's FEN
+func fullMoveNumber(pos *chess.Position) int {
+	var placement, turn, castling, ep string
+	var halfmove, fullmove int
+	if _, err := fmt.Sscan(pos.String(), &placement, &turn, &castling, &ep, &halfmove, &fullmove); err != nil {
+		return 1
+	}
+	return fullmove
+}
+
+// PieceBucket groups positions by the number of pieces on the board,
+// kings and pawns included
+func PieceBucket(pos *chess.Position) string {
+	count := len(pos.Board().SquareMap())
+	switch {
+	case count <= 8:
+		return "02-08"
+	case count <= 16:
+		return "09-16"
+	case count <= 24:
+		return "17-24"
+	default:
+		return "25-32"
+	}
+}
+
+// EloBand groups ratings into 200 point bands
+func EloBand(elo int) string {
+	switch {
+	case elo <= 0:
+		return "unknown"
+	case elo < 1200:
+		return "<1200"
+	case elo >= 2600:
+		return "2600+"
+	default:
+		low := elo / 200 * 200
+		return fmt.Sprintf("%d-%d", low, low+199)
+	}
+}
@@ -0,0 +1,148 @@
+package evaluation
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/model"
+)
+
+// fixedRanker returns the same ranking for every position
+type fixedRanker []string
+
+func (f fixedRanker) Rank(positions []*chess.Position) ([][]string, error) {
+	rankings := make([][]string, len(positions))
+	for i := range rankings {
+		rankings[i] = f
+	}
+	return rankings, nil
+}
+
+func TestEvaluate(t *testing.T) {
+	start := chess.NewGame().Position()
+	positions := []Position{
+		{ID: "a", Source: "x.epd", Position: start, Best: []string{"e2e4"}},
+		{ID: "b", Source: "x.epd", Position: start, Best: []string{"d2d4", "c2c4"}},
+		{ID: "c", Source: "y.pgn", Position: start, Best: []string{"h2h4"}, Elo: 1900},
+		{ID: "d", Source: "y.pgn", Position: start, Avoid: []string{"e2e4"}},
+		{ID: "e", Source: "y.pgn", Position: start, Avoid: []string{"a2a3"}},
+	}
+	ranking := fixedRanker{"e2e4", "g1f3", "c2c4", "d2d4", "b1c3", "h2h3", "h2h4"}
+
+	config := DefaultConfig()
+	config.BatchSize = 2
+	config.IncludePositions = true
+	report, err := Evaluate(ranking, positions, config)
+	if err != nil {
+		t.Fatalf("Failed to evaluate: %v", err)
+	}
+
+	// Ranks 1, 3 and 7
+	want := Metrics{Positions: 3, Top1: 1.0 / 3, Top3: 2.0 / 3, Top5: 2.0 / 3, MRR: (1 + 1.0/3 + 1.0/7) / 3, AvoidPositions: 2, Avoided: 0.5}
+	if got := report.Overall; got.Positions != want.Positions || got.AvoidPositions != want.AvoidPositions ||
+		math.Abs(got.Top1-want.Top1)+math.Abs(got.Top3-want.Top3)+math.Abs(got.Top5-want.Top5)+math.Abs(got.MRR-want.MRR)+math.Abs(got.Avoided-want.Avoided) > 1e-9 {
+		t.Errorf("Overall %+v, want %+v", got, want)
+	}
+	if x := report.Sources["x.epd"]; x.Positions != 2 || x.Top1 != 0.5 {
+		t.Errorf("Source x.epd: %+v", x)
+	}
+	if elo := report.EloBands["1800-1999"]; elo.Positions != 1 || elo.Top5 != 0 {
+		t.Errorf("Elo band 1800-1999: %+v", elo)
+	}
+	if opening := report.Phases["opening"]; opening.Positions != 3 || report.Pieces["25-32"].AvoidPositions != 2 {
+		t.Errorf("Phases %+v, pieces %+v", report.Phases, report.Pieces)
+	}
+	correct := map[string]bool{"a": true, "b": false, "c": false, "d": false, "e": true}
+	for _, r := range report.Results {
+		if r.Correct != correct[r.ID] || r.Top != "e2e4" {
+			t.Errorf("Result %+v", r)
+		}
+	}
+}
+
+func TestPolicyRanker(t *testing.T) {
+	cnn, err := model.NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+	r, err := model.NewRuntime(cnn)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+
+	positions, err := ParseEPD(strings.NewReader(testEPD), "tactics.epd")
+	if err != nil {
+		t.Fatalf("Failed to parse EPD: %v", err)
+	}
+	boards := []*chess.Position{positions[0].Position, positions[1].Position}
+	rankings, err := NewPolicyRanker(r).Rank(boards)
+	if err != nil {
+		t.Fatalf("Failed to rank: %v", err)
+	}
+
+	// Every legal move is ranked once, in the order of the single position forward pass
+	for i, pos := range boards {
+		if len(rankings[i]) != len(pos.ValidMoves()) {
+			t.Errorf("Position %d: ranked %d of %d moves", i, len(rankings[i]), len(pos.ValidMoves()))
+		}
+		predictions, err := r.PredictState(mustTensorize(t, r, pos), 1)
+		if err != nil {
+			t.Fatalf("Failed to predict: %v", err)
+		}
+		if predictions[0].UCI() != rankings[i][0] {
+			t.Errorf("Position %d: top move %s, want %s", i, rankings[i][0], predictions[0].UCI())
+		}
+	}
+
+	report, err := Evaluate(NewPolicyRanker(r), positions, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to evaluate: %v", err)
+	}
+	if report.Overall.Positions != 2 || report.Overall.AvoidPositions != 2 || report.Overall.MRR <= 0 {
+		t.Errorf("Report: %+v", report.Overall)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	tests := []struct {
+		fen    string
+		phase  string
+		pieces string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", "opening", "25-32"},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 30", "middlegame", "25-32"},
+		{"r3k3/pp3ppp/8/8/8/8/PP3PPP/R3K3 w - - 0 40", "endgame", "09-16"},
+		{"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", "endgame", "09-16"},
+		{"8/8/4k3/8/8/3K4/8/8 w - - 0 60", "endgame", "02-08"},
+	}
+	for _, tt := range tests {
+		fen, err := chess.FEN(tt.fen)
+		if err != nil {
+			t.Fatalf("Failed to parse FEN: %v", err)
+		}
+		pos := chess.NewGame(fen).Position()
+		if phase, pieces := Phase(pos), PieceBucket(pos); phase != tt.phase || pieces != tt.pieces {
+			t.Errorf("%s: %s %s, want %s %s", tt.fen, phase, pieces, tt.phase, tt.pieces)
+		}
+	}
+
+	for elo, want := range map[int]string{0: "unknown", 900: "<1200", 1200: "1200-1399", 2399: "2200-2399", 2850: "2600+"} {
+		if got := EloBand(elo); got != want {
+			t.Errorf("EloBand(%d) = %s, want %s", elo, got, want)
+		}
+	}
+}
+
+func mustTensorize(t *testing.T, r *model.Runtime, pos *chess.Position) []float32 {
+	t.Helper()
+	state, err := data.TensorizePosition(pos, r.InputChannels())
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	return state
+}
@@ -0,0 +1,218 @@
+package evaluation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/data"
+)
+
+// Position is a test position with the moves that count as right or wrong
+type Position struct {
+	ID       string
+	Source   string // Base name of the file the position came from
+	Position *chess.Position
+	Best     []string // UCI moves counted as correct: EPD bm, or the move played
+	Avoid    []string // UCI moves counted as mistakes: EPD am
+	Elo      int      // Rating of the side to move, 0 if unknown
+}
+
+// LoadEPD reads the positions of an EPD file. Each line holds the first four
+// FEN fields followed by operations such as bm (best moves), am (moves to
+// avoid) and id; lines without bm or am are skipped.
+func LoadEPD(path string) ([]Position, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPD file: %w", err)
+	}
+	defer file.Close()
+	return ParseEPD(file, filepath.Base(path))
+}
+
+// ParseEPD reads EPD records from r, labelling them with source
+func ParseEPD(r io.Reader, source string) ([]Position, error) {
+	var positions []Position
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		position, err := parseEPDLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, line, err)
+		}
+		if len(position.Best) == 0 && len(position.Avoid) == 0 {
+			continue
+		}
+		position.Source = source
+		if position.ID == "" {
+			position.ID = fmt.Sprintf("%s:%d", source, line)
+		}
+		positions = append(positions, position)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read EPD: %w", err)
+	}
+	return positions, nil
+}
+
+// parseEPDLine parses one EPD record
+func parseEPDLine(line string) (Position, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return Position{}, fmt.Errorf("expected 4 FEN fields, got %q", line)
+	}
+	// Skip the FEN fields in the original text, so quoted operands keep their spacing
+	rest := line
+	for i := 0; i < 4; i++ {
+		rest = strings.TrimSpace(rest)
+		rest = rest[len(fields[i]):]
+	}
+
+	operations := splitOperations(rest)
+	halfmove, fullmove := "0", "1"
+	if operands := operations["hmvc"]; len(operands) == 1 {
+		halfmove = operands[0]
+	}
+	if operands := operations["fmvn"]; len(operands) == 1 {
+		fullmove = operands[0]
+	}
+	fen, err := chess.FEN(strings.Join(append(fields[:4:4], halfmove, fullmove), " "))
+	if err != nil {
+		return Position{}, fmt.Errorf("invalid position: %w", err)
+	}
+	pos := chess.NewGame(fen).Position()
+
+	position := Position{Position: pos}
+	if operands := operations["id"]; len(operands) > 0 {
+		position.ID = strings.Join(operands, " ")
+	}
+	for _, op := range []struct {
+		opcode string
+		moves  *[]string
+	}{{"bm", &position.Best}, {"am", &position.Avoid}} {
+		for _, san := range operations[op.opcode] {
+			move := findMove(pos, san)
+			if move == nil {
+				return Position{}, fmt.Errorf("%s move %s is not legal", op.opcode, san)
+			}
+			*op.moves = append(*op.moves, move.String())
+		}
+	}
+	return position, nil
+}
+
+// splitOperations splits "bm Nf3 Nc3; id \"a; b\";" into opcodes and operands
+func splitOperations(text string) map[string][]string {
+	operations := make(map[string][]string)
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	flush := func() {
+		if token.Len() > 0 {
+			tokens = append(tokens, token.String())
+			token.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+			token.WriteRune(r)
+		case r == ';':
+			flush()
+			if len(tokens) > 0 {
+				operations[tokens[0]] = tokens[1:]
+			}
+			tokens = nil
+		case r == ' ' || r == '\t':
+			flush()
+		default:
+			token.WriteRune(r)
+		}
+	}
+	flush()
+	if len(tokens) > 0 {
+		operations[tokens[0]] = tokens[1:]
+	}
+	return operations
+}
+
+// findMove resolves a move in SAN (check marks and annotations are ignored)
+// or UCI notation
+func findMove(pos *chess.Position, text string) *chess.Move {
+	san := strings.TrimRight(text, "+#!?")
+	for _, move := range pos.ValidMoves() {
+		if move.String() == text || strings.TrimRight(chess.AlgebraicNotation{}.Encode(pos, move), "+#") == san {
+			return move
+		}
+	}
+	return nil
+}
+
+// PGNOptions selects the positions taken from PGN games
+type PGNOptions struct {
+	SkipOpening  int // Skip the first N plies of each game
+	Every        int // Keep every Nth remaining position (1 keeps all)
+	MaxPositions int // Stop after this many positions (0 = all)
+}
+
+// LoadPGN reads held-out games and returns each position with the move
+// played as the best move. Files ending in .zst, .gz or .bz2 are
+// decompressed on the fly.
+func LoadPGN(path string, options PGNOptions) ([]Position, error) {
+	stream, err := data.OpenPGNStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	if options.Every < 1 {
+		options.Every = 1
+	}
+	source := filepath.Base(path)
+	var positions []Position
+	for stream.Next() {
+		game := stream.Game()
+		info := data.ParseGameInfo(game.Game)
+		extracted, err := data.ExtractPositions(game.Game)
+		if err != nil {
+			continue
+		}
+		for ply, extract := range extracted {
+			if ply < options.SkipOpening || (ply-options.SkipOpening)%options.Every != 0 {
+				continue
+			}
+			elo := info.WhiteElo
+			if extract.Position.Turn() == chess.Black {
+				elo = info.BlackElo
+			}
+			positions = append(positions, Position{
+				ID:       source + ":" + strconv.Itoa(game.Index+1) + ":" + strconv.Itoa(ply),
+				Source:   source,
+				Position: extract.Position,
+				Best:     []string{extract.Move.String()},
+				Elo:      elo,
+			})
+			if options.MaxPositions > 0 && len(positions) >= options.MaxPositions {
+				return positions, nil
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read PGN: %w", err)
+	}
+	return positions, nil
+}
@@ -0,0 +1,100 @@
+package evaluation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testEPD = `# Tactics
+6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - bm Ra8#; id "back rank; mate";
+r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - bm Bb5 Bc4; am Qe2; hmvc 2; fmvn 3;
+6k1/8/4p3/3p4/3Q4/8/8/6K1 w - - am Qxd5+;
+rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - c0 "no opcodes we use";
+`
+
+func TestParseEPD(t *testing.T) {
+	positions, err := ParseEPD(strings.NewReader(testEPD), "tactics.epd")
+	if err != nil {
+		t.Fatalf("Failed to parse EPD: %v", err)
+	}
+	if len(positions) != 3 {
+		t.Fatalf("Parsed %d positions, want 3", len(positions))
+	}
+
+	tests := []struct {
+		id    string
+		best  []string
+		avoid []string
+	}{
+		{"back rank; mate", []string{"a1a8"}, nil},
+		{"tactics.epd:3", []string{"f1b5", "f1c4"}, []string{"d1e2"}},
+		{"tactics.epd:4", nil, []string{"d4d5"}},
+	}
+	for i, tt := range tests {
+		p := positions[i]
+		if p.ID != tt.id || !reflect.DeepEqual(p.Best, tt.best) || !reflect.DeepEqual(p.Avoid, tt.avoid) || p.Source != "tactics.epd" {
+			t.Errorf("Position %d: %s best %v avoid %v, want %s %v %v", i, p.ID, p.Best, p.Avoid, tt.id, tt.best, tt.avoid)
+		}
+	}
+	if fen := positions[1].Position.String(); !strings.HasSuffix(fen, " 2 3") {
+		t.Errorf("Move counters not applied: %s", fen)
+	}
+
+	for _, bad := range []string{
+		"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - bm Qh5;",
+		"6k1/5ppp/8/8 w - - bm Ra8;",
+		"6k1/5ppp w",
+	} {
+		if _, err := ParseEPD(strings.NewReader(bad), "bad.epd"); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadPGN(t *testing.T) {
+	pgn := `[Event "Held out"]
+[WhiteElo "1850"]
+[BlackElo "2210"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+
+[Event "Unrated"]
+[Result "1/2-1/2"]
+
+1. d4 d5 1/2-1/2
+`
+	path := filepath.Join(t.TempDir(), "heldout.pgn")
+	if err := os.WriteFile(path, []byte(pgn), 0644); err != nil {
+		t.Fatalf("Failed to write PGN: %v", err)
+	}
+
+	positions, err := LoadPGN(path, PGNOptions{})
+	if err != nil {
+		t.Fatalf("Failed to load PGN: %v", err)
+	}
+	if len(positions) != 9 {
+		t.Fatalf("Loaded %d positions, want 9", len(positions))
+	}
+	if p := positions[0]; p.Best[0] != "e2e4" || p.Elo != 1850 || p.ID != "heldout.pgn:1:0" {
+		t.Errorf("First position: %+v", p)
+	}
+	if p := positions[1]; p.Best[0] != "e7e5" || p.Elo != 2210 {
+		t.Errorf("Second position: %+v", p)
+	}
+	if p := positions[8]; p.Best[0] != "d7d5" || p.Elo != 0 {
+		t.Errorf("Last position: %+v", p)
+	}
+
+	// Skip the first two plies, then keep every third position
+	positions, err = LoadPGN(path, PGNOptions{SkipOpening: 2, Every: 3, MaxPositions: 2})
+	if err != nil {
+		t.Fatalf("Failed to load PGN: %v", err)
+	}
+	if len(positions) != 2 || positions[0].Best[0] != "d1h5" || positions[1].Best[0] != "g8f6" {
+		t.Errorf("Sampled positions: %+v", positions)
+	}
+}
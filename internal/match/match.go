@@ -0,0 +1,359 @@
+package match
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/search"
+)
+
+// Adjudication ends games that the players would drag out. Draws by the
+// rules of chess (stalemate, insufficient material, threefold repetition
+// and the fifty-move rule) and checkmates always end a game.
+type Adjudication struct {
+	MaxPlies  int // Declare a draw after this many plies, 0 for no limit
+	WinMargin int // Material lead in centipawns that wins the game...
+	WinPlies  int // ...once held for this many consecutive plies, 0 to disable
+}
+
+// Config controls a match
+type Config struct {
+	Games        int       // Games to play
+	Concurrency  int       // Games played in parallel
+	Openings     []Opening // Each opening is played twice with colors swapped; none starts from the initial position
+	Adjudication Adjudication
+	SPRT         SPRTConfig
+	StopOnSPRT   bool  // Stop scheduling games once the SPRT accepts a hypothesis
+	Seed         int64 // Game i draws its random moves from Seed+i
+	Event        string
+}
+
+// DefaultConfig returns the default match configuration
+func DefaultConfig() Config {
+	return Config{
+		Games:       100,
+		Concurrency: 4,
+		Adjudication: Adjudication{
+			MaxPlies:  300,
+			WinMargin: 1000,
+			WinPlies:  8,
+		},
+		SPRT:  DefaultSPRTConfig(),
+		Event: "P.A.R.T.N.E.R match",
+	}
+}
+
+// GameResult is the outcome of one game
+type GameResult struct {
+	Index       int
+	White       string
+	Black       string
+	Opening     string
+	Result      string // "1-0", "0-1" or "1/2-1/2"
+	Termination string // How the game ended, e.g. "checkmate" or "adjudication: material"
+	Plies       int
+	PGN         string
+}
+
+// ScoreA is the first player's score: 1 for a win, 0.5 for a draw
+func (g GameResult) ScoreA() float64 {
+	aWhite := g.Index%2 == 0
+	switch {
+	case g.Result == "1/2-1/2":
+		return 0.5
+	case (g.Result == "1-0") == aWhite:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Result is the outcome of a match, counted from the first player's view
+type Result struct {
+	PlayerA string
+	PlayerB string
+	Wins    int
+	Draws   int
+	Losses  int
+	Games   []GameResult // In game order
+	SPRT    SPRTResult
+}
+
+// Elo returns the first player's Elo difference and its 95% margin
+func (r *Result) Elo() (float64, float64) {
+	return EloDifference(r.Wins, r.Draws, r.Losses)
+}
+
+// add counts a finished game
+func (r *Result) add(game GameResult) {
+	switch game.ScoreA() {
+	case 1:
+		r.Wins++
+	case 0:
+		r.Losses++
+	default:
+		r.Draws++
+	}
+	r.Games = append(r.Games, game)
+}
+
+// Run plays a match between a and b. Player a has White in even games.
+// onGame, if not nil, is called after every game from a single goroutine.
+func Run(ctx context.Context, a, b Player, config Config, onGame func(GameResult, *Result)) (*Result, error) {
+	if config.Games < 1 {
+		return nil, fmt.Errorf("a match needs at least one game")
+	}
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indices := make(chan int)
+	go func() {
+		defer close(indices)
+		for i := 0; i < config.Games; i++ {
+			select {
+			case indices <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	result := &Result{PlayerA: a.Name(), PlayerB: b.Name()}
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for w := 0; w < config.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				game, err := playGame(ctx, i, a, b, config)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					if firstErr == nil && ctx.Err() == nil {
+						firstErr = err
+					}
+					cancel()
+				case ctx.Err() == nil:
+					result.add(game)
+					result.SPRT = SPRT(result.Wins, result.Draws, result.Losses, config.SPRT)
+					if onGame != nil {
+						onGame(game, result)
+					}
+					if config.StopOnSPRT && result.SPRT.Verdict != SPRTContinue {
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil && len(result.Games) == 0 {
+		return nil, err
+	}
+	sort.Slice(result.Games, func(i, j int) bool {
+		return result.Games[i].Index < result.Games[j].Index
+	})
+	return result, nil
+}
+
+// playGame plays game i of a match
+func playGame(ctx context.Context, i int, a, b Player, config Config) (GameResult, error) {
+	white, black := a, b
+	if i%2 == 1 {
+		white, black = b, a
+	}
+	opening := Opening{Name: "startpos", Start: chess.StartingPosition()}
+	if len(config.Openings) > 0 {
+		opening = config.Openings[i/2%len(config.Openings)]
+	}
+	rng := rand.New(rand.NewSource(config.Seed + int64(i)))
+
+	fen, err := chess.FEN(opening.Start.String())
+	if err != nil {
+		return GameResult{}, fmt.Errorf("invalid opening %s: %w", opening.Name, err)
+	}
+	game := chess.NewGame(fen)
+	for _, move := range opening.Moves {
+		if err := game.Move(move); err != nil {
+			return GameResult{}, fmt.Errorf("invalid opening %s: %w", opening.Name, err)
+		}
+	}
+
+	var result, termination string
+	lead, leadPlies := 0, 0 // Sign of White's material lead and how long it has been held
+	for result == "" {
+		if game.Outcome() != chess.NoOutcome {
+			result, termination = string(game.Outcome()), methodName(game.Method())
+			break
+		}
+		for _, method := range game.EligibleDraws() {
+			if method == chess.ThreefoldRepetition || method == chess.FiftyMoveRule {
+				result, termination = "1/2-1/2", methodName(method)
+			}
+		}
+		plies := len(game.Moves())
+		if result == "" && config.Adjudication.MaxPlies > 0 && plies >= config.Adjudication.MaxPlies {
+			result, termination = "1/2-1/2", "adjudication: max plies"
+		}
+		if result != "" {
+			break
+		}
+
+		pos := game.Position()
+		player := white
+		if pos.Turn() == chess.Black {
+			player = black
+		}
+		move, err := player.Move(ctx, pos, rng)
+		if err != nil {
+			return GameResult{}, fmt.Errorf("game %d: %s failed to move: %w", i+1, player.Name(), err)
+		}
+		if err := game.Move(move); err != nil {
+			return GameResult{}, fmt.Errorf("game %d: %s played an illegal move: %w", i+1, player.Name(), err)
+		}
+
+		if adj := config.Adjudication; adj.WinPlies > 0 && game.Outcome() == chess.NoOutcome {
+			balance := search.MaterialBalance(game.Position())
+			if game.Position().Turn() == chess.Black {
+				balance = -balance
+			}
+			sign := 0
+			if balance >= adj.WinMargin {
+				sign = 1
+			} else if balance <= -adj.WinMargin {
+				sign = -1
+			}
+			if sign != 0 && sign == lead {
+				leadPlies++
+			} else {
+				lead, leadPlies = sign, 1
+			}
+			if lead != 0 && leadPlies >= adj.WinPlies {
+				result, termination = "1-0", "adjudication: material"
+				if lead < 0 {
+					result = "0-1"
+				}
+			}
+		}
+	}
+
+	g := GameResult{
+		Index:       i,
+		White:       white.Name(),
+		Black:       black.Name(),
+		Opening:     opening.Name,
+		Result:      result,
+		Termination: termination,
+		Plies:       len(game.Moves()),
+	}
+	g.PGN = encodePGN(game, g, config.Event)
+	return g, nil
+}
+
+// methodName describes how the rules ended a game
+func methodName(method chess.Method) string {
+	switch method {
+	case chess.Checkmate:
+		return "checkmate"
+	case chess.Stalemate:
+		return "stalemate"
+	case chess.ThreefoldRepetition, chess.FivefoldRepetition:
+		return "repetition"
+	case chess.FiftyMoveRule, chess.SeventyFiveMoveRule:
+		return "fifty-move rule"
+	case chess.InsufficientMaterial:
+		return "insufficient material"
+	default:
+		return strings.ToLower(method.String())
+	}
+}
+
+// encodePGN writes a game with its tags. Games that start from a position
+// other than the initial one carry SetUp and FEN tags.
+func encodePGN(game *chess.Game, g GameResult, event string) string {
+	positions := game.Positions()
+	start := positions[0]
+
+	var sb strings.Builder
+	tag := func(key, value string) {
+		fmt.Fprintf(&sb, "[%s %q]\n", key, value)
+	}
+	tag("Event", event)
+	tag("Site", "?")
+	tag("Date", time.Now().Format("2006.01.02"))
+	tag("Round", strconv.Itoa(g.Index+1))
+	tag("White", g.White)
+	tag("Black", g.Black)
+	tag("Result", g.Result)
+	if start.String() != chess.StartingPosition().String() {
+		tag("SetUp", "1")
+		tag("FEN", start.String())
+	}
+	tag("Opening", g.Opening)
+	tag("Termination", g.Termination)
+	sb.WriteString("\n")
+
+	moveNumber := fullMoveNumber(start)
+	line := 0
+	write := func(token string) {
+		if line > 0 && line+1+len(token) > 79 {
+			sb.WriteString("\n")
+			line = 0
+		} else if line > 0 {
+			sb.WriteString(" ")
+			line++
+		}
+		sb.WriteString(token)
+		line += len(token)
+	}
+	for i, move := range game.Moves() {
+		pos := positions[i]
+		san := chess.AlgebraicNotation{}.Encode(pos, move)
+		switch {
+		case pos.Turn() == chess.White:
+			write(fmt.Sprintf("%d. %s", moveNumber, san))
+		case i == 0:
+			write(fmt.Sprintf("%d... %s", moveNumber, san))
+		default:
+			write(san)
+		}
+		if pos.Turn() == chess.Black {
+			moveNumber++
+		}
+	}
+	write(g.Result)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// fullMoveNumber reads the move number from a position's FEN
+func fullMoveNumber(pos *chess.Position) int {
+	fields := strings.Fields(pos.String())
+	if len(fields) < 6 {
+		return 1
+	}
+	n, err := strconv.Atoi(fields[5])
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
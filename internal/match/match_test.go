@@ -0,0 +1,201 @@
+package match
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/search"
+)
+
+// favoriteEvaluator puts all of the prior on one move
+type favoriteEvaluator struct {
+	move string
+}
+
+func (e favoriteEvaluator) Evaluate(_ context.Context, pos *chess.Position) (search.Evaluation, error) {
+	moves := pos.ValidMoves()
+	priors := make([]float64, len(moves))
+	for i, move := range moves {
+		if move.String() == e.move {
+			priors[i] = 1
+		}
+	}
+	return search.Evaluation{Priors: priors}, nil
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	book := filepath.Join(dir, "book.epd")
+	content := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - id \"e4\";\n" +
+		"# comment\n" +
+		"rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR b KQkq - 0 1\n"
+	if err := os.WriteFile(book, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write book: %v", err)
+	}
+	openings, err := LoadOpenings(book, 0)
+	if err != nil {
+		t.Fatalf("Failed to load openings: %v", err)
+	}
+	if len(openings) != 2 || openings[0].Start.Turn() != chess.Black {
+		t.Fatalf("Loaded %d openings", len(openings))
+	}
+
+	config := DefaultConfig()
+	config.Games = 6
+	config.Concurrency = 3
+	config.Openings = openings
+	config.Adjudication.MaxPlies = 80
+	config.Seed = 42
+
+	calls := 0
+	run := func() *Result {
+		result, err := Run(context.Background(), MaterialPlayer{}, RandomPlayer{}, config, func(GameResult, *Result) { calls++ })
+		if err != nil {
+			t.Fatalf("Match failed: %v", err)
+		}
+		return result
+	}
+	result := run()
+
+	if result.Wins+result.Draws+result.Losses != 6 || len(result.Games) != 6 || calls != 6 {
+		t.Fatalf("Got %d-%d-%d over %d games", result.Wins, result.Draws, result.Losses, len(result.Games))
+	}
+	if result.Wins <= result.Losses {
+		t.Errorf("Material baseline scored %d-%d-%d against random moves", result.Wins, result.Draws, result.Losses)
+	}
+	for i, game := range result.Games {
+		wantWhite := "material"
+		if i%2 == 1 {
+			wantWhite = "random"
+		}
+		if game.Index != i || game.White != wantWhite || game.Opening != openings[i/2%2].Name {
+			t.Errorf("Game %d: index %d, %s as White, opening %s", i, game.Index, game.White, game.Opening)
+		}
+
+		// The PGN replays to the recorded result
+		replay, err := chess.PGN(strings.NewReader(game.PGN))
+		if err != nil {
+			t.Fatalf("Failed to parse PGN of game %d: %v\n%s", i, err, game.PGN)
+		}
+		g := chess.NewGame(replay)
+		if len(g.Moves()) != game.Plies || !strings.Contains(game.PGN, `[Result "`+game.Result+`"]`) {
+			t.Errorf("Game %d PGN has %d moves, want %d:\n%s", i, len(g.Moves()), game.Plies, game.PGN)
+		}
+		if !strings.Contains(game.PGN, `[FEN "`+openings[i/2%2].Start.String()+`"]`) {
+			t.Errorf("Game %d PGN lacks the opening FEN:\n%s", i, game.PGN)
+		}
+	}
+
+	// Seeded games repeat exactly, whatever order they finish in
+	again := run()
+	for i := range result.Games {
+		if again.Games[i].PGN != result.Games[i].PGN {
+			t.Errorf("Game %d differs between seeded runs", i)
+		}
+	}
+}
+
+func TestAdjudication(t *testing.T) {
+	opening := func(fen string) []Opening {
+		opt, err := chess.FEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to parse FEN: %v", err)
+		}
+		return []Opening{{Name: "test", Start: chess.NewGame(opt).Position()}}
+	}
+
+	tests := []struct {
+		name         string
+		fen          string
+		a            Player
+		adjudication Adjudication
+		result       string
+		termination  string
+		plies        int
+	}{
+		{"checkmate", "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", MaterialPlayer{}, Adjudication{}, "1-0", "checkmate", 1},
+		{"material", "4k3/8/8/8/8/8/8/QQ2K3 w - - 0 1", RandomPlayer{}, Adjudication{WinMargin: 1000, WinPlies: 2}, "1-0", "adjudication: material", 2},
+		{"max plies", "4k3/8/8/8/8/8/8/QQ2K3 w - - 0 1", RandomPlayer{}, Adjudication{MaxPlies: 4}, "1/2-1/2", "adjudication: max plies", 4},
+		{"insufficient material", "4k3/8/8/8/8/8/3p4/4K3 w - - 0 1", MaterialPlayer{}, Adjudication{}, "1/2-1/2", "insufficient material", 1},
+		{"policy", "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", NewPolicyPlayer("cnn", favoriteEvaluator{"a1a8"}, 0), Adjudication{}, "1-0", "checkmate", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Games = 1
+			config.Openings = opening(tt.fen)
+			config.Adjudication = tt.adjudication
+			result, err := Run(context.Background(), tt.a, RandomPlayer{}, config, nil)
+			if err != nil {
+				t.Fatalf("Match failed: %v", err)
+			}
+			game := result.Games[0]
+			if game.Result != tt.result || game.Termination != tt.termination || game.Plies != tt.plies {
+				t.Errorf("Got %s by %s after %d plies, want %s by %s after %d", game.Result, game.Termination, game.Plies, tt.result, tt.termination, tt.plies)
+			}
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	weights := []float64{0.1, 0.7, 0.2}
+	if got := sample(weights, 0, rng); got != 1 {
+		t.Errorf("Temperature 0 picked %d, want 1", got)
+	}
+	counts := make([]int, 3)
+	for i := 0; i < 10000; i++ {
+		counts[sample(weights, 1, rng)]++
+	}
+	for i, w := range weights {
+		if share := float64(counts[i]) / 10000; math.Abs(share-w) > 0.02 {
+			t.Errorf("Move %d sampled %.3f of the time, want %.1f", i, share, w)
+		}
+	}
+	if got := sample([]float64{0, 0}, 1, rng); got < 0 || got > 1 {
+		t.Errorf("All-zero weights picked %d", got)
+	}
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		wins, draws, losses int
+		elo                 float64
+		verdict             string
+	}{
+		{0, 0, 0, 0, SPRTContinue},
+		{10, 0, 10, 0, SPRTContinue},
+		{300, 0, 100, 190.85, SPRTAcceptH1},
+		{25, 50, 25, 0, SPRTContinue},
+		{100, 300, 200, -58.5, SPRTAcceptH0},
+		{20, 0, 0, math.Inf(1), SPRTAcceptH1},
+	}
+	for _, tt := range tests {
+		elo, margin := EloDifference(tt.wins, tt.draws, tt.losses)
+		if math.Abs(elo-tt.elo) > 0.1 && !(math.IsInf(tt.elo, 1) && math.IsInf(elo, 1)) {
+			t.Errorf("%d-%d-%d: Elo %.2f, want %.2f", tt.wins, tt.draws, tt.losses, elo, tt.elo)
+		}
+		if margin <= 0 {
+			t.Errorf("%d-%d-%d: margin %.2f", tt.wins, tt.draws, tt.losses, margin)
+		}
+		sprt := SPRT(tt.wins, tt.draws, tt.losses, DefaultSPRTConfig())
+		if sprt.Verdict != tt.verdict {
+			t.Errorf("%d-%d-%d: SPRT %s (LLR %.2f), want %s", tt.wins, tt.draws, tt.losses, sprt.Verdict, sprt.LLR, tt.verdict)
+		}
+	}
+
+	// Draws narrow the interval
+	_, decisive := EloDifference(50, 0, 50)
+	_, drawish := EloDifference(25, 50, 25)
+	if drawish >= decisive {
+		t.Errorf("Margin with draws %.1f, without %.1f", drawish, decisive)
+	}
+}
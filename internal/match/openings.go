@@ -0,0 +1,118 @@
+package match
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/data"
+)
+
+// Opening is a starting point of a game: a position and the book moves
+// played from it before the players take over
+type Opening struct {
+	Name  string
+	Start *chess.Position
+	Moves []*chess.Move
+}
+
+// LoadOpenings reads an opening book. PGN files (optionally .zst, .gz or
+// .bz2 compressed) give the first plies moves of each game, skipping games
+// that are shorter and repeated lines. Any other file is read as a list of
+// FEN or EPD positions, one per line.
+func LoadOpenings(path string, plies int) ([]Opening, error) {
+	if strings.Contains(filepath.Base(path), ".pgn") {
+		return loadPGNOpenings(path, plies)
+	}
+	return loadFENOpenings(path)
+}
+
+func loadPGNOpenings(path string, plies int) ([]Opening, error) {
+	stream, err := data.OpenPGNStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	source := filepath.Base(path)
+	seen := make(map[string]bool)
+	var openings []Opening
+	for stream.Next() {
+		game := stream.Game()
+		moves := game.Game.Moves()
+		if len(moves) < plies {
+			continue
+		}
+		start := game.Game.Positions()[0]
+		line := make([]string, plies)
+		for i, move := range moves[:plies] {
+			line[i] = move.String()
+		}
+		key := start.String() + " " + strings.Join(line, " ")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		openings = append(openings, Opening{
+			Name:  source + ":" + strconv.Itoa(game.Index+1),
+			Start: start,
+			Moves: moves[:plies],
+		})
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read opening book: %w", err)
+	}
+	return openings, nil
+}
+
+func loadFENOpenings(path string) ([]Opening, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open opening book: %w", err)
+	}
+	defer file.Close()
+
+	source := filepath.Base(path)
+	var openings []Opening
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s:%d: expected a FEN, got %q", source, line, text)
+		}
+		// EPD records have no move counters and may carry operations
+		counters := []string{"0", "1"}
+		if len(fields) >= 6 && isNumber(fields[4]) && isNumber(fields[5]) {
+			counters = fields[4:6]
+		}
+		fen, err := chess.FEN(strings.Join(append(fields[:4:4], counters...), " "))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, line, err)
+		}
+		pos := chess.NewGame(fen).Position()
+		if len(pos.ValidMoves()) == 0 {
+			return nil, fmt.Errorf("%s:%d: position has no legal moves", source, line)
+		}
+		openings = append(openings, Opening{Name: source + ":" + strconv.Itoa(line), Start: pos})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read opening book: %w", err)
+	}
+	return openings, nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
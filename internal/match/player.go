@@ -0,0 +1,137 @@
+package match
+
+import (
+	"context"
+	"math"
+	"math/rand"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/search"
+)
+
+// Player chooses moves in a match. Games run in parallel, so Move is called
+// concurrently; randomness comes from the game's own rng.
+type Player interface {
+	Name() string
+	Move(ctx context.Context, pos *chess.Position, rng *rand.Rand) (*chess.Move, error)
+}
+
+// PolicyPlayer samples moves from a model's policy over the legal moves
+type PolicyPlayer struct {
+	name        string
+	evaluator   search.Evaluator
+	temperature float64
+}
+
+// NewPolicyPlayer creates a player that samples from the policy of an
+// evaluator (see search.NewRuntimeEvaluator and search.NewBatcherEvaluator).
+// A temperature of 0 always plays the most likely move.
+func NewPolicyPlayer(name string, evaluator search.Evaluator, temperature float64) *PolicyPlayer {
+	return &PolicyPlayer{name: name, evaluator: evaluator, temperature: math.Max(0, temperature)}
+}
+
+// Name implements Player
+func (p *PolicyPlayer) Name() string {
+	return p.name
+}
+
+// Move implements Player
+func (p *PolicyPlayer) Move(ctx context.Context, pos *chess.Position, rng *rand.Rand) (*chess.Move, error) {
+	eval, err := p.evaluator.Evaluate(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+	moves := pos.ValidMoves()
+	return moves[sample(eval.Priors, p.temperature, rng)], nil
+}
+
+// sample draws an index with probability proportional to
+// weight^(1/temperature), or returns the largest weight at temperature 0
+func sample(weights []float64, temperature float64, rng *rand.Rand) int {
+	if temperature == 0 {
+		best := 0
+		for i, w := range weights {
+			if w > weights[best] {
+				best = i
+			}
+		}
+		return best
+	}
+
+	scaled := make([]float64, len(weights))
+	sum := 0.0
+	for i, w := range weights {
+		scaled[i] = math.Pow(w, 1/temperature)
+		sum += scaled[i]
+	}
+	if sum == 0 || math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return rng.Intn(len(weights))
+	}
+	r := rng.Float64() * sum
+	for i, w := range scaled {
+		r -= w
+		if r < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// RandomPlayer plays uniformly random legal moves
+type RandomPlayer struct{}
+
+// Name implements Player
+func (RandomPlayer) Name() string {
+	return "random"
+}
+
+// Move implements Player
+func (RandomPlayer) Move(_ context.Context, pos *chess.Position, rng *rand.Rand) (*chess.Move, error) {
+	moves := pos.ValidMoves()
+	return moves[rng.Intn(len(moves))], nil
+}
+
+// MaterialPlayer looks two plies ahead and plays the move that keeps the
+// most material against the opponent's best reply, mating when it can. Ties
+// are broken at random. It is a baseline that does not hang pieces to
+// one-move captures.
+type MaterialPlayer struct{}
+
+// Name implements Player
+func (MaterialPlayer) Name() string {
+	return "material"
+}
+
+// Move implements Player
+func (MaterialPlayer) Move(_ context.Context, pos *chess.Position, rng *rand.Rand) (*chess.Move, error) {
+	var best []*chess.Move
+	bestScore := math.MinInt
+	for _, move := range pos.ValidMoves() {
+		score := replyScore(pos.Update(move))
+		if score > bestScore {
+			best, bestScore = nil, score
+		}
+		if score == bestScore {
+			best = append(best, move)
+		}
+	}
+	return best[rng.Intn(len(best))], nil
+}
+
+// replyScore is the material balance for the side that just moved after
+// the opponent's best reply
+func replyScore(pos *chess.Position) int {
+	replies := pos.ValidMoves()
+	if len(replies) == 0 {
+		if pos.Status() == chess.Checkmate {
+			return math.MaxInt
+		}
+		return 0
+	}
+	score := math.MaxInt
+	for _, reply := range replies {
+		score = min(score, search.MaterialBalance(pos.Update(reply)))
+	}
+	return score
+}
@@ -0,0 +1,103 @@
+package match
+
+import "math"
+
+// EloDifference estimates the Elo difference implied by a score with the
+// logistic model, and the half width of its 95% confidence interval. A
+// perfect or zero score gives an infinite difference, and an interval that
+// reaches a perfect or zero score an infinite margin.
+func EloDifference(wins, draws, losses int) (float64, float64) {
+	n := float64(wins + draws + losses)
+	if n == 0 {
+		return 0, math.Inf(1)
+	}
+	score, variance := scoreStats(wins, draws, losses)
+	spread := 1.959964 * math.Sqrt(variance/n)
+	low, high := scoreToElo(score-spread), scoreToElo(score+spread)
+	return scoreToElo(score), (high - low) / 2
+}
+
+// scoreStats returns the mean score per game and its variance
+func scoreStats(wins, draws, losses int) (float64, float64) {
+	n := float64(wins + draws + losses)
+	w, d, l := float64(wins)/n, float64(draws)/n, float64(losses)/n
+	score := w + d/2
+	variance := w*math.Pow(1-score, 2) + d*math.Pow(0.5-score, 2) + l*math.Pow(score, 2)
+	return score, variance
+}
+
+// scoreToElo converts an expected score to an Elo difference
+func scoreToElo(score float64) float64 {
+	switch {
+	case score <= 0:
+		return math.Inf(-1)
+	case score >= 1:
+		return math.Inf(1)
+	}
+	return -400 * math.Log10(1/score-1)
+}
+
+// eloToScore converts an Elo difference to an expected score
+func eloToScore(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// SPRTConfig is a sequential probability ratio test of H0: the Elo
+// difference is Elo0 against H1: it is Elo1, with false positive rate
+// Alpha and false negative rate Beta
+type SPRTConfig struct {
+	Elo0  float64
+	Elo1  float64
+	Alpha float64
+	Beta  float64
+}
+
+// DefaultSPRTConfig tests whether the first player is at least 10 Elo
+// stronger, at 5% error rates
+func DefaultSPRTConfig() SPRTConfig {
+	return SPRTConfig{Elo0: 0, Elo1: 10, Alpha: 0.05, Beta: 0.05}
+}
+
+// SPRT verdicts
+const (
+	SPRTContinue = "continue"  // Neither bound reached yet
+	SPRTAcceptH0 = "accept H0" // The difference is Elo0 or less
+	SPRTAcceptH1 = "accept H1" // The difference is Elo1 or more
+)
+
+// SPRTResult is the state of an SPRT
+type SPRTResult struct {
+	LLR     float64 // Log-likelihood ratio of H1 against H0
+	Lower   float64 // H0 is accepted at or below this bound
+	Upper   float64 // H1 is accepted at or above this bound
+	Verdict string
+}
+
+// SPRT runs the test on a score with the normal approximation of the
+// trinomial (win/draw/loss) model used by engine testing frameworks. A score
+// without spread, such as all wins, counts one extra draw so that one-sided
+// matches still reach a verdict.
+func SPRT(wins, draws, losses int, config SPRTConfig) SPRTResult {
+	result := SPRTResult{
+		Lower:   math.Log(config.Beta / (1 - config.Alpha)),
+		Upper:   math.Log((1 - config.Beta) / config.Alpha),
+		Verdict: SPRTContinue,
+	}
+	n := float64(wins + draws + losses)
+	if n == 0 {
+		return result
+	}
+	score, variance := scoreStats(wins, draws, losses)
+	if variance == 0 {
+		score, variance = scoreStats(wins, draws+1, losses)
+	}
+	s0, s1 := eloToScore(config.Elo0), eloToScore(config.Elo1)
+	result.LLR = n * (s1 - s0) * (2*score - s0 - s1) / (2 * variance)
+	switch {
+	case result.LLR >= result.Upper:
+		result.Verdict = SPRTAcceptH1
+	case result.LLR <= result.Lower:
+		result.Verdict = SPRTAcceptH0
+	}
+	return result
+}
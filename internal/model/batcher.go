@@ -0,0 +1,366 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+)
+
+// latencyWindow is the number of recent requests latency percentiles cover
+const latencyWindow = 1024
+
+// BatcherConfig controls how requests are grouped into batches
+type BatcherConfig struct {
+	MaxBatchSize int           // Largest batch run in one forward pass
+	MaxWait      time.Duration // Longest time the first request of a batch waits for more
+	QueueSize    int           // Requests that can wait before callers block
+	Workers      int           // Batches evaluated concurrently
+}
+
+// DefaultBatcherConfig returns the default batching configuration
+func DefaultBatcherConfig() BatcherConfig {
+	return BatcherConfig{
+		MaxBatchSize: 32,
+		MaxWait:      2 * time.Millisecond,
+		QueueSize:    1024,
+		Workers:      1,
+	}
+}
+
+// Batcher collects forward pass requests from concurrent goroutines into
+// batches of up to MaxBatchSize states, runs each batch through a Runtime
+// in one pass and fans the results back out. A batch is run as soon as it
+// is full or its first request has waited MaxWait.
+type Batcher struct {
+	runtime *Runtime
+	config  BatcherConfig
+
+	queue  chan *batchRequest
+	mu     sync.RWMutex // Guards closed against sends on the closed queue
+	closed bool
+	wg     sync.WaitGroup
+
+	queueDepth int64 // Requests submitted but not yet taken into a batch, atomic
+
+	statsMu sync.Mutex
+	stats   batcherStats
+}
+
+// batchRequest is one queued state and the channel its result is sent on
+type batchRequest struct {
+	ctx      context.Context
+	state    []float32
+	queued   time.Time
+	started  time.Time
+	logits   []float64
+	value    float64
+	err      error
+	finished chan *batchRequest
+}
+
+// batcherStats accumulates the counters behind BatchStats
+type batcherStats struct {
+	requests      int64
+	failed        int64
+	batches       int64
+	batchSizes    []int64 // Indexed by batch size
+	maxQueueDepth int
+	queueWait     time.Duration
+	latency       time.Duration
+	latencies     []time.Duration // Ring of the most recent request latencies
+	next          int
+}
+
+// BatchStats is a snapshot of a Batcher's counters
+type BatchStats struct {
+	Requests      int64         // Requests evaluated
+	Failed        int64         // Requests that failed or were cancelled while queued
+	Batches       int64         // Forward passes run
+	BatchSizes    map[int]int64 // Number of batches of each size
+	AvgBatchSize  float64       // Mean requests per batch
+	QueueDepth    int           // Requests currently waiting for a batch
+	MaxQueueDepth int           // Most requests seen waiting at once
+	AvgQueueWait  time.Duration // Mean time from submission to the start of its batch
+	AvgLatency    time.Duration // Mean time from submission to result
+	P50Latency    time.Duration // Latency percentiles over the recent requests
+	P95Latency    time.Duration
+	P99Latency    time.Duration
+}
+
+// NewBatcher starts a scheduler running batches on r
+func NewBatcher(r *Runtime, config BatcherConfig) *Batcher {
+	defaults := DefaultBatcherConfig()
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = defaults.MaxBatchSize
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = defaults.MaxWait
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+
+	b := &Batcher{
+		runtime: r,
+		config:  config,
+		queue:   make(chan *batchRequest, config.QueueSize),
+		stats:   batcherStats{batchSizes: make([]int64, config.MaxBatchSize+1)},
+	}
+	for i := 0; i < config.Workers; i++ {
+		b.wg.Add(1)
+		go b.worker()
+	}
+	return b
+}
+
+// Runtime returns the runtime evaluating the batches
+func (b *Batcher) Runtime() *Runtime {
+	return b.runtime
+}
+
+// Logits queues a flat state tensor and waits for its policy logits and
+// value
+func (b *Batcher) Logits(ctx context.Context, state []float32) ([]float64, float64, error) {
+	if _, err := data.InputChannelsForLength(len(state)); err != nil {
+		return nil, 0, fmt.Errorf("invalid input: %w", err)
+	}
+	req := &batchRequest{ctx: ctx, state: state, queued: time.Now(), finished: make(chan *batchRequest, 1)}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return nil, 0, fmt.Errorf("batcher is closed")
+	}
+	b.recordQueued()
+	select {
+	case b.queue <- req:
+		b.mu.RUnlock()
+	case <-ctx.Done():
+		b.mu.RUnlock()
+		atomic.AddInt64(&b.queueDepth, -1)
+		return nil, 0, ctx.Err()
+	}
+
+	select {
+	case <-req.finished:
+		return req.logits, req.value, req.err
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+// Forward queues a flat state tensor and returns its policy probabilities
+// and value
+func (b *Batcher) Forward(ctx context.Context, state []float32) ([]float64, float64, error) {
+	logits, value, err := b.Logits(ctx, state)
+	if err != nil {
+		return nil, 0, err
+	}
+	return SoftmaxManual(logits), value, nil
+}
+
+// ForwardLegal queues a flat state tensor and returns its policy with
+// illegal moves masked before the softmax, as Runtime.ForwardLegal does
+func (b *Batcher) ForwardLegal(ctx context.Context, state []float32, pos *chess.Position) ([]float64, float64, error) {
+	logits, value, err := b.Logits(ctx, state)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var legal []bool
+	if pos != nil {
+		legal = LegalMask(pos, b.runtime.PolicySize())
+	} else {
+		legal = stateLegalMask(state, b.runtime.MoveEncoding())
+	}
+	if legal == nil {
+		return SoftmaxManual(logits), value, nil
+	}
+	return MaskedSoftmax(logits, legal), value, nil
+}
+
+// Close stops accepting requests and waits for the queued ones to finish
+func (b *Batcher) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+// worker collects and runs batches until the queue is closed
+func (b *Batcher) worker() {
+	defer b.wg.Done()
+
+	batch := make([]*batchRequest, 0, b.config.MaxBatchSize)
+	timer := time.NewTimer(b.config.MaxWait)
+	stopTimer(timer)
+	for {
+		req, ok := <-b.queue
+		if !ok {
+			return
+		}
+		atomic.AddInt64(&b.queueDepth, -1)
+		batch = append(batch[:0], req)
+
+		timer.Reset(b.config.MaxWait)
+	collect:
+		for len(batch) < b.config.MaxBatchSize {
+			select {
+			case req, ok := <-b.queue:
+				if !ok {
+					break collect
+				}
+				atomic.AddInt64(&b.queueDepth, -1)
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			}
+		}
+		stopTimer(timer)
+
+		b.run(batch)
+	}
+}
+
+// stopTimer stops a timer and drains a pending expiry so it can be reset
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// run evaluates a batch, skipping requests whose callers have given up
+func (b *Batcher) run(batch []*batchRequest) {
+	start := time.Now()
+	live := batch[:0]
+	for _, req := range batch {
+		if err := req.ctx.Err(); err != nil {
+			req.err = err
+			b.finish(req)
+			continue
+		}
+		req.started = start
+		live = append(live, req)
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	states := make([][]float32, len(live))
+	logits := make([][]float64, len(live))
+	values := make([]float64, len(live))
+	for i, req := range live {
+		states[i] = req.state
+		logits[i] = make([]float64, b.runtime.PolicySize())
+	}
+	err := b.runtime.LogitsBatch(states, logits, values)
+
+	b.recordBatch(len(live))
+	for i, req := range live {
+		req.logits, req.value, req.err = logits[i], values[i], err
+		b.finish(req)
+	}
+}
+
+// finish records a request's latency and hands it back to its caller
+func (b *Batcher) finish(req *batchRequest) {
+	b.statsMu.Lock()
+	s := &b.stats
+	if req.err != nil {
+		s.failed++
+	} else {
+		latency := time.Since(req.queued)
+		s.requests++
+		s.queueWait += req.started.Sub(req.queued)
+		s.latency += latency
+		if len(s.latencies) < latencyWindow {
+			s.latencies = append(s.latencies, latency)
+		} else {
+			s.latencies[s.next] = latency
+		}
+		s.next = (s.next + 1) % latencyWindow
+	}
+	b.statsMu.Unlock()
+
+	req.finished <- req
+}
+
+func (b *Batcher) recordQueued() {
+	depth := int(atomic.AddInt64(&b.queueDepth, 1))
+	b.statsMu.Lock()
+	if depth > b.stats.maxQueueDepth {
+		b.stats.maxQueueDepth = depth
+	}
+	b.statsMu.Unlock()
+}
+
+func (b *Batcher) recordBatch(size int) {
+	b.statsMu.Lock()
+	b.stats.batches++
+	b.stats.batchSizes[size]++
+	b.statsMu.Unlock()
+}
+
+// Stats returns a snapshot of the batching counters
+func (b *Batcher) Stats() BatchStats {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	s := &b.stats
+
+	stats := BatchStats{
+		Requests:      s.requests,
+		Failed:        s.failed,
+		Batches:       s.batches,
+		BatchSizes:    make(map[int]int64),
+		QueueDepth:    int(atomic.LoadInt64(&b.queueDepth)),
+		MaxQueueDepth: s.maxQueueDepth,
+	}
+	batched := int64(0)
+	for size, count := range s.batchSizes {
+		if count > 0 {
+			stats.BatchSizes[size] = count
+			batched += int64(size) * count
+		}
+	}
+	if s.batches > 0 {
+		stats.AvgBatchSize = float64(batched) / float64(s.batches)
+	}
+	if s.requests > 0 {
+		stats.AvgQueueWait = s.queueWait / time.Duration(s.requests)
+		stats.AvgLatency = s.latency / time.Duration(s.requests)
+	}
+
+	if len(s.latencies) > 0 {
+		sorted := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		percentile := func(p float64) time.Duration {
+			return sorted[int(p*float64(len(sorted)-1))]
+		}
+		stats.P50Latency = percentile(0.50)
+		stats.P95Latency = percentile(0.95)
+		stats.P99Latency = percentile(0.99)
+	}
+	return stats
+}
+
+// ResetStats clears the counters; the current queue depth is kept
+func (b *Batcher) ResetStats() {
+	b.statsMu.Lock()
+	b.stats = batcherStats{batchSizes: make([]int64, b.config.MaxBatchSize+1)}
+	b.statsMu.Unlock()
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcherGroupsConcurrentRequests(t *testing.T) {
+	cnn, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+	r, err := NewRuntime(cnn)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+
+	states := runtimeTestStates(t, cnn.InputChannels())
+	want := make([][]float64, len(states))
+	for i, state := range states {
+		if want[i], _, err = r.Forward(state); err != nil {
+			t.Fatalf("Runtime forward failed: %v", err)
+		}
+	}
+
+	// A long wait lets full batches form from the concurrent callers
+	b := NewBatcher(r, BatcherConfig{MaxBatchSize: 8, MaxWait: time.Second})
+	const requests = 24
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			probs, _, err := b.Forward(context.Background(), states[i%len(states)])
+			if err != nil {
+				t.Errorf("Request %d failed: %v", i, err)
+				return
+			}
+			if diff := maxAbsDiff(probs, want[i%len(states)]); diff > 1e-12 {
+				t.Errorf("Request %d differs by %v", i, diff)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := b.Stats()
+	batched := int64(0)
+	for size, count := range stats.BatchSizes {
+		if size > 8 {
+			t.Errorf("Batch of %d exceeds the maximum", size)
+		}
+		batched += int64(size) * count
+	}
+	if stats.Requests != requests || batched != requests || stats.AvgBatchSize <= 1 {
+		t.Errorf("Stats: %d requests in %d batches of %v (average %.1f)",
+			stats.Requests, stats.Batches, stats.BatchSizes, stats.AvgBatchSize)
+	}
+	if stats.QueueDepth != 0 || stats.MaxQueueDepth == 0 || stats.P50Latency <= 0 || stats.P99Latency < stats.P50Latency {
+		t.Errorf("Stats: queue depth %d (max %d), latency p50 %v p99 %v",
+			stats.QueueDepth, stats.MaxQueueDepth, stats.P50Latency, stats.P99Latency)
+	}
+
+	// A lone request runs once MaxWait expires
+	b.Close()
+	b = NewBatcher(r, BatcherConfig{MaxBatchSize: 8, MaxWait: time.Millisecond})
+	defer b.Close()
+	if _, _, err := b.Forward(context.Background(), states[0]); err != nil {
+		t.Fatalf("Single request failed: %v", err)
+	}
+	if stats := b.Stats(); stats.BatchSizes[1] != 1 {
+		t.Errorf("Batch sizes %v, want one batch of 1", stats.BatchSizes)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := b.Forward(ctx, states[0]); err == nil {
+		t.Error("Expected error for cancelled request")
+	}
+	if _, _, err := b.Forward(context.Background(), make([]float32, 10)); err == nil {
+		t.Error("Expected error for invalid state")
+	}
+}
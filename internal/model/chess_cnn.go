@@ -6,6 +6,7 @@ import (
 	"math"
 	"os"
 
+	"github.com/thyrook/partner/internal/data"
 	"gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
 )
@@ -15,11 +16,11 @@ type ChessCNN struct {
 	// Graph
 	g *gorgonia.ExprGraph
 
-	// Input: [batch, 12, 8, 8]
+	// Input: [batch, inputChannels, 8, 8]
 	input *gorgonia.Node
 
 	// Convolutional layers
-	conv1W *gorgonia.Node // [32, 12, 3, 3]
+	conv1W *gorgonia.Node // [32, inputChannels, 3, 3]
 	conv1B *gorgonia.Node // [32]
 	conv2W *gorgonia.Node // [64, 32, 3, 3]
 	conv2B *gorgonia.Node // [64]
@@ -29,8 +30,15 @@ type ChessCNN struct {
 	fc1B *gorgonia.Node // [512]
 	fc2W *gorgonia.Node // [512, 128]
 	fc2B *gorgonia.Node // [128]
-	fc3W *gorgonia.Node // [128, 4096]
-	fc3B *gorgonia.Node // [4096]
+	fc3W *gorgonia.Node // [128, policySize]
+	fc3B *gorgonia.Node // [policySize]
+
+	// Input format and move encoding of the policy output
+	inputChannels int
+	moveEncoding  data.MoveEncoding
+
+	// Seed of the initial weights, recorded in checkpoints (0 = unseeded)
+	seed int64
 
 	// Output (logits and probabilities)
 	logits *gorgonia.Node
@@ -43,6 +51,23 @@ type ChessCNN struct {
 	isTraining bool
 }
 
+// CNNConfig describes the input and output layout of a ChessCNN
+type CNNConfig struct {
+	BatchSize     int
+	InputChannels int // data.NumChannels or data.NumExtendedChannels
+	MoveEncoding  data.MoveEncoding
+	Seed          int64 // Seed of the initial weights (0 = time based)
+}
+
+// DefaultCNNConfig returns the layout used for new models
+func DefaultCNNConfig() CNNConfig {
+	return CNNConfig{
+		BatchSize:     1,
+		InputChannels: data.DefaultInputChannels,
+		MoveEncoding:  data.DefaultMoveEncoding,
+	}
+}
+
 // NewChessCNN creates a new CNN model for chess move prediction
 // The model supports variable batch sizes by using batch dimension in input shape
 func NewChessCNN() (*ChessCNN, error) {
@@ -50,10 +75,21 @@ func NewChessCNN() (*ChessCNN, error) {
 }
 
 // NewChessCNNForInference creates a model for inference and loads weights from a checkpoint
-// This allows using a model trained with a different batch size
+// This allows using a model trained with a different batch size, input format or move encoding
 func NewChessCNNForInference(checkpointPath string) (*ChessCNN, error) {
+	metadata, err := ReadModelMetadata(checkpointPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	config, err := metadata.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
 	// Always create inference model with batch size 1
-	model, err := NewChessCNNWithBatchSize(1)
+	config.BatchSize = 1
+	model, err := NewChessCNNWithConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create inference model: %w", err)
 	}
@@ -69,18 +105,36 @@ func NewChessCNNForInference(checkpointPath string) (*ChessCNN, error) {
 
 // NewChessCNNWithBatchSize creates a CNN model with specified batch size
 func NewChessCNNWithBatchSize(batchSize int) (*ChessCNN, error) {
+	config := DefaultCNNConfig()
+	config.BatchSize = batchSize
+	return NewChessCNNWithConfig(config)
+}
+
+// NewChessCNNWithConfig creates a CNN model with the given batch size, input format and move encoding
+func NewChessCNNWithConfig(config CNNConfig) (*ChessCNN, error) {
+	if !config.MoveEncoding.Valid() {
+		return nil, fmt.Errorf("unknown move encoding: %q", config.MoveEncoding)
+	}
+	if !data.ValidInputChannels(config.InputChannels) {
+		return nil, fmt.Errorf("unsupported input channels: %d", config.InputChannels)
+	}
+	batchSize := config.BatchSize
+	channels := config.InputChannels
+	policySize := config.MoveEncoding.Size()
+
 	g := gorgonia.NewGraph()
+	rng := initRand(config.Seed)
 
-	// Input: [batch, 12, 8, 8]
+	// Input: [batch, channels, 8, 8]
 	input := gorgonia.NewTensor(g, tensor.Float64, 4,
-		gorgonia.WithShape(batchSize, 12, 8, 8),
+		gorgonia.WithShape(batchSize, channels, 8, 8),
 		gorgonia.WithName("input"))
 
-	// Conv1: 12 -> 32 channels, 3x3 kernel
+	// Conv1: channels -> 32 channels, 3x3 kernel
 	conv1W := gorgonia.NewTensor(g, tensor.Float64, 4,
-		gorgonia.WithShape(32, 12, 3, 3),
+		gorgonia.WithShape(32, channels, 3, 3),
 		gorgonia.WithName("conv1_w"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, rng)))
 	conv1B := gorgonia.NewTensor(g, tensor.Float64, 1,
 		gorgonia.WithShape(32),
 		gorgonia.WithName("conv1_b"),
@@ -90,14 +144,14 @@ func NewChessCNNWithBatchSize(batchSize int) (*ChessCNN, error) {
 	conv2W := gorgonia.NewTensor(g, tensor.Float64, 4,
 		gorgonia.WithShape(64, 32, 3, 3),
 		gorgonia.WithName("conv2_w"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, rng)))
 	conv2B := gorgonia.NewTensor(g, tensor.Float64, 1,
 		gorgonia.WithShape(64),
 		gorgonia.WithName("conv2_b"),
 		gorgonia.WithInit(gorgonia.Zeroes()))
 
 	// Build forward pass
-	// Conv1: [1, 12, 8, 8] -> [1, 32, 8, 8] (with padding=1)
+	// Conv1: [1, channels, 8, 8] -> [1, 32, 8, 8] (with padding=1)
 	conv1, err := gorgonia.Conv2d(input, conv1W, tensor.Shape{3, 3}, []int{1, 1}, []int{1, 1}, []int{1, 1})
 	if err != nil {
 		return nil, fmt.Errorf("conv1 failed: %w", err)
@@ -121,7 +175,7 @@ func NewChessCNNWithBatchSize(batchSize int) (*ChessCNN, error) {
 	fc1W := gorgonia.NewMatrix(g, tensor.Float64,
 		gorgonia.WithShape(flatSize, 512),
 		gorgonia.WithName("fc1_w"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, rng)))
 	fc1B := gorgonia.NewVector(g, tensor.Float64,
 		gorgonia.WithShape(512),
 		gorgonia.WithName("fc1_b"),
@@ -135,7 +189,7 @@ func NewChessCNNWithBatchSize(batchSize int) (*ChessCNN, error) {
 	fc2W := gorgonia.NewMatrix(g, tensor.Float64,
 		gorgonia.WithShape(512, 128),
 		gorgonia.WithName("fc2_w"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, rng)))
 	fc2B := gorgonia.NewVector(g, tensor.Float64,
 		gorgonia.WithShape(128),
 		gorgonia.WithName("fc2_b"),
@@ -145,13 +199,13 @@ func NewChessCNNWithBatchSize(batchSize int) (*ChessCNN, error) {
 	fc2 = gorgonia.Must(gorgonia.BroadcastAdd(fc2, fc2B, nil, []byte{0}))
 	fc2 = gorgonia.Must(gorgonia.Rectify(fc2))
 
-	// FC3: 128 -> 4096 (64x64 from-to pairs)
+	// FC3: 128 -> policySize (64x64 from-to pairs, plus underpromotions)
 	fc3W := gorgonia.NewMatrix(g, tensor.Float64,
-		gorgonia.WithShape(128, 4096),
+		gorgonia.WithShape(128, policySize),
 		gorgonia.WithName("fc3_w"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, rng)))
 	fc3B := gorgonia.NewVector(g, tensor.Float64,
-		gorgonia.WithShape(4096),
+		gorgonia.WithShape(policySize),
 		gorgonia.WithName("fc3_b"),
 		gorgonia.WithInit(gorgonia.Zeroes()))
 
@@ -180,75 +234,81 @@ func NewChessCNNWithBatchSize(batchSize int) (*ChessCNN, error) {
 		logits: logits,
 		output: output,
 		vm:     vm,
+
+		inputChannels: channels,
+		moveEncoding:  config.MoveEncoding,
+		seed:          config.Seed,
 	}, nil
 }
 
-// Predict performs inference and returns top K moves with probabilities
-func (cnn *ChessCNN) Predict(boardTensor [12][8][8]float32, topK int) ([]MovePrediction, error) {
-	// Convert float32 to float64 and flatten
-	inputData := make([]float64, 12*8*8)
-	idx := 0
-	for c := 0; c < 12; c++ {
-		for r := 0; r < 8; r++ {
-			for f := 0; f < 8; f++ {
-				inputData[idx] = float64(boardTensor[c][r][f])
-				idx++
-			}
-		}
-	}
-
-	// Create tensor
-	inputTensor := tensor.New(
-		tensor.WithShape(1, 12, 8, 8),
-		tensor.WithBacking(inputData),
-	)
-
-	// Set input
-	if err := gorgonia.Let(cnn.input, inputTensor); err != nil {
-		return nil, fmt.Errorf("failed to set input: %w", err)
-	}
-
-	// Run forward pass
-	if err := cnn.vm.RunAll(); err != nil {
-		return nil, fmt.Errorf("failed to run inference: %w", err)
-	}
+// InputChannels returns the number of input planes the model expects
+func (cnn *ChessCNN) InputChannels() int {
+	return cnn.inputChannels
+}
 
-	// Get output probabilities
-	outputValue := cnn.output.Value()
-	if outputValue == nil {
-		return nil, fmt.Errorf("output is nil")
-	}
+// MoveEncoding returns the move encoding of the policy output
+func (cnn *ChessCNN) MoveEncoding() data.MoveEncoding {
+	return cnn.moveEncoding
+}
 
-	probs := outputValue.Data().([]float64)
+// PolicySize returns the length of the policy output
+func (cnn *ChessCNN) PolicySize() int {
+	return cnn.moveEncoding.Size()
+}
 
-	// Reset VM for next run
-	cnn.vm.Reset()
+// Predict performs inference and returns top K moves with probabilities.
+// Extended models see the board with data.DefaultAuxState; use PredictState
+// to supply side to move, castling and en-passant planes. Illegal moves are
+// masked before the softmax (see ForwardLegal).
+func (cnn *ChessCNN) Predict(boardTensor [12][8][8]float32, topK int) ([]MovePrediction, error) {
+	return cnn.PredictState(data.TensorToFlatArray(boardTensor), topK)
+}
 
-	// Get top K moves
-	if topK <= 0 || topK > len(probs) {
-		topK = 3
-	}
+// PredictState performs inference on a flat 12- or 19-channel state tensor,
+// masking illegal moves before the softmax
+func (cnn *ChessCNN) PredictState(state []float32, topK int) ([]MovePrediction, error) {
+	return predictTopK(cnn, state, topK)
+}
 
-	return getTopKPredictions(probs, topK), nil
+// Forward returns the policy probabilities for a flat state tensor.
+// ChessCNN has no value head, so the value is always 0.
+func (cnn *ChessCNN) Forward(state []float32) ([]float64, float64, error) {
+	return forwardState(cnn, state)
 }
 
 // MovePrediction represents a predicted move with probability
 type MovePrediction struct {
-	FromSquare  int // 0-63
-	ToSquare    int // 0-63
+	FromSquare  int    // 0-63
+	ToSquare    int    // 0-63
+	Promotion   string // Promotion piece ("q", "r", "b", "n"), empty if none
 	Probability float64
-	MoveIndex   int // Combined index (from*64 + to)
+	MoveIndex   int // Policy index under the model's move encoding
+}
+
+// UCI returns the move in UCI notation (e.g. "e2e4", "e7e8n"). Queen
+// promotions use the plain from/to index and have no promotion piece here;
+// with a position at hand, data.MoveFromIndex gives the exact move.
+func (p MovePrediction) UCI() string {
+	return data.MoveIndexToUCI(p.MoveIndex)
+}
+
+// TopKPredictions returns the top K moves of a policy vector sorted by probability
+func TopKPredictions(probs []float64, k int) []MovePrediction {
+	if k <= 0 || k > len(probs) {
+		k = 3
+	}
+	return getTopKPredictions(probs, k)
 }
 
 // getTopKPredictions returns top K moves sorted by probability
 func getTopKPredictions(probs []float64, k int) []MovePrediction {
 	predictions := make([]MovePrediction, len(probs))
 	for i, p := range probs {
-		fromSquare := i / 64
-		toSquare := i % 64
+		fromSquare, toSquare, promo, _ := data.DecodeMoveIndex(i)
 		predictions[i] = MovePrediction{
 			FromSquare:  fromSquare,
 			ToSquare:    toSquare,
+			Promotion:   data.PromotionToString(promo),
 			Probability: p,
 			MoveIndex:   i,
 		}
@@ -279,131 +339,146 @@ func (cnn *ChessCNN) Learnables() gorgonia.Nodes {
 	}
 }
 
-// SaveModel saves model weights to file
-func (cnn *ChessCNN) SaveModel(path string) error {
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer f.Close()
-
-	encoder := gob.NewEncoder(f)
-
-	// Save metadata
-	metadata := ModelMetadata{
-		Version:     "1.0",
-		ModelType:   "ChessCNN",
-		InputShape:  []int{12, 8, 8},
-		OutputShape: []int{4096},
-	}
-	if err := encoder.Encode(metadata); err != nil {
-		return fmt.Errorf("failed to encode metadata: %w", err)
-	}
-
-	// Save weights
-	weights := []*gorgonia.Node{
-		cnn.conv1W, cnn.conv1B,
-		cnn.conv2W, cnn.conv2B,
-		cnn.fc1W, cnn.fc1B,
-		cnn.fc2W, cnn.fc2B,
-		cnn.fc3W, cnn.fc3B,
-	}
-
-	for i, w := range weights {
-		val := w.Value()
-		if val == nil {
-			return fmt.Errorf("weight %d has nil value", i)
-		}
+// Architecture returns ArchitectureCNN
+func (cnn *ChessCNN) Architecture() Architecture {
+	return ArchitectureCNN
+}
 
-		data := val.Data().([]float64)
-		shape := val.Shape()
+// HasValueHead reports false; ChessCNN only predicts moves
+func (cnn *ChessCNN) HasValueHead() bool {
+	return false
+}
 
-		if err := encoder.Encode(shape); err != nil {
-			return fmt.Errorf("failed to encode weight %d shape: %w", i, err)
-		}
-		if err := encoder.Encode(data); err != nil {
-			return fmt.Errorf("failed to encode weight %d data: %w", i, err)
-		}
+// Metadata describes the model layout as recorded in checkpoints
+func (cnn *ChessCNN) Metadata() ModelMetadata {
+	return ModelMetadata{
+		Version:      "1.0",
+		ModelType:    ArchitectureCNN.modelType(),
+		InputShape:   []int{cnn.inputChannels, 8, 8},
+		OutputShape:  []int{cnn.PolicySize()},
+		MoveEncoding: string(cnn.moveEncoding),
+		Seed:         cnn.seed,
 	}
+}
 
-	return nil
+// SaveModel saves model weights to file
+func (cnn *ChessCNN) SaveModel(path string) error {
+	return saveCheckpoint(path, cnn.Metadata(), cnn.Learnables())
 }
 
 // LoadModel loads model weights from file
 func (cnn *ChessCNN) LoadModel(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
-	}
-	defer f.Close()
+	return loadCheckpoint(path, cnn, cnn.Learnables())
+}
 
-	decoder := gob.NewDecoder(f)
+// graph returns the nodes the trainer attaches its loss to
+func (cnn *ChessCNN) graph() modelGraph {
+	return modelGraph{g: cnn.g, input: cnn.input, logits: cnn.logits, policy: cnn.output}
+}
 
-	// Load metadata
-	var metadata ModelMetadata
-	if err := decoder.Decode(&metadata); err != nil {
-		return fmt.Errorf("failed to decode metadata: %w", err)
-	}
+// machine returns the VM executing the graph
+func (cnn *ChessCNN) machine() gorgonia.VM {
+	return cnn.vm
+}
 
-	// Validate metadata
-	if metadata.ModelType != "ChessCNN" {
-		return fmt.Errorf("invalid model type: %s", metadata.ModelType)
+// compile replaces the VM after the graph has been extended
+func (cnn *ChessCNN) compile() {
+	if cnn.vm != nil {
+		cnn.vm.Close()
 	}
+	cnn.vm = gorgonia.NewTapeMachine(cnn.g)
+}
 
-	// Load weights
-	weights := []*gorgonia.Node{
-		cnn.conv1W, cnn.conv1B,
-		cnn.conv2W, cnn.conv2B,
-		cnn.fc1W, cnn.fc1B,
-		cnn.fc2W, cnn.fc2B,
-		cnn.fc3W, cnn.fc3B,
+// Close cleans up resources
+func (cnn *ChessCNN) Close() error {
+	if cnn.vm != nil {
+		cnn.vm.Close()
 	}
+	return nil
+}
 
-	for i, w := range weights {
-		var shape tensor.Shape
-		var data []float64
+// ModelMetadata stores model information
+type ModelMetadata struct {
+	Version      string
+	ModelType    string
+	InputShape   []int
+	OutputShape  []int
+	MoveEncoding string // Empty in checkpoints written before move encodings were versioned
+	Seed         int64  // Seed of the training run (0 = unseeded or unknown)
+}
 
-		if err := decoder.Decode(&shape); err != nil {
-			return fmt.Errorf("failed to decode weight %d shape: %w", i, err)
-		}
-		if err := decoder.Decode(&data); err != nil {
-			return fmt.Errorf("failed to decode weight %d data: %w", i, err)
-		}
+// Architecture returns the network architecture recorded in the metadata
+func (m ModelMetadata) Architecture() (Architecture, error) {
+	switch m.ModelType {
+	case ArchitectureCNN.modelType():
+		return ArchitectureCNN, nil
+	case ArchitectureResNet.modelType():
+		return ArchitectureResNet, nil
+	default:
+		return "", fmt.Errorf("unknown model type: %q", m.ModelType)
+	}
+}
 
-		t := tensor.New(tensor.WithShape(shape...), tensor.WithBacking(data))
-		if err := gorgonia.Let(w, t); err != nil {
-			return fmt.Errorf("failed to set weight %d: %w", i, err)
+// Encoding returns the move encoding recorded in the metadata.
+// Older checkpoints without an explicit encoding are resolved from OutputShape.
+func (m ModelMetadata) Encoding() (data.MoveEncoding, error) {
+	if m.MoveEncoding != "" {
+		encoding := data.MoveEncoding(m.MoveEncoding)
+		if !encoding.Valid() {
+			return "", fmt.Errorf("unknown move encoding: %q", m.MoveEncoding)
 		}
+		return encoding, nil
+	}
+	if len(m.OutputShape) != 1 {
+		return "", fmt.Errorf("invalid output shape: %v", m.OutputShape)
 	}
+	return data.MoveEncodingForSize(m.OutputShape[0])
+}
 
-	return nil
+// Channels returns the number of input planes recorded in the metadata
+func (m ModelMetadata) Channels() (int, error) {
+	if len(m.InputShape) != 3 || !data.ValidInputChannels(m.InputShape[0]) {
+		return 0, fmt.Errorf("invalid input shape: %v", m.InputShape)
+	}
+	return m.InputShape[0], nil
 }
 
-// Close cleans up resources
-func (cnn *ChessCNN) Close() error {
-	if cnn.vm != nil {
-		cnn.vm.Close()
+// Config returns the model layout recorded in the metadata
+func (m ModelMetadata) Config() (CNNConfig, error) {
+	channels, err := m.Channels()
+	if err != nil {
+		return CNNConfig{}, err
 	}
-	return nil
+	encoding, err := m.Encoding()
+	if err != nil {
+		return CNNConfig{}, err
+	}
+	return CNNConfig{BatchSize: 1, InputChannels: channels, MoveEncoding: encoding, Seed: m.Seed}, nil
 }
 
-// ModelMetadata stores model information
-type ModelMetadata struct {
-	Version     string
-	ModelType   string
-	InputShape  []int
-	OutputShape []int
+// ReadModelMetadata reads only the metadata header of a checkpoint
+func ReadModelMetadata(path string) (*ModelMetadata, error) {
+	if isTensorFile(path) {
+		return readTensorMetadata(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	var metadata ModelMetadata
+	if err := gob.NewDecoder(f).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	return &metadata, nil
 }
 
 // ComputeLoss computes categorical cross-entropy loss
 func (cnn *ChessCNN) ComputeLoss(target *gorgonia.Node) (*gorgonia.Node, error) {
-	// Cross-entropy loss: -sum(target * log(output))
-	logProbs := gorgonia.Must(gorgonia.Log(cnn.output))
-	loss := gorgonia.Must(gorgonia.HadamardProd(target, logProbs))
-	loss = gorgonia.Must(gorgonia.Sum(loss))
-	loss = gorgonia.Must(gorgonia.Neg(loss))
-
-	return loss, nil
+	return PolicyLoss(cnn.output, target)
 }
 
 // ClipGradients applies gradient clipping for stability
@@ -439,14 +514,24 @@ func ClipGradients(nodes gorgonia.Nodes, maxNorm float64) error {
 	return nil
 }
 
-// ConvertMoveToTarget creates one-hot target vector
+// ConvertMoveToTarget creates one-hot target vector using the legacy from/to encoding
 func ConvertMoveToTarget(fromSquare, toSquare int) ([]float64, error) {
-	if fromSquare < 0 || fromSquare >= 64 || toSquare < 0 || toSquare >= 64 {
-		return nil, fmt.Errorf("invalid squares: from=%d, to=%d", fromSquare, toSquare)
+	return ConvertMoveToTargetWithEncoding(fromSquare, toSquare, "", data.MoveEncodingFromTo)
+}
+
+// ConvertMoveToTargetWithEncoding creates one-hot target vector for the given move encoding
+func ConvertMoveToTargetWithEncoding(fromSquare, toSquare int, promotion string, encoding data.MoveEncoding) ([]float64, error) {
+	promo, err := data.ParsePromotion(promotion)
+	if err != nil {
+		return nil, err
+	}
+
+	moveIndex, err := encoding.EncodeMoveIndex(fromSquare, toSquare, promo)
+	if err != nil {
+		return nil, err
 	}
 
-	moveIndex := fromSquare*64 + toSquare
-	target := make([]float64, 4096)
+	target := make([]float64, encoding.Size())
 	target[moveIndex] = 1.0
 
 	return target, nil
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+)
+
+func TestModelMetadataEncoding(t *testing.T) {
+	tests := []struct {
+		metadata ModelMetadata
+		expected data.MoveEncoding
+	}{
+		// Checkpoints written before encodings were recorded
+		{ModelMetadata{OutputShape: []int{4096}}, data.MoveEncodingFromTo},
+		{ModelMetadata{OutputShape: []int{4240}}, data.MoveEncodingUnderpromotion},
+		{ModelMetadata{OutputShape: []int{4096}, MoveEncoding: string(data.MoveEncodingFromTo)}, data.MoveEncodingFromTo},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.metadata.Encoding()
+		if err != nil {
+			t.Errorf("Encoding() for %+v returned error: %v", tt.metadata, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Encoding() for %+v = %s; want %s", tt.metadata, got, tt.expected)
+		}
+	}
+
+	if _, err := (ModelMetadata{MoveEncoding: "bogus"}).Encoding(); err == nil {
+		t.Error("Expected error for unknown move encoding")
+	}
+}
+
+func TestMovePredictionUCI(t *testing.T) {
+	knight, _ := data.MoveEncodingUnderpromotion.EncodeMoveIndex(52, 60, chess.Knight)
+	tests := []struct {
+		index    int
+		expected string
+	}{
+		{12*64 + 28, "e2e4"},
+		{52*64 + 60, "e7e8"}, // Plain indices carry no promotion piece
+		{51*64 + 59, "d7d8"},
+		{knight, "e7e8n"},
+	}
+
+	probs := make([]float64, data.MoveEncodingUnderpromotion.Size())
+	for _, tt := range tests {
+		probs[tt.index] = 1
+		if got := TopKPredictions(probs, 1)[0].UCI(); got != tt.expected {
+			t.Errorf("UCI() of index %d = %s; want %s", tt.index, got, tt.expected)
+		}
+		probs[tt.index] = 0
+	}
+}
+
+func TestChessCNNCheckpointEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.gob")
+
+	legacy, err := NewChessCNNWithConfig(CNNConfig{
+		BatchSize:     1,
+		InputChannels: data.NumChannels,
+		MoveEncoding:  data.MoveEncodingFromTo,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer legacy.Close()
+
+	if err := legacy.SaveModel(path); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+
+	metadata, err := ReadModelMetadata(path)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if metadata.OutputShape[0] != 4096 || metadata.MoveEncoding != string(data.MoveEncodingFromTo) {
+		t.Errorf("Unexpected metadata: %+v", metadata)
+	}
+
+	// Inference picks up the encoding from the checkpoint
+	loaded, err := NewChessCNNForInference(path)
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	defer loaded.Close()
+
+	if loaded.MoveEncoding() != data.MoveEncodingFromTo {
+		t.Errorf("Loaded encoding = %s; want %s", loaded.MoveEncoding(), data.MoveEncodingFromTo)
+	}
+	if loaded.InputChannels() != data.NumChannels {
+		t.Errorf("Loaded input channels = %d; want %d", loaded.InputChannels(), data.NumChannels)
+	}
+
+	// 12-plane models still accept extended state tensors
+	state := data.AppendAuxPlanes(make([]float32, data.NumChannels*64), data.DefaultAuxState())
+	if _, err := loaded.PredictState(state, 3); err != nil {
+		t.Errorf("PredictState on extended input failed: %v", err)
+	}
+
+	// Loading into a model with a different encoding is rejected
+	current, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer current.Close()
+
+	if err := current.LoadModel(path); err == nil {
+		t.Error("Expected error loading checkpoint with mismatched move encoding")
+	}
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/thyrook/partner/internal/data"
+)
+
+const (
+	// DefaultDistillTemperature softens the teacher policy when none is configured
+	DefaultDistillTemperature = 2.0
+
+	// DefaultDistillWeight is the share of the policy target taken from the
+	// teacher when none is configured
+	DefaultDistillWeight = 0.5
+)
+
+// Distiller streams temperature-softened policy targets from a teacher model.
+// Target is safe for concurrent use by data loader workers.
+type Distiller struct {
+	teacher     ChessModel
+	temperature float64
+	mu          sync.Mutex // Serializes teacher forward passes
+}
+
+// NewDistiller loads a teacher checkpoint of any architecture
+func NewDistiller(teacherPath string, temperature float64) (*Distiller, error) {
+	if temperature <= 0 {
+		return nil, fmt.Errorf("distillation temperature must be positive, got %v", temperature)
+	}
+
+	teacher, err := LoadChessModel(teacherPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load teacher: %w", err)
+	}
+
+	return &Distiller{teacher: teacher, temperature: temperature}, nil
+}
+
+// Teacher returns the teacher model
+func (d *Distiller) Teacher() ChessModel {
+	return d.teacher
+}
+
+// Target runs the teacher on a state tensor and returns its policy softened
+// by the temperature (p^(1/T), renormalized) in the student's encoding,
+// together with the teacher's top move index
+func (d *Distiller) Target(state []float32, encoding data.MoveEncoding) ([]float64, int, error) {
+	d.mu.Lock()
+	probs, _, err := d.teacher.Forward(state)
+	d.mu.Unlock()
+	if err != nil {
+		return nil, 0, fmt.Errorf("teacher forward failed: %w", err)
+	}
+
+	// Soften in log space so small probabilities don't underflow
+	maxLog := math.Inf(-1)
+	logs := make([]float64, len(probs))
+	for i, p := range probs {
+		logs[i] = math.Log(p) / d.temperature
+		if logs[i] > maxLog {
+			maxLog = logs[i]
+		}
+	}
+
+	target := make([]float64, encoding.Size())
+	total := 0.0
+	for i, l := range logs {
+		if math.IsInf(l, -1) {
+			continue
+		}
+		idx, err := data.ConvertMoveIndex(i, encoding)
+		if err != nil {
+			return nil, 0, err
+		}
+		p := math.Exp(l - maxLog)
+		target[idx] += p
+		total += p
+	}
+	if total == 0 {
+		return nil, 0, fmt.Errorf("teacher policy is empty")
+	}
+
+	best := 0
+	for i := range target {
+		target[i] /= total
+		if target[i] > target[best] {
+			best = i
+		}
+	}
+
+	return target, best, nil
+}
+
+// Close releases the teacher model
+func (d *Distiller) Close() error {
+	return d.teacher.Close()
+}
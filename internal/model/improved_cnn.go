@@ -2,29 +2,31 @@ package model
 
 import (
 	"fmt"
+	"math/rand"
 
+	"github.com/thyrook/partner/internal/data"
 	"gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
 )
 
 // ImprovedChessCNN is an enhanced CNN with residual blocks and more capacity
 type ImprovedChessCNN struct {
-	graph *gorgonia.ExprGraph
-	vm    gorgonia.VM
+	g  *gorgonia.ExprGraph
+	vm gorgonia.VM
 
 	// Input
 	input *gorgonia.Node
 
 	// Residual blocks
-	conv1  *gorgonia.Node
-	conv2  *gorgonia.Node
-	res1   *gorgonia.Node
-	conv3  *gorgonia.Node
-	conv4  *gorgonia.Node
-	res2   *gorgonia.Node
-	conv5  *gorgonia.Node
-	conv6  *gorgonia.Node
-	res3   *gorgonia.Node
+	conv1 *gorgonia.Node
+	conv2 *gorgonia.Node
+	res1  *gorgonia.Node
+	conv3 *gorgonia.Node
+	conv4 *gorgonia.Node
+	res2  *gorgonia.Node
+	conv5 *gorgonia.Node
+	conv6 *gorgonia.Node
+	res3  *gorgonia.Node
 
 	// Policy head (move prediction)
 	policyConv *gorgonia.Node
@@ -39,22 +41,67 @@ type ImprovedChessCNN struct {
 
 	// Learnables
 	learnables gorgonia.Nodes
+
+	// Layout
+	batchSize     int
+	inputChannels int
+	moveEncoding  data.MoveEncoding
+
+	seed int64      // Seed of the initial weights, recorded in checkpoints (0 = unseeded)
+	rng  *rand.Rand // Draws the initial weights while the graph is built
 }
 
-// NewImprovedChessCNN creates an enhanced CNN architecture
+// NewImprovedChessCNN creates an enhanced CNN architecture with the default layout
 func NewImprovedChessCNN() (*ImprovedChessCNN, error) {
+	return NewImprovedChessCNNWithConfig(DefaultCNNConfig())
+}
+
+// NewImprovedChessCNNForInference creates a model for inference and loads weights from a checkpoint
+func NewImprovedChessCNNForInference(checkpointPath string) (*ImprovedChessCNN, error) {
+	m, err := LoadChessModel(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	cnn, ok := m.(*ImprovedChessCNN)
+	if !ok {
+		m.Close()
+		return nil, fmt.Errorf("checkpoint %s is not an ImprovedChessCNN", checkpointPath)
+	}
+	return cnn, nil
+}
+
+// NewImprovedChessCNNWithConfig creates an enhanced CNN with the given batch size, input format and move encoding
+func NewImprovedChessCNNWithConfig(config CNNConfig) (*ImprovedChessCNN, error) {
+	if !config.MoveEncoding.Valid() {
+		return nil, fmt.Errorf("unknown move encoding: %q", config.MoveEncoding)
+	}
+	if !data.ValidInputChannels(config.InputChannels) {
+		return nil, fmt.Errorf("unsupported input channels: %d", config.InputChannels)
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1
+	}
+	batchSize := config.BatchSize
+	channels := config.InputChannels
+	policySize := config.MoveEncoding.Size()
+
 	g := gorgonia.NewGraph()
 	cnn := &ImprovedChessCNN{
-		graph:      g,
-		learnables: make(gorgonia.Nodes, 0),
+		g:             g,
+		learnables:    make(gorgonia.Nodes, 0),
+		batchSize:     batchSize,
+		inputChannels: channels,
+		moveEncoding:  config.MoveEncoding,
+		seed:          config.Seed,
+		rng:           initRand(config.Seed),
 	}
 
-	// Input: [batch, 12, 8, 8] (12 piece planes)
-	inputShape := tensor.Shape{1, 12, 8, 8}
+	// Input: [batch, channels, 8, 8]
+	inputShape := tensor.Shape{batchSize, channels, 8, 8}
 	cnn.input = gorgonia.NewTensor(g, tensor.Float64, 4, gorgonia.WithShape(inputShape...), gorgonia.WithName("input"))
 
-	// First conv block: 12 -> 128 channels
-	conv1, err := cnn.convBlock(cnn.input, 12, 128, "conv1")
+	// First conv block: channels -> 128
+	conv1, err := cnn.convBlock(cnn.input, channels, 128, "conv1")
 	if err != nil {
 		return nil, fmt.Errorf("conv1: %w", err)
 	}
@@ -125,23 +172,29 @@ func NewImprovedChessCNN() (*ImprovedChessCNN, error) {
 	cnn.res3 = res3
 
 	// === Policy Head (Move Prediction) ===
-	// Conv: 512 -> 256
-	policyConv, err := cnn.convBlock(res3, 512, 256, "policy_conv")
+	// Conv: 512 -> 32 (keeps the policy FC at ~9M weights instead of ~70M)
+	policyConv, err := cnn.convBlock(res3, 512, 32, "policy_conv")
 	if err != nil {
 		return nil, fmt.Errorf("policy_conv: %w", err)
 	}
 	cnn.policyConv = policyConv
 
-	// Flatten: [batch, 256, 8, 8] -> [batch, 16384]
-	policyFlat := gorgonia.Must(gorgonia.Reshape(policyConv, tensor.Shape{1, 256 * 8 * 8}))
+	// Flatten: [batch, 32, 8, 8] -> [batch, 2048]
+	policyFlat := gorgonia.Must(gorgonia.Reshape(policyConv, tensor.Shape{batchSize, 32 * 8 * 8}))
 
-	// FC: 16384 -> 4096 (64x64 possible moves)
-	policyFC, err := cnn.fcLayer(policyFlat, 256*8*8, 4096, "policy_fc")
+	// FC: 2048 -> policySize (64x64 from-to pairs, plus underpromotions)
+	policyFC, err := cnn.fcLayer(policyFlat, 32*8*8, policySize, "policy_fc")
 	if err != nil {
 		return nil, fmt.Errorf("policy_fc: %w", err)
 	}
 	cnn.policyFC = policyFC
-	cnn.policyOut = policyFC
+
+	// Softmax for probabilities
+	policyOut, err := gorgonia.SoftMax(policyFC)
+	if err != nil {
+		return nil, fmt.Errorf("policy_softmax: %w", err)
+	}
+	cnn.policyOut = policyOut
 
 	// === Value Head (Position Evaluation) ===
 	// Conv: 512 -> 32
@@ -152,13 +205,17 @@ func NewImprovedChessCNN() (*ImprovedChessCNN, error) {
 	cnn.valueConv = valueConv
 
 	// Flatten: [batch, 32, 8, 8] -> [batch, 2048]
-	valueFlat := gorgonia.Must(gorgonia.Reshape(valueConv, tensor.Shape{1, 32 * 8 * 8}))
+	valueFlat := gorgonia.Must(gorgonia.Reshape(valueConv, tensor.Shape{batchSize, 32 * 8 * 8}))
 
 	// FC: 2048 -> 256
 	valueFC1, err := cnn.fcLayer(valueFlat, 32*8*8, 256, "value_fc1")
 	if err != nil {
 		return nil, fmt.Errorf("value_fc1: %w", err)
 	}
+	valueFC1, err = gorgonia.Rectify(valueFC1)
+	if err != nil {
+		return nil, fmt.Errorf("value_relu: %w", err)
+	}
 	cnn.valueFC1 = valueFC1
 
 	// FC: 256 -> 1 (single value output)
@@ -185,10 +242,10 @@ func NewImprovedChessCNN() (*ImprovedChessCNN, error) {
 // convBlock creates a conv + batchnorm + relu block
 func (cnn *ImprovedChessCNN) convBlock(input *gorgonia.Node, inChannels, outChannels int, name string) (*gorgonia.Node, error) {
 	// Conv2D
-	kernel := gorgonia.NewTensor(cnn.graph, tensor.Float64, 4,
+	kernel := gorgonia.NewTensor(cnn.g, tensor.Float64, 4,
 		gorgonia.WithShape(outChannels, inChannels, 3, 3),
 		gorgonia.WithName(name+"_kernel"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, cnn.rng)))
 	cnn.learnables = append(cnn.learnables, kernel)
 
 	conv, err := gorgonia.Conv2d(input, kernel, tensor.Shape{3, 3}, []int{1, 1}, []int{1, 1}, []int{1, 1})
@@ -197,15 +254,14 @@ func (cnn *ImprovedChessCNN) convBlock(input *gorgonia.Node, inChannels, outChan
 	}
 
 	// Bias
-	bias := gorgonia.NewTensor(cnn.graph, tensor.Float64, 1,
+	bias := gorgonia.NewTensor(cnn.g, tensor.Float64, 1,
 		gorgonia.WithShape(outChannels),
 		gorgonia.WithName(name+"_bias"),
 		gorgonia.WithInit(gorgonia.Zeroes()))
 	cnn.learnables = append(cnn.learnables, bias)
 
-	// Broadcast bias and add
-	biasReshaped := gorgonia.Must(gorgonia.Reshape(bias, tensor.Shape{1, outChannels, 1, 1}))
-	convBias, err := gorgonia.BroadcastAdd(conv, biasReshaped, nil, []byte{0, 2, 3})
+	// Broadcast bias over batch and board dimensions and add
+	convBias, err := gorgonia.BroadcastAdd(conv, bias, nil, []byte{0, 2, 3})
 	if err != nil {
 		return nil, err
 	}
@@ -221,10 +277,10 @@ func (cnn *ImprovedChessCNN) convBlock(input *gorgonia.Node, inChannels, outChan
 
 // conv1x1 creates a 1x1 convolution for projection (channel matching)
 func (cnn *ImprovedChessCNN) conv1x1(input *gorgonia.Node, inChannels, outChannels int, name string) (*gorgonia.Node, error) {
-	kernel := gorgonia.NewTensor(cnn.graph, tensor.Float64, 4,
+	kernel := gorgonia.NewTensor(cnn.g, tensor.Float64, 4,
 		gorgonia.WithShape(outChannels, inChannels, 1, 1),
 		gorgonia.WithName(name+"_kernel"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, cnn.rng)))
 	cnn.learnables = append(cnn.learnables, kernel)
 
 	conv, err := gorgonia.Conv2d(input, kernel, tensor.Shape{1, 1}, []int{0, 0}, []int{1, 1}, []int{1, 1})
@@ -237,13 +293,13 @@ func (cnn *ImprovedChessCNN) conv1x1(input *gorgonia.Node, inChannels, outChanne
 
 // fcLayer creates a fully connected layer
 func (cnn *ImprovedChessCNN) fcLayer(input *gorgonia.Node, inSize, outSize int, name string) (*gorgonia.Node, error) {
-	weights := gorgonia.NewMatrix(cnn.graph, tensor.Float64,
+	weights := gorgonia.NewMatrix(cnn.g, tensor.Float64,
 		gorgonia.WithShape(inSize, outSize),
 		gorgonia.WithName(name+"_weights"),
-		gorgonia.WithInit(gorgonia.GlorotU(1.0)))
+		gorgonia.WithInit(glorotU(1.0, cnn.rng)))
 	cnn.learnables = append(cnn.learnables, weights)
 
-	bias := gorgonia.NewVector(cnn.graph, tensor.Float64,
+	bias := gorgonia.NewVector(cnn.g, tensor.Float64,
 		gorgonia.WithShape(outSize),
 		gorgonia.WithName(name+"_bias"),
 		gorgonia.WithInit(gorgonia.Zeroes()))
@@ -254,7 +310,7 @@ func (cnn *ImprovedChessCNN) fcLayer(input *gorgonia.Node, inSize, outSize int,
 		return nil, err
 	}
 
-	result, err := gorgonia.Add(mul, bias)
+	result, err := gorgonia.BroadcastAdd(mul, bias, nil, []byte{0})
 	if err != nil {
 		return nil, err
 	}
@@ -262,32 +318,73 @@ func (cnn *ImprovedChessCNN) fcLayer(input *gorgonia.Node, inSize, outSize int,
 	return result, nil
 }
 
-// Forward performs a forward pass returning both policy and value
-func (cnn *ImprovedChessCNN) Forward(inputData tensor.Tensor) (policy, value tensor.Tensor, err error) {
-	// Set input
-	if err := gorgonia.Let(cnn.input, inputData); err != nil {
-		return nil, nil, fmt.Errorf("failed to set input: %w", err)
-	}
+// Forward runs a flat state tensor through the network and returns the
+// policy probabilities and the value from the side to move's perspective
+func (cnn *ImprovedChessCNN) Forward(state []float32) ([]float64, float64, error) {
+	return forwardState(cnn, state)
+}
 
-	// Run forward pass
-	if err := cnn.vm.RunAll(); err != nil {
-		return nil, nil, fmt.Errorf("forward pass failed: %w", err)
-	}
+// PredictState performs inference on a flat 12- or 19-channel state tensor,
+// masking illegal moves before the softmax
+func (cnn *ImprovedChessCNN) PredictState(state []float32, topK int) ([]MovePrediction, error) {
+	return predictTopK(cnn, state, topK)
+}
 
-	// Get outputs
-	policyVal := cnn.policyOut.Value()
-	valueVal := cnn.valueOut.Value()
+// Predict performs inference on a 12-plane board tensor (see ChessCNN.Predict)
+func (cnn *ImprovedChessCNN) Predict(boardTensor [12][8][8]float32, topK int) ([]MovePrediction, error) {
+	return cnn.PredictState(data.TensorToFlatArray(boardTensor), topK)
+}
+
+// Learnables returns all trainable parameters
+func (cnn *ImprovedChessCNN) Learnables() gorgonia.Nodes {
+	return cnn.learnables
+}
 
-	if policyVal == nil || valueVal == nil {
-		return nil, nil, fmt.Errorf("output is nil")
+// Architecture returns ArchitectureResNet
+func (cnn *ImprovedChessCNN) Architecture() Architecture {
+	return ArchitectureResNet
+}
+
+// InputChannels returns the number of input planes the model expects
+func (cnn *ImprovedChessCNN) InputChannels() int {
+	return cnn.inputChannels
+}
+
+// MoveEncoding returns the move encoding of the policy output
+func (cnn *ImprovedChessCNN) MoveEncoding() data.MoveEncoding {
+	return cnn.moveEncoding
+}
+
+// PolicySize returns the length of the policy output
+func (cnn *ImprovedChessCNN) PolicySize() int {
+	return cnn.moveEncoding.Size()
+}
+
+// HasValueHead reports true; the value head predicts the game outcome
+func (cnn *ImprovedChessCNN) HasValueHead() bool {
+	return true
+}
+
+// Metadata describes the model layout as recorded in checkpoints
+func (cnn *ImprovedChessCNN) Metadata() ModelMetadata {
+	return ModelMetadata{
+		Version:      "1.0",
+		ModelType:    ArchitectureResNet.modelType(),
+		InputShape:   []int{cnn.inputChannels, 8, 8},
+		OutputShape:  []int{cnn.PolicySize()},
+		MoveEncoding: string(cnn.moveEncoding),
+		Seed:         cnn.seed,
 	}
+}
 
-	return policyVal.(tensor.Tensor), valueVal.(tensor.Tensor), nil
+// SaveModel saves model weights to file
+func (cnn *ImprovedChessCNN) SaveModel(path string) error {
+	return saveCheckpoint(path, cnn.Metadata(), cnn.learnables)
 }
 
-// GetLearnables returns all trainable parameters
-func (cnn *ImprovedChessCNN) GetLearnables() gorgonia.Nodes {
-	return cnn.learnables
+// LoadModel loads model weights from file
+func (cnn *ImprovedChessCNN) LoadModel(path string) error {
+	return loadCheckpoint(path, cnn, cnn.learnables)
 }
 
 // Reset resets the VM state
@@ -298,5 +395,26 @@ func (cnn *ImprovedChessCNN) Reset() error {
 
 // Close closes the VM
 func (cnn *ImprovedChessCNN) Close() error {
-	return cnn.vm.Close()
+	if cnn.vm != nil {
+		return cnn.vm.Close()
+	}
+	return nil
+}
+
+// graph returns the nodes the trainer attaches its loss to
+func (cnn *ImprovedChessCNN) graph() modelGraph {
+	return modelGraph{g: cnn.g, input: cnn.input, logits: cnn.policyFC, policy: cnn.policyOut, value: cnn.valueOut}
+}
+
+// machine returns the VM executing the graph
+func (cnn *ImprovedChessCNN) machine() gorgonia.VM {
+	return cnn.vm
+}
+
+// compile replaces the VM after the graph has been extended
+func (cnn *ImprovedChessCNN) compile() {
+	if cnn.vm != nil {
+		cnn.vm.Close()
+	}
+	cnn.vm = gorgonia.NewTapeMachine(cnn.g)
 }
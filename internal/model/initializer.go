@@ -0,0 +1,47 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// initRand returns the generator of a model's initial weights. Seed 0 is
+// time based.
+func initRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// glorotU is gorgonia.GlorotU drawing from rng instead of a time-seeded
+// source, so that a model built from the same seed starts from the same
+// weights. Weights are drawn in the order the layers are created.
+func glorotU(gain float64, rng *rand.Rand) gorgonia.InitWFn {
+	return func(dt tensor.Dtype, s ...int) interface{} {
+		if dt != tensor.Float64 {
+			panic("glorotU only supports float64 weights, got " + dt.String())
+		}
+
+		// Fan computation as in gorgonia.GlorotEtAlU64
+		n1, n2, fieldSize := 1, s[0], 1
+		if len(s) > 1 {
+			n1, n2 = s[0], s[1]
+			for _, v := range s[2:] {
+				fieldSize *= v
+			}
+		}
+		stdev := gain * math.Sqrt(2.0/float64((n1+n2)*fieldSize))
+		limit := math.Sqrt(3.0) * stdev
+
+		weights := make([]float64, tensor.Shape(s).TotalSize())
+		for i := range weights {
+			weights[i] = -limit + 2*limit*rng.Float64()
+		}
+		return weights
+	}
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+)
+
+// MaskedSoftmax computes the softmax over the logits of legal moves only.
+// Illegal moves get probability 0.
+func MaskedSoftmax(logits []float64, legal []bool) []float64 {
+	maxLogit := math.Inf(-1)
+	for i, l := range logits {
+		if legal[i] && l > maxLogit {
+			maxLogit = l
+		}
+	}
+
+	probs := make([]float64, len(logits))
+	if math.IsInf(maxLogit, -1) {
+		return probs
+	}
+
+	sum := 0.0
+	for i, l := range logits {
+		if legal[i] {
+			probs[i] = math.Exp(l - maxLogit)
+			sum += probs[i]
+		}
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	return probs
+}
+
+// MaskPolicy restricts policy probabilities to the legal moves and
+// renormalizes them, which equals masking the logits before the softmax.
+// It is used for networks that only expose probabilities.
+func MaskPolicy(probs []float64, legal []bool) []float64 {
+	masked := make([]float64, len(probs))
+	sum := 0.0
+	for i, p := range probs {
+		if legal[i] {
+			masked[i] = p
+			sum += p
+		}
+	}
+	if sum == 0 {
+		return masked
+	}
+	for i := range masked {
+		masked[i] /= sum
+	}
+	return masked
+}
+
+// LegalMask returns the legal move mask of a position for a policy of the
+// given length, or nil if the position has no legal moves or the length
+// matches no move encoding
+func LegalMask(pos *chess.Position, policySize int) []bool {
+	encoding, err := data.MoveEncodingForSize(policySize)
+	if err != nil || pos == nil {
+		return nil
+	}
+	return indexMask(data.LegalMoveIndices(pos, encoding), policySize)
+}
+
+// stateLegalMask returns the legal move mask of a state tensor (see
+// data.StateLegalMoveIndices), or nil if no legal moves can be generated
+func stateLegalMask(state []float32, encoding data.MoveEncoding) []bool {
+	indices, err := data.StateLegalMoveIndices(state, encoding)
+	if err != nil {
+		return nil
+	}
+	return indexMask(indices, encoding.Size())
+}
+
+// indexMask converts move indices to a mask, or nil if there are none
+func indexMask(indices []int, size int) []bool {
+	if len(indices) == 0 {
+		return nil
+	}
+	mask := make([]bool, size)
+	for _, index := range indices {
+		mask[index] = true
+	}
+	return mask
+}
+
+// ForwardLegal runs a forward pass with the logits of illegal moves masked
+// before the softmax. pos supplies the legal moves; when nil they are
+// generated from the state tensor (either side's moves for 12-channel
+// states). States without legal moves (e.g. partial board captures) keep
+// the full policy.
+func ForwardLegal(m ChessModel, state []float32, pos *chess.Position) ([]float64, float64, error) {
+	logits, probs, value, err := runState(m, state)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var legal []bool
+	if pos != nil {
+		legal = LegalMask(pos, m.PolicySize())
+	} else {
+		legal = stateLegalMask(state, m.MoveEncoding())
+	}
+	if legal == nil {
+		return probs, value, nil
+	}
+	return MaskedSoftmax(logits, legal), value, nil
+}
+
+// PredictPosition returns the top K legal moves of a position
+func PredictPosition(m ChessModel, pos *chess.Position, topK int) ([]MovePrediction, error) {
+	state, err := data.TensorizePosition(pos, m.InputChannels())
+	if err != nil {
+		return nil, fmt.Errorf("failed to tensorize position: %w", err)
+	}
+
+	probs, _, err := ForwardLegal(m, state, pos)
+	if err != nil {
+		return nil, err
+	}
+	return legalPredictions(TopKPredictions(probs, topK)), nil
+}
+
+// legalPredictions drops the zero-probability moves a masked policy pads the
+// top K with when the position has fewer than K legal moves
+func legalPredictions(predictions []MovePrediction) []MovePrediction {
+	for i, p := range predictions {
+		if p.Probability == 0 && i > 0 {
+			return predictions[:i]
+		}
+	}
+	return predictions
+}
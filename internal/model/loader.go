@@ -0,0 +1,207 @@
+package model
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/thyrook/partner/internal/data"
+)
+
+// loadedBatch is one training batch decoded, augmented and packed into
+// batch buffers
+type loadedBatch struct {
+	index   int
+	entries []*data.DataEntry // Augmented entries; the first BatchSize are packed
+	buf     *batchBuffers
+	err     error
+
+	loaded chan struct{} // Closed once the batch is ready (background loading only)
+}
+
+// batchLoader produces the batches of one epoch in order. With workers it
+// loads them on background goroutines into a pool of reusable buffers, at
+// most depth batches ahead of the training step; without, each batch is
+// loaded on demand. Every batch augments with its own seed drawn from the
+// epoch generator, so the batches don't depend on the number of workers or
+// the order they finish in.
+type batchLoader struct {
+	t          *Trainer
+	dataset    *data.Dataset
+	indices    []int
+	seeds      []int64
+	augConfig  data.AugmentationConfig
+	numBatches int
+
+	// Sequential loading
+	nextIndex int
+	buf       *batchBuffers
+
+	// Background loading
+	free  chan *batchBuffers
+	ready chan *loadedBatch
+	jobs  chan *loadedBatch
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	stall time.Duration
+}
+
+// newBatchLoader starts loading the batches of t.trainIndices, drawing the
+// per-batch augmentation seeds from rng
+func (t *Trainer) newBatchLoader(dataset *data.Dataset, rng *rand.Rand) *batchLoader {
+	batchSize := t.config.BatchSize
+	numBatches := (len(t.trainIndices) + batchSize - 1) / batchSize
+
+	l := &batchLoader{
+		t:          t,
+		dataset:    dataset,
+		indices:    t.trainIndices,
+		seeds:      make([]int64, numBatches),
+		augConfig:  data.DefaultAugmentationConfig(),
+		numBatches: numBatches,
+	}
+	for i := range l.seeds {
+		l.seeds[i] = rng.Int63()
+	}
+
+	workers := t.config.NumWorkers
+	if workers <= 0 {
+		l.buf = newBatchBuffers(batchSize, t.inputChannels, t.policySize)
+		return l
+	}
+
+	depth := t.config.PrefetchDepth
+	if depth <= 0 {
+		depth = 2 * workers
+	}
+	// One buffer per waiting batch and one for the batch being trained on
+	l.free = make(chan *batchBuffers, depth+1)
+	for i := 0; i < depth+1; i++ {
+		l.free <- newBatchBuffers(batchSize, t.inputChannels, t.policySize)
+	}
+	l.ready = make(chan *loadedBatch, depth)
+	l.jobs = make(chan *loadedBatch)
+	l.done = make(chan struct{})
+
+	l.wg.Add(1 + workers)
+	go l.dispatch()
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer l.wg.Done()
+			for batch := range l.jobs {
+				l.load(batch)
+				close(batch.loaded)
+			}
+		}()
+	}
+	return l
+}
+
+// dispatch hands out the batches in order. A batch takes its buffer before it
+// is queued, so the oldest unfinished batch never waits for a buffer held by
+// a later one.
+func (l *batchLoader) dispatch() {
+	defer l.wg.Done()
+	defer close(l.jobs)
+	defer close(l.ready)
+
+	for i := 0; i < l.numBatches; i++ {
+		var buf *batchBuffers
+		select {
+		case buf = <-l.free:
+		case <-l.done:
+			return
+		}
+		batch := &loadedBatch{index: i, buf: buf, loaded: make(chan struct{})}
+		select {
+		case l.ready <- batch:
+		case <-l.done:
+			return
+		}
+		select {
+		case l.jobs <- batch:
+		case <-l.done:
+			// Nobody waits on a batch after close
+			return
+		}
+	}
+}
+
+// next returns the next batch, or nil at the end of the epoch. Time spent
+// waiting for it counts as loader stall.
+func (l *batchLoader) next() *loadedBatch {
+	start := time.Now()
+	defer func() { l.stall += time.Since(start) }()
+
+	if l.ready == nil {
+		if l.nextIndex >= l.numBatches {
+			return nil
+		}
+		batch := &loadedBatch{index: l.nextIndex, buf: l.buf}
+		l.nextIndex++
+		l.load(batch)
+		return batch
+	}
+
+	batch, ok := <-l.ready
+	if !ok {
+		return nil
+	}
+	<-batch.loaded
+	return batch
+}
+
+// release returns a batch's buffer to the pool once it has been trained on
+func (l *batchLoader) release(batch *loadedBatch) {
+	if l.free != nil {
+		l.free <- batch.buf
+	}
+}
+
+// stallTime returns the time the training step has waited for batches
+func (l *batchLoader) stallTime() time.Duration {
+	return l.stall
+}
+
+// close stops the background workers
+func (l *batchLoader) close() {
+	if l.done == nil {
+		return
+	}
+	close(l.done)
+	l.wg.Wait()
+}
+
+// load reads, augments and packs one batch
+func (l *batchLoader) load(batch *loadedBatch) {
+	batchSize := l.t.config.BatchSize
+	start := batch.index * batchSize
+	end := min(start+batchSize, len(l.indices))
+
+	entries := make([]*data.DataEntry, 0, end-start)
+	for _, idx := range l.indices[start:end] {
+		entry, err := l.dataset.LoadBatch(idx, 1)
+		if err == nil && len(entry) > 0 {
+			entries = append(entries, entry[0])
+		}
+	}
+	if len(entries) == 0 {
+		batch.err = fmt.Errorf("no entries loaded for batch %d", batch.index)
+		return
+	}
+
+	rng := rand.New(rand.NewSource(l.seeds[batch.index]))
+	batch.entries = data.AugmentBatchRand(entries, l.augConfig, rng)
+
+	// Augmented batches can outgrow the model batch; the rest are dropped
+	// as by trainBatch
+	batch.buf.clear()
+	for i, entry := range batch.entries[:min(len(batch.entries), batchSize)] {
+		if err := l.t.fillSample(i, entry, batch.buf); err != nil {
+			batch.err = err
+			return
+		}
+	}
+}
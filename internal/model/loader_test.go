@@ -0,0 +1,80 @@
+package model
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackgroundLoaderMatchesSequential(t *testing.T) {
+	dataset := newOpeningDataset(t, filepath.Join(t.TempDir(), "train.db"))
+
+	train := func(workers, depth int) *Trainer {
+		config := DefaultTrainingConfig()
+		config.Epochs = 2
+		config.BatchSize = 2
+		config.Verbose = false
+		config.SaveInterval = 0
+		config.SavePath = ""
+		config.ValidationSplit = 0.25
+		config.LegalMovesOnly = true
+		config.Seed = 7
+		config.NumWorkers = workers
+		config.PrefetchDepth = depth
+
+		trainer, err := NewTrainer(config)
+		if err != nil {
+			t.Fatalf("Failed to create trainer: %v", err)
+		}
+		t.Cleanup(func() { trainer.GetModel().Close() })
+		if err := trainer.Train(dataset); err != nil {
+			t.Fatalf("Failed to train: %v", err)
+		}
+		return trainer
+	}
+
+	sequential := train(0, 0)
+	for _, tt := range []struct{ workers, depth int }{{1, 1}, {3, 0}, {4, 1}} {
+		trainer := train(tt.workers, tt.depth)
+		want, got := sequential.GetModel().Learnables(), trainer.GetModel().Learnables()
+		for i := range want {
+			a, b := want[i].Value().Data().([]float64), got[i].Value().Data().([]float64)
+			for j := range a {
+				if a[j] != b[j] {
+					t.Fatalf("%d workers, depth %d: weight %d[%d] = %v, sequential loading gave %v", tt.workers, tt.depth, i, j, b[j], a[j])
+				}
+			}
+		}
+		for _, metrics := range trainer.GetMetrics() {
+			if metrics.LoaderStall <= 0 || metrics.LoaderStall > metrics.Duration {
+				t.Errorf("%d workers: epoch %d loader stall %v of %v", tt.workers, metrics.Epoch, metrics.LoaderStall, metrics.Duration)
+			}
+		}
+	}
+}
+
+func TestBatchLoaderClose(t *testing.T) {
+	dataset := newOpeningDataset(t, filepath.Join(t.TempDir(), "train.db"))
+
+	config := DefaultTrainingConfig()
+	config.BatchSize = 1
+	config.NumWorkers = 2
+	config.PrefetchDepth = 1
+	trainer, err := NewTrainer(config)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer trainer.GetModel().Close()
+	trainer.trainIndices = []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+	loader := trainer.newBatchLoader(dataset, rand.New(rand.NewSource(1)))
+	for i := 0; i < 2; i++ {
+		batch := loader.next()
+		if batch == nil || batch.err != nil || batch.index != i {
+			t.Fatalf("Batch %d: %+v", i, batch)
+		}
+		loader.release(batch)
+	}
+	// Workers blocked on a full prefetch queue stop without the rest being read
+	loader.close()
+}
@@ -0,0 +1,322 @@
+package model
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/thyrook/partner/internal/data"
+	"gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// Architecture identifies a network architecture
+type Architecture string
+
+const (
+	// ArchitectureCNN is ChessCNN: two conv layers and a policy head
+	ArchitectureCNN Architecture = "cnn"
+
+	// ArchitectureResNet is ImprovedChessCNN: residual blocks with policy and value heads
+	ArchitectureResNet Architecture = "resnet"
+
+	// DefaultArchitecture is used when no architecture is configured
+	DefaultArchitecture = ArchitectureCNN
+)
+
+// ParseArchitecture converts a command-line architecture name to an Architecture
+func ParseArchitecture(name string) (Architecture, error) {
+	switch strings.ToLower(name) {
+	case "", "cnn", "chesscnn":
+		return ArchitectureCNN, nil
+	case "resnet", "improved", "improvedchesscnn":
+		return ArchitectureResNet, nil
+	default:
+		return "", fmt.Errorf("unknown architecture: %q (expected cnn or resnet)", name)
+	}
+}
+
+// modelType returns the ModelType recorded in checkpoint metadata
+func (a Architecture) modelType() string {
+	switch a {
+	case ArchitectureResNet:
+		return "ImprovedChessCNN"
+	default:
+		return "ChessCNN"
+	}
+}
+
+// ChessModel is the interface shared by all trainable move prediction networks
+type ChessModel interface {
+	// Architecture returns the network architecture
+	Architecture() Architecture
+
+	// InputChannels returns the number of input planes the model expects
+	InputChannels() int
+
+	// MoveEncoding returns the move encoding of the policy output
+	MoveEncoding() data.MoveEncoding
+
+	// PolicySize returns the length of the policy output
+	PolicySize() int
+
+	// HasValueHead reports whether the model predicts a position evaluation
+	HasValueHead() bool
+
+	// Forward runs a flat 12- or 19-channel state tensor through the network and
+	// returns the policy probabilities and the value in [-1, 1] from the side to
+	// move's perspective (always 0 for models without a value head)
+	Forward(state []float32) ([]float64, float64, error)
+
+	// PredictState returns the top K moves for a flat state tensor
+	PredictState(state []float32, topK int) ([]MovePrediction, error)
+
+	// Learnables returns all trainable parameters
+	Learnables() gorgonia.Nodes
+
+	// Metadata describes the model layout as recorded in checkpoints
+	Metadata() ModelMetadata
+
+	// SaveModel saves model weights to file
+	SaveModel(path string) error
+
+	// LoadModel loads model weights from file
+	LoadModel(path string) error
+
+	// Close cleans up resources
+	Close() error
+
+	// graph returns the nodes the trainer attaches its loss to
+	graph() modelGraph
+
+	// machine returns the VM executing the graph
+	machine() gorgonia.VM
+
+	// compile replaces the VM after the graph has been extended
+	compile()
+}
+
+// modelGraph holds the computation graph nodes shared with the trainer
+type modelGraph struct {
+	g      *gorgonia.ExprGraph
+	input  *gorgonia.Node // [batch, channels, 8, 8]
+	logits *gorgonia.Node // Policy logits before the softmax [batch, policySize]
+	policy *gorgonia.Node // Softmax probabilities [batch, policySize]
+	value  *gorgonia.Node // Tanh evaluation [batch, 1], nil without a value head
+}
+
+// NewChessModel creates a model of the given architecture and layout
+func NewChessModel(arch Architecture, config CNNConfig) (ChessModel, error) {
+	switch arch {
+	case ArchitectureCNN, "":
+		return NewChessCNNWithConfig(config)
+	case ArchitectureResNet:
+		return NewImprovedChessCNNWithConfig(config)
+	default:
+		return nil, fmt.Errorf("unknown architecture: %q", arch)
+	}
+}
+
+// LoadChessModel creates an inference model (batch size 1) matching a checkpoint
+// and loads its weights. The architecture is read from the checkpoint metadata.
+func LoadChessModel(checkpointPath string) (ChessModel, error) {
+	metadata, err := ReadModelMetadata(checkpointPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	arch, err := metadata.Architecture()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	config, err := metadata.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	m, err := NewChessModel(arch, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inference model: %w", err)
+	}
+
+	if err := m.LoadModel(checkpointPath); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	return m, nil
+}
+
+// predictTopK runs a forward pass masked to the legal moves of the position
+// encoded in the state and returns the top K moves
+func predictTopK(m ChessModel, state []float32, topK int) ([]MovePrediction, error) {
+	probs, _, err := ForwardLegal(m, state, nil)
+	if err != nil {
+		return nil, err
+	}
+	return legalPredictions(TopKPredictions(probs, topK)), nil
+}
+
+// forwardState runs a single state tensor through a batch size 1 graph
+func forwardState(m ChessModel, state []float32) ([]float64, float64, error) {
+	_, probs, value, err := runState(m, state)
+	return probs, value, err
+}
+
+// runState runs a single state tensor through a batch size 1 graph and
+// returns the policy logits and probabilities and the value
+func runState(m ChessModel, state []float32) ([]float64, []float64, float64, error) {
+	state, err := data.ExpandInputChannels(state, m.InputChannels())
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid input: %w", err)
+	}
+
+	// Convert float32 to float64
+	inputData := make([]float64, len(state))
+	for i, v := range state {
+		inputData[i] = float64(v)
+	}
+
+	nodes := m.graph()
+	inputTensor := tensor.New(
+		tensor.WithShape(1, m.InputChannels(), 8, 8),
+		tensor.WithBacking(inputData),
+	)
+
+	if err := gorgonia.Let(nodes.input, inputTensor); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to set input: %w", err)
+	}
+
+	vm := m.machine()
+	defer vm.Reset()
+
+	if err := vm.RunAll(); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to run inference: %w", err)
+	}
+
+	policyValue, logitsValue := nodes.policy.Value(), nodes.logits.Value()
+	if policyValue == nil || logitsValue == nil {
+		return nil, nil, 0, fmt.Errorf("output is nil")
+	}
+	probs := append([]float64(nil), policyValue.Data().([]float64)...)
+	logits := append([]float64(nil), logitsValue.Data().([]float64)...)
+
+	var value float64
+	if nodes.value != nil {
+		if v := nodes.value.Value(); v != nil {
+			value = v.Data().([]float64)[0]
+		}
+	}
+
+	return logits, probs, value, nil
+}
+
+// saveCheckpoint writes named tensors for TensorFileExt paths, or otherwise a
+// gob stream of the metadata followed by the shape and data of each weight
+func saveCheckpoint(path string, metadata ModelMetadata, weights gorgonia.Nodes) error {
+	if filepath.Ext(path) == TensorFileExt {
+		return saveTensorCheckpoint(path, metadata, weights)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	encoder := gob.NewEncoder(f)
+
+	if err := encoder.Encode(metadata); err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	for i, w := range weights {
+		val := w.Value()
+		if val == nil {
+			return fmt.Errorf("weight %d has nil value", i)
+		}
+
+		weightData := val.Data().([]float64)
+		shape := val.Shape()
+
+		if err := encoder.Encode(shape); err != nil {
+			return fmt.Errorf("failed to encode weight %d shape: %w", i, err)
+		}
+		if err := encoder.Encode(weightData); err != nil {
+			return fmt.Errorf("failed to encode weight %d data: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// checkMetadata checks that checkpoint metadata matches the model's
+// architecture and layout
+func checkMetadata(metadata ModelMetadata, m ChessModel) error {
+	if metadata.ModelType != m.Architecture().modelType() {
+		return fmt.Errorf("invalid model type: %s (expected %s)", metadata.ModelType, m.Architecture().modelType())
+	}
+	config, err := metadata.Config()
+	if err != nil {
+		return err
+	}
+	if config.MoveEncoding != m.MoveEncoding() {
+		return fmt.Errorf("move encoding mismatch: checkpoint uses %s, model uses %s", config.MoveEncoding, m.MoveEncoding())
+	}
+	if config.InputChannels != m.InputChannels() {
+		return fmt.Errorf("input channel mismatch: checkpoint uses %d, model uses %d", config.InputChannels, m.InputChannels())
+	}
+	return nil
+}
+
+// loadCheckpoint reads a checkpoint written by saveCheckpoint into the model's
+// weights after checking that its architecture and layout match the model.
+// The format is detected from the file content.
+func loadCheckpoint(path string, m ChessModel, weights gorgonia.Nodes) error {
+	if isTensorFile(path) {
+		return loadTensorCheckpoint(path, m, weights)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := gob.NewDecoder(f)
+
+	// Load metadata
+	var metadata ModelMetadata
+	if err := decoder.Decode(&metadata); err != nil {
+		return fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	if err := checkMetadata(metadata, m); err != nil {
+		return err
+	}
+
+	// Load weights
+	for i, w := range weights {
+		var shape tensor.Shape
+		var weightData []float64
+
+		if err := decoder.Decode(&shape); err != nil {
+			return fmt.Errorf("failed to decode weight %d shape: %w", i, err)
+		}
+		if err := decoder.Decode(&weightData); err != nil {
+			return fmt.Errorf("failed to decode weight %d data: %w", i, err)
+		}
+		if !shape.Eq(w.Shape()) {
+			return fmt.Errorf("weight %d (%s) shape mismatch: checkpoint has %v, model has %v", i, w.Name(), shape, w.Shape())
+		}
+
+		t := tensor.New(tensor.WithShape(shape...), tensor.WithBacking(weightData))
+		if err := gorgonia.Let(w, t); err != nil {
+			return fmt.Errorf("failed to set weight %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package model
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+)
+
+func TestParseArchitecture(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Architecture
+	}{
+		{"", ArchitectureCNN},
+		{"cnn", ArchitectureCNN},
+		{"resnet", ArchitectureResNet},
+		{"ImprovedChessCNN", ArchitectureResNet},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseArchitecture(tt.name)
+		if err != nil || got != tt.expected {
+			t.Errorf("ParseArchitecture(%q) = %q, %v; want %q", tt.name, got, err, tt.expected)
+		}
+	}
+
+	if _, err := ParseArchitecture("transformer"); err == nil {
+		t.Error("Expected error for unknown architecture")
+	}
+}
+
+func TestImprovedChessCNNCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resnet.gob")
+
+	resnet, err := NewImprovedChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer resnet.Close()
+
+	state := data.AppendAuxPlanes(make([]float32, data.NumChannels*64), data.DefaultAuxState())
+	probs, value, err := resnet.Forward(state)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	if len(probs) != resnet.PolicySize() {
+		t.Errorf("Policy length = %d; want %d", len(probs), resnet.PolicySize())
+	}
+	if value < -1 || value > 1 {
+		t.Errorf("Value %v outside [-1, 1]", value)
+	}
+
+	if err := resnet.SaveModel(path); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+
+	// The checkpoint records the architecture, so the generic loader rebuilds the right network
+	loaded, err := LoadChessModel(path)
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	defer loaded.Close()
+
+	if loaded.Architecture() != ArchitectureResNet || !loaded.HasValueHead() {
+		t.Fatalf("Loaded %s model (value head: %v); want resnet with value head", loaded.Architecture(), loaded.HasValueHead())
+	}
+
+	loadedProbs, loadedValue, err := loaded.Forward(state)
+	if err != nil {
+		t.Fatalf("Forward on loaded model failed: %v", err)
+	}
+	if math.Abs(loadedValue-value) > 1e-9 {
+		t.Errorf("Loaded value = %v; want %v", loadedValue, value)
+	}
+	for i := range probs {
+		if math.Abs(loadedProbs[i]-probs[i]) > 1e-9 {
+			t.Fatalf("Loaded policy differs at %d: %v vs %v", i, loadedProbs[i], probs[i])
+		}
+	}
+
+	// Checkpoints are not interchangeable between architectures
+	cnn, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+
+	if err := cnn.LoadModel(path); err == nil {
+		t.Error("Expected error loading resnet checkpoint into ChessCNN")
+	}
+}
+
+func TestTrainerJointLoss(t *testing.T) {
+	config := DefaultTrainingConfig()
+	config.BatchSize = 2
+	config.Architecture = ArchitectureResNet
+	config.Verbose = false
+
+	trainer, err := NewTrainer(config)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer trainer.GetModel().Close()
+
+	if !trainer.GetModel().HasValueHead() {
+		t.Fatal("Expected resnet trainer model to have a value head")
+	}
+
+	state := data.AppendAuxPlanes(make([]float32, data.NumChannels*64), data.DefaultAuxState())
+	entries := []*data.DataEntry{
+		{StateTensor: state, FromSquare: 12, ToSquare: 28, Outcome: 1, HasOutcome: true},
+		{StateTensor: state, FromSquare: 6, ToSquare: 21}, // Unknown outcome, policy loss only
+	}
+
+	loss, _, err := trainer.TrainOnBatch(entries)
+	if err != nil {
+		t.Fatalf("Training step failed: %v", err)
+	}
+	if math.IsNaN(loss) || math.IsInf(loss, 0) || loss <= 0 {
+		t.Errorf("Unexpected joint loss: %v", loss)
+	}
+}
+
+func TestFillSampleSoftTarget(t *testing.T) {
+	config := DefaultTrainingConfig()
+	config.BatchSize = 2
+	config.Verbose = false
+
+	trainer, err := NewTrainer(config)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer trainer.GetModel().Close()
+
+	state := data.AppendAuxPlanes(make([]float32, data.NumChannels*64), data.DefaultAuxState())
+	entry := &data.DataEntry{
+		StateTensor: state,
+		FromSquare:  12,
+		ToSquare:    28,
+		MoveCounts: []data.MoveCount{
+			{FromSquare: 12, ToSquare: 28, Count: 3},
+			{FromSquare: 11, ToSquare: 27, Count: 1},
+		},
+	}
+
+	buf := newBatchBuffers(config.BatchSize, config.InputChannels, trainer.policySize)
+	if err := trainer.fillSample(1, entry, buf); err != nil {
+		t.Fatalf("fillSample failed: %v", err)
+	}
+
+	row := buf.policy[trainer.policySize:]
+	if math.Abs(row[12*64+28]-0.75) > 1e-6 || math.Abs(row[11*64+27]-0.25) > 1e-6 {
+		t.Errorf("Soft target = %v / %v, want 0.75 / 0.25", row[12*64+28], row[11*64+27])
+	}
+
+	// Label smoothing keeps the target a distribution with mass on every move
+	trainer.config.LabelSmoothing = 0.1
+	buf.clear()
+	if err := trainer.fillSample(0, entry, buf); err != nil {
+		t.Fatalf("fillSample failed: %v", err)
+	}
+
+	row = buf.policy[:trainer.policySize]
+	uniform := 0.1 / float64(trainer.policySize)
+	sum := 0.0
+	for _, p := range row {
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-9 || math.Abs(row[0]-uniform) > 1e-12 || math.Abs(row[12*64+28]-(0.75*0.9+uniform)) > 1e-9 {
+		t.Errorf("Smoothed target: sum %v, empty move %v, played move %v", sum, row[0], row[12*64+28])
+	}
+}
+
+func TestDistillationTarget(t *testing.T) {
+	teacherPath := filepath.Join(t.TempDir(), "teacher.gob")
+
+	teacher, err := NewImprovedChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create teacher: %v", err)
+	}
+	if err := teacher.SaveModel(teacherPath); err != nil {
+		t.Fatalf("Failed to save teacher: %v", err)
+	}
+	teacher.Close()
+
+	config := DefaultTrainingConfig()
+	config.BatchSize = 2
+	config.Verbose = false
+	config.TeacherPath = teacherPath
+	config.DistillWeight = 0.25
+
+	trainer, err := NewTrainer(config)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer trainer.Close()
+	defer trainer.GetModel().Close()
+
+	state := data.AppendAuxPlanes(make([]float32, data.NumChannels*64), data.DefaultAuxState())
+	target, best, err := trainer.Distiller().Target(state, trainer.GetModel().MoveEncoding())
+	if err != nil {
+		t.Fatalf("Teacher target failed: %v", err)
+	}
+	sum := 0.0
+	for _, p := range target {
+		sum += p
+	}
+	if len(target) != trainer.policySize || math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("Teacher target has %d moves summing to %v", len(target), sum)
+	}
+
+	entry := &data.DataEntry{StateTensor: state, FromSquare: 12, ToSquare: 28}
+	buf := newBatchBuffers(config.BatchSize, config.InputChannels, trainer.policySize)
+	if err := trainer.fillSample(0, entry, buf); err != nil {
+		t.Fatalf("fillSample failed: %v", err)
+	}
+
+	played := 12*64 + 28
+	row := buf.policy[:trainer.policySize]
+	if math.Abs(row[played]-(0.75+0.25*target[played])) > 1e-9 {
+		t.Errorf("Played move target = %v, want %v", row[played], 0.75+0.25*target[played])
+	}
+	if other := (played + 1) % len(row); math.Abs(row[other]-0.25*target[other]) > 1e-9 {
+		t.Errorf("Teacher-only move target = %v, want %v", row[other], 0.25*target[other])
+	}
+	if buf.teacher[0] != best || buf.teacher[1] != -1 {
+		t.Errorf("Teacher moves = %v, want [%d -1]", buf.teacher, best)
+	}
+}
+
+func TestForwardLegal(t *testing.T) {
+	cnn, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+
+	start := chess.StartingPosition()
+	predictions, err := PredictPosition(cnn, start, 30)
+	if err != nil {
+		t.Fatalf("PredictPosition failed: %v", err)
+	}
+
+	// Only the 20 legal moves have probability, and they sum to 1
+	if len(predictions) != 20 {
+		t.Fatalf("Got %d predictions, want the 20 legal moves", len(predictions))
+	}
+	legal := make(map[string]bool)
+	for _, m := range start.ValidMoves() {
+		legal[m.String()] = true
+	}
+	sum := 0.0
+	for _, p := range predictions {
+		if !legal[p.UCI()] {
+			t.Errorf("Illegal move %s predicted", p.UCI())
+		}
+		sum += p.Probability
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Legal probabilities sum to %v", sum)
+	}
+
+	// Masking the logits matches renormalizing the full softmax
+	state, err := data.TensorizePosition(start, cnn.InputChannels())
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	full, _, err := cnn.Forward(state)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	masked, _, err := ForwardLegal(cnn, state, nil)
+	if err != nil {
+		t.Fatalf("ForwardLegal failed: %v", err)
+	}
+	renormalized := MaskPolicy(full, LegalMask(start, cnn.PolicySize()))
+	for i := range masked {
+		if math.Abs(masked[i]-renormalized[i]) > 1e-9 {
+			t.Fatalf("Masked policy differs at %d: %v vs %v", i, masked[i], renormalized[i])
+		}
+	}
+}
+
+func TestTrainerLegalMovesOnly(t *testing.T) {
+	config := DefaultTrainingConfig()
+	config.BatchSize = 2
+	config.Verbose = false
+	config.LegalMovesOnly = true
+	config.LabelSmoothing = 0.1
+
+	trainer, err := NewTrainer(config)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer trainer.GetModel().Close()
+
+	state, err := data.TensorizePosition(chess.StartingPosition(), data.DefaultInputChannels)
+	if err != nil {
+		t.Fatalf("Failed to tensorize position: %v", err)
+	}
+	entry := &data.DataEntry{StateTensor: state, FromSquare: 12, ToSquare: 28} // e2e4
+
+	buf := newBatchBuffers(config.BatchSize, config.InputChannels, trainer.policySize)
+	if err := trainer.fillSample(0, entry, buf); err != nil {
+		t.Fatalf("fillSample failed: %v", err)
+	}
+
+	// Smoothing is spread over the 20 legal moves only
+	row := buf.policy[:trainer.policySize]
+	bias := buf.legal[:trainer.policySize]
+	legalMoves, sum := 0, 0.0
+	for j, p := range row {
+		if bias[j] == 0 {
+			legalMoves++
+		} else if p != 0 {
+			t.Fatalf("Illegal move %d has target %v", j, p)
+		}
+		sum += p
+	}
+	if legalMoves != 20 || math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Target covers %d legal moves and sums to %v", legalMoves, sum)
+	}
+	if padding := buf.legal[trainer.policySize:]; padding[0] != 0 || padding[len(padding)-1] != 0 {
+		t.Error("Padding row should not be masked")
+	}
+
+	loss, _, err := trainer.TrainOnBatch([]*data.DataEntry{entry, entry})
+	if err != nil {
+		t.Fatalf("Training step failed: %v", err)
+	}
+	if math.IsNaN(loss) || math.IsInf(loss, 0) || loss <= 0 {
+		t.Errorf("Unexpected legal move loss: %v", loss)
+	}
+}
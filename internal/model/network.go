@@ -6,6 +6,7 @@ import (
 	"math"
 	"os"
 
+	"github.com/thyrook/partner/internal/data"
 	"gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
 )
@@ -322,38 +323,22 @@ type MoveScore struct {
 	Score     float64
 }
 
-// DecodeMove converts a move index to chess notation (simplified)
+// DecodeMove converts a move index to UCI notation (e.g. "e2e4", "e7e8n")
 func DecodeMove(moveIndex int) string {
-	// For 8x8 board, 4096 possible moves (64 * 64)
-	from := moveIndex / 64
-	to := moveIndex % 64
-
-	fromFile := rune('a' + (from % 8))
-	fromRank := (from / 8) + 1
-	toFile := rune('a' + (to % 8))
-	toRank := (to / 8) + 1
-
-	return fmt.Sprintf("%c%d%c%d", fromFile, fromRank, toFile, toRank)
+	return data.MoveIndexToUCI(moveIndex)
 }
 
-// EncodeMove converts chess notation to move index
+// EncodeMove converts UCI notation to a move index under the default move encoding
 func EncodeMove(move string) (int, error) {
-	if len(move) != 4 {
-		return -1, fmt.Errorf("invalid move format: %s", move)
+	from, to, promo, err := data.ParseUCIMove(move)
+	if err != nil {
+		return -1, err
 	}
 
-	fromFile := int(move[0] - 'a')
-	fromRank := int(move[1] - '1')
-	toFile := int(move[2] - 'a')
-	toRank := int(move[3] - '1')
-
-	if fromFile < 0 || fromFile > 7 || fromRank < 0 || fromRank > 7 ||
-		toFile < 0 || toFile > 7 || toRank < 0 || toRank > 7 {
-		return -1, fmt.Errorf("invalid move coordinates: %s", move)
+	index, err := data.DefaultMoveEncoding.EncodeMoveIndex(from, to, promo)
+	if err != nil {
+		return -1, err
 	}
 
-	from := fromRank*8 + fromFile
-	to := toRank*8 + toFile
-
-	return from*64 + to, nil
+	return index, nil
 }
@@ -9,11 +9,12 @@ func TestDecodeMove(t *testing.T) {
 		index    int
 		expected string
 	}{
-		{0, "a1a1"},    // from=0 (a1), to=0 (a1) → 0*64+0=0
-		{7, "a1h1"},    // from=0 (a1), to=7 (h1) → 0*64+7=7
-		{63, "a1h8"},   // from=0 (a1), to=63 (h8) → 0*64+63=63
-		{4032, "h8a1"}, // from=63 (h8), to=0 (a1) → 63*64+0=4032
-		{4095, "h8h8"}, // from=63 (h8), to=63 (h8) → 63*64+63=4095
+		{0, "a1a1"},     // from=0 (a1), to=0 (a1) → 0*64+0=0
+		{7, "a1h1"},     // from=0 (a1), to=7 (h1) → 0*64+7=7
+		{63, "a1h8"},    // from=0 (a1), to=63 (h8) → 0*64+63=63
+		{4032, "h8a1"},  // from=63 (h8), to=0 (a1) → 63*64+0=4032
+		{4095, "h8h8"},  // from=63 (h8), to=63 (h8) → 63*64+63=4095
+		{4099, "a7a8n"}, // white underpromotion push from a7 to knight
 	}
 
 	for _, tt := range tests {
@@ -29,12 +30,15 @@ func TestEncodeMove(t *testing.T) {
 		move     string
 		expected int
 	}{
-		{"a1a1", 0},    // from=a1(0), to=a1(0) → 0*64+0=0
-		{"a1h1", 7},    // from=a1(0), to=h1(7) → 0*64+7=7
-		{"a1h8", 63},   // from=a1(0), to=h8(63) → 0*64+63=63
-		{"h8a1", 4032}, // from=h8(63), to=a1(0) → 63*64+0=4032
-		{"h8h8", 4095}, // from=h8(63), to=h8(63) → 63*64+63=4095
-		{"e2e4", 796},  // from=e2(12), to=e4(28) → 12*64+28=796
+		{"a1a1", 0},     // from=a1(0), to=a1(0) → 0*64+0=0
+		{"a1h1", 7},     // from=a1(0), to=h1(7) → 0*64+7=7
+		{"a1h8", 63},    // from=a1(0), to=h8(63) → 0*64+63=63
+		{"h8a1", 4032},  // from=h8(63), to=a1(0) → 63*64+0=4032
+		{"h8h8", 4095},  // from=h8(63), to=h8(63) → 63*64+63=4095
+		{"e2e4", 796},   // from=e2(12), to=e4(28) → 12*64+28=796
+		{"e7e8q", 3388}, // queen promotions keep the from/to index → 52*64+60=3388
+		{"e7e8n", 4135}, // white underpromotion → 4096+((0*8+4)*3+1)*3+0=4135
+		{"e2e1r", 4209}, // black underpromotion → 4096+((1*8+4)*3+1)*3+2=4209
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,279 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/thyrook/partner/internal/onnx"
+	"gorgonia.org/gorgonia"
+)
+
+// Names of the exported ONNX graph inputs and outputs
+const (
+	ONNXInput  = "input"  // [batch, channels, 8, 8]
+	ONNXLogits = "logits" // [batch, policySize], before the softmax
+	ONNXPolicy = "policy" // [batch, policySize]
+	ONNXValue  = "value"  // [batch, 1], ImprovedChessCNN only
+)
+
+// onnxBuilder accumulates the nodes and initializers of an exported graph
+type onnxBuilder struct {
+	weights map[string]gorgonia.Value
+	graph   onnx.Graph
+}
+
+// ExportONNX converts a model to an ONNX graph with a dynamic batch
+// dimension. Weights are stored as float32 initializers named after the
+// model's learnables. Both the logits and the softmax policy are outputs so
+// that callers can mask illegal moves before normalizing.
+func ExportONNX(m ChessModel) (*onnx.Model, error) {
+	b := &onnxBuilder{weights: make(map[string]gorgonia.Value)}
+	for _, w := range m.Learnables() {
+		if w.Value() == nil {
+			return nil, fmt.Errorf("weight %s has no value", w.Name())
+		}
+		b.weights[w.Name()] = w.Value()
+	}
+	b.graph.Name = m.Architecture().modelType()
+	b.graph.Inputs = []onnx.ValueInfo{batchValue(ONNXInput, int64(m.InputChannels()), 8, 8)}
+	b.graph.Outputs = []onnx.ValueInfo{
+		batchValue(ONNXLogits, int64(m.PolicySize())),
+		batchValue(ONNXPolicy, int64(m.PolicySize())),
+	}
+
+	var err error
+	switch m.Architecture() {
+	case ArchitectureCNN:
+		err = b.chessCNN()
+	case ArchitectureResNet:
+		err = b.improvedChessCNN()
+		b.graph.Outputs = append(b.graph.Outputs, batchValue(ONNXValue, 1))
+	default:
+		err = fmt.Errorf("unsupported architecture: %q", m.Architecture())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to export %s: %w", m.Architecture(), err)
+	}
+
+	metadata := m.Metadata()
+	return &onnx.Model{
+		IRVersion:       onnx.IRVersion,
+		OpsetVersion:    onnx.OpsetVersion,
+		ProducerName:    onnx.ProducerName,
+		ProducerVersion: onnx.ProducerVersion,
+		DocString:       "P.A.R.T.N.E.R move prediction network",
+		Metadata: map[string]string{
+			"model_type":     metadata.ModelType,
+			"input_channels": strconv.Itoa(m.InputChannels()),
+			"move_encoding":  metadata.MoveEncoding,
+			"policy_size":    strconv.Itoa(m.PolicySize()),
+		},
+		Graph: b.graph,
+	}, nil
+}
+
+// ExportONNXFile exports a model and writes it to an .onnx file
+func ExportONNXFile(m ChessModel, path string) error {
+	exported, err := ExportONNX(m)
+	if err != nil {
+		return err
+	}
+	return onnx.WriteFile(path, exported)
+}
+
+// chessCNN mirrors NewChessCNNWithConfig
+func (b *onnxBuilder) chessCNN() error {
+	conv1, err := b.conv("conv1", ONNXInput, "conv1_w", "conv1_b", 1)
+	if err != nil {
+		return err
+	}
+	conv2, err := b.conv("conv2", b.relu("conv1_relu", conv1), "conv2_w", "conv2_b", 1)
+	if err != nil {
+		return err
+	}
+	flat := b.flatten("flatten", b.relu("conv2_relu", conv2))
+
+	fc1, err := b.gemm("fc1", flat, "fc1_w", "fc1_b")
+	if err != nil {
+		return err
+	}
+	fc2, err := b.gemm("fc2", b.relu("fc1_relu", fc1), "fc2_w", "fc2_b")
+	if err != nil {
+		return err
+	}
+	if _, err := b.gemm(ONNXLogits, b.relu("fc2_relu", fc2), "fc3_w", "fc3_b"); err != nil {
+		return err
+	}
+	b.outputs("")
+	return nil
+}
+
+// improvedChessCNN mirrors NewImprovedChessCNNWithConfig
+func (b *onnxBuilder) improvedChessCNN() error {
+	block := func(name, input string) (string, error) {
+		conv, err := b.conv(name, input, name+"_kernel", name+"_bias", 1)
+		if err != nil {
+			return "", err
+		}
+		return b.relu(name+"_relu", conv), nil
+	}
+	residual := func(name, shortcut, input string) string {
+		b.node(name, "Add", []string{shortcut, input})
+		return name
+	}
+
+	conv1, err := block("conv1", ONNXInput)
+	if err != nil {
+		return err
+	}
+	conv2, err := block("conv2", conv1)
+	if err != nil {
+		return err
+	}
+	res1 := residual("res1", conv1, conv2)
+
+	conv3, err := block("conv3", res1)
+	if err != nil {
+		return err
+	}
+	conv4, err := block("conv4", conv3)
+	if err != nil {
+		return err
+	}
+	res1Proj, err := b.conv("res1_proj", res1, "res1_proj_kernel", "", 0)
+	if err != nil {
+		return err
+	}
+	res2 := residual("res2", res1Proj, conv4)
+
+	conv5, err := block("conv5", res2)
+	if err != nil {
+		return err
+	}
+	conv6, err := block("conv6", conv5)
+	if err != nil {
+		return err
+	}
+	res2Proj, err := b.conv("res2_proj", res2, "res2_proj_kernel", "", 0)
+	if err != nil {
+		return err
+	}
+	res3 := residual("res3", res2Proj, conv6)
+
+	policyConv, err := block("policy_conv", res3)
+	if err != nil {
+		return err
+	}
+	if _, err := b.gemm(ONNXLogits, b.flatten("policy_flatten", policyConv), "policy_fc_weights", "policy_fc_bias"); err != nil {
+		return err
+	}
+
+	valueConv, err := block("value_conv", res3)
+	if err != nil {
+		return err
+	}
+	valueFC1, err := b.gemm("value_fc1", b.flatten("value_flatten", valueConv), "value_fc1_weights", "value_fc1_bias")
+	if err != nil {
+		return err
+	}
+	valueFC2, err := b.gemm("value_fc2", b.relu("value_fc1_relu", valueFC1), "value_fc2_weights", "value_fc2_bias")
+	if err != nil {
+		return err
+	}
+
+	b.outputs(valueFC2)
+	return nil
+}
+
+// outputs adds the softmax of the logits and, if the model has a value
+// head, the tanh of its last layer
+func (b *onnxBuilder) outputs(value string) {
+	b.node(ONNXPolicy, "Softmax", []string{ONNXLogits}, onnx.IntAttr("axis", 1))
+	if value != "" {
+		b.node(ONNXValue, "Tanh", []string{value})
+	}
+}
+
+// conv adds a same-padded convolution; bias may be empty
+func (b *onnxBuilder) conv(name, input, kernel, bias string, pad int64) (string, error) {
+	inputs := []string{input}
+	for _, w := range []string{kernel, bias} {
+		if w == "" {
+			continue
+		}
+		if err := b.initializer(w); err != nil {
+			return "", err
+		}
+		inputs = append(inputs, w)
+	}
+
+	shape := b.weights[kernel].Shape()
+	b.node(name, "Conv", inputs,
+		onnx.IntsAttr("kernel_shape", int64(shape[2]), int64(shape[3])),
+		onnx.IntsAttr("pads", pad, pad, pad, pad),
+		onnx.IntsAttr("strides", 1, 1),
+		onnx.IntsAttr("dilations", 1, 1),
+		onnx.IntAttr("group", 1))
+	return name, nil
+}
+
+// gemm adds a fully connected layer; the weights are stored [in, out]
+func (b *onnxBuilder) gemm(name, input, weights, bias string) (string, error) {
+	for _, w := range []string{weights, bias} {
+		if err := b.initializer(w); err != nil {
+			return "", err
+		}
+	}
+	b.node(name, "Gemm", []string{input, weights, bias},
+		onnx.FloatAttr("alpha", 1), onnx.FloatAttr("beta", 1))
+	return name, nil
+}
+
+func (b *onnxBuilder) relu(name, input string) string {
+	b.node(name, "Relu", []string{input})
+	return name
+}
+
+func (b *onnxBuilder) flatten(name, input string) string {
+	b.node(name, "Flatten", []string{input}, onnx.IntAttr("axis", 1))
+	return name
+}
+
+// node appends a node whose single output is named after the node
+func (b *onnxBuilder) node(name, op string, inputs []string, attrs ...onnx.Attribute) {
+	b.graph.Nodes = append(b.graph.Nodes, onnx.Node{
+		Name: name, OpType: op, Inputs: inputs, Outputs: []string{name}, Attributes: attrs,
+	})
+}
+
+// initializer adds a model weight as a float32 initializer
+func (b *onnxBuilder) initializer(name string) error {
+	value, ok := b.weights[name]
+	if !ok {
+		return fmt.Errorf("model has no weight %s", name)
+	}
+	values, ok := value.Data().([]float64)
+	if !ok {
+		return fmt.Errorf("weight %s is not float64", name)
+	}
+
+	t := onnx.Tensor{Name: name, Data: make([]float32, len(values))}
+	for _, d := range value.Shape() {
+		t.Dims = append(t.Dims, int64(d))
+	}
+	for i, v := range values {
+		t.Data[i] = float32(v)
+	}
+	b.graph.Initializers = append(b.graph.Initializers, t)
+	return nil
+}
+
+// batchValue describes a float tensor with a leading dynamic batch dimension
+func batchValue(name string, dims ...int64) onnx.ValueInfo {
+	v := onnx.ValueInfo{Name: name, Dims: []int64{-1}, DimParams: []string{"batch"}}
+	for _, d := range dims {
+		v.Dims = append(v.Dims, d)
+		v.DimParams = append(v.DimParams, "")
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/onnx"
+)
+
+func TestExportONNXMatchesPredict(t *testing.T) {
+	game := chess.NewGame()
+	var boards [][12][8][8]float32
+	for _, move := range []string{"", "e4", "c5"} {
+		if move != "" {
+			if err := game.MoveStr(move); err != nil {
+				t.Fatalf("Failed to play %s: %v", move, err)
+			}
+		}
+		board, err := data.TensorizeBoard(game.Position().Board())
+		if err != nil {
+			t.Fatalf("Failed to tensorize board: %v", err)
+		}
+		boards = append(boards, board)
+	}
+
+	tests := []struct {
+		arch   Architecture
+		boards int
+	}{
+		{ArchitectureCNN, 3},
+		{ArchitectureResNet, 1}, // The reference evaluator is slow on 512-channel convolutions
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.arch), func(t *testing.T) {
+			m, err := NewChessModel(tt.arch, DefaultCNNConfig())
+			if err != nil {
+				t.Fatalf("Failed to create model: %v", err)
+			}
+			defer m.Close()
+
+			// Round trip through the file to check the protobuf encoding as well
+			path := filepath.Join(t.TempDir(), "model.onnx")
+			if err := ExportONNXFile(m, path); err != nil {
+				t.Fatalf("Failed to export model: %v", err)
+			}
+			exported, err := onnx.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read exported model: %v", err)
+			}
+			if exported.OpsetVersion != onnx.OpsetVersion || exported.Metadata["model_type"] != m.Metadata().ModelType {
+				t.Errorf("Exported opset %d, metadata %v", exported.OpsetVersion, exported.Metadata)
+			}
+
+			// Evaluate all boards as one batch
+			channels := m.InputChannels()
+			input := &onnx.Tensor{Dims: []int64{int64(tt.boards), int64(channels), 8, 8}}
+			states := make([][]float32, tt.boards)
+			for i := range states {
+				states[i], err = data.ExpandInputChannels(data.TensorToFlatArray(boards[i]), channels)
+				if err != nil {
+					t.Fatalf("Failed to expand state: %v", err)
+				}
+				input.Data = append(input.Data, states[i]...)
+			}
+			outputs, err := onnx.Run(exported, map[string]*onnx.Tensor{ONNXInput: input})
+			if err != nil {
+				t.Fatalf("Failed to evaluate exported model: %v", err)
+			}
+
+			policySize := m.PolicySize()
+			for i, state := range states {
+				logits := make([]float64, policySize)
+				for j := range logits {
+					logits[j] = float64(outputs[ONNXLogits].Data[i*policySize+j])
+				}
+
+				probs, value, err := m.Forward(state)
+				if err != nil {
+					t.Fatalf("Forward failed: %v", err)
+				}
+				for j, p := range probs {
+					if got := float64(outputs[ONNXPolicy].Data[i*policySize+j]); math.Abs(got-p) > 1e-5+1e-3*p {
+						t.Fatalf("Board %d: policy[%d] = %v, model %v", i, j, got, p)
+					}
+				}
+				if m.HasValueHead() {
+					if got := float64(outputs[ONNXValue].Data[i]); math.Abs(got-value) > 1e-4 {
+						t.Errorf("Board %d: value = %v, model %v", i, got, value)
+					}
+				}
+
+				// Predict masks illegal moves; masking the exported logits must agree
+				predictions, err := m.PredictState(state, 5)
+				if err != nil {
+					t.Fatalf("Predict failed: %v", err)
+				}
+				masked := MaskedSoftmax(logits, stateLegalMask(state, m.MoveEncoding()))
+				for rank, p := range predictions {
+					if got := masked[p.MoveIndex]; math.Abs(got-p.Probability) > 1e-5+1e-3*p.Probability {
+						t.Errorf("Board %d: %s (rank %d) has probability %v, model %v", i, p.UCI(), rank+1, got, p.Probability)
+					}
+				}
+				if top := TopKPredictions(masked, 1)[0]; math.Abs(top.Probability-predictions[0].Probability) > 1e-4 {
+					t.Errorf("Board %d: exported top move %s (%v), model %s (%v)",
+						i, top.UCI(), top.Probability, predictions[0].UCI(), predictions[0].Probability)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"math"
+
+	"gorgonia.org/gorgonia"
+)
+
+// Adam hyperparameters (the gorgonia.AdamSolver defaults)
+const (
+	adamBeta1   = 0.9
+	adamBeta2   = 0.999
+	adamEpsilon = 1e-8
+)
+
+// AdamOptimizer is an Adam solver whose moment estimates can be saved and
+// restored, which gorgonia.AdamSolver keeps unexported. The learning rate can
+// be changed between steps without losing the moments.
+type AdamOptimizer struct {
+	learnRate float64
+	batchSize float64
+	clip      float64
+
+	iter int
+	m, v [][]float64 // First and second moment estimates per learnable
+}
+
+// AdamState is the serializable state of an AdamOptimizer
+type AdamState struct {
+	LearnRate float64
+	Iter      int
+	M, V      [][]float64
+}
+
+// NewAdamOptimizer creates an Adam optimizer. Gradients are divided by
+// batchSize and clamped to ±clip (clip <= 0 disables clamping).
+func NewAdamOptimizer(learnRate, batchSize, clip float64) *AdamOptimizer {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &AdamOptimizer{learnRate: learnRate, batchSize: batchSize, clip: clip}
+}
+
+// LearningRate returns the current learning rate
+func (o *AdamOptimizer) LearningRate() float64 {
+	return o.learnRate
+}
+
+// SetLearningRate changes the learning rate for the following steps
+func (o *AdamOptimizer) SetLearningRate(lr float64) {
+	o.learnRate = lr
+}
+
+// Step updates the weights from their gradients and zeroes the gradients.
+// It implements gorgonia.Solver.
+func (o *AdamOptimizer) Step(model []gorgonia.ValueGrad) error {
+	if o.m == nil {
+		o.m = make([][]float64, len(model))
+		o.v = make([][]float64, len(model))
+	}
+	if len(model) != len(o.m) {
+		return fmt.Errorf("optimizer tracks %d learnables, got %d", len(o.m), len(model))
+	}
+
+	o.iter++
+	correction1 := 1 - math.Pow(adamBeta1, float64(o.iter))
+	correction2 := 1 - math.Pow(adamBeta2, float64(o.iter))
+
+	for i, n := range model {
+		grad, err := n.Grad()
+		if err != nil {
+			return fmt.Errorf("no gradient for learnable %d: %w", i, err)
+		}
+		weights, ok := n.Value().Data().([]float64)
+		if !ok {
+			return fmt.Errorf("learnable %d is not float64", i)
+		}
+		grads, ok := grad.Data().([]float64)
+		if !ok || len(grads) != len(weights) {
+			return fmt.Errorf("learnable %d has mismatched gradient", i)
+		}
+
+		if o.m[i] == nil {
+			o.m[i] = make([]float64, len(weights))
+			o.v[i] = make([]float64, len(weights))
+		}
+		m, v := o.m[i], o.v[i]
+		if len(m) != len(weights) {
+			return fmt.Errorf("learnable %d has %d weights, optimizer state has %d", i, len(weights), len(m))
+		}
+
+		for j, g := range grads {
+			g /= o.batchSize
+			if o.clip > 0 {
+				g = math.Max(-o.clip, math.Min(o.clip, g))
+			}
+
+			m[j] = adamBeta1*m[j] + (1-adamBeta1)*g
+			v[j] = adamBeta2*v[j] + (1-adamBeta2)*g*g
+
+			mHat := m[j] / correction1
+			vHat := v[j] / correction2
+			weights[j] -= o.learnRate * mHat / (math.Sqrt(vHat) + adamEpsilon)
+			grads[j] = 0
+		}
+	}
+
+	return nil
+}
+
+// State returns a copy of the optimizer state
+func (o *AdamOptimizer) State() AdamState {
+	return AdamState{
+		LearnRate: o.learnRate,
+		Iter:      o.iter,
+		M:         copyMoments(o.m),
+		V:         copyMoments(o.v),
+	}
+}
+
+// Restore replaces the optimizer state with a saved one
+func (o *AdamOptimizer) Restore(state AdamState) error {
+	if len(state.M) != len(state.V) {
+		return fmt.Errorf("optimizer state has %d first and %d second moments", len(state.M), len(state.V))
+	}
+	o.learnRate = state.LearnRate
+	o.iter = state.Iter
+	o.m = copyMoments(state.M)
+	o.v = copyMoments(state.V)
+	return nil
+}
+
+// copyMoments deep-copies per-learnable moment estimates
+func copyMoments(moments [][]float64) [][]float64 {
+	if moments == nil {
+		return nil
+	}
+	copied := make([][]float64, len(moments))
+	for i, m := range moments {
+		copied[i] = append([]float64(nil), m...)
+	}
+	return copied
+}
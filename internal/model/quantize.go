@@ -0,0 +1,525 @@
+package model
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/onnx"
+)
+
+// QuantizationFormat identifies quantized checkpoints
+const QuantizationFormat = "int8-per-channel-v1"
+
+// QuantizedModel is an inference-only copy of a model that runs its
+// convolutions and fully connected layers with int8 weights and activations
+// and int32 accumulation. Weights have a symmetric scale per output channel;
+// layer inputs have a symmetric per-tensor scale calibrated on sample
+// positions. The remaining operators run in float32.
+type QuantizedModel struct {
+	Format      string
+	Metadata    ModelMetadata
+	Layers      []QuantizedLayer // In evaluation order
+	Calibration int              // Number of positions used to calibrate the input scales
+}
+
+// QuantizedLayer is one operator of a quantized model. Its output is named
+// after the layer, following the ONNX export.
+type QuantizedLayer struct {
+	Name   string
+	Op     string // Conv, Gemm, Relu, Add, Flatten, Softmax or Tanh
+	Inputs []string
+
+	// Conv and Gemm only. Weights are stored with the output channel last.
+	Shape      []int // Conv [in, kh, kw, out]; Gemm [in, out]
+	Pad        int
+	Weights    []int8
+	Scales     []float32 // Weight scale of each output channel
+	Bias       []float32
+	InputScale float32
+}
+
+// activation is an unbatched float32 layer output
+type activation struct {
+	shape []int
+	data  []float32
+}
+
+// Quantize converts a model to int8, calibrating the input scale of each
+// quantized layer on the largest activation seen over the sample states
+func Quantize(m ChessModel, samples [][]float32) (*QuantizedModel, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("quantization needs calibration positions")
+	}
+	exported, err := ExportONNX(m)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &QuantizedModel{Format: QuantizationFormat, Metadata: m.Metadata(), Calibration: len(samples)}
+	if err := q.calibrate(exported, samples); err != nil {
+		return nil, fmt.Errorf("failed to calibrate: %w", err)
+	}
+
+	weights := make(map[string]*onnx.Tensor)
+	for i := range exported.Graph.Initializers {
+		weights[exported.Graph.Initializers[i].Name] = &exported.Graph.Initializers[i]
+	}
+	for i := range q.Layers {
+		layer := &q.Layers[i]
+		node := &exported.Graph.Nodes[i]
+		switch layer.Op {
+		case "Conv":
+			// Exported [out, in, kh, kw]; move the output channel last
+			kernel := weights[node.Inputs[1]]
+			outC, inC, kH, kW := int(kernel.Dims[0]), int(kernel.Dims[1]), int(kernel.Dims[2]), int(kernel.Dims[3])
+			taps := inC * kH * kW
+			transposed := make([]float32, len(kernel.Data))
+			for o := 0; o < outC; o++ {
+				for t := 0; t < taps; t++ {
+					transposed[t*outC+o] = kernel.Data[o*taps+t]
+				}
+			}
+			layer.Shape = []int{inC, kH, kW, outC}
+			if pads, ok := node.Attribute("pads"); ok {
+				layer.Pad = int(pads.Ints[0])
+			}
+			layer.Bias = make([]float32, outC)
+			if len(node.Inputs) > 2 {
+				copy(layer.Bias, weights[node.Inputs[2]].Data)
+			}
+			layer.quantizeWeights(transposed)
+		case "Gemm":
+			w := weights[node.Inputs[1]]
+			layer.Shape = []int{int(w.Dims[0]), int(w.Dims[1])}
+			layer.Bias = append([]float32(nil), weights[node.Inputs[2]].Data...)
+			layer.quantizeWeights(w.Data)
+		}
+	}
+	return q, nil
+}
+
+// calibrate creates the layers and sets each quantized layer's input scale
+// by running the float graph on the samples
+func (q *QuantizedModel) calibrate(exported *onnx.Model, samples [][]float32) error {
+	channels, err := q.Metadata.Channels()
+	if err != nil {
+		return err
+	}
+
+	// Expose the inputs of the quantized layers as graph outputs
+	graph := exported.Graph
+	graph.Outputs = nil
+	for _, node := range graph.Nodes {
+		q.Layers = append(q.Layers, QuantizedLayer{Name: node.Outputs[0], Op: node.OpType, Inputs: node.Inputs})
+		if node.OpType == "Conv" || node.OpType == "Gemm" {
+			graph.Outputs = append(graph.Outputs, onnx.ValueInfo{Name: node.Inputs[0]})
+		}
+	}
+	probe := *exported
+	probe.Graph = graph
+
+	maxAbs := make(map[string]float64)
+	for _, sample := range samples {
+		state, err := data.ExpandInputChannels(sample, channels)
+		if err != nil {
+			return fmt.Errorf("invalid calibration state: %w", err)
+		}
+		input := &onnx.Tensor{Dims: []int64{1, int64(channels), 8, 8}, Data: state}
+		outputs, err := onnx.Run(&probe, map[string]*onnx.Tensor{ONNXInput: input})
+		if err != nil {
+			return err
+		}
+		for name, t := range outputs {
+			for _, v := range t.Data {
+				maxAbs[name] = math.Max(maxAbs[name], math.Abs(float64(v)))
+			}
+		}
+	}
+
+	for i := range q.Layers {
+		if q.Layers[i].Op == "Conv" || q.Layers[i].Op == "Gemm" {
+			q.Layers[i].InputScale = int8Scale(maxAbs[q.Layers[i].Inputs[0]])
+		}
+	}
+	return nil
+}
+
+// quantizeWeights sets the int8 weights and per-output-channel scales from
+// float weights laid out with the output channel last
+func (l *QuantizedLayer) quantizeWeights(w []float32) {
+	out := l.Shape[len(l.Shape)-1]
+	maxAbs := make([]float64, out)
+	for i, v := range w {
+		maxAbs[i%out] = math.Max(maxAbs[i%out], math.Abs(float64(v)))
+	}
+	l.Scales = make([]float32, out)
+	for o := range l.Scales {
+		l.Scales[o] = int8Scale(maxAbs[o])
+	}
+
+	l.Weights = make([]int8, len(w))
+	for i, v := range w {
+		l.Weights[i] = quantizeValue(v, 1/l.Scales[i%out])
+	}
+}
+
+// int8Scale returns the symmetric scale mapping [-maxAbs, maxAbs] to [-127, 127]
+func int8Scale(maxAbs float64) float32 {
+	if maxAbs == 0 {
+		return 1
+	}
+	return float32(maxAbs / 127)
+}
+
+// quantizeInto rounds values divided by scale to int8
+func quantizeInto(dst []int8, src []float32, scale float32) {
+	inv := 1 / scale
+	for i, v := range src {
+		dst[i] = quantizeValue(v, inv)
+	}
+}
+
+// quantizeValue rounds v times the inverse scale to int8, saturating at ±127
+func quantizeValue(v, inv float32) int8 {
+	x := math.Round(float64(v * inv))
+	if x > 127 {
+		x = 127
+	} else if x < -127 {
+		x = -127
+	}
+	return int8(x)
+}
+
+// InputChannels returns the number of input planes the model expects
+func (q *QuantizedModel) InputChannels() int {
+	channels, _ := q.Metadata.Channels()
+	return channels
+}
+
+// MoveEncoding returns the move encoding of the policy output
+func (q *QuantizedModel) MoveEncoding() data.MoveEncoding {
+	encoding, _ := q.Metadata.Encoding()
+	return encoding
+}
+
+// HasValueHead reports whether the model predicts a position evaluation
+func (q *QuantizedModel) HasValueHead() bool {
+	for _, l := range q.Layers {
+		if l.Name == ONNXValue {
+			return true
+		}
+	}
+	return false
+}
+
+// Size returns the size in bytes of the quantized weights, scales and biases
+func (q *QuantizedModel) Size() int {
+	size := 0
+	for _, l := range q.Layers {
+		size += len(l.Weights) + 4*len(l.Scales) + 4*len(l.Bias)
+	}
+	return size
+}
+
+// Forward runs a flat state tensor through the quantized network and returns
+// the policy probabilities and the value (0 without a value head)
+func (q *QuantizedModel) Forward(state []float32) ([]float64, float64, error) {
+	logits, value, err := q.run(state)
+	if err != nil {
+		return nil, 0, err
+	}
+	return SoftmaxManual(logits), value, nil
+}
+
+// PredictState returns the top K moves for a flat state tensor, masking
+// illegal moves before the softmax like the float models
+func (q *QuantizedModel) PredictState(state []float32, topK int) ([]MovePrediction, error) {
+	logits, _, err := q.run(state)
+	if err != nil {
+		return nil, err
+	}
+	// As in ForwardLegal, states without legal moves keep the full policy
+	probs := SoftmaxManual(logits)
+	if legal := stateLegalMask(state, q.MoveEncoding()); legal != nil {
+		probs = MaskedSoftmax(logits, legal)
+	}
+	return legalPredictions(TopKPredictions(probs, topK)), nil
+}
+
+// run evaluates the layers and returns the policy logits and the value
+func (q *QuantizedModel) run(state []float32) ([]float64, float64, error) {
+	channels := q.InputChannels()
+	state, err := data.ExpandInputChannels(state, channels)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid input: %w", err)
+	}
+
+	values := map[string]activation{ONNXInput: {shape: []int{channels, 8, 8}, data: state}}
+	for i := range q.Layers {
+		l := &q.Layers[i]
+		names := l.Inputs
+		if l.Op == "Conv" || l.Op == "Gemm" {
+			names = names[:1] // The other inputs are the weights
+		}
+		in := make([]activation, len(names))
+		for j, name := range names {
+			v, ok := values[name]
+			if !ok {
+				return nil, 0, fmt.Errorf("layer %s: undefined input %s", l.Name, name)
+			}
+			in[j] = v
+		}
+
+		var out activation
+		switch l.Op {
+		case "Conv":
+			out = l.conv(in[0])
+		case "Gemm":
+			out = l.gemm(in[0])
+		case "Relu":
+			out = mapActivation(in[0], func(x float32) float32 { return float32(math.Max(float64(x), 0)) })
+		case "Tanh":
+			out = mapActivation(in[0], func(x float32) float32 { return float32(math.Tanh(float64(x))) })
+		case "Add":
+			out = mapActivation(in[0], nil)
+			for k, v := range in[1].data {
+				out.data[k] += v
+			}
+		case "Flatten":
+			out = activation{shape: []int{len(in[0].data)}, data: in[0].data}
+		case "Softmax":
+			continue // Applied by the caller, which may mask illegal moves first
+		default:
+			return nil, 0, fmt.Errorf("layer %s: unsupported operator %s", l.Name, l.Op)
+		}
+		values[l.Name] = out
+	}
+
+	logits := values[ONNXLogits].data
+	result := make([]float64, len(logits))
+	for i, v := range logits {
+		result[i] = float64(v)
+	}
+	var value float64
+	if v, ok := values[ONNXValue]; ok {
+		value = float64(v.data[0])
+	}
+	return result, value, nil
+}
+
+// conv computes a stride 1 convolution with int8 inputs and weights. Each
+// nonzero input is scattered into the accumulators of the outputs it
+// reaches, so the zeros of sparse board planes and ReLU outputs cost nothing.
+func (l *QuantizedLayer) conv(x activation) activation {
+	xq := make([]int8, len(x.data))
+	quantizeInto(xq, x.data, l.InputScale)
+
+	inC, kH, kW, outC := l.Shape[0], l.Shape[1], l.Shape[2], l.Shape[3]
+	h, w := x.shape[1], x.shape[2]
+	outH, outW := h+2*l.Pad-kH+1, w+2*l.Pad-kW+1
+
+	// Accumulators are laid out [y, x, channel] so each kernel tap is a
+	// contiguous update over the output channels
+	acc := make([]int32, outH*outW*outC)
+	for c := 0; c < inC; c++ {
+		for iy := 0; iy < h; iy++ {
+			for ix := 0; ix < w; ix++ {
+				xv := int32(xq[(c*h+iy)*w+ix])
+				if xv == 0 {
+					continue
+				}
+				for ky := 0; ky < kH; ky++ {
+					oy := iy - ky + l.Pad
+					if oy < 0 || oy >= outH {
+						continue
+					}
+					for kx := 0; kx < kW; kx++ {
+						ox := ix - kx + l.Pad
+						if ox < 0 || ox >= outW {
+							continue
+						}
+						taps := l.Weights[((c*kH+ky)*kW+kx)*outC:][:outC]
+						dst := acc[(oy*outW+ox)*outC:][:len(taps)]
+						for o, wv := range taps {
+							dst[o] += int32(wv) * xv
+						}
+					}
+				}
+			}
+		}
+	}
+
+	out := activation{shape: []int{outC, outH, outW}, data: make([]float32, outC*outH*outW)}
+	for p := 0; p < outH*outW; p++ {
+		for o, a := range acc[p*outC : (p+1)*outC] {
+			out.data[o*outH*outW+p] = float32(a)*l.Scales[o]*l.InputScale + l.Bias[o]
+		}
+	}
+	return out
+}
+
+// gemm computes a fully connected layer with int8 inputs and weights,
+// skipping zero inputs like conv. Nonzero inputs are applied four at a
+// time to cut accumulator loads and stores.
+func (l *QuantizedLayer) gemm(x activation) activation {
+	xq := make([]int8, len(x.data))
+	quantizeInto(xq, x.data, l.InputScale)
+
+	nonzero := make([]int, 0, len(xq))
+	for i, v := range xq {
+		if v != 0 {
+			nonzero = append(nonzero, i)
+		}
+	}
+
+	outSize := l.Shape[1]
+	acc := make([]int32, outSize)
+	n := 0
+	for ; n+4 <= len(nonzero); n += 4 {
+		i0, i1, i2, i3 := nonzero[n], nonzero[n+1], nonzero[n+2], nonzero[n+3]
+		x0, x1, x2, x3 := int32(xq[i0]), int32(xq[i1]), int32(xq[i2]), int32(xq[i3])
+		w0 := l.Weights[i0*outSize:][:len(acc)]
+		w1 := l.Weights[i1*outSize:][:len(acc)]
+		w2 := l.Weights[i2*outSize:][:len(acc)]
+		w3 := l.Weights[i3*outSize:][:len(acc)]
+		for o := range acc {
+			acc[o] += int32(w0[o])*x0 + int32(w1[o])*x1 + int32(w2[o])*x2 + int32(w3[o])*x3
+		}
+	}
+	for _, i := range nonzero[n:] {
+		xv := int32(xq[i])
+		for o, wv := range l.Weights[i*outSize:][:outSize] {
+			acc[o] += int32(wv) * xv
+		}
+	}
+
+	out := activation{shape: []int{outSize}, data: make([]float32, outSize)}
+	for o, a := range acc {
+		out.data[o] = float32(a)*l.Scales[o]*l.InputScale + l.Bias[o]
+	}
+	return out
+}
+
+// mapActivation applies fn elementwise to a copy of x; a nil fn copies
+func mapActivation(x activation, fn func(float32) float32) activation {
+	out := activation{shape: x.shape, data: make([]float32, len(x.data))}
+	for i, v := range x.data {
+		if fn != nil {
+			v = fn(v)
+		}
+		out.data[i] = v
+	}
+	return out
+}
+
+// Save writes the quantized weights and scales to a gob checkpoint
+func (q *QuantizedModel) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	if err := gob.NewEncoder(f).Encode(q); err != nil {
+		return fmt.Errorf("failed to encode quantized model: %w", err)
+	}
+	return nil
+}
+
+// LoadQuantizedModel reads a checkpoint written by QuantizedModel.Save
+func LoadQuantizedModel(path string) (*QuantizedModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	var q QuantizedModel
+	if err := gob.NewDecoder(f).Decode(&q); err != nil {
+		return nil, fmt.Errorf("failed to decode quantized model: %w", err)
+	}
+	if q.Format != QuantizationFormat {
+		return nil, fmt.Errorf("unsupported quantization format: %q", q.Format)
+	}
+	if _, err := q.Metadata.Config(); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// QuantizationReport compares a quantized model with its float model
+type QuantizationReport struct {
+	Positions        int
+	Top1Agreement    float64       // Fraction of positions with the same top move
+	Top5Agreement    float64       // Mean fraction of the float top 5 moves in the quantized top 5
+	FloatLatency     time.Duration // Mean PredictState time of the float model
+	QuantizedLatency time.Duration // Mean PredictState time of the quantized model
+}
+
+// Speedup returns how many times faster the quantized model predicts
+func (r *QuantizationReport) Speedup() float64 {
+	if r.QuantizedLatency == 0 {
+		return 0
+	}
+	return float64(r.FloatLatency) / float64(r.QuantizedLatency)
+}
+
+// CompareQuantized measures the top-1 and top-5 agreement and the
+// prediction latency of a quantized model against its float model
+func CompareQuantized(m ChessModel, q *QuantizedModel, states [][]float32) (*QuantizationReport, error) {
+	report := &QuantizationReport{Positions: len(states)}
+	if len(states) == 0 {
+		return report, nil
+	}
+
+	var floatTime, quantizedTime time.Duration
+	top1, top5 := 0, 0.0
+	for _, state := range states {
+		start := time.Now()
+		want, err := m.PredictState(state, 5)
+		if err != nil {
+			return nil, err
+		}
+		floatTime += time.Since(start)
+
+		start = time.Now()
+		got, err := q.PredictState(state, 5)
+		if err != nil {
+			return nil, err
+		}
+		quantizedTime += time.Since(start)
+
+		if len(want) == 0 || len(got) == 0 {
+			// No legal moves: both agree there is nothing to play
+			if len(want) == len(got) {
+				top1++
+				top5++
+			}
+			continue
+		}
+		if got[0].MoveIndex == want[0].MoveIndex {
+			top1++
+		}
+		found := 0
+		for _, w := range want {
+			for _, g := range got {
+				if g.MoveIndex == w.MoveIndex {
+					found++
+					break
+				}
+			}
+		}
+		top5 += float64(found) / float64(len(want))
+	}
+
+	n := len(states)
+	report.Top1Agreement = float64(top1) / float64(n)
+	report.Top5Agreement = top5 / float64(n)
+	report.FloatLatency = floatTime / time.Duration(n)
+	report.QuantizedLatency = quantizedTime / time.Duration(n)
+	return report, nil
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+)
+
+func TestQuantizeChessCNN(t *testing.T) {
+	cnn, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+
+	var states [][]float32
+	game := chess.NewGame()
+	for _, move := range []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Ba4", "Nf6", "O-O", "Be7"} {
+		state, err := data.TensorizePosition(game.Position(), cnn.InputChannels())
+		if err != nil {
+			t.Fatalf("Failed to tensorize position: %v", err)
+		}
+		states = append(states, state)
+		if err := game.MoveStr(move); err != nil {
+			t.Fatalf("Failed to play %s: %v", move, err)
+		}
+	}
+
+	quantized, err := Quantize(cnn, states[:5])
+	if err != nil {
+		t.Fatalf("Failed to quantize: %v", err)
+	}
+	for _, l := range quantized.Layers {
+		if l.Op != "Conv" && l.Op != "Gemm" {
+			continue
+		}
+		if channels := l.Shape[len(l.Shape)-1]; len(l.Scales) != channels || l.InputScale <= 0 {
+			t.Errorf("Layer %s has %d scales for %d channels, input scale %v", l.Name, len(l.Scales), channels, l.InputScale)
+		}
+	}
+
+	// The scales are stored in the checkpoint
+	path := filepath.Join(t.TempDir(), "model.int8")
+	if err := quantized.Save(path); err != nil {
+		t.Fatalf("Failed to save quantized model: %v", err)
+	}
+	loaded, err := LoadQuantizedModel(path)
+	if err != nil {
+		t.Fatalf("Failed to load quantized model: %v", err)
+	}
+	if loaded.Calibration != 5 || loaded.MoveEncoding() != cnn.MoveEncoding() || loaded.HasValueHead() {
+		t.Errorf("Loaded quantized model: calibration %d, encoding %s, value head %v",
+			loaded.Calibration, loaded.MoveEncoding(), loaded.HasValueHead())
+	}
+	if params := paramCount(cnn); loaded.Size() > params+params/10 {
+		t.Errorf("Quantized size %d bytes for %d parameters", loaded.Size(), params)
+	}
+
+	// Positions outside the calibration sample stay close to the float model
+	for i, state := range states {
+		want, _, err := cnn.Forward(state)
+		if err != nil {
+			t.Fatalf("Forward failed: %v", err)
+		}
+		got, _, err := loaded.Forward(state)
+		if err != nil {
+			t.Fatalf("Quantized forward failed: %v", err)
+		}
+		maxDiff := 0.0
+		for j := range want {
+			maxDiff = math.Max(maxDiff, math.Abs(got[j]-want[j]))
+		}
+		if maxDiff > 0.05*maxValue(want) {
+			t.Errorf("Position %d: quantized policy differs by %v (max probability %v)", i, maxDiff, maxValue(want))
+		}
+	}
+
+	// An empty board has no legal moves and keeps the full policy
+	if predictions, err := loaded.PredictState(make([]float32, data.NumChannels*64), 5); err != nil || len(predictions) != 5 {
+		t.Errorf("Empty board: %d predictions, %v", len(predictions), err)
+	}
+
+	report, err := CompareQuantized(cnn, loaded, states)
+	if err != nil {
+		t.Fatalf("Failed to compare models: %v", err)
+	}
+	if report.Positions != len(states) || report.Top5Agreement < 0.8 || report.Top1Agreement < 0.7 {
+		t.Errorf("Agreement over %d positions: top-1 %.2f, top-5 %.2f", report.Positions, report.Top1Agreement, report.Top5Agreement)
+	}
+	if report.FloatLatency <= 0 || report.QuantizedLatency <= 0 {
+		t.Errorf("Latencies %v and %v", report.FloatLatency, report.QuantizedLatency)
+	}
+}
+
+func paramCount(m ChessModel) int {
+	n := 0
+	for _, w := range m.Learnables() {
+		n += w.Shape().TotalSize()
+	}
+	return n
+}
+
+func maxValue(values []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range values {
+		m = math.Max(m, v)
+	}
+	return m
+}
@@ -0,0 +1,272 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// registryManifest is the manifest file of a registry directory
+	registryManifest = "manifest.json"
+
+	// Checkpoint references resolved by Registry.Get besides checkpoint IDs
+	RefBest   = "best"
+	RefLatest = "latest"
+)
+
+// CheckpointRecord is the manifest entry of a registered checkpoint
+type CheckpointRecord struct {
+	ID            string         `json:"id"`
+	File          string         `json:"file"` // Relative to the registry directory
+	Epoch         int            `json:"epoch"`
+	TrainLoss     float64        `json:"train_loss"`
+	TrainAccuracy float64        `json:"train_accuracy"`
+	ValLoss       float64        `json:"val_loss"`
+	ValAccuracy   float64        `json:"val_accuracy"`
+	DatasetPath   string         `json:"dataset_path"`
+	DatasetHash   string         `json:"dataset_hash"`
+	Parent        string         `json:"parent,omitempty"` // Checkpoint this one was trained from
+	CreatedAt     time.Time      `json:"created_at"`
+	Config        TrainingConfig `json:"config"`
+}
+
+// registryManifestData is the on-disk manifest
+type registryManifestData struct {
+	Checkpoints []CheckpointRecord `json:"checkpoints"`
+	Best        string             `json:"best"`
+	Latest      string             `json:"latest"`
+	NextID      int                `json:"next_id"`
+}
+
+// Registry is a directory keeping every checkpoint of one or more training
+// runs together with a manifest of their metrics and lineage, plus best (by
+// validation loss, or promoted by hand) and latest pointers
+type Registry struct {
+	dir      string
+	manifest registryManifestData
+}
+
+// OpenRegistry opens the registry in dir, creating it if needed
+func OpenRegistry(dir string) (*Registry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory: %w", err)
+	}
+
+	r := &Registry{dir: dir, manifest: registryManifestData{NextID: 1}}
+	content, err := os.ReadFile(filepath.Join(dir, registryManifest))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry manifest: %w", err)
+	}
+	if err := json.Unmarshal(content, &r.manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse registry manifest: %w", err)
+	}
+	return r, nil
+}
+
+// Dir returns the registry directory
+func (r *Registry) Dir() string {
+	return r.dir
+}
+
+// Checkpoints returns the registered checkpoints, oldest first
+func (r *Registry) Checkpoints() []CheckpointRecord {
+	return append([]CheckpointRecord(nil), r.manifest.Checkpoints...)
+}
+
+// Best returns the ID of the best checkpoint ("" for an empty registry)
+func (r *Registry) Best() string {
+	return r.manifest.Best
+}
+
+// Latest returns the ID of the most recent checkpoint ("" for an empty registry)
+func (r *Registry) Latest() string {
+	return r.manifest.Latest
+}
+
+// Get returns the checkpoint with the given ID, or the one RefBest or
+// RefLatest points to
+func (r *Registry) Get(ref string) (*CheckpointRecord, error) {
+	id := ref
+	switch ref {
+	case RefBest:
+		id = r.manifest.Best
+	case RefLatest:
+		id = r.manifest.Latest
+	}
+	for i := range r.manifest.Checkpoints {
+		if r.manifest.Checkpoints[i].ID == id && id != "" {
+			record := r.manifest.Checkpoints[i]
+			return &record, nil
+		}
+	}
+	return nil, fmt.Errorf("checkpoint %q not found in registry %s", ref, r.dir)
+}
+
+// Path returns the model file of a checkpoint
+func (r *Registry) Path(record *CheckpointRecord) string {
+	return filepath.Join(r.dir, record.File)
+}
+
+// Register saves the model as a new checkpoint described by record. The ID,
+// file and (if zero) creation time are assigned by the registry. The latest
+// pointer moves to the new checkpoint, and the best pointer too if its
+// validation loss is lower than the current best's. Checkpoints without a
+// validation loss are never selected as best, and a best promoted without
+// one is kept, since training losses are not comparable to it.
+func (r *Registry) Register(m ChessModel, record CheckpointRecord) (*CheckpointRecord, error) {
+	record.ID = fmt.Sprintf("ckpt-%04d", r.manifest.NextID)
+	record.File = record.ID + ".gob"
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	if err := m.SaveModel(r.Path(&record)); err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint %s: %w", record.ID, err)
+	}
+
+	r.manifest.NextID++
+	r.manifest.Checkpoints = append(r.manifest.Checkpoints, record)
+	r.manifest.Latest = record.ID
+	if record.ValLoss > 0 {
+		if best, err := r.Get(RefBest); err != nil || (best.ValLoss > 0 && record.ValLoss < best.ValLoss) {
+			r.manifest.Best = record.ID
+		}
+	}
+
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Promote makes a checkpoint the best one regardless of its loss
+func (r *Registry) Promote(ref string) error {
+	record, err := r.Get(ref)
+	if err != nil {
+		return err
+	}
+	r.manifest.Best = record.ID
+	return r.save()
+}
+
+// Prune deletes all but the keep most recent checkpoints. The best and latest
+// checkpoints are always kept. It returns the deleted checkpoints.
+func (r *Registry) Prune(keep int) ([]CheckpointRecord, error) {
+	if keep < 0 {
+		return nil, fmt.Errorf("number of checkpoints to keep must not be negative, got %d", keep)
+	}
+
+	checkpoints := r.manifest.Checkpoints
+	var kept, pruned []CheckpointRecord
+	for i, record := range checkpoints {
+		if i >= len(checkpoints)-keep || record.ID == r.manifest.Best || record.ID == r.manifest.Latest {
+			kept = append(kept, record)
+		} else {
+			pruned = append(pruned, record)
+		}
+	}
+
+	r.manifest.Checkpoints = kept
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+
+	for _, record := range pruned {
+		if err := os.Remove(r.Path(&record)); err != nil && !os.IsNotExist(err) {
+			return pruned, fmt.Errorf("failed to delete checkpoint %s: %w", record.ID, err)
+		}
+	}
+	return pruned, nil
+}
+
+// MetadataDiff is a manifest field that differs between two checkpoints
+type MetadataDiff struct {
+	Field string
+	A, B  string
+}
+
+// DiffMetadata compares the manifest entries of two checkpoints field by
+// field (config fields as "config.<Name>") and returns the fields that differ
+func (r *Registry) DiffMetadata(refA, refB string) ([]MetadataDiff, error) {
+	a, err := r.Get(refA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.Get(refB)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldsA, err := flattenRecord(a)
+	if err != nil {
+		return nil, err
+	}
+	fieldsB, err := flattenRecord(b)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range fieldsA {
+		names[name] = true
+	}
+	for name := range fieldsB {
+		names[name] = true
+	}
+
+	var diffs []MetadataDiff
+	for name := range names {
+		if fieldsA[name] != fieldsB[name] {
+			diffs = append(diffs, MetadataDiff{Field: name, A: fieldsA[name], B: fieldsB[name]})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs, nil
+}
+
+// flattenRecord converts a record to dotted field names and printed values
+func flattenRecord(record *CheckpointRecord) (map[string]string, error) {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode checkpoint %s: %w", record.ID, err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %s: %w", record.ID, err)
+	}
+
+	flat := make(map[string]string)
+	var flatten func(prefix string, value interface{})
+	flatten = func(prefix string, value interface{}) {
+		if nested, ok := value.(map[string]interface{}); ok {
+			for name, v := range nested {
+				flatten(prefix+name+".", v)
+			}
+			return
+		}
+		flat[prefix[:len(prefix)-1]] = fmt.Sprint(value)
+	}
+	flatten("", fields)
+	return flat, nil
+}
+
+// save writes the manifest, replacing the old one only once fully written
+func (r *Registry) save() error {
+	content, err := json.MarshalIndent(&r.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode registry manifest: %w", err)
+	}
+
+	path := filepath.Join(r.dir, registryManifest)
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return fmt.Errorf("failed to write registry manifest: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "registry")
+	registry, err := OpenRegistry(dir)
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+
+	m, err := NewChessModel(DefaultArchitecture, DefaultCNNConfig())
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer m.Close()
+
+	for epoch, valLoss := range []float64{2.0, 1.5, 1.8} {
+		config := *DefaultTrainingConfig()
+		config.LearningRate = 0.001 * float64(epoch+1)
+		if _, err := registry.Register(m, CheckpointRecord{Epoch: epoch + 1, ValLoss: valLoss, Config: config}); err != nil {
+			t.Fatalf("Failed to register checkpoint: %v", err)
+		}
+	}
+	if registry.Best() != "ckpt-0002" || registry.Latest() != "ckpt-0003" {
+		t.Fatalf("Best %s and latest %s, want ckpt-0002 and ckpt-0003", registry.Best(), registry.Latest())
+	}
+
+	if err := registry.Promote("ckpt-0001"); err != nil {
+		t.Fatalf("Failed to promote checkpoint: %v", err)
+	}
+	best, err := registry.Get(RefBest)
+	if err != nil || best.Epoch != 1 {
+		t.Fatalf("Best checkpoint after promotion: %+v, %v", best, err)
+	}
+
+	diffs, err := registry.DiffMetadata(RefBest, RefLatest)
+	if err != nil {
+		t.Fatalf("Failed to diff checkpoints: %v", err)
+	}
+	changed := make(map[string]MetadataDiff)
+	for _, d := range diffs {
+		changed[d.Field] = d
+	}
+	for _, field := range []string{"id", "epoch", "val_loss", "config.LearningRate"} {
+		if _, ok := changed[field]; !ok {
+			t.Errorf("Diff is missing field %s: %+v", field, diffs)
+		}
+	}
+	if d := changed["epoch"]; d.A != "1" || d.B != "3" {
+		t.Errorf("Epoch diff = %+v", d)
+	}
+	if _, ok := changed["config.BatchSize"]; ok {
+		t.Error("Unchanged config field reported as different")
+	}
+
+	// Pruning everything keeps the promoted best and the latest checkpoint
+	pruned, err := registry.Prune(0)
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].ID != "ckpt-0002" {
+		t.Fatalf("Pruned %+v, want only ckpt-0002", pruned)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ckpt-0002.gob")); !os.IsNotExist(err) {
+		t.Errorf("Pruned checkpoint file still exists: %v", err)
+	}
+
+	reopened, err := OpenRegistry(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen registry: %v", err)
+	}
+	if len(reopened.Checkpoints()) != 2 || reopened.Best() != "ckpt-0001" {
+		t.Fatalf("Reopened registry has %d checkpoints, best %s", len(reopened.Checkpoints()), reopened.Best())
+	}
+	latest, err := reopened.Get(RefLatest)
+	if err != nil {
+		t.Fatalf("Failed to get latest checkpoint: %v", err)
+	}
+	if _, err := LoadChessModel(reopened.Path(latest)); err != nil {
+		t.Errorf("Failed to load registered checkpoint: %v", err)
+	}
+}
+
+func TestRegistryBestByValidationLoss(t *testing.T) {
+	registry, err := OpenRegistry(filepath.Join(t.TempDir(), "registry"))
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	m, err := NewChessModel(DefaultArchitecture, DefaultCNNConfig())
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer m.Close()
+
+	// Training losses are never compared with validation losses
+	steps := []struct {
+		record CheckpointRecord
+		best   string
+	}{
+		{CheckpointRecord{TrainLoss: 0.1}, ""},
+		{CheckpointRecord{TrainLoss: 3.0, ValLoss: 2.0}, "ckpt-0002"},
+		{CheckpointRecord{TrainLoss: 0.01}, "ckpt-0002"},
+		{CheckpointRecord{TrainLoss: 2.5, ValLoss: 1.5}, "ckpt-0004"},
+	}
+	for i, step := range steps {
+		if _, err := registry.Register(m, step.record); err != nil {
+			t.Fatalf("Failed to register checkpoint: %v", err)
+		}
+		if registry.Best() != step.best {
+			t.Errorf("Step %d: best %q, want %q", i, registry.Best(), step.best)
+		}
+	}
+
+	// A best promoted without a validation loss is kept
+	if err := registry.Promote("ckpt-0003"); err != nil {
+		t.Fatalf("Failed to promote checkpoint: %v", err)
+	}
+	if _, err := registry.Register(m, CheckpointRecord{ValLoss: 0.5}); err != nil {
+		t.Fatalf("Failed to register checkpoint: %v", err)
+	}
+	if registry.Best() != "ckpt-0003" {
+		t.Errorf("Best %q after promotion, want ckpt-0003", registry.Best())
+	}
+}
+
+func TestTrainerRegistersCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	dataset := newOpeningDataset(t, filepath.Join(dir, "train.db"))
+
+	config := DefaultTrainingConfig()
+	config.Epochs = 2
+	config.BatchSize = 2
+	config.Verbose = false
+	config.SaveInterval = 1
+	config.SavePath = filepath.Join(dir, "model.gob")
+	config.RegistryDir = filepath.Join(dir, "registry")
+	config.ParentCheckpoint = "ckpt-base"
+
+	trainer, err := NewTrainer(config)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer trainer.GetModel().Close()
+	if err := trainer.Train(dataset); err != nil {
+		t.Fatalf("Failed to train: %v", err)
+	}
+
+	// One checkpoint per epoch; the final save does not duplicate the last one
+	checkpoints := trainer.Registry().Checkpoints()
+	if len(checkpoints) != 2 {
+		t.Fatalf("Registered %d checkpoints, want 2", len(checkpoints))
+	}
+	hash, err := dataset.Hash()
+	if err != nil {
+		t.Fatalf("Failed to hash dataset: %v", err)
+	}
+	for i, record := range checkpoints {
+		if record.Epoch != i+1 || record.DatasetHash != hash || record.DatasetPath != dataset.Path() {
+			t.Errorf("Checkpoint %d: %+v", i, record)
+		}
+	}
+	if checkpoints[0].Parent != "ckpt-base" || checkpoints[1].Parent != checkpoints[0].ID {
+		t.Errorf("Parents %q and %q, want ckpt-base and %s", checkpoints[0].Parent, checkpoints[1].Parent, checkpoints[0].ID)
+	}
+}
@@ -0,0 +1,556 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/onnx"
+)
+
+// Runtime is a pure-Go float32 forward pass over a model's weights that
+// needs no Gorgonia graph. It accepts any batch size and, once its scratch
+// buffers are warm, runs without allocating. The weights are read-only and
+// scratch buffers come from a pool, so one Runtime can be shared by many
+// goroutines.
+type Runtime struct {
+	metadata ModelMetadata
+	channels int
+	encoding data.MoveEncoding
+
+	layers  []runtimeLayer
+	sizes   []int // Per-position length of each activation buffer
+	logits  int   // Buffer of the policy logits
+	value   int   // Buffer of the value, -1 without a value head
+	scratch sync.Pool
+}
+
+// Runtime operators
+const (
+	opConv = iota
+	opGemm
+	opAdd
+	opRelu
+	opTanh
+)
+
+// runtimeLayer is one operator of a Runtime. Inputs and output are indices
+// of activation buffers; spatial activations are laid out [y, x, channel]
+// so that convolutions update contiguous output channels.
+type runtimeLayer struct {
+	op     int
+	inputs []int
+	output int
+	relu   bool // ReLU fused into a conv or gemm
+
+	// conv and gemm only, weights stored with the output channel last
+	shape   []int // conv [kh, kw, in, out]; gemm [in, out]
+	height  int   // conv input height
+	width   int   // conv input width
+	pad     int
+	weights []float32
+	bias    []float32
+}
+
+// runtimeScratch holds the activation buffers of one forward pass
+type runtimeScratch struct {
+	buffers [][]float32
+}
+
+// NewRuntime copies a model's weights into a Runtime
+func NewRuntime(m ChessModel) (*Runtime, error) {
+	exported, err := ExportONNX(m)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Runtime{metadata: m.Metadata(), channels: m.InputChannels(), encoding: m.MoveEncoding(), value: -1}
+	if err := r.compile(&exported.Graph); err != nil {
+		return nil, fmt.Errorf("failed to compile %s: %w", m.Architecture(), err)
+	}
+	r.scratch.New = func() interface{} { return &runtimeScratch{} }
+	return r, nil
+}
+
+// LoadRuntime creates a Runtime from a checkpoint of any architecture
+func LoadRuntime(checkpointPath string) (*Runtime, error) {
+	m, err := LoadChessModel(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return NewRuntime(m)
+}
+
+// compile converts the nodes of an exported graph to layers, fusing each
+// ReLU into the layer that produces its only input
+func (r *Runtime) compile(graph *onnx.Graph) error {
+	weights := make(map[string]*onnx.Tensor)
+	for i := range graph.Initializers {
+		weights[graph.Initializers[i].Name] = &graph.Initializers[i]
+	}
+	consumers := make(map[string]int)
+	for _, node := range graph.Nodes {
+		for _, input := range node.Inputs {
+			consumers[input]++
+		}
+	}
+
+	// shapes holds [height, width, channels] for spatial buffers and
+	// [length] otherwise
+	buffers := map[string]int{ONNXInput: 0}
+	shapes := [][]int{{8, 8, r.channels}}
+	r.sizes = []int{8 * 8 * r.channels}
+	input := func(node onnx.Node, i int) (int, []int, error) {
+		buffer, ok := buffers[node.Inputs[i]]
+		if !ok {
+			return 0, nil, fmt.Errorf("node %s: undefined input %s", node.Name, node.Inputs[i])
+		}
+		return buffer, shapes[buffer], nil
+	}
+	output := func(node onnx.Node, shape []int) int {
+		size := 1
+		for _, d := range shape {
+			size *= d
+		}
+		buffers[node.Name] = len(r.sizes)
+		shapes = append(shapes, shape)
+		r.sizes = append(r.sizes, size)
+		return len(r.sizes) - 1
+	}
+
+	for _, node := range graph.Nodes {
+		in, shape, err := input(node, 0)
+		if err != nil {
+			return err
+		}
+
+		switch node.OpType {
+		case "Conv":
+			if len(shape) != 3 {
+				return fmt.Errorf("node %s: convolution of a flat input", node.Name)
+			}
+			layer, err := convLayer(node, weights, shape)
+			if err != nil {
+				return err
+			}
+			layer.inputs = []int{in}
+			outH := shape[0] + 2*layer.pad - layer.shape[0] + 1
+			outW := shape[1] + 2*layer.pad - layer.shape[1] + 1
+			layer.output = output(node, []int{outH, outW, layer.shape[3]})
+			r.layers = append(r.layers, layer)
+		case "Gemm":
+			layer, err := gemmLayer(node, weights, shape)
+			if err != nil {
+				return err
+			}
+			layer.inputs = []int{in}
+			layer.output = output(node, []int{layer.shape[1]})
+			r.layers = append(r.layers, layer)
+		case "Add":
+			other, otherShape, err := input(node, 1)
+			if err != nil {
+				return err
+			}
+			if r.sizes[in] != r.sizes[other] || len(shape) != len(otherShape) {
+				return fmt.Errorf("node %s: shapes %v and %v differ", node.Name, shape, otherShape)
+			}
+			r.layers = append(r.layers, runtimeLayer{op: opAdd, inputs: []int{in, other}, output: output(node, shape)})
+		case "Relu":
+			last := len(r.layers) - 1
+			if last >= 0 && r.layers[last].output == in && consumers[node.Inputs[0]] == 1 &&
+				(r.layers[last].op == opConv || r.layers[last].op == opGemm) {
+				r.layers[last].relu = true
+				buffers[node.Name] = in
+				continue
+			}
+			r.layers = append(r.layers, runtimeLayer{op: opRelu, inputs: []int{in}, output: output(node, shape)})
+		case "Tanh":
+			r.layers = append(r.layers, runtimeLayer{op: opTanh, inputs: []int{in}, output: output(node, shape)})
+		case "Flatten":
+			// Gemm reads spatial inputs directly, see gemmLayer
+			buffers[node.Name] = in
+		case "Softmax":
+			// Applied by the caller, which may mask illegal moves first
+		default:
+			return fmt.Errorf("node %s: unsupported operator %s", node.Name, node.OpType)
+		}
+	}
+
+	logits, ok := buffers[ONNXLogits]
+	if !ok {
+		return fmt.Errorf("graph has no %s output", ONNXLogits)
+	}
+	if r.sizes[logits] != r.encoding.Size() {
+		return fmt.Errorf("%d logits for %s move encoding", r.sizes[logits], r.encoding)
+	}
+	r.logits = logits
+	if value, ok := buffers[ONNXValue]; ok {
+		r.value = value
+	}
+	return nil
+}
+
+// convLayer converts an exported [out, in, kh, kw] kernel to [kh, kw, in, out]
+func convLayer(node onnx.Node, weights map[string]*onnx.Tensor, shape []int) (runtimeLayer, error) {
+	kernel, ok := weights[node.Inputs[1]]
+	if !ok || len(kernel.Dims) != 4 {
+		return runtimeLayer{}, fmt.Errorf("node %s: missing kernel", node.Name)
+	}
+	outC, inC, kH, kW := int(kernel.Dims[0]), int(kernel.Dims[1]), int(kernel.Dims[2]), int(kernel.Dims[3])
+	if inC != shape[2] {
+		return runtimeLayer{}, fmt.Errorf("node %s: kernel expects %d channels, input has %d", node.Name, inC, shape[2])
+	}
+
+	layer := runtimeLayer{
+		op:      opConv,
+		shape:   []int{kH, kW, inC, outC},
+		height:  shape[0],
+		width:   shape[1],
+		weights: make([]float32, len(kernel.Data)),
+		bias:    make([]float32, outC),
+	}
+	for o := 0; o < outC; o++ {
+		for c := 0; c < inC; c++ {
+			for t := 0; t < kH*kW; t++ {
+				layer.weights[(t*inC+c)*outC+o] = kernel.Data[(o*inC+c)*kH*kW+t]
+			}
+		}
+	}
+	if pads, ok := node.Attribute("pads"); ok {
+		layer.pad = int(pads.Ints[0])
+	}
+	if len(node.Inputs) > 2 {
+		copy(layer.bias, weights[node.Inputs[2]].Data)
+	}
+	return layer, nil
+}
+
+// gemmLayer copies [in, out] weights. For a flattened spatial input the rows
+// are reordered from the exported [channel, y, x] order to [y, x, channel].
+func gemmLayer(node onnx.Node, weights map[string]*onnx.Tensor, shape []int) (runtimeLayer, error) {
+	w, ok := weights[node.Inputs[1]]
+	if !ok || len(w.Dims) != 2 {
+		return runtimeLayer{}, fmt.Errorf("node %s: missing weights", node.Name)
+	}
+	bias, ok := weights[node.Inputs[2]]
+	inSize, outSize := int(w.Dims[0]), int(w.Dims[1])
+	if !ok || len(bias.Data) != outSize {
+		return runtimeLayer{}, fmt.Errorf("node %s: missing bias", node.Name)
+	}
+
+	layer := runtimeLayer{
+		op:      opGemm,
+		shape:   []int{inSize, outSize},
+		weights: append([]float32(nil), w.Data...),
+		bias:    append([]float32(nil), bias.Data...),
+	}
+	if len(shape) == 3 {
+		pixels, channels := shape[0]*shape[1], shape[2]
+		if pixels*channels != inSize {
+			return runtimeLayer{}, fmt.Errorf("node %s: %d inputs for shape %v", node.Name, inSize, shape)
+		}
+		for c := 0; c < channels; c++ {
+			for p := 0; p < pixels; p++ {
+				copy(layer.weights[(p*channels+c)*outSize:][:outSize], w.Data[(c*pixels+p)*outSize:][:outSize])
+			}
+		}
+	} else if shape[0] != inSize {
+		return runtimeLayer{}, fmt.Errorf("node %s: %d inputs, expected %d", node.Name, shape[0], inSize)
+	}
+	return layer, nil
+}
+
+// Metadata describes the model layout as recorded in checkpoints
+func (r *Runtime) Metadata() ModelMetadata {
+	return r.metadata
+}
+
+// InputChannels returns the number of input planes the model expects
+func (r *Runtime) InputChannels() int {
+	return r.channels
+}
+
+// MoveEncoding returns the move encoding of the policy output
+func (r *Runtime) MoveEncoding() data.MoveEncoding {
+	return r.encoding
+}
+
+// PolicySize returns the length of the policy output
+func (r *Runtime) PolicySize() int {
+	return r.encoding.Size()
+}
+
+// HasValueHead reports whether the model predicts a position evaluation
+func (r *Runtime) HasValueHead() bool {
+	return r.value >= 0
+}
+
+// ForwardBatch runs a batch of flat state tensors and writes the policy
+// probabilities of state i to policies[i], which must hold PolicySize
+// values, and its value to values[i]. values may be nil. States with
+// InputChannels planes are evaluated without allocating.
+func (r *Runtime) ForwardBatch(states [][]float32, policies [][]float64, values []float64) error {
+	return r.forwardBatch(states, policies, values, true)
+}
+
+// LogitsBatch is ForwardBatch without the softmax, for callers that mask
+// illegal moves before normalizing
+func (r *Runtime) LogitsBatch(states [][]float32, logits [][]float64, values []float64) error {
+	return r.forwardBatch(states, logits, values, false)
+}
+
+// Forward runs a flat 12- or 19-channel state tensor through the network and
+// returns the policy probabilities and the value (0 without a value head)
+func (r *Runtime) Forward(state []float32) ([]float64, float64, error) {
+	probs := make([]float64, r.PolicySize())
+	values := make([]float64, 1)
+	if err := r.ForwardBatch([][]float32{state}, [][]float64{probs}, values); err != nil {
+		return nil, 0, err
+	}
+	return probs, values[0], nil
+}
+
+// ForwardLegal runs a forward pass with the logits of illegal moves masked
+// before the softmax, following the package-level ForwardLegal
+func (r *Runtime) ForwardLegal(state []float32, pos *chess.Position) ([]float64, float64, error) {
+	logits := make([]float64, r.PolicySize())
+	values := make([]float64, 1)
+	if err := r.LogitsBatch([][]float32{state}, [][]float64{logits}, values); err != nil {
+		return nil, 0, err
+	}
+
+	var legal []bool
+	if pos != nil {
+		legal = LegalMask(pos, r.PolicySize())
+	} else {
+		legal = stateLegalMask(state, r.encoding)
+	}
+	if legal == nil {
+		return SoftmaxManual(logits), values[0], nil
+	}
+	return MaskedSoftmax(logits, legal), values[0], nil
+}
+
+// PredictState returns the top K legal moves for a flat state tensor
+func (r *Runtime) PredictState(state []float32, topK int) ([]MovePrediction, error) {
+	probs, _, err := r.ForwardLegal(state, nil)
+	if err != nil {
+		return nil, err
+	}
+	return legalPredictions(TopKPredictions(probs, topK)), nil
+}
+
+func (r *Runtime) forwardBatch(states [][]float32, outputs [][]float64, values []float64, softmax bool) error {
+	if len(outputs) != len(states) || (values != nil && len(values) != len(states)) {
+		return fmt.Errorf("%d states for %d outputs and %d values", len(states), len(outputs), len(values))
+	}
+	for i, out := range outputs {
+		if len(out) != r.PolicySize() {
+			return fmt.Errorf("output %d has length %d, expected %d", i, len(out), r.PolicySize())
+		}
+	}
+
+	s := r.scratch.Get().(*runtimeScratch)
+	defer r.scratch.Put(s)
+	s.reserve(r.sizes, len(states))
+
+	input := s.buffers[0]
+	for i, state := range states {
+		if err := r.setInput(input[i*r.sizes[0]:][:r.sizes[0]], state); err != nil {
+			return fmt.Errorf("invalid input %d: %w", i, err)
+		}
+	}
+	r.run(s.buffers, len(states))
+
+	policySize := r.PolicySize()
+	logits := s.buffers[r.logits]
+	for i, out := range outputs {
+		row := logits[i*policySize:][:policySize]
+		if softmax {
+			softmaxInto(out, row)
+		} else {
+			for j, v := range row {
+				out[j] = float64(v)
+			}
+		}
+	}
+	for i := range values {
+		values[i] = 0
+		if r.value >= 0 {
+			values[i] = float64(s.buffers[r.value][i])
+		}
+	}
+	return nil
+}
+
+// setInput copies a [channel, y, x] state to a [y, x, channel] buffer
+func (r *Runtime) setInput(dst []float32, state []float32) error {
+	if len(state) != len(dst) {
+		expanded, err := data.ExpandInputChannels(state, r.channels)
+		if err != nil {
+			return err
+		}
+		state = expanded
+	}
+	for c := 0; c < r.channels; c++ {
+		for p, v := range state[c*64 : (c+1)*64] {
+			dst[p*r.channels+c] = v
+		}
+	}
+	return nil
+}
+
+// run evaluates the layers on n positions
+func (r *Runtime) run(buffers [][]float32, n int) {
+	for i := range r.layers {
+		l := &r.layers[i]
+		in, out := buffers[l.inputs[0]], buffers[l.output]
+		switch l.op {
+		case opConv:
+			inSize, outSize := r.sizes[l.inputs[0]], r.sizes[l.output]
+			for b := 0; b < n; b++ {
+				l.conv(in[b*inSize:][:inSize], out[b*outSize:][:outSize])
+			}
+		case opGemm:
+			l.gemm(in, out, n)
+		case opAdd:
+			other := buffers[l.inputs[1]]
+			for j := range out {
+				out[j] = in[j] + other[j]
+			}
+		case opRelu:
+			for j, v := range in {
+				out[j] = float32(math.Max(float64(v), 0))
+			}
+		case opTanh:
+			for j, v := range in {
+				out[j] = float32(math.Tanh(float64(v)))
+			}
+		}
+		if l.relu {
+			relu(out)
+		}
+	}
+}
+
+// conv computes a stride 1 convolution of one position. Each nonzero input
+// is scattered into the outputs it reaches, so the zeros of sparse board
+// planes and ReLU outputs cost nothing.
+func (l *runtimeLayer) conv(x, out []float32) {
+	kH, kW, inC, outC := l.shape[0], l.shape[1], l.shape[2], l.shape[3]
+	h, w := l.height, l.width
+	outH, outW := h+2*l.pad-kH+1, w+2*l.pad-kW+1
+
+	for p := 0; p < outH*outW; p++ {
+		copy(out[p*outC:(p+1)*outC], l.bias)
+	}
+	for iy := 0; iy < h; iy++ {
+		for ix := 0; ix < w; ix++ {
+			pixel := x[(iy*w+ix)*inC:][:inC]
+			for ky := 0; ky < kH; ky++ {
+				oy := iy - ky + l.pad
+				if oy < 0 || oy >= outH {
+					continue
+				}
+				for kx := 0; kx < kW; kx++ {
+					ox := ix - kx + l.pad
+					if ox < 0 || ox >= outW {
+						continue
+					}
+					dst := out[(oy*outW+ox)*outC:][:outC]
+					taps := l.weights[(ky*kW+kx)*inC*outC:][:inC*outC]
+					for c, xv := range pixel {
+						if xv == 0 {
+							continue
+						}
+						for o, wv := range taps[c*outC:][:len(dst)] {
+							dst[o] += wv * xv
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// gemm computes a fully connected layer over n positions. Four weight rows
+// at a time are applied to every position so each row is loaded once per
+// batch; blocks of zero inputs are skipped.
+func (l *runtimeLayer) gemm(x, out []float32, n int) {
+	inSize, outSize := l.shape[0], l.shape[1]
+	for b := 0; b < n; b++ {
+		copy(out[b*outSize:][:outSize], l.bias)
+	}
+
+	i := 0
+	for ; i+4 <= inSize; i += 4 {
+		w0 := l.weights[i*outSize:][:outSize]
+		w1 := l.weights[(i+1)*outSize:][:len(w0)]
+		w2 := l.weights[(i+2)*outSize:][:len(w0)]
+		w3 := l.weights[(i+3)*outSize:][:len(w0)]
+		for b := 0; b < n; b++ {
+			xs := x[b*inSize+i:][:4]
+			x0, x1, x2, x3 := xs[0], xs[1], xs[2], xs[3]
+			if x0 == 0 && x1 == 0 && x2 == 0 && x3 == 0 {
+				continue
+			}
+			dst := out[b*outSize:][:len(w0)]
+			for o := range dst {
+				dst[o] += w0[o]*x0 + w1[o]*x1 + w2[o]*x2 + w3[o]*x3
+			}
+		}
+	}
+	for ; i < inSize; i++ {
+		row := l.weights[i*outSize:][:outSize]
+		for b := 0; b < n; b++ {
+			xv := x[b*inSize+i]
+			if xv == 0 {
+				continue
+			}
+			for o, wv := range row {
+				out[b*outSize+o] += wv * xv
+			}
+		}
+	}
+}
+
+// relu clamps negative values to zero in place
+func relu(values []float32) {
+	for i, v := range values {
+		if v < 0 {
+			values[i] = 0
+		}
+	}
+}
+
+// softmaxInto writes the softmax of float32 logits to dst
+func softmaxInto(dst []float64, logits []float32) {
+	maxLogit := math.Inf(-1)
+	for _, v := range logits {
+		maxLogit = math.Max(maxLogit, float64(v))
+	}
+	sum := 0.0
+	for i, v := range logits {
+		dst[i] = math.Exp(float64(v) - maxLogit)
+		sum += dst[i]
+	}
+	for i := range dst {
+		dst[i] /= sum
+	}
+}
+
+// reserve sizes the buffers for n positions, reusing earlier allocations
+func (s *runtimeScratch) reserve(sizes []int, n int) {
+	if len(s.buffers) != len(sizes) {
+		s.buffers = make([][]float32, len(sizes))
+	}
+	for i, size := range sizes {
+		if cap(s.buffers[i]) < n*size {
+			s.buffers[i] = make([]float32, n*size)
+		}
+		s.buffers[i] = s.buffers[i][:n*size]
+	}
+}
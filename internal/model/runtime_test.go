@@ -0,0 +1,174 @@
+package model
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+)
+
+func TestRuntimeMatchesForward(t *testing.T) {
+	for _, arch := range []Architecture{ArchitectureCNN, ArchitectureResNet} {
+		t.Run(string(arch), func(t *testing.T) {
+			m, err := NewChessModel(arch, DefaultCNNConfig())
+			if err != nil {
+				t.Fatalf("Failed to create model: %v", err)
+			}
+			defer m.Close()
+
+			r, err := NewRuntime(m)
+			if err != nil {
+				t.Fatalf("Failed to create runtime: %v", err)
+			}
+			if r.PolicySize() != m.PolicySize() || r.HasValueHead() != m.HasValueHead() || r.InputChannels() != m.InputChannels() {
+				t.Errorf("Runtime layout differs from %s", arch)
+			}
+
+			states := runtimeTestStates(t, m.InputChannels())
+			logits := make([][]float64, len(states))
+			for i := range logits {
+				logits[i] = make([]float64, r.PolicySize())
+			}
+			values := make([]float64, len(states))
+			if err := r.LogitsBatch(states, logits, values); err != nil {
+				t.Fatalf("Failed to run batch: %v", err)
+			}
+
+			for i, state := range states {
+				wantLogits, wantProbs, wantValue, err := runState(m, state)
+				if err != nil {
+					t.Fatalf("Forward failed: %v", err)
+				}
+				if diff := maxAbsDiff(logits[i], wantLogits); diff > 1e-4*(1+maxAbs(wantLogits)) {
+					t.Errorf("State %d: logits differ by %v", i, diff)
+				}
+				if math.Abs(values[i]-wantValue) > 1e-5 {
+					t.Errorf("State %d: value %v, want %v", i, values[i], wantValue)
+				}
+
+				probs, value, err := r.Forward(state)
+				if err != nil {
+					t.Fatalf("Runtime forward failed: %v", err)
+				}
+				if diff := maxAbsDiff(probs, wantProbs); diff > 1e-4*maxValue(wantProbs) || value != values[i] {
+					t.Errorf("State %d: policy differs by %v, value %v", i, diff, value)
+				}
+			}
+
+			want, err := m.PredictState(states[0], 5)
+			if err != nil {
+				t.Fatalf("Failed to predict: %v", err)
+			}
+			got, err := r.PredictState(states[0], 5)
+			if err != nil {
+				t.Fatalf("Failed to predict with runtime: %v", err)
+			}
+			if len(got) != len(want) || got[0].MoveIndex != want[0].MoveIndex {
+				t.Errorf("Runtime predictions %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRuntimeConcurrentBatches(t *testing.T) {
+	cnn, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+	r, err := NewRuntime(cnn)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+
+	states := runtimeTestStates(t, cnn.InputChannels())
+	want := make([][]float64, len(states))
+	for i, state := range states {
+		if want[i], _, err = r.Forward(state); err != nil {
+			t.Fatalf("Runtime forward failed: %v", err)
+		}
+	}
+
+	// Goroutines run different batch sizes on the shared runtime
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			n := g%len(states) + 1
+			policies := make([][]float64, n)
+			for i := range policies {
+				policies[i] = make([]float64, r.PolicySize())
+			}
+			for iter := 0; iter < 5; iter++ {
+				if err := r.ForwardBatch(states[:n], policies, nil); err != nil {
+					t.Errorf("Goroutine %d: %v", g, err)
+					return
+				}
+				for i := range policies {
+					if diff := maxAbsDiff(policies[i], want[i]); diff > 1e-12 {
+						t.Errorf("Goroutine %d: state %d differs by %v in a batch of %d", g, i, diff, n)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// A warm runtime does not allocate
+	policies := [][]float64{make([]float64, r.PolicySize()), make([]float64, r.PolicySize())}
+	values := make([]float64, 2)
+	allocs := testing.AllocsPerRun(10, func() {
+		if err := r.ForwardBatch(states[:2], policies, values); err != nil {
+			t.Fatalf("Runtime forward failed: %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ForwardBatch made %v allocations", allocs)
+	}
+
+	if err := r.ForwardBatch(states[:2], policies[:1], nil); err == nil {
+		t.Error("Expected error for missing outputs")
+	}
+}
+
+// runtimeTestStates returns opening positions followed by a 12-channel state
+func runtimeTestStates(t *testing.T, channels int) [][]float32 {
+	t.Helper()
+	var states [][]float32
+	game := chess.NewGame()
+	for _, move := range []string{"e4", "c5", "Nf3", "d6"} {
+		state, err := data.TensorizePosition(game.Position(), channels)
+		if err != nil {
+			t.Fatalf("Failed to tensorize position: %v", err)
+		}
+		states = append(states, state)
+		if err := game.MoveStr(move); err != nil {
+			t.Fatalf("Failed to play %s: %v", move, err)
+		}
+	}
+	board, err := data.TensorizeBoard(game.Position().Board())
+	if err != nil {
+		t.Fatalf("Failed to tensorize board: %v", err)
+	}
+	return append(states, data.TensorToFlatArray(board))
+}
+
+func maxAbsDiff(a, b []float64) float64 {
+	diff := 0.0
+	for i := range a {
+		diff = math.Max(diff, math.Abs(a[i]-b[i]))
+	}
+	return diff
+}
+
+func maxAbs(values []float64) float64 {
+	m := 0.0
+	for _, v := range values {
+		m = math.Max(m, math.Abs(v))
+	}
+	return m
+}
@@ -9,6 +9,10 @@ type LRScheduler interface {
 	GetLR(step int) float64
 	Step()
 	GetCurrentLR() float64
+
+	// CurrentStep and Restore save and restore the scheduler position
+	CurrentStep() int
+	Restore(step int, lr float64)
 }
 
 // CosineAnnealingScheduler implements cosine annealing with warmup
@@ -60,6 +64,17 @@ func (s *CosineAnnealingScheduler) GetCurrentLR() float64 {
 	return s.currentLR
 }
 
+// CurrentStep returns the number of steps taken
+func (s *CosineAnnealingScheduler) CurrentStep() int {
+	return s.currentStep
+}
+
+// Restore sets the step count and current learning rate of a saved scheduler
+func (s *CosineAnnealingScheduler) Restore(step int, lr float64) {
+	s.currentStep = step
+	s.currentLR = lr
+}
+
 // StepLRScheduler implements step-based learning rate decay
 type StepLRScheduler struct {
 	baseLR      float64
@@ -97,6 +112,17 @@ func (s *StepLRScheduler) GetCurrentLR() float64 {
 	return s.currentLR
 }
 
+// CurrentStep returns the number of steps taken
+func (s *StepLRScheduler) CurrentStep() int {
+	return s.currentStep
+}
+
+// Restore sets the step count and current learning rate of a saved scheduler
+func (s *StepLRScheduler) Restore(step int, lr float64) {
+	s.currentStep = step
+	s.currentLR = lr
+}
+
 // ExponentialLRScheduler implements exponential decay
 type ExponentialLRScheduler struct {
 	baseLR      float64
@@ -130,3 +156,14 @@ func (s *ExponentialLRScheduler) Step() {
 func (s *ExponentialLRScheduler) GetCurrentLR() float64 {
 	return s.currentLR
 }
+
+// CurrentStep returns the number of steps taken
+func (s *ExponentialLRScheduler) CurrentStep() int {
+	return s.currentStep
+}
+
+// Restore sets the step count and current learning rate of a saved scheduler
+func (s *ExponentialLRScheduler) Restore(step int, lr float64) {
+	s.currentStep = step
+	s.currentLR = lr
+}
@@ -0,0 +1,449 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// TensorFileExt selects the named-tensor checkpoint format in SaveModel.
+// Other extensions (.gob, .bin) keep the legacy gob format.
+//
+// The layout follows safetensors, so the files can be read by its tooling:
+// an 8-byte little-endian header length, a JSON header mapping each tensor
+// name to its dtype, shape and byte offsets (plus a "__metadata__" map of
+// strings), then the little-endian tensor data. The metadata records the
+// model layout and the SHA-256 of the data, which is verified on load.
+const TensorFileExt = ".safetensors"
+
+const (
+	tensorMetadataKey = "__metadata__"
+	tensorFileFormat  = "partner-tensors"
+
+	// maxTensorHeader bounds the header size read from untrusted files
+	maxTensorHeader = 100 << 20
+)
+
+// NamedTensor is one tensor of a tensor file
+type NamedTensor struct {
+	Name  string
+	Shape []int
+	Data  []float64
+}
+
+// TensorFile is the content of a named-tensor file
+type TensorFile struct {
+	Metadata map[string]string
+	Tensors  []NamedTensor // In file order
+}
+
+// Tensor returns the tensor with the given name
+func (f *TensorFile) Tensor(name string) (*NamedTensor, bool) {
+	for i := range f.Tensors {
+		if f.Tensors[i].Name == name {
+			return &f.Tensors[i], true
+		}
+	}
+	return nil, false
+}
+
+// tensorHeaderEntry describes one tensor in the JSON header
+type tensorHeaderEntry struct {
+	DType       string   `json:"dtype"`
+	Shape       []int    `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// WriteTensorFile writes tensors as float64 ("F64") with the given metadata.
+// The SHA-256 of the data is added to the metadata as "sha256".
+func WriteTensorFile(path string, metadata map[string]string, tensors []NamedTensor) error {
+	header := make(map[string]interface{}, len(tensors)+1)
+	var body bytes.Buffer
+	for _, t := range tensors {
+		if _, dup := header[t.Name]; dup || t.Name == tensorMetadataKey {
+			return fmt.Errorf("duplicate or reserved tensor name %q", t.Name)
+		}
+		if shapeSize(t.Shape) != len(t.Data) {
+			return fmt.Errorf("tensor %s has shape %v but %d values", t.Name, t.Shape, len(t.Data))
+		}
+
+		begin := int64(body.Len())
+		raw := make([]byte, 8*len(t.Data))
+		for i, v := range t.Data {
+			binary.LittleEndian.PutUint64(raw[i*8:], math.Float64bits(v))
+		}
+		body.Write(raw)
+		header[t.Name] = tensorHeaderEntry{
+			DType:       "F64",
+			Shape:       append([]int{}, t.Shape...),
+			DataOffsets: [2]int64{begin, int64(body.Len())},
+		}
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	meta := map[string]string{"sha256": hex.EncodeToString(sum[:])}
+	for k, v := range metadata {
+		if k != "sha256" {
+			meta[k] = v
+		}
+	}
+	header[tensorMetadataKey] = meta
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to encode tensor header: %w", err)
+	}
+	// Pad the header with spaces so the data starts 8-byte aligned
+	if pad := (8 - len(headerJSON)%8) % 8; pad > 0 {
+		headerJSON = append(headerJSON, bytes.Repeat([]byte{' '}, pad)...)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	if err := binary.Write(f, binary.LittleEndian, uint64(len(headerJSON))); err != nil {
+		return fmt.Errorf("failed to write tensor header: %w", err)
+	}
+	if _, err := f.Write(headerJSON); err != nil {
+		return fmt.Errorf("failed to write tensor header: %w", err)
+	}
+	if _, err := body.WriteTo(f); err != nil {
+		return fmt.Errorf("failed to write tensor data: %w", err)
+	}
+	return f.Close()
+}
+
+// ReadTensorFile reads a named-tensor file and verifies its data checksum.
+// Files without a checksum are rejected, since WriteTensorFile always records
+// one. F64 and F32 tensors are supported and returned as float64.
+func ReadTensorFile(path string) (*TensorFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	header, metadata, err := readTensorHeader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tensor data: %w", err)
+	}
+	want, ok := metadata["sha256"]
+	if !ok {
+		return nil, fmt.Errorf("tensor file has no sha256 checksum in its metadata")
+	}
+	sum := sha256.Sum256(body)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("tensor data checksum mismatch: file records %s, data hashes to %s", want, got)
+	}
+
+	file := &TensorFile{Metadata: metadata}
+	for _, name := range sortedTensorNames(header) {
+		entry := header[name]
+		begin, end := entry.DataOffsets[0], entry.DataOffsets[1]
+		if begin < 0 || end < begin || end > int64(len(body)) {
+			return nil, fmt.Errorf("tensor %s has invalid data offsets %v", name, entry.DataOffsets)
+		}
+		values, err := decodeTensorData(entry.DType, body[begin:end])
+		if err != nil {
+			return nil, fmt.Errorf("tensor %s: %w", name, err)
+		}
+		if shapeSize(entry.Shape) != len(values) {
+			return nil, fmt.Errorf("tensor %s has shape %v but %d values", name, entry.Shape, len(values))
+		}
+		file.Tensors = append(file.Tensors, NamedTensor{Name: name, Shape: entry.Shape, Data: values})
+	}
+	return file, nil
+}
+
+// readTensorHeader reads the header length and JSON header of a tensor file
+func readTensorHeader(r io.Reader) (map[string]tensorHeaderEntry, map[string]string, error) {
+	var size uint64
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, nil, fmt.Errorf("failed to read tensor header size: %w", err)
+	}
+	if size > maxTensorHeader {
+		return nil, nil, fmt.Errorf("tensor header of %d bytes is too large", size)
+	}
+	headerJSON := make([]byte, size)
+	if _, err := io.ReadFull(r, headerJSON); err != nil {
+		return nil, nil, fmt.Errorf("failed to read tensor header: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(headerJSON, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse tensor header: %w", err)
+	}
+
+	metadata := make(map[string]string)
+	header := make(map[string]tensorHeaderEntry, len(raw))
+	for name, value := range raw {
+		if name == tensorMetadataKey {
+			if err := json.Unmarshal(value, &metadata); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse tensor metadata: %w", err)
+			}
+			continue
+		}
+		var entry tensorHeaderEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse tensor %s: %w", name, err)
+		}
+		header[name] = entry
+	}
+	return header, metadata, nil
+}
+
+// sortedTensorNames returns the tensor names in data order
+func sortedTensorNames(header map[string]tensorHeaderEntry) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return header[names[i]].DataOffsets[0] < header[names[j]].DataOffsets[0]
+	})
+	return names
+}
+
+// decodeTensorData converts little-endian tensor bytes to float64
+func decodeTensorData(dtype string, raw []byte) ([]float64, error) {
+	switch dtype {
+	case "F64":
+		if len(raw)%8 != 0 {
+			return nil, fmt.Errorf("F64 data of %d bytes", len(raw))
+		}
+		values := make([]float64, len(raw)/8)
+		for i := range values {
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw[i*8:]))
+		}
+		return values, nil
+	case "F32":
+		if len(raw)%4 != 0 {
+			return nil, fmt.Errorf("F32 data of %d bytes", len(raw))
+		}
+		values := make([]float64, len(raw)/4)
+		for i := range values {
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:])))
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported dtype %q", dtype)
+	}
+}
+
+// shapeSize returns the number of values of a shape
+func shapeSize(shape []int) int {
+	size := 1
+	for _, d := range shape {
+		size *= d
+	}
+	return size
+}
+
+// sameShape reports whether two shapes have identical dimensions. Unlike
+// tensor.Shape.Eq it does not treat [1 n] and [n] as equal.
+func sameShape(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isTensorFile reports whether the file starts like a tensor file: a
+// plausible header length followed by a JSON object
+func isTensorFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var prefix [9]byte
+	if _, err := io.ReadFull(f, prefix[:]); err != nil {
+		return false
+	}
+	size := binary.LittleEndian.Uint64(prefix[:8])
+	return size > 0 && size <= maxTensorHeader && prefix[8] == '{'
+}
+
+// metadataToStrings records model metadata in tensor file metadata
+func metadataToStrings(metadata ModelMetadata) map[string]string {
+	meta := map[string]string{
+		"format":        tensorFileFormat,
+		"version":       metadata.Version,
+		"model_type":    metadata.ModelType,
+		"input_shape":   joinInts(metadata.InputShape),
+		"output_shape":  joinInts(metadata.OutputShape),
+		"move_encoding": metadata.MoveEncoding,
+	}
+	if metadata.Seed != 0 {
+		meta["seed"] = strconv.FormatInt(metadata.Seed, 10)
+	}
+	return meta
+}
+
+// metadataFromStrings reads model metadata from tensor file metadata
+func metadataFromStrings(meta map[string]string) (*ModelMetadata, error) {
+	if meta["format"] != tensorFileFormat {
+		return nil, fmt.Errorf("not a model tensor file (format %q)", meta["format"])
+	}
+	inputShape, err := splitInts(meta["input_shape"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid input shape: %w", err)
+	}
+	outputShape, err := splitInts(meta["output_shape"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid output shape: %w", err)
+	}
+	var seed int64
+	if meta["seed"] != "" {
+		if seed, err = strconv.ParseInt(meta["seed"], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid seed: %w", err)
+		}
+	}
+	return &ModelMetadata{
+		Version:      meta["version"],
+		ModelType:    meta["model_type"],
+		InputShape:   inputShape,
+		OutputShape:  outputShape,
+		MoveEncoding: meta["move_encoding"],
+		Seed:         seed,
+	}, nil
+}
+
+// joinInts formats a shape as comma-separated integers
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// splitInts parses comma-separated integers
+func splitInts(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	values := make([]int, len(parts))
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// saveTensorCheckpoint writes the weights as named tensors
+func saveTensorCheckpoint(path string, metadata ModelMetadata, weights gorgonia.Nodes) error {
+	tensors := make([]NamedTensor, len(weights))
+	for i, w := range weights {
+		val := w.Value()
+		if val == nil {
+			return fmt.Errorf("weight %d has nil value", i)
+		}
+		tensors[i] = NamedTensor{Name: w.Name(), Shape: val.Shape(), Data: val.Data().([]float64)}
+	}
+	return WriteTensorFile(path, metadataToStrings(metadata), tensors)
+}
+
+// loadTensorCheckpoint loads a named-tensor checkpoint, matching every
+// weight by name and shape against the model's graph
+func loadTensorCheckpoint(path string, m ChessModel, weights gorgonia.Nodes) error {
+	file, err := ReadTensorFile(path)
+	if err != nil {
+		return err
+	}
+	metadata, err := metadataFromStrings(file.Metadata)
+	if err != nil {
+		return err
+	}
+	if err := checkMetadata(*metadata, m); err != nil {
+		return err
+	}
+
+	if len(file.Tensors) != len(weights) {
+		return fmt.Errorf("checkpoint has %d tensors, model has %d weights", len(file.Tensors), len(weights))
+	}
+	for _, w := range weights {
+		t, ok := file.Tensor(w.Name())
+		if !ok {
+			return fmt.Errorf("checkpoint has no tensor for weight %s", w.Name())
+		}
+		if !sameShape(t.Shape, w.Shape()) {
+			return fmt.Errorf("weight %s shape mismatch: checkpoint has %v, model has %v", w.Name(), t.Shape, w.Shape())
+		}
+	}
+
+	for _, w := range weights {
+		t, _ := file.Tensor(w.Name())
+		value := tensor.New(tensor.WithShape(t.Shape...), tensor.WithBacking(t.Data))
+		if err := gorgonia.Let(w, value); err != nil {
+			return fmt.Errorf("failed to set weight %s: %w", w.Name(), err)
+		}
+	}
+	return nil
+}
+
+// readTensorMetadata reads the model metadata of a named-tensor checkpoint
+// without loading its data
+func readTensorMetadata(path string) (*ModelMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	_, meta, err := readTensorHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	return metadataFromStrings(meta)
+}
+
+// ConvertCheckpoint rewrites a checkpoint in the format selected by the
+// output extension (TensorFileExt or legacy gob), e.g. to convert .gob and
+// .bin checkpoints to named tensors
+func ConvertCheckpoint(inputPath, outputPath string) (ModelMetadata, error) {
+	m, err := LoadChessModel(inputPath)
+	if err != nil {
+		return ModelMetadata{}, err
+	}
+	defer m.Close()
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return ModelMetadata{}, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := m.SaveModel(outputPath); err != nil {
+		return ModelMetadata{}, fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return m.Metadata(), nil
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thyrook/partner/internal/data"
+)
+
+func TestConvertCheckpointToTensorFile(t *testing.T) {
+	dir := t.TempDir()
+	gobPath := filepath.Join(dir, "model.gob")
+	tensorPath := filepath.Join(dir, "model"+TensorFileExt)
+
+	cnn, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+	if err := cnn.SaveModel(gobPath); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+
+	if _, err := ConvertCheckpoint(gobPath, tensorPath); err != nil {
+		t.Fatalf("Failed to convert checkpoint: %v", err)
+	}
+
+	metadata, err := ReadModelMetadata(tensorPath)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if metadata.ModelType != cnn.Metadata().ModelType || metadata.MoveEncoding != string(cnn.MoveEncoding()) {
+		t.Errorf("Metadata = %+v; want %+v", metadata, cnn.Metadata())
+	}
+
+	loaded, err := LoadChessModel(tensorPath)
+	if err != nil {
+		t.Fatalf("Failed to load converted checkpoint: %v", err)
+	}
+	defer loaded.Close()
+
+	state := data.AppendAuxPlanes(make([]float32, data.NumChannels*64), data.DefaultAuxState())
+	state[0*64+6*8+4] = 1 // White pawn on e2
+	probs, _, err := cnn.Forward(state)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	loadedProbs, _, err := loaded.Forward(state)
+	if err != nil {
+		t.Fatalf("Forward on loaded model failed: %v", err)
+	}
+	for i := range probs {
+		if math.Abs(loadedProbs[i]-probs[i]) > 1e-12 {
+			t.Fatalf("Loaded policy differs at %d: %v vs %v", i, loadedProbs[i], probs[i])
+		}
+	}
+}
+
+func TestTensorFileVerification(t *testing.T) {
+	dir := t.TempDir()
+
+	cnn, err := NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+
+	path := filepath.Join(dir, "model"+TensorFileExt)
+	if err := cnn.SaveModel(path); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+	file, err := ReadTensorFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read tensor file: %v", err)
+	}
+	metadata := file.Metadata
+
+	// Tensors are matched by name, so their order in the file does not matter
+	reversed := make([]NamedTensor, len(file.Tensors))
+	for i, tensor := range file.Tensors {
+		reversed[len(reversed)-1-i] = tensor
+	}
+
+	renamed := append([]NamedTensor(nil), file.Tensors...)
+	renamed[0].Name = "conv0_w"
+
+	reshaped := append([]NamedTensor(nil), file.Tensors...)
+	last := reshaped[len(reshaped)-1]
+	reshaped[len(reshaped)-1] = NamedTensor{Name: last.Name, Shape: []int{1, len(last.Data)}, Data: last.Data}
+
+	tests := []struct {
+		name    string
+		tensors []NamedTensor
+		wantErr string
+	}{
+		{"reordered", reversed, ""},
+		{"renamed", renamed, "no tensor for weight conv1_w"},
+		{"reshaped", reshaped, "shape mismatch"},
+		{"missing", file.Tensors[1:], "tensors"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+TensorFileExt)
+			if err := WriteTensorFile(path, metadata, tt.tensors); err != nil {
+				t.Fatalf("Failed to write tensor file: %v", err)
+			}
+			err := cnn.LoadModel(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Error = %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A flipped data byte fails the checksum
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	content[len(content)-1] ^= 0xFF
+	corrupt := filepath.Join(dir, "corrupt"+TensorFileExt)
+	if err := os.WriteFile(corrupt, content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := cnn.LoadModel(corrupt); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Error = %v; want checksum mismatch", err)
+	}
+
+	// A header that lost its checksum is not loaded unverified
+	content[len(content)-1] ^= 0xFF
+	size := binary.LittleEndian.Uint64(content)
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(content[8:8+size], &header); err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	delete(metadata, "sha256")
+	if header[tensorMetadataKey], err = json.Marshal(metadata); err != nil {
+		t.Fatalf("Failed to encode metadata: %v", err)
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("Failed to encode header: %v", err)
+	}
+	stripped := binary.LittleEndian.AppendUint64(nil, uint64(len(headerJSON)))
+	stripped = append(append(stripped, headerJSON...), content[8+size:]...)
+	unverified := filepath.Join(dir, "unverified"+TensorFileExt)
+	if err := os.WriteFile(unverified, stripped, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := cnn.LoadModel(unverified); err == nil || !strings.Contains(err.Error(), "no sha256 checksum") {
+		t.Errorf("Error = %v; want missing checksum", err)
+	}
+}
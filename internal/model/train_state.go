@@ -0,0 +1,180 @@
+package model
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+)
+
+// TrainingState is a resumable snapshot of a training run. Besides the
+// weights it holds the optimizer moments and all loop state, so a run resumed
+// from it follows the same trajectory as one that was never interrupted.
+type TrainingState struct {
+	Config   TrainingConfig // Config of the run, with the seed in use
+	Metadata ModelMetadata
+	Weights  []WeightData
+
+	Optimizer     AdamState
+	SchedulerStep int
+	SchedulerLR   float64
+
+	Epoch        int   // Completed epochs
+	Seed         int64 // Seed of the initial weights, split, shuffling and augmentation
+	TotalSamples int   // Dataset size the split was made for
+	TrainIndices []int // Training indices in their current shuffled order
+	ValIndices   []int
+
+	BestValLoss  float64
+	PatienceLeft int
+
+	// Registry ID of the run's newest checkpoint and its epoch
+	LastCheckpoint  string
+	RegisteredEpoch int
+
+	Metrics []TrainingMetrics
+}
+
+// WeightData is the shape and data of one learnable
+type WeightData struct {
+	Shape []int
+	Data  []float64
+}
+
+// State captures the trainer's current training state
+func (t *Trainer) State() (*TrainingState, error) {
+	config := *t.config
+	config.Seed = t.seed
+
+	learnables := t.model.Learnables()
+	weights := make([]WeightData, len(learnables))
+	for i, w := range learnables {
+		val := w.Value()
+		if val == nil {
+			return nil, fmt.Errorf("weight %d has nil value", i)
+		}
+		weights[i] = WeightData{
+			Shape: append([]int(nil), val.Shape()...),
+			Data:  append([]float64(nil), val.Data().([]float64)...),
+		}
+	}
+
+	return &TrainingState{
+		Config:          config,
+		Metadata:        t.model.Metadata(),
+		Weights:         weights,
+		Optimizer:       t.optimizer.State(),
+		SchedulerStep:   t.scheduler.CurrentStep(),
+		SchedulerLR:     t.scheduler.GetCurrentLR(),
+		Epoch:           t.epoch,
+		Seed:            t.seed,
+		TotalSamples:    t.totalSamples,
+		TrainIndices:    append([]int(nil), t.trainIndices...),
+		ValIndices:      append([]int(nil), t.valIndices...),
+		BestValLoss:     t.bestValLoss,
+		PatienceLeft:    t.patienceLeft,
+		LastCheckpoint:  t.lastCheckpoint,
+		RegisteredEpoch: t.registeredEpoch,
+		Metrics:         append([]TrainingMetrics(nil), t.metrics...),
+	}, nil
+}
+
+// SaveState writes the trainer's training state to path
+func (t *Trainer) SaveState(path string) error {
+	state, err := t.State()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted save keeps the old state
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if err := gob.NewEncoder(f).Encode(state); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to encode training state: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write training state: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadTrainingState reads a training state written by SaveState
+func LoadTrainingState(path string) (*TrainingState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	var state TrainingState
+	if err := gob.NewDecoder(f).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode training state: %w", err)
+	}
+	return &state, nil
+}
+
+// NewTrainerFromState creates a trainer from a saved training state. The
+// trainer uses state.Config, which callers may adjust first (e.g. raise
+// Epochs to train further than the original run).
+func NewTrainerFromState(state *TrainingState) (*Trainer, error) {
+	config := state.Config
+	config.Seed = state.Seed
+
+	trainer, err := NewTrainer(&config)
+	if err != nil {
+		return nil, err
+	}
+	if err := trainer.RestoreState(state); err != nil {
+		trainer.Close()
+		trainer.GetModel().Close()
+		return nil, err
+	}
+	return trainer, nil
+}
+
+// RestoreState loads the weights, optimizer and loop state of a saved
+// training state into the trainer. The trainer's model must match the
+// state's architecture and layout.
+func (t *Trainer) RestoreState(state *TrainingState) error {
+	if err := checkMetadata(state.Metadata, t.model); err != nil {
+		return err
+	}
+
+	learnables := t.model.Learnables()
+	if len(state.Weights) != len(learnables) {
+		return fmt.Errorf("training state has %d weights, model has %d", len(state.Weights), len(learnables))
+	}
+	for i, w := range learnables {
+		weights := w.Value().Data().([]float64)
+		if len(state.Weights[i].Data) != len(weights) {
+			return fmt.Errorf("weight %d (%s) shape mismatch: state has %v, model has %v",
+				i, w.Name(), state.Weights[i].Shape, w.Shape())
+		}
+	}
+
+	if err := t.optimizer.Restore(state.Optimizer); err != nil {
+		return err
+	}
+	for i, w := range learnables {
+		copy(w.Value().Data().([]float64), state.Weights[i].Data)
+	}
+
+	t.scheduler.Restore(state.SchedulerStep, state.SchedulerLR)
+	t.epoch = state.Epoch
+	t.seed = state.Seed
+	t.totalSamples = state.TotalSamples
+	t.trainIndices = append([]int(nil), state.TrainIndices...)
+	t.valIndices = append([]int(nil), state.ValIndices...)
+	t.bestValLoss = state.BestValLoss
+	t.patienceLeft = state.PatienceLeft
+	t.lastCheckpoint = state.LastCheckpoint
+	t.registeredEpoch = state.RegisteredEpoch
+	t.metrics = append([]TrainingMetrics(nil), state.Metrics...)
+
+	return nil
+}
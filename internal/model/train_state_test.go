@@ -0,0 +1,256 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
+)
+
+// trainRunners are the entry points that run the training loop
+var trainRunners = []struct {
+	name string
+	run  func(t *testing.T, trainer *Trainer, dataset *data.Dataset) error
+}{
+	{"Train", func(t *testing.T, trainer *Trainer, dataset *data.Dataset) error {
+		return trainer.Train(dataset)
+	}},
+	{"TrainWithCallback", func(t *testing.T, trainer *Trainer, dataset *data.Dataset) error {
+		first, epochs := len(trainer.GetMetrics()), 0
+		err := trainer.TrainWithCallback(dataset, func(metrics TrainingMetrics) {
+			epochs++
+			if metrics != trainer.GetMetrics()[first+epochs-1] {
+				t.Errorf("Callback got metrics %+v for epoch %d", metrics, metrics.Epoch)
+			}
+		})
+		if err == nil && epochs != len(trainer.GetMetrics())-first {
+			t.Errorf("Callback ran for %d of %d epochs", epochs, len(trainer.GetMetrics())-first)
+		}
+		return err
+	}},
+}
+
+func TestResumeMatchesUninterruptedTraining(t *testing.T) {
+	for _, runner := range trainRunners {
+		t.Run(runner.name, func(t *testing.T) {
+			testResumeMatchesUninterruptedTraining(t, runner.run)
+		})
+	}
+}
+
+func testResumeMatchesUninterruptedTraining(t *testing.T, run func(*testing.T, *Trainer, *data.Dataset) error) {
+	dir := t.TempDir()
+	dataset := newOpeningDataset(t, filepath.Join(dir, "train.db"))
+
+	config := DefaultTrainingConfig()
+	config.Epochs = 2
+	config.BatchSize = 2
+	config.Verbose = false
+	config.SaveInterval = 0
+	config.SavePath = ""
+	config.StatePath = filepath.Join(dir, "run.state")
+	config.ValidationSplit = 0.25
+	config.EarlyStopPatience = 3
+	config.WarmupEpochs = 3
+	config.Seed = 42
+
+	interrupted, err := NewTrainer(config)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer interrupted.GetModel().Close()
+
+	initial, err := interrupted.State()
+	if err != nil {
+		t.Fatalf("Failed to capture initial state: %v", err)
+	}
+	if err := run(t, interrupted, dataset); err != nil {
+		t.Fatalf("Failed to train: %v", err)
+	}
+
+	// Resume the interrupted run for two more epochs
+	saved, err := LoadTrainingState(config.StatePath)
+	if err != nil {
+		t.Fatalf("Failed to load training state: %v", err)
+	}
+	if saved.Epoch != 2 || saved.Seed != 42 || len(saved.Metrics) != 2 || saved.Optimizer.Iter == 0 {
+		t.Fatalf("Unexpected saved state: epoch %d, seed %d, %d metrics, %d optimizer steps",
+			saved.Epoch, saved.Seed, len(saved.Metrics), saved.Optimizer.Iter)
+	}
+	saved.Config.Epochs = 4
+	saved.Config.StatePath = ""
+	resumed, err := NewTrainerFromState(saved)
+	if err != nil {
+		t.Fatalf("Failed to resume trainer: %v", err)
+	}
+	defer resumed.GetModel().Close()
+	if err := run(t, resumed, dataset); err != nil {
+		t.Fatalf("Failed to train resumed run: %v", err)
+	}
+
+	// Run all four epochs from the same initial weights without interruption
+	initial.Config.Epochs = 4
+	initial.Config.StatePath = ""
+	uninterrupted, err := NewTrainerFromState(initial)
+	if err != nil {
+		t.Fatalf("Failed to create trainer: %v", err)
+	}
+	defer uninterrupted.GetModel().Close()
+	if err := run(t, uninterrupted, dataset); err != nil {
+		t.Fatalf("Failed to train uninterrupted run: %v", err)
+	}
+
+	resumedMetrics, uninterruptedMetrics := resumed.GetMetrics(), uninterrupted.GetMetrics()
+	if len(resumedMetrics) != 4 || len(uninterruptedMetrics) != 4 {
+		t.Fatalf("Expected 4 epochs of metrics, got %d and %d", len(resumedMetrics), len(uninterruptedMetrics))
+	}
+	for i := range resumedMetrics {
+		r, u := resumedMetrics[i], uninterruptedMetrics[i]
+		if r.Loss != u.Loss || r.ValLoss != u.ValLoss || r.LearningRate != u.LearningRate {
+			t.Errorf("Epoch %d: resumed loss %v/%v lr %v, uninterrupted loss %v/%v lr %v",
+				i+1, r.Loss, r.ValLoss, r.LearningRate, u.Loss, u.ValLoss, u.LearningRate)
+		}
+	}
+
+	resumedWeights := resumed.GetModel().Learnables()
+	for i, w := range uninterrupted.GetModel().Learnables() {
+		want := w.Value().Data().([]float64)
+		got := resumedWeights[i].Value().Data().([]float64)
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("Weight %s[%d] = %v after resuming, %v uninterrupted", w.Name(), j, got[j], want[j])
+			}
+		}
+	}
+}
+
+func TestSeededTrainingIsReproducible(t *testing.T) {
+	for _, runner := range trainRunners {
+		t.Run(runner.name, func(t *testing.T) {
+			testSeededTrainingIsReproducible(t, runner.run)
+		})
+	}
+}
+
+func testSeededTrainingIsReproducible(t *testing.T, run func(*testing.T, *Trainer, *data.Dataset) error) {
+	dir := t.TempDir()
+	dataset := newOpeningDataset(t, filepath.Join(dir, "train.db"))
+
+	train := func(seed int64) *Trainer {
+		config := DefaultTrainingConfig()
+		config.Epochs = 2
+		config.BatchSize = 2
+		config.Verbose = false
+		config.SaveInterval = 0
+		config.SavePath = ""
+		config.ValidationSplit = 0.25
+		config.Seed = seed
+
+		trainer, err := NewTrainer(config)
+		if err != nil {
+			t.Fatalf("Failed to create trainer: %v", err)
+		}
+		t.Cleanup(func() { trainer.GetModel().Close() })
+		if err := run(t, trainer, dataset); err != nil {
+			t.Fatalf("Failed to train: %v", err)
+		}
+		return trainer
+	}
+	weights := func(m ChessModel) [][]float64 {
+		var all [][]float64
+		for _, w := range m.Learnables() {
+			all = append(all, w.Value().Data().([]float64))
+		}
+		return all
+	}
+
+	first, second, other := train(7), train(7), train(8)
+	a, b, c := weights(first.GetModel()), weights(second.GetModel()), weights(other.GetModel())
+	differs := false
+	for i := range a {
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				t.Fatalf("Weight %d[%d] = %v and %v in two runs with the same seed", i, j, a[i][j], b[i][j])
+			}
+			differs = differs || a[i][j] != c[i][j]
+		}
+	}
+	if !differs {
+		t.Error("Runs with different seeds trained identical weights")
+	}
+
+	// The seed is recorded in both checkpoint formats
+	for _, name := range []string{"seeded.gob", "seeded" + TensorFileExt} {
+		path := filepath.Join(dir, name)
+		if err := first.GetModel().SaveModel(path); err != nil {
+			t.Fatalf("Failed to save %s: %v", name, err)
+		}
+		metadata, err := ReadModelMetadata(path)
+		if err != nil {
+			t.Fatalf("Failed to read metadata of %s: %v", name, err)
+		}
+		if metadata.Seed != 7 {
+			t.Errorf("%s records seed %d, want 7", name, metadata.Seed)
+		}
+		loaded, err := LoadChessModel(path)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", name, err)
+		}
+		if loaded.Metadata().Seed != 7 {
+			t.Errorf("Model loaded from %s has seed %d, want 7", name, loaded.Metadata().Seed)
+		}
+		loaded.Close()
+	}
+
+	// Seeded residual networks start from the same weights too
+	config := DefaultCNNConfig()
+	config.Seed = 7
+	resnetA, err := NewImprovedChessCNNWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer resnetA.Close()
+	resnetB, err := NewImprovedChessCNNWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer resnetB.Close()
+	a, b = weights(resnetA), weights(resnetB)
+	for i := range a {
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				t.Fatalf("ResNet weight %d[%d] differs between models with the same seed", i, j)
+			}
+		}
+	}
+}
+
+// newOpeningDataset creates a dataset of the positions and moves of a short opening
+func newOpeningDataset(t *testing.T, path string) *data.Dataset {
+	t.Helper()
+
+	dataset, err := data.NewDataset(path)
+	if err != nil {
+		t.Fatalf("Failed to create dataset: %v", err)
+	}
+	t.Cleanup(func() { dataset.Close() })
+
+	game := chess.NewGame()
+	for _, move := range []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Ba4", "Nf6"} {
+		pos := game.Position()
+		if err := game.MoveStr(move); err != nil {
+			t.Fatalf("Failed to play %s: %v", move, err)
+		}
+		played := game.Moves()[len(game.Moves())-1]
+		state, err := data.TensorizePosition(pos, data.DefaultInputChannels)
+		if err != nil {
+			t.Fatalf("Failed to tensorize position: %v", err)
+		}
+		entry := &data.DataEntry{StateTensor: state, FromSquare: int(played.S1()), ToSquare: int(played.S2())}
+		if err := dataset.Add(entry); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+	return dataset
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 
 	"github.com/thyrook/partner/internal/data"
@@ -15,8 +16,6 @@ type TrainingConfig struct {
 	Epochs          int
 	BatchSize       int
 	LearningRate    float64
-	LRDecayRate     float64 // Learning rate decay per epoch
-	LRDecaySteps    int     // Decay every N epochs
 	GradientClipMax float64
 	Verbose         bool
 	SaveInterval    int // Save model every N epochs
@@ -26,10 +25,54 @@ type TrainingConfig struct {
 	ValidationSplit   float64 // Fraction of data for validation (0.0-1.0)
 	GradAccumSteps    int     // Accumulate gradients over N batches (effective batch size = BatchSize * GradAccumSteps)
 	EarlyStopPatience int     // Stop if no improvement for N epochs (0 = disabled)
-	NumWorkers        int     // Number of parallel data loaders (0 = sequential)
+	NumWorkers        int     // Background data loader goroutines (0 = load on the training goroutine)
+	PrefetchDepth     int     // Batches the loader keeps ready ahead of training (0 = 2 * NumWorkers)
 	ShuffleBatches    bool    // Shuffle batches each epoch
 	WeightDecay       float64 // L2 regularization strength
 	WarmupEpochs      int     // Linear warmup for this many epochs
+
+	// Model layout (zero values = data.DefaultInputChannels / data.DefaultMoveEncoding)
+	InputChannels int
+	MoveEncoding  data.MoveEncoding
+
+	// Architecture selects the network (zero value = DefaultArchitecture)
+	Architecture Architecture
+
+	// ValueLossWeight scales the value loss for models with a value head (0 = 1.0)
+	ValueLossWeight float64
+
+	// LabelSmoothing mixes this fraction of a uniform distribution into every
+	// policy target (0 = disabled)
+	LabelSmoothing float64
+
+	// Distillation: TeacherPath loads a teacher checkpoint whose policy,
+	// softened by DistillTemperature (0 = DefaultDistillTemperature), makes up
+	// DistillWeight (0 = DefaultDistillWeight) of every policy target. The
+	// rest is the ground-truth target, so the loss is a weighted mix of
+	// teacher KL divergence and ground-truth cross-entropy.
+	TeacherPath        string
+	DistillTemperature float64
+	DistillWeight      float64
+
+	// LegalMovesOnly computes the policy loss over legal moves only: illegal
+	// logits of each position (rebuilt from its state tensor) are masked
+	// before the softmax and target mass on illegal moves is dropped
+	LegalMovesOnly bool
+
+	// Seed drives the initial weights, train/val split, shuffling and
+	// augmentation (0 = time-based; the seed in use is recorded in the
+	// training state and checkpoint metadata)
+	Seed int64
+
+	// StatePath receives a resumable training state (see TrainingState)
+	// with every model save ("" = disabled)
+	StatePath string
+
+	// RegistryDir keeps every saved checkpoint in a Registry, so a late
+	// overfit epoch never replaces the best one ("" = disabled).
+	// ParentCheckpoint is the registry ID the run's weights start from.
+	RegistryDir      string
+	ParentCheckpoint string
 }
 
 // DefaultTrainingConfig returns default training configuration
@@ -38,8 +81,6 @@ func DefaultTrainingConfig() *TrainingConfig {
 		Epochs:            10,
 		BatchSize:         64,
 		LearningRate:      0.001,
-		LRDecayRate:       0.95,
-		LRDecaySteps:      2,
 		GradientClipMax:   5.0,
 		Verbose:           true,
 		SaveInterval:      5,
@@ -51,6 +92,10 @@ func DefaultTrainingConfig() *TrainingConfig {
 		ShuffleBatches:    true,   // Shuffle enabled
 		WeightDecay:       0.0001, // Small L2 regularization
 		WarmupEpochs:      0,      // No warmup by default
+		InputChannels:     data.DefaultInputChannels,
+		MoveEncoding:      data.DefaultMoveEncoding,
+		Architecture:      DefaultArchitecture,
+		ValueLossWeight:   1.0,
 	}
 }
 
@@ -62,28 +107,64 @@ type TrainingMetrics struct {
 	LearningRate float64
 	Duration     time.Duration
 	SamplesSeen  int
+
+	// Validation split results (zero when there is no validation split)
+	ValLoss          float64
+	ValAccuracy      float64
+	TeacherAgreement float64 // Top-1 agreement between student and teacher (distillation only)
+
+	// LoaderStall is the time training waited on the data loader. Close to
+	// the epoch's training time, the run is I/O bound; close to zero, compute
+	// bound.
+	LoaderStall time.Duration
 }
 
 // Trainer manages the training process
 type Trainer struct {
-	model      *ChessCNN
+	model      ChessModel
 	config     *TrainingConfig
-	solver     gorgonia.Solver
+	optimizer  *AdamOptimizer
 	scheduler  LRScheduler
 	metrics    []TrainingMetrics
 	targetNode *gorgonia.Node
 	lossNode   *gorgonia.Node
 
-	// Optimization state
-	inputBuffer  []float64 // Reusable input buffer
-	targetBuffer []float64 // Reusable target buffer
-	bestValLoss  float64   // Best validation loss for early stopping
-	patienceLeft int       // Epochs left before early stopping
-	accumStep    int       // Current gradient accumulation step
+	// Value head targets (nil for models without a value head)
+	valueTargetNode *gorgonia.Node
+	valueMaskNode   *gorgonia.Node
+
+	// Logit bias masking illegal moves (nil unless LegalMovesOnly)
+	legalBiasNode *gorgonia.Node
+
+	// Teacher for distillation (nil when not distilling)
+	distiller         *Distiller
+	agreements, total int // Validation top-1 agreement with the teacher
+
+	loaderStall time.Duration // Time the last epoch waited on the data loader
 
-	// Training/validation split indices
+	// Optimization state
+	buffers      *batchBuffers // Reusable batch buffers
+	bestValLoss  float64       // Best validation loss for early stopping
+	patienceLeft int           // Epochs left before early stopping
+	accumStep    int           // Current gradient accumulation step
+	epoch        int           // Completed epochs
+	seed         int64         // Seed of the initial weights, split, shuffling and augmentation
+
+	// Checkpoint registry (nil when disabled)
+	registry        *Registry
+	lastCheckpoint  string // Registry ID of the run's newest checkpoint
+	registeredEpoch int    // Epoch of lastCheckpoint
+	datasetPath     string
+	datasetHash     string
+
+	// Training/validation split indices (totalSamples = 0 until split)
 	trainIndices []int
 	valIndices   []int
+	totalSamples int
+
+	// Model layout
+	inputChannels int
+	policySize    int
 }
 
 // NewTrainer creates a new trainer with a model that supports the specified batch size
@@ -92,41 +173,122 @@ func NewTrainer(config *TrainingConfig) (*Trainer, error) {
 		config = DefaultTrainingConfig()
 	}
 
-	// Create model with batch size from config
-	model, err := NewChessCNNWithBatchSize(config.BatchSize)
+	if config.InputChannels == 0 {
+		config.InputChannels = data.DefaultInputChannels
+	}
+	if config.MoveEncoding == "" {
+		config.MoveEncoding = data.DefaultMoveEncoding
+	}
+
+	if config.Architecture == "" {
+		config.Architecture = DefaultArchitecture
+	}
+	if config.ValueLossWeight == 0 {
+		config.ValueLossWeight = 1.0
+	}
+	if config.LabelSmoothing < 0 || config.LabelSmoothing >= 1 {
+		return nil, fmt.Errorf("label smoothing must be in [0, 1), got %v", config.LabelSmoothing)
+	}
+	if config.DistillTemperature == 0 {
+		config.DistillTemperature = DefaultDistillTemperature
+	}
+	if config.DistillWeight == 0 {
+		config.DistillWeight = DefaultDistillWeight
+	}
+	if config.DistillWeight < 0 || config.DistillWeight > 1 {
+		return nil, fmt.Errorf("distillation weight must be in [0, 1], got %v", config.DistillWeight)
+	}
+
+	var registry *Registry
+	if config.RegistryDir != "" {
+		var err error
+		if registry, err = OpenRegistry(config.RegistryDir); err != nil {
+			return nil, err
+		}
+	}
+
+	var distiller *Distiller
+	if config.TeacherPath != "" {
+		var err error
+		if distiller, err = NewDistiller(config.TeacherPath, config.DistillTemperature); err != nil {
+			return nil, err
+		}
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	// Create model with batch size and layout from config; the seed also
+	// draws its initial weights
+	model, err := NewChessModel(config.Architecture, CNNConfig{
+		BatchSize:     config.BatchSize,
+		InputChannels: config.InputChannels,
+		MoveEncoding:  config.MoveEncoding,
+		Seed:          seed,
+	})
 	if err != nil {
+		if distiller != nil {
+			distiller.Close()
+		}
 		return nil, fmt.Errorf("failed to create model: %w", err)
 	}
 
-	// Create Adam solver
-	solver := gorgonia.NewAdamSolver(
-		gorgonia.WithLearnRate(config.LearningRate),
-		gorgonia.WithBatchSize(float64(config.BatchSize)),
-		gorgonia.WithClip(config.GradientClipMax),
-	)
+	// Create Adam optimizer; gradients are averaged over the accumulated batch
+	optimizer := NewAdamOptimizer(config.LearningRate,
+		float64(config.BatchSize*config.GradAccumSteps), config.GradientClipMax)
+
+	nodes := model.graph()
 
 	// Create target node for training
 	targetNode := gorgonia.NewMatrix(
-		model.g,
+		nodes.g,
 		tensor.Float64,
-		gorgonia.WithShape(config.BatchSize, 4096),
+		gorgonia.WithShape(config.BatchSize, model.PolicySize()),
 		gorgonia.WithName("target"),
 	)
 
-	// Create loss node
-	lossNode, err := model.ComputeLoss(targetNode)
+	// Create loss node, restricting the softmax to legal moves if requested
+	var lossNode, legalBiasNode *gorgonia.Node
+	if config.LegalMovesOnly {
+		legalBiasNode = gorgonia.NewMatrix(nodes.g, tensor.Float64,
+			gorgonia.WithShape(config.BatchSize, model.PolicySize()),
+			gorgonia.WithName("legal_bias"))
+		lossNode, err = LegalPolicyLoss(nodes.logits, targetNode, legalBiasNode)
+	} else {
+		lossNode, err = PolicyLoss(nodes.policy, targetNode)
+	}
 	if err != nil {
+		closeTrainerModels(model, distiller)
 		return nil, fmt.Errorf("failed to create loss node: %w", err)
 	}
 
+	// Add the value loss for models with a value head
+	var valueTargetNode, valueMaskNode *gorgonia.Node
+	if nodes.value != nil {
+		valueTargetNode = gorgonia.NewMatrix(nodes.g, tensor.Float64,
+			gorgonia.WithShape(config.BatchSize, 1),
+			gorgonia.WithName("value_target"))
+		valueMaskNode = gorgonia.NewMatrix(nodes.g, tensor.Float64,
+			gorgonia.WithShape(config.BatchSize, 1),
+			gorgonia.WithName("value_mask"))
+
+		lossNode, err = JointLoss(lossNode, nodes.value, valueTargetNode, valueMaskNode, config.ValueLossWeight)
+		if err != nil {
+			closeTrainerModels(model, distiller)
+			return nil, fmt.Errorf("failed to create value loss node: %w", err)
+		}
+	}
+
 	// Compute gradients
 	if _, err := gorgonia.Grad(lossNode, model.Learnables()...); err != nil {
+		closeTrainerModels(model, distiller)
 		return nil, fmt.Errorf("failed to compute gradients: %w", err)
 	}
 
 	// Recreate VM now that we have the full graph including loss and gradients
-	model.vm.Close()
-	model.vm = gorgonia.NewTapeMachine(model.g)
+	model.compile()
 
 	// Create learning rate scheduler
 	// Estimate total steps: epochs * (samples / batch_size)
@@ -138,28 +300,114 @@ func NewTrainer(config *TrainingConfig) (*Trainer, error) {
 		1000,                     // total steps (will be updated)
 	)
 
-	// Pre-allocate buffers for efficiency
-	inputBuffer := make([]float64, config.BatchSize*12*8*8)
-	targetBuffer := make([]float64, config.BatchSize*4096)
-
 	return &Trainer{
-		model:        model,
-		config:       config,
-		solver:       solver,
-		scheduler:    scheduler,
-		metrics:      make([]TrainingMetrics, 0, config.Epochs),
-		targetNode:   targetNode,
-		lossNode:     lossNode,
-		inputBuffer:  inputBuffer,
-		targetBuffer: targetBuffer,
-		bestValLoss:  math.Inf(1), // Initialize to infinity
-		patienceLeft: config.EarlyStopPatience,
-		accumStep:    0,
+		model:           model,
+		config:          config,
+		optimizer:       optimizer,
+		scheduler:       scheduler,
+		metrics:         make([]TrainingMetrics, 0, config.Epochs),
+		targetNode:      targetNode,
+		lossNode:        lossNode,
+		valueTargetNode: valueTargetNode,
+		valueMaskNode:   valueMaskNode,
+		legalBiasNode:   legalBiasNode,
+		distiller:       distiller,
+		registry:        registry,
+		lastCheckpoint:  config.ParentCheckpoint,
+		buffers:         newBatchBuffers(config.BatchSize, config.InputChannels, model.PolicySize()),
+		bestValLoss:     math.Inf(1), // Initialize to infinity
+		patienceLeft:    config.EarlyStopPatience,
+		accumStep:       0,
+		seed:            seed,
+		inputChannels:   config.InputChannels,
+		policySize:      model.PolicySize(),
 	}, nil
 }
 
+// closeTrainerModels releases the models created by NewTrainer after a failure
+func closeTrainerModels(model ChessModel, distiller *Distiller) {
+	model.Close()
+	if distiller != nil {
+		distiller.Close()
+	}
+}
+
+// PolicyLoss computes categorical cross-entropy between policy probabilities and targets
+func PolicyLoss(policy, target *gorgonia.Node) (*gorgonia.Node, error) {
+	// Cross-entropy loss: -sum(target * log(output))
+	logProbs, err := gorgonia.Log(policy)
+	if err != nil {
+		return nil, err
+	}
+	loss, err := gorgonia.HadamardProd(target, logProbs)
+	if err != nil {
+		return nil, err
+	}
+	loss, err = gorgonia.Sum(loss)
+	if err != nil {
+		return nil, err
+	}
+	return gorgonia.Neg(loss)
+}
+
+// illegalLogitBias is added to the logits of illegal moves by LegalPolicyLoss.
+// It leaves them a probability below 1e-40, which is masked for any
+// practical purpose while keeping log(p) finite for the cross-entropy.
+const illegalLogitBias = -100.0
+
+// LegalPolicyLoss is the cross-entropy of PolicyLoss against a softmax over
+// logits + bias, where bias is 0 for legal moves and illegalLogitBias for
+// illegal ones. Rows with an all-zero bias (padding, unknown positions) use
+// the full softmax. Targets must not put mass on illegal moves.
+func LegalPolicyLoss(logits, target, bias *gorgonia.Node) (*gorgonia.Node, error) {
+	// Bias first: Add may reuse its first operand's memory, and the logits
+	// still feed the model's own softmax
+	masked, err := gorgonia.Add(bias, logits)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := gorgonia.SoftMax(masked)
+	if err != nil {
+		return nil, err
+	}
+	return PolicyLoss(policy, target)
+}
+
+// JointLoss adds the masked squared error between the value head and the game
+// outcome to the policy loss: policyLoss + weight * sum(mask * (value - outcome)^2).
+// The mask zeroes samples with an unknown outcome and batch padding.
+func JointLoss(policyLoss, value, outcome, mask *gorgonia.Node, weight float64) (*gorgonia.Node, error) {
+	diff, err := gorgonia.Sub(value, outcome)
+	if err != nil {
+		return nil, err
+	}
+	sq, err := gorgonia.Square(diff)
+	if err != nil {
+		return nil, err
+	}
+	masked, err := gorgonia.HadamardProd(sq, mask)
+	if err != nil {
+		return nil, err
+	}
+	valueLoss, err := gorgonia.Sum(masked)
+	if err != nil {
+		return nil, err
+	}
+	scaled, err := gorgonia.Mul(valueLoss, gorgonia.NewConstant(weight))
+	if err != nil {
+		return nil, err
+	}
+	return gorgonia.Add(policyLoss, scaled)
+}
+
 // Train trains the model on the dataset
 func (t *Trainer) Train(dataset *data.Dataset) error {
+	return t.train(dataset, nil)
+}
+
+// train runs the training loop, calling callback with the metrics of each
+// epoch when it is not nil
+func (t *Trainer) train(dataset *data.Dataset, callback func(TrainingMetrics)) error {
 	if dataset == nil {
 		return fmt.Errorf("dataset is nil")
 	}
@@ -174,15 +422,25 @@ func (t *Trainer) Train(dataset *data.Dataset) error {
 		return fmt.Errorf("dataset is empty")
 	}
 
+	if err := t.checkDatasetFormat(dataset); err != nil {
+		return err
+	}
+	if err := t.identifyDataset(dataset); err != nil {
+		return err
+	}
+
 	if t.config.Verbose {
 		fmt.Printf("Starting training with %d samples\n", totalSamples)
 		fmt.Printf("Epochs: %d, Batch size: %d, Learning rate: %.6f\n",
 			t.config.Epochs, t.config.BatchSize, t.config.LearningRate)
+		if t.epoch > 0 {
+			fmt.Printf("Resuming after epoch %d\n", t.epoch)
+		}
 		fmt.Println()
 	}
 
-	// Split train/validation if needed
-	if err := t.splitTrainVal(totalSamples); err != nil {
+	// Split train/validation unless resuming
+	if err := t.prepareSplit(totalSamples); err != nil {
 		return fmt.Errorf("failed to split train/val: %w", err)
 	}
 
@@ -194,19 +452,15 @@ func (t *Trainer) Train(dataset *data.Dataset) error {
 	}
 
 	// Training loop
-	for epoch := 0; epoch < t.config.Epochs; epoch++ {
+	for epoch := t.epoch; epoch < t.config.Epochs; epoch++ {
 		startTime := time.Now()
 
 		// Update learning rate using scheduler with warmup
 		currentLR := t.getLearningRate(epoch)
-		t.solver = gorgonia.NewAdamSolver(
-			gorgonia.WithLearnRate(currentLR),
-			gorgonia.WithBatchSize(float64(t.config.BatchSize*t.config.GradAccumSteps)),
-			gorgonia.WithClip(t.config.GradientClipMax),
-		)
+		t.optimizer.SetLearningRate(currentLR)
 
 		// Train one epoch
-		epochLoss, accuracy, samplesSeen, err := t.trainEpoch(dataset, trainSamples)
+		epochLoss, accuracy, samplesSeen, err := t.trainEpoch(dataset, trainSamples, t.epochRand(epoch))
 		if err != nil {
 			if t.config.Verbose {
 				fmt.Printf("Warning: Epoch %d had errors: %v\n", epoch+1, err)
@@ -230,14 +484,23 @@ func (t *Trainer) Train(dataset *data.Dataset) error {
 
 		// Record metrics
 		metrics := TrainingMetrics{
-			Epoch:        epoch + 1,
-			Loss:         epochLoss,
-			Accuracy:     accuracy,
-			LearningRate: currentLR,
-			Duration:     duration,
-			SamplesSeen:  samplesSeen,
+			Epoch:            epoch + 1,
+			Loss:             epochLoss,
+			Accuracy:         accuracy,
+			LearningRate:     currentLR,
+			Duration:         duration,
+			SamplesSeen:      samplesSeen,
+			ValLoss:          valLoss,
+			ValAccuracy:      valAcc,
+			TeacherAgreement: t.teacherAgreement(),
+			LoaderStall:      t.loaderStall,
 		}
 		t.metrics = append(t.metrics, metrics)
+		t.epoch = epoch + 1
+
+		if callback != nil {
+			callback(metrics)
+		}
 
 		// Print progress
 		if t.config.Verbose {
@@ -247,9 +510,12 @@ func (t *Trainer) Train(dataset *data.Dataset) error {
 
 			if valSamples > 0 {
 				fmt.Printf(" - Val Loss: %.4f - Val Acc: %.2f%%", valLoss, valAcc*100)
+				if t.distiller != nil {
+					fmt.Printf(" - Teacher Agreement: %.2f%%", metrics.TeacherAgreement*100)
+				}
 			}
 
-			fmt.Printf(" - %v\n", duration)
+			fmt.Printf(" - %v (loader stall %v)\n", duration, t.loaderStall.Round(time.Millisecond))
 		}
 
 		// Early stopping check
@@ -274,7 +540,7 @@ func (t *Trainer) Train(dataset *data.Dataset) error {
 
 		// Save checkpoint
 		if t.config.SaveInterval > 0 && (epoch+1)%t.config.SaveInterval == 0 {
-			if err := t.model.SaveModel(t.config.SavePath); err != nil {
+			if err := t.saveProgress(); err != nil {
 				fmt.Printf("Warning: Failed to save checkpoint: %v\n", err)
 			} else if t.config.Verbose {
 				fmt.Printf("  ✓ Checkpoint saved to %s\n", t.config.SavePath)
@@ -283,15 +549,119 @@ func (t *Trainer) Train(dataset *data.Dataset) error {
 	}
 
 	// Final save
+	if err := t.saveProgress(); err != nil {
+		return fmt.Errorf("failed to save final model: %w", err)
+	}
+	if t.config.Verbose && t.config.SavePath != "" {
+		fmt.Printf("\nModel saved to %s\n", t.config.SavePath)
+	}
+
+	return nil
+}
+
+// saveProgress saves the model to SavePath, registers it as a checkpoint
+// and saves the training state to StatePath, skipping each step that is not
+// configured
+func (t *Trainer) saveProgress() error {
 	if t.config.SavePath != "" {
 		if err := t.model.SaveModel(t.config.SavePath); err != nil {
-			return fmt.Errorf("failed to save final model: %w", err)
+			return err
 		}
-		if t.config.Verbose {
-			fmt.Printf("\nModel saved to %s\n", t.config.SavePath)
+	}
+	if err := t.registerCheckpoint(); err != nil {
+		return err
+	}
+	if t.config.StatePath != "" {
+		if err := t.SaveState(t.config.StatePath); err != nil {
+			return fmt.Errorf("failed to save training state: %w", err)
+		}
+	}
+	return nil
+}
+
+// registerCheckpoint adds the model to the registry with the metrics of the
+// last epoch, once per epoch
+func (t *Trainer) registerCheckpoint() error {
+	if t.registry == nil || len(t.metrics) == 0 || t.registeredEpoch == t.epoch {
+		return nil
+	}
+
+	config := *t.config
+	config.Seed = t.seed
+	last := t.metrics[len(t.metrics)-1]
+	record, err := t.registry.Register(t.model, CheckpointRecord{
+		Epoch:         t.epoch,
+		TrainLoss:     last.Loss,
+		TrainAccuracy: last.Accuracy,
+		ValLoss:       last.ValLoss,
+		ValAccuracy:   last.ValAccuracy,
+		DatasetPath:   t.datasetPath,
+		DatasetHash:   t.datasetHash,
+		Parent:        t.lastCheckpoint,
+		Config:        config,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register checkpoint: %w", err)
+	}
+
+	t.lastCheckpoint, t.registeredEpoch = record.ID, t.epoch
+	if t.config.Verbose {
+		best := t.registry.Best()
+		if best == "" {
+			best = "none, no validation loss yet"
 		}
+		fmt.Printf("  ✓ Registered checkpoint %s (best: %s)\n", record.ID, best)
 	}
+	return nil
+}
+
+// Registry returns the checkpoint registry, or nil when disabled
+func (t *Trainer) Registry() *Registry {
+	return t.registry
+}
 
+// epochRand returns the generator for an epoch's shuffling and augmentation.
+// It depends only on the seed and the epoch, so a resumed run draws the same
+// numbers as an uninterrupted one.
+func (t *Trainer) epochRand(epoch int) *rand.Rand {
+	return rand.New(rand.NewSource(t.seed + int64(epoch) + 1))
+}
+
+// prepareSplit splits the dataset into train and validation sets, or checks
+// that a split restored from a training state fits the dataset
+func (t *Trainer) prepareSplit(totalSamples int) error {
+	if t.totalSamples == 0 {
+		t.totalSamples = totalSamples
+		return t.splitTrainVal(totalSamples)
+	}
+	if t.totalSamples != totalSamples {
+		return fmt.Errorf("training state was saved for %d samples, dataset has %d", t.totalSamples, totalSamples)
+	}
+	return nil
+}
+
+// checkDatasetFormat ensures the dataset's state tensors match the model input
+func (t *Trainer) checkDatasetFormat(dataset *data.Dataset) error {
+	channels, err := dataset.InputChannels()
+	if err != nil {
+		return fmt.Errorf("failed to read dataset format: %w", err)
+	}
+	if channels != t.inputChannels {
+		return fmt.Errorf("dataset has %d input channels but model expects %d", channels, t.inputChannels)
+	}
+	return nil
+}
+
+// identifyDataset records the dataset path and hash for registered checkpoints
+func (t *Trainer) identifyDataset(dataset *data.Dataset) error {
+	if t.registry == nil || (t.datasetPath == dataset.Path() && t.datasetHash != "") {
+		return nil
+	}
+	hash, err := dataset.Hash()
+	if err != nil {
+		return err
+	}
+	t.datasetPath, t.datasetHash = dataset.Path(), hash
 	return nil
 }
 
@@ -304,10 +674,10 @@ func (t *Trainer) splitTrainVal(totalSamples int) error {
 
 	// Shuffle if enabled
 	if t.config.ShuffleBatches {
-		for i := len(allIndices) - 1; i > 0; i-- {
-			j := int(float64(i+1) * float64(time.Now().UnixNano()%1000000) / 1000000.0)
+		rng := rand.New(rand.NewSource(t.seed))
+		rng.Shuffle(len(allIndices), func(i, j int) {
 			allIndices[i], allIndices[j] = allIndices[j], allIndices[i]
-		}
+		})
 	}
 
 	// Split
@@ -348,6 +718,7 @@ func (t *Trainer) validateEpoch(dataset *data.Dataset) (float64, float64, error)
 	totalLoss := 0.0
 	correctPredictions := 0
 	samplesSeen := 0
+	t.agreements, t.total = 0, 0
 
 	for batchIdx := 0; batchIdx < numBatches; batchIdx++ {
 		startIdx := batchIdx * batchSize
@@ -392,8 +763,9 @@ func (t *Trainer) validateEpoch(dataset *data.Dataset) (float64, float64, error)
 	return avgLoss, accuracy, nil
 }
 
-// trainEpoch trains for one epoch
-func (t *Trainer) trainEpoch(dataset *data.Dataset, totalSamples int) (float64, float64, int, error) {
+// trainEpoch trains for one epoch, shuffling and augmenting with rng. The
+// time spent waiting on the data loader is kept in t.loaderStall.
+func (t *Trainer) trainEpoch(dataset *data.Dataset, totalSamples int, rng *rand.Rand) (float64, float64, int, error) {
 	batchSize := t.config.BatchSize
 	numBatches := (totalSamples + batchSize - 1) / batchSize
 
@@ -402,45 +774,28 @@ func (t *Trainer) trainEpoch(dataset *data.Dataset, totalSamples int) (float64,
 	samplesSeen := 0
 	batchesFailed := 0
 
-	// Configure augmentation
-	augConfig := data.DefaultAugmentationConfig()
-
 	// Shuffle training indices each epoch
 	if t.config.ShuffleBatches {
-		for i := len(t.trainIndices) - 1; i > 0; i-- {
-			j := int(float64(i+1) * float64(time.Now().UnixNano()%1000000) / 1000000.0)
+		rng.Shuffle(len(t.trainIndices), func(i, j int) {
 			t.trainIndices[i], t.trainIndices[j] = t.trainIndices[j], t.trainIndices[i]
-		}
+		})
 	}
 
-	for batchIdx := 0; batchIdx < numBatches; batchIdx++ {
-		startIdx := batchIdx * batchSize
-		endIdx := startIdx + batchSize
-		if endIdx > len(t.trainIndices) {
-			endIdx = len(t.trainIndices)
-		}
-
-		batchIndices := t.trainIndices[startIdx:endIdx]
+	// Batches are loaded, augmented and packed ahead by the loader
+	loader := t.newBatchLoader(dataset, rng)
+	defer loader.close()
 
-		// Load batch from dataset using indices
-		entries := make([]*data.DataEntry, 0, len(batchIndices))
-		for _, idx := range batchIndices {
-			entry, err := dataset.LoadBatch(idx, 1)
-			if err == nil && len(entry) > 0 {
-				entries = append(entries, entry[0])
-			}
-		}
-
-		if len(entries) == 0 {
+	for batch := loader.next(); batch != nil; batch = loader.next() {
+		if batch.err != nil {
+			loader.release(batch)
 			batchesFailed++
 			continue
 		}
 
-		// Apply data augmentation
-		entries = data.AugmentBatch(entries, augConfig)
-
 		// Train on batch
-		batchLoss, batchCorrect, err := t.trainBatch(entries)
+		entries := batch.entries[:min(len(batch.entries), batchSize)]
+		batchLoss, batchCorrect, err := t.stepBatch(entries, batch.buf)
+		loader.release(batch)
 		if err != nil {
 			batchesFailed++
 			continue // Skip failed batches, don't stop training
@@ -448,8 +803,9 @@ func (t *Trainer) trainEpoch(dataset *data.Dataset, totalSamples int) (float64,
 
 		totalLoss += batchLoss
 		correctPredictions += batchCorrect
-		samplesSeen += len(entries)
+		samplesSeen += len(batch.entries)
 	}
+	t.loaderStall = loader.stallTime()
 
 	if samplesSeen == 0 {
 		return 0, 0, 0, fmt.Errorf("no samples processed successfully")
@@ -478,95 +834,99 @@ func (t *Trainer) trainBatch(entries []*data.DataEntry) (float64, int, error) {
 		}
 		// Truncate if larger (shouldn't happen with proper batching)
 		entries = entries[:t.config.BatchSize]
-		batchSize = t.config.BatchSize
 	}
 
 	// Use pre-allocated buffers for efficiency
-	inputData := t.inputBuffer[:batchSize*12*8*8]
-	targetData := t.targetBuffer[:batchSize*4096]
-
-	// Clear buffers (only necessary portions)
-	for i := range inputData {
-		inputData[i] = 0
-	}
-	for i := range targetData {
-		targetData[i] = 0
-	}
+	buf := t.buffers
+	buf.clear()
 
 	// Fill batch data
 	for i, entry := range entries {
-		// Convert state tensor
-		boardTensor, err := data.FlatArrayToTensor(entry.StateTensor)
-		if err != nil {
-			return 0, 0, fmt.Errorf("failed to convert entry %d: %w", i, err)
+		if err := t.fillSample(i, entry, buf); err != nil {
+			return 0, 0, err
 		}
+	}
 
-		// Copy board data to batch input
-		offset := i * 12 * 8 * 8
-		idx := 0
-		for c := 0; c < 12; c++ {
-			for r := 0; r < 8; r++ {
-				for f := 0; f < 8; f++ {
-					inputData[offset+idx] = float64(boardTensor[c][r][f])
-					idx++
-				}
-			}
+	return t.stepBatch(entries, buf)
+}
+
+// evalBatch evaluates a batch without updating weights (for validation)
+func (t *Trainer) evalBatch(entries []*data.DataEntry) (float64, int, error) {
+	if len(entries) == 0 {
+		return 0, 0, nil
+	}
+
+	batchSize := len(entries)
+	if batchSize != t.config.BatchSize {
+		if batchSize < t.config.BatchSize {
+			return t.evalBatchSmall(entries)
 		}
+		entries = entries[:t.config.BatchSize]
+	}
 
-		// Create target for this sample
-		targetVec, err := ConvertMoveToTarget(entry.FromSquare, entry.ToSquare)
-		if err != nil {
-			return 0, 0, fmt.Errorf("failed to create target for entry %d: %w", i, err)
+	// Use pre-allocated buffers
+	buf := t.buffers
+	buf.clear()
+
+	// Fill batch data (no augmentation for validation)
+	for i, entry := range entries {
+		if err := t.fillSample(i, entry, buf); err != nil {
+			continue
 		}
+	}
+
+	return t.forwardBatch(entries, buf)
+}
+
+// evalBatchSmall evaluates small batches
+func (t *Trainer) evalBatchSmall(entries []*data.DataEntry) (float64, int, error) {
+	// Similar to evalBatch but with padding
+	buf := t.buffers
+	buf.clear()
 
-		// Copy target data to batch targets
-		copy(targetData[i*4096:(i+1)*4096], targetVec)
+	// Fill only actual entries
+	for i, entry := range entries {
+		if err := t.fillSample(i, entry, buf); err != nil {
+			continue
+		}
 	}
 
-	// Create batch tensors
-	inputTensor := tensor.New(
-		tensor.WithShape(batchSize, 12, 8, 8),
-		tensor.WithBacking(inputData),
-	)
+	return t.forwardBatch(entries, buf)
+}
 
-	targetTensor := tensor.New(
-		tensor.WithShape(batchSize, 4096),
-		tensor.WithBacking(targetData),
-	)
+// trainBatchSmall handles batches smaller than the configured batch size
+func (t *Trainer) trainBatchSmall(entries []*data.DataEntry) (float64, int, error) {
+	// Pad the batch with zeros to match model batch size
+	buf := newBatchBuffers(t.config.BatchSize, t.inputChannels, t.policySize)
 
-	// Set input and target
-	if err := gorgonia.Let(t.model.input, inputTensor); err != nil {
-		return 0, 0, fmt.Errorf("failed to set input: %w", err)
+	// Fill only the actual entries
+	for i, entry := range entries {
+		if err := t.fillSample(i, entry, buf); err != nil {
+			return 0, 0, err
+		}
 	}
 
-	if err := gorgonia.Let(t.targetNode, targetTensor); err != nil {
-		return 0, 0, fmt.Errorf("failed to set target: %w", err)
+	return t.stepBatch(entries, buf)
+}
+
+// stepBatch runs the forward and backward pass on a filled batch and updates weights
+func (t *Trainer) stepBatch(entries []*data.DataEntry, buf *batchBuffers) (float64, int, error) {
+	// Set input and targets
+	if err := t.bindBatch(buf); err != nil {
+		return 0, 0, err
 	}
 
+	vm := t.model.machine()
+
 	// Run forward and backward pass
-	if err := t.model.vm.RunAll(); err != nil {
+	if err := vm.RunAll(); err != nil {
 		return 0, 0, fmt.Errorf("failed to run forward/backward: %w", err)
 	}
 
 	// Get loss value
-	lossValue := t.lossNode.Value()
-	if lossValue == nil {
-		return 0, 0, fmt.Errorf("loss value is nil")
-	}
-
-	// Extract scalar loss value
-	var avgLoss float64
-	switch v := lossValue.Data().(type) {
-	case float64:
-		avgLoss = v
-	case []float64:
-		if len(v) > 0 {
-			avgLoss = v[0]
-		} else {
-			return 0, 0, fmt.Errorf("loss value array is empty")
-		}
-	default:
-		return 0, 0, fmt.Errorf("unexpected loss value type: %T", v)
+	avgLoss, err := t.lossValue()
+	if err != nil {
+		return 0, 0, err
 	}
 
 	// Update weights
@@ -575,378 +935,312 @@ func (t *Trainer) trainBatch(entries []*data.DataEntry) (float64, int, error) {
 	for i, n := range learnables {
 		valueGrads[i] = n
 	}
-	if err := t.solver.Step(valueGrads); err != nil {
+	if err := t.optimizer.Step(valueGrads); err != nil {
 		return 0, 0, fmt.Errorf("failed to update weights: %w", err)
 	}
 
 	// Reset VM for next batch
-	t.model.vm.Reset()
+	vm.Reset()
 
-	// Count correct predictions
-	correctCount := 0
-	outputValue := t.model.output.Value()
-	if outputValue != nil {
-		outputData := outputValue.Data().([]float64)
-
-		for i, entry := range entries {
-			// Get predicted move (argmax of output)
-			maxIdx := 0
-			maxProb := outputData[i*4096]
-			for j := 1; j < 4096; j++ {
-				if outputData[i*4096+j] > maxProb {
-					maxProb = outputData[i*4096+j]
-					maxIdx = j
-				}
-			}
+	return avgLoss, t.countCorrect(entries), nil
+}
 
-			// Check if prediction is correct
-			expectedIdx := entry.FromSquare*64 + entry.ToSquare
-			if maxIdx == expectedIdx {
-				correctCount++
-			}
-		}
+// forwardBatch runs the forward pass on a filled batch without updating weights
+func (t *Trainer) forwardBatch(entries []*data.DataEntry, buf *batchBuffers) (float64, int, error) {
+	if err := t.bindBatch(buf); err != nil {
+		return 0, 0, err
 	}
 
-	return avgLoss, correctCount, nil
-}
+	vm := t.model.machine()
+	defer vm.Reset()
 
-// evalBatch evaluates a batch without updating weights (for validation)
-func (t *Trainer) evalBatch(entries []*data.DataEntry) (float64, int, error) {
-	if len(entries) == 0 {
-		return 0, 0, nil
+	if err := vm.RunAll(); err != nil {
+		return 0, 0, err
 	}
 
-	batchSize := len(entries)
-	if batchSize != t.config.BatchSize {
-		if batchSize < t.config.BatchSize {
-			return t.evalBatchSmall(entries)
-		}
-		entries = entries[:t.config.BatchSize]
-		batchSize = t.config.BatchSize
+	avgLoss, err := t.lossValue()
+	if err != nil {
+		return 0, 0, err
 	}
 
-	// Use pre-allocated buffers
-	inputData := t.inputBuffer[:batchSize*12*8*8]
-	targetData := t.targetBuffer[:batchSize*4096]
-
-	// Clear buffers
-	for i := range inputData {
-		inputData[i] = 0
-	}
-	for i := range targetData {
-		targetData[i] = 0
+	if t.distiller != nil {
+		t.countAgreement(len(entries), buf)
 	}
 
-	// Fill batch data (no augmentation for validation)
-	for i, entry := range entries {
-		boardTensor, err := data.FlatArrayToTensor(entry.StateTensor)
-		if err != nil {
-			continue
-		}
-
-		offset := i * 12 * 8 * 8
-		idx := 0
-		for c := 0; c < 12; c++ {
-			for r := 0; r < 8; r++ {
-				for f := 0; f < 8; f++ {
-					inputData[offset+idx] = float64(boardTensor[c][r][f])
-					idx++
-				}
-			}
-		}
+	return avgLoss, t.countCorrect(entries), nil
+}
 
-		targetVec, err := ConvertMoveToTarget(entry.FromSquare, entry.ToSquare)
-		if err != nil {
-			continue
-		}
-		copy(targetData[i*4096:(i+1)*4096], targetVec)
-	}
+// bindBatch sets the input and target nodes from the batch buffers
+func (t *Trainer) bindBatch(buf *batchBuffers) error {
+	batchSize := t.config.BatchSize
 
-	// Create tensors
 	inputTensor := tensor.New(
-		tensor.WithShape(batchSize, 12, 8, 8),
-		tensor.WithBacking(inputData),
+		tensor.WithShape(batchSize, t.inputChannels, 8, 8),
+		tensor.WithBacking(buf.input),
 	)
+	if err := gorgonia.Let(t.model.graph().input, inputTensor); err != nil {
+		return fmt.Errorf("failed to set input: %w", err)
+	}
+
 	targetTensor := tensor.New(
-		tensor.WithShape(batchSize, 4096),
-		tensor.WithBacking(targetData),
+		tensor.WithShape(batchSize, t.policySize),
+		tensor.WithBacking(buf.policy),
 	)
+	if err := gorgonia.Let(t.targetNode, targetTensor); err != nil {
+		return fmt.Errorf("failed to set target: %w", err)
+	}
 
-	// Set input and target
-	if err := gorgonia.Let(t.model.input, inputTensor); err != nil {
-		return 0, 0, err
+	if t.legalBiasNode != nil {
+		legalTensor := tensor.New(
+			tensor.WithShape(batchSize, t.policySize),
+			tensor.WithBacking(buf.legalBias(t.policySize)),
+		)
+		if err := gorgonia.Let(t.legalBiasNode, legalTensor); err != nil {
+			return fmt.Errorf("failed to set legal move bias: %w", err)
+		}
 	}
-	if err := gorgonia.Let(t.targetNode, targetTensor); err != nil {
-		return 0, 0, err
+
+	if t.valueTargetNode == nil {
+		return nil
 	}
 
-	// Run forward pass only (no backward)
-	if err := t.model.vm.RunAll(); err != nil {
-		return 0, 0, err
+	valueTensor := tensor.New(tensor.WithShape(batchSize, 1), tensor.WithBacking(buf.value))
+	if err := gorgonia.Let(t.valueTargetNode, valueTensor); err != nil {
+		return fmt.Errorf("failed to set value target: %w", err)
 	}
+	maskTensor := tensor.New(tensor.WithShape(batchSize, 1), tensor.WithBacking(buf.mask))
+	if err := gorgonia.Let(t.valueMaskNode, maskTensor); err != nil {
+		return fmt.Errorf("failed to set value mask: %w", err)
+	}
+
+	return nil
+}
 
-	// Get loss
+// lossValue extracts the scalar loss after a forward pass
+func (t *Trainer) lossValue() (float64, error) {
 	lossValue := t.lossNode.Value()
 	if lossValue == nil {
-		return 0, 0, fmt.Errorf("loss value is nil")
+		return 0, fmt.Errorf("loss value is nil")
 	}
 
-	var avgLoss float64
 	switch v := lossValue.Data().(type) {
 	case float64:
-		avgLoss = v
+		return v, nil
 	case []float64:
 		if len(v) > 0 {
-			avgLoss = v[0]
+			return v[0], nil
 		}
+		return 0, fmt.Errorf("loss value array is empty")
+	default:
+		return 0, fmt.Errorf("unexpected loss value type: %T", v)
 	}
+}
 
-	// Count correct predictions
+// countCorrect counts entries whose move matches the argmax of the policy output
+func (t *Trainer) countCorrect(entries []*data.DataEntry) int {
+	outputValue := t.model.graph().policy.Value()
+	if outputValue == nil {
+		return 0
+	}
+
+	outputData := outputValue.Data().([]float64)
 	correctCount := 0
-	outputValue := t.model.output.Value()
-	if outputValue != nil {
-		outputData := outputValue.Data().([]float64)
-		for i, entry := range entries {
-			maxIdx := 0
-			maxProb := outputData[i*4096]
-			for j := 1; j < 4096; j++ {
-				if outputData[i*4096+j] > maxProb {
-					maxProb = outputData[i*4096+j]
-					maxIdx = j
-				}
-			}
-			expectedIdx := entry.FromSquare*64 + entry.ToSquare
-			if maxIdx == expectedIdx {
-				correctCount++
-			}
+	for i, entry := range entries {
+		if t.isCorrect(outputData, i, entry) {
+			correctCount++
 		}
 	}
-
-	// Reset VM
-	t.model.vm.Reset()
-
-	return avgLoss, correctCount, nil
+	return correctCount
 }
 
-// evalBatchSmall evaluates small batches
-func (t *Trainer) evalBatchSmall(entries []*data.DataEntry) (float64, int, error) {
-	// Similar to evalBatch but with padding
-	batchSize := t.config.BatchSize
-	actualSize := len(entries)
-
-	inputData := t.inputBuffer
-	targetData := t.targetBuffer
-
-	// Clear all
-	for i := range inputData {
-		inputData[i] = 0
-	}
-	for i := range targetData {
-		targetData[i] = 0
+// countAgreement adds the samples whose policy argmax matches the teacher's
+// top move to the validation agreement counts
+func (t *Trainer) countAgreement(n int, buf *batchBuffers) {
+	outputValue := t.model.graph().policy.Value()
+	if outputValue == nil {
+		return
 	}
 
-	// Fill only actual entries
-	for i := 0; i < actualSize; i++ {
-		entry := entries[i]
-		boardTensor, err := data.FlatArrayToTensor(entry.StateTensor)
-		if err != nil {
+	outputData := outputValue.Data().([]float64)
+	for i := 0; i < n; i++ {
+		if buf.teacher[i] < 0 {
 			continue
 		}
-
-		offset := i * 12 * 8 * 8
-		idx := 0
-		for c := 0; c < 12; c++ {
-			for r := 0; r < 8; r++ {
-				for f := 0; f < 8; f++ {
-					inputData[offset+idx] = float64(boardTensor[c][r][f])
-					idx++
-				}
-			}
+		t.total++
+		if argmax(outputData[i*t.policySize:(i+1)*t.policySize]) == buf.teacher[i] {
+			t.agreements++
 		}
-
-		targetVec, err := ConvertMoveToTarget(entry.FromSquare, entry.ToSquare)
-		if err != nil {
-			continue
-		}
-		copy(targetData[i*4096:(i+1)*4096], targetVec)
-	}
-
-	inputTensor := tensor.New(
-		tensor.WithShape(batchSize, 12, 8, 8),
-		tensor.WithBacking(inputData),
-	)
-	targetTensor := tensor.New(
-		tensor.WithShape(batchSize, 4096),
-		tensor.WithBacking(targetData),
-	)
-
-	if err := gorgonia.Let(t.model.input, inputTensor); err != nil {
-		return 0, 0, err
-	}
-	if err := gorgonia.Let(t.targetNode, targetTensor); err != nil {
-		return 0, 0, err
 	}
+}
 
-	if err := t.model.vm.RunAll(); err != nil {
-		return 0, 0, err
+// teacherAgreement returns the top-1 agreement with the teacher over the last validation pass
+func (t *Trainer) teacherAgreement() float64 {
+	if t.total == 0 {
+		return 0
 	}
+	return float64(t.agreements) / float64(t.total)
+}
 
-	lossValue := t.lossNode.Value()
-	var avgLoss float64
-	if lossValue != nil {
-		switch v := lossValue.Data().(type) {
-		case float64:
-			avgLoss = v
-		case []float64:
-			if len(v) > 0 {
-				avgLoss = v[0]
-			}
+// argmax returns the index of the largest value
+func argmax(values []float64) int {
+	best := 0
+	for i := 1; i < len(values); i++ {
+		if values[i] > values[best] {
+			best = i
 		}
 	}
+	return best
+}
 
-	correctCount := 0
-	outputValue := t.model.output.Value()
-	if outputValue != nil {
-		outputData := outputValue.Data().([]float64)
-		for i := 0; i < actualSize; i++ {
-			entry := entries[i]
-			maxIdx := 0
-			maxProb := outputData[i*4096]
-			for j := 1; j < 4096; j++ {
-				if outputData[i*4096+j] > maxProb {
-					maxProb = outputData[i*4096+j]
-					maxIdx = j
-				}
-			}
-			expectedIdx := entry.FromSquare*64 + entry.ToSquare
-			if maxIdx == expectedIdx {
-				correctCount++
-			}
-		}
-	}
+// batchBuffers holds the flat input and target data for one batch
+type batchBuffers struct {
+	input  []float64 // [batch, channels, 8, 8]
+	policy []float64 // [batch, policySize] move target distributions
+	value  []float64 // [batch] game outcome from the side to move's perspective
+	mask   []float64 // [batch] 1 where the outcome is known
 
-	t.model.vm.Reset()
-	return avgLoss, correctCount, nil
+	teacher []int // [batch] teacher's top move index, -1 if none
+
+	legal []float64 // [batch, policySize] logit bias masking illegal moves, allocated by legalBias
 }
 
-// trainBatchSmall handles batches smaller than the configured batch size
-func (t *Trainer) trainBatchSmall(entries []*data.DataEntry) (float64, int, error) {
-	// Pad the batch with zeros to match model batch size
-	batchSize := t.config.BatchSize
-	inputData := make([]float64, batchSize*12*8*8)
-	targetData := make([]float64, batchSize*4096)
+// newBatchBuffers allocates zeroed buffers for a batch
+func newBatchBuffers(batchSize, inputChannels, policySize int) *batchBuffers {
+	return &batchBuffers{
+		input:  make([]float64, batchSize*inputChannels*8*8),
+		policy: make([]float64, batchSize*policySize),
+		value:  make([]float64, batchSize),
+		mask:   make([]float64, batchSize),
 
-	actualSize := len(entries)
+		teacher: newTeacherMoves(batchSize),
+	}
+}
 
-	// Fill only the actual entries
-	for i, entry := range entries {
-		boardTensor, err := data.FlatArrayToTensor(entry.StateTensor)
-		if err != nil {
-			return 0, 0, fmt.Errorf("failed to convert entry %d: %w", i, err)
-		}
+// maskIllegalTargets sets illegalLogitBias on the illegal moves of the
+// entry's position and renormalizes the target row over the legal ones.
+// Entries whose position cannot be rebuilt, or whose target has no legal
+// mass, keep a zero bias and their target.
+func maskIllegalTargets(entry *data.DataEntry, encoding data.MoveEncoding, row, bias []float64) {
+	indices, err := data.StateLegalMoveIndices(entry.StateTensor, encoding)
+	if err != nil {
+		return
+	}
 
-		offset := i * 12 * 8 * 8
-		idx := 0
-		for c := 0; c < 12; c++ {
-			for r := 0; r < 8; r++ {
-				for f := 0; f < 8; f++ {
-					inputData[offset+idx] = float64(boardTensor[c][r][f])
-					idx++
-				}
-			}
-		}
+	legalMass := 0.0
+	for _, index := range indices {
+		legalMass += row[index]
+	}
+	if legalMass == 0 {
+		return
+	}
 
-		targetVec, err := ConvertMoveToTarget(entry.FromSquare, entry.ToSquare)
-		if err != nil {
-			return 0, 0, fmt.Errorf("failed to create target for entry %d: %w", i, err)
+	for j := range bias {
+		bias[j] = illegalLogitBias
+	}
+	for _, index := range indices {
+		bias[index] = 0
+	}
+	for j := range row {
+		if bias[j] == 0 {
+			row[j] /= legalMass
+		} else {
+			row[j] = 0
 		}
-		copy(targetData[i*4096:(i+1)*4096], targetVec)
 	}
+}
 
-	// Create tensors
-	inputTensor := tensor.New(
-		tensor.WithShape(batchSize, 12, 8, 8),
-		tensor.WithBacking(inputData),
-	)
+// newTeacherMoves returns teacher move slots initialized to -1
+func newTeacherMoves(batchSize int) []int {
+	moves := make([]int, batchSize)
+	for i := range moves {
+		moves[i] = -1
+	}
+	return moves
+}
 
-	targetTensor := tensor.New(
-		tensor.WithShape(batchSize, 4096),
-		tensor.WithBacking(targetData),
-	)
+// clear zeroes all buffers
+func (b *batchBuffers) clear() {
+	for _, buf := range [][]float64{b.input, b.policy, b.value, b.mask, b.legal} {
+		for i := range buf {
+			buf[i] = 0
+		}
+	}
+	for i := range b.teacher {
+		b.teacher[i] = -1
+	}
+}
 
-	// Set input and target
-	if err := gorgonia.Let(t.model.input, inputTensor); err != nil {
-		return 0, 0, fmt.Errorf("failed to set input: %w", err)
+// legalBias returns the legal move logit bias, allocating it on first use.
+// Rows default to zero, which leaves the softmax unrestricted.
+func (b *batchBuffers) legalBias(policySize int) []float64 {
+	if b.legal == nil {
+		b.legal = make([]float64, len(b.value)*policySize)
 	}
+	return b.legal
+}
 
-	if err := gorgonia.Let(t.targetNode, targetTensor); err != nil {
-		return 0, 0, fmt.Errorf("failed to set target: %w", err)
+// fillSample writes entry i of a batch into the batch buffers
+func (t *Trainer) fillSample(i int, entry *data.DataEntry, buf *batchBuffers) error {
+	stateSize := t.inputChannels * 8 * 8
+	if len(entry.StateTensor) != stateSize {
+		return fmt.Errorf("failed to convert entry %d: state tensor length %d, model expects %d",
+			i, len(entry.StateTensor), stateSize)
 	}
 
-	// Run forward and backward pass
-	if err := t.model.vm.RunAll(); err != nil {
-		return 0, 0, fmt.Errorf("failed to run forward/backward: %w", err)
+	offset := i * stateSize
+	for j, v := range entry.StateTensor {
+		buf.input[offset+j] = float64(v)
 	}
 
-	// Get loss (only for actual samples)
-	lossValue := t.lossNode.Value()
-	if lossValue == nil {
-		return 0, 0, fmt.Errorf("loss value is nil")
+	// Cross-entropy against the entry's target distribution: a sparse policy
+	// (e.g. distilled), the visit counts of a deduplicated position, or one-hot
+	target, err := entry.PolicyTarget(t.model.MoveEncoding())
+	if err != nil {
+		return fmt.Errorf("failed to create target for entry %d: %w", i, err)
+	}
+	row := buf.policy[i*t.policySize : (i+1)*t.policySize]
+	for moveIndex, p := range target {
+		row[moveIndex] = float64(p)
 	}
 
-	// Extract scalar loss value
-	var avgLoss float64
-	switch v := lossValue.Data().(type) {
-	case float64:
-		avgLoss = v
-	case []float64:
-		if len(v) > 0 {
-			avgLoss = v[0]
-		} else {
-			return 0, 0, fmt.Errorf("loss value array is empty")
+	// Distillation mixes in the teacher's softened policy
+	if t.distiller != nil {
+		teacher, best, err := t.distiller.Target(entry.StateTensor, t.model.MoveEncoding())
+		if err != nil {
+			return fmt.Errorf("failed to create teacher target for entry %d: %w", i, err)
 		}
-	default:
-		return 0, 0, fmt.Errorf("unexpected loss value type: %T", v)
+		w := t.config.DistillWeight
+		for j := range row {
+			row[j] = (1-w)*row[j] + w*teacher[j]
+		}
+		buf.teacher[i] = best
 	}
 
-	// Update weights
-	learnables := t.model.Learnables()
-	valueGrads := make([]gorgonia.ValueGrad, len(learnables))
-	for i, n := range learnables {
-		valueGrads[i] = n
+	if eps := t.config.LabelSmoothing; eps > 0 {
+		uniform := eps / float64(t.policySize)
+		for j := range row {
+			row[j] = row[j]*(1-eps) + uniform
+		}
 	}
-	if err := t.solver.Step(valueGrads); err != nil {
-		return 0, 0, fmt.Errorf("failed to update weights: %w", err)
+
+	if t.legalBiasNode != nil {
+		maskIllegalTargets(entry, t.model.MoveEncoding(), row, buf.legalBias(t.policySize)[i*t.policySize:(i+1)*t.policySize])
 	}
 
-	// Reset VM
-	t.model.vm.Reset()
+	if entry.HasOutcome {
+		buf.value[i] = float64(entry.Outcome)
+		buf.mask[i] = 1.0
+	}
 
-	// Count correct predictions (only for actual samples)
-	correctCount := 0
-	outputValue := t.model.output.Value()
-	if outputValue != nil {
-		outputData := outputValue.Data().([]float64)
-
-		for i := 0; i < actualSize; i++ {
-			entry := entries[i]
-			maxIdx := 0
-			maxProb := outputData[i*4096]
-			for j := 1; j < 4096; j++ {
-				if outputData[i*4096+j] > maxProb {
-					maxProb = outputData[i*4096+j]
-					maxIdx = j
-				}
-			}
+	return nil
+}
 
-			expectedIdx := entry.FromSquare*64 + entry.ToSquare
-			if maxIdx == expectedIdx {
-				correctCount++
-			}
-		}
-	}
+// isCorrect reports whether the argmax of sample i's output matches the entry's move
+func (t *Trainer) isCorrect(outputData []float64, i int, entry *data.DataEntry) bool {
+	maxIdx := argmax(outputData[i*t.policySize : (i+1)*t.policySize])
 
-	return avgLoss, correctCount, nil
+	expectedIdx, err := entry.MoveIndex(t.model.MoveEncoding())
+	return err == nil && maxIdx == expectedIdx
 }
 
 // GetMetrics returns training metrics
@@ -954,8 +1248,27 @@ func (t *Trainer) GetMetrics() []TrainingMetrics {
 	return t.metrics
 }
 
-// GetModel returns the underlying CNN model
-func (t *Trainer) GetModel() *ChessCNN {
+// Seed returns the seed of the run, resolved from the time if none was
+// configured
+func (t *Trainer) Seed() int64 {
+	return t.seed
+}
+
+// Distiller returns the teacher used for distillation, or nil
+func (t *Trainer) Distiller() *Distiller {
+	return t.distiller
+}
+
+// Close releases the teacher model. The student is closed with GetModel().Close().
+func (t *Trainer) Close() error {
+	if t.distiller != nil {
+		return t.distiller.Close()
+	}
+	return nil
+}
+
+// GetModel returns the model being trained
+func (t *Trainer) GetModel() ChessModel {
 	return t.model
 }
 
@@ -965,79 +1278,14 @@ func (t *Trainer) TrainOnBatch(entries []*data.DataEntry) (loss float64, correct
 	return t.trainBatch(entries)
 }
 
-// TrainWithCallback trains with a callback function for progress monitoring
+// TrainWithCallback trains like Train with the internal logging disabled,
+// calling callback with the metrics of each epoch for progress monitoring
 func (t *Trainer) TrainWithCallback(dataset *data.Dataset, callback func(TrainingMetrics)) error {
-	// Store original verbose setting
 	originalVerbose := t.config.Verbose
-	t.config.Verbose = false // Disable internal logging
-
-	// Get total samples
-	totalSamples, err := dataset.Count()
-	if err != nil {
-		return fmt.Errorf("failed to get dataset count: %w", err)
-	}
-
-	if totalSamples == 0 {
-		return fmt.Errorf("dataset is empty")
-	}
-
-	// Training loop
-	for epoch := 0; epoch < t.config.Epochs; epoch++ {
-		startTime := time.Now()
-
-		// Apply learning rate decay
-		if epoch > 0 && epoch%t.config.LRDecaySteps == 0 {
-			newLR := t.config.LearningRate * math.Pow(t.config.LRDecayRate, float64(epoch/t.config.LRDecaySteps))
-			t.solver = gorgonia.NewAdamSolver(
-				gorgonia.WithLearnRate(newLR),
-				gorgonia.WithBatchSize(float64(t.config.BatchSize)),
-				gorgonia.WithClip(t.config.GradientClipMax),
-			)
-		}
-
-		// Train one epoch
-		epochLoss, accuracy, samplesSeen, err := t.trainEpoch(dataset, totalSamples)
-		if err != nil {
-			return fmt.Errorf("epoch %d failed: %w", epoch+1, err)
-		}
+	t.config.Verbose = false
+	defer func() { t.config.Verbose = originalVerbose }()
 
-		duration := time.Since(startTime)
-
-		// Record metrics
-		metrics := TrainingMetrics{
-			Epoch:        epoch + 1,
-			Loss:         epochLoss,
-			Accuracy:     accuracy,
-			LearningRate: t.config.LearningRate,
-			Duration:     duration,
-			SamplesSeen:  samplesSeen,
-		}
-		t.metrics = append(t.metrics, metrics)
-
-		// Call callback
-		if callback != nil {
-			callback(metrics)
-		}
-
-		// Save checkpoint
-		if t.config.SaveInterval > 0 && (epoch+1)%t.config.SaveInterval == 0 {
-			if err := t.model.SaveModel(t.config.SavePath); err != nil {
-				fmt.Printf("Warning: Failed to save checkpoint: %v\n", err)
-			}
-		}
-	}
-
-	// Final save
-	if t.config.SavePath != "" {
-		if err := t.model.SaveModel(t.config.SavePath); err != nil {
-			return fmt.Errorf("failed to save final model: %w", err)
-		}
-	}
-
-	// Restore verbose setting
-	t.config.Verbose = originalVerbose
-
-	return nil
+	return t.train(dataset, callback)
 }
 
 // ComputeEnhancedLoss computes loss with chess-specific penalties
@@ -1064,7 +1312,7 @@ func ComputeEnhancedLoss(predictions []float64, targetIdx int, boardTensor [12][
 	// 2. Encourage center control in opening/middlegame
 	if features.GamePhase < 0.5 {
 		// Reward moves to center
-		targetSquare := targetIdx % 64
+		_, targetSquare, _, _ := data.DecodeMoveIndex(targetIdx)
 		targetRow, targetCol := targetSquare/8, targetSquare%8
 		if (targetRow == 3 || targetRow == 4) && (targetCol == 3 || targetCol == 4) {
 			penalty -= 0.1 // Bonus (negative penalty)
@@ -1081,8 +1329,7 @@ func ComputeEnhancedLoss(predictions []float64, targetIdx int, boardTensor [12][
 	}
 
 	// 4. Illegal move approximation penalty
-	fromSquare := targetIdx / 64
-	toSquare := targetIdx % 64
+	fromSquare, toSquare, _, _ := data.DecodeMoveIndex(targetIdx)
 	if !IsLegalMovePlausible(fromSquare, toSquare, boardTensor) {
 		penalty += 2.0 // Heavy penalty for obviously illegal moves
 	}
@@ -3,6 +3,9 @@ package model
 import (
 	"fmt"
 	"math"
+
+	"github.com/notnil/chess"
+	"github.com/thyrook/partner/internal/data"
 )
 
 // ModelInfo contains metadata about the model
@@ -475,97 +478,47 @@ func absFloat(x float32) float32 {
 	return x
 }
 
-// IsLegalMovePlausible checks if a move is plausibly legal (basic check)
+// IsLegalMovePlausible checks if a move is legal for the side owning the
+// piece on the from-square. The 12-plane tensor has no side to move,
+// castling or en-passant information, so castling and en-passant captures
+// are never accepted; use data.LegalMoveIndices with a full position instead.
 func IsLegalMovePlausible(fromSquare, toSquare int, tensor [12][8][8]float32) bool {
 	if fromSquare < 0 || fromSquare >= 64 || toSquare < 0 || toSquare >= 64 {
 		return false
 	}
 
-	fromRow, fromCol := fromSquare/8, fromSquare%8
-	toRow, toCol := toSquare/8, toSquare%8
-
-	// Check if source has a piece
-	hasPiece := false
-	movingPieceType := -1
-	isWhite := false
-
-	for ch := 0; ch < 12; ch++ {
-		if tensor[ch][fromRow][fromCol] > 0 {
-			hasPiece = true
-			movingPieceType = ch % 6
-			isWhite = ch < 6
-			break
-		}
-	}
-
-	if !hasPiece {
+	pos, err := positionForMover(tensor, fromSquare)
+	if err != nil {
 		return false
 	}
 
-	// Check if capturing own piece
-	targetStart, targetEnd := 0, 6
-	if !isWhite {
-		targetStart, targetEnd = 6, 12
-	}
-
-	for ch := targetStart; ch < targetEnd; ch++ {
-		if tensor[ch][toRow][toCol] > 0 {
-			return false // Can't capture own piece
+	for _, m := range pos.ValidMoves() {
+		if int(m.S1()) == fromSquare && int(m.S2()) == toSquare {
+			return true
 		}
 	}
+	return false
+}
 
-	// Basic movement rules
-	rowDiff := absInt(toRow - fromRow)
-	colDiff := absInt(toCol - fromCol)
-
-	switch movingPieceType {
-	case 0: // Pawn
-		// Very basic pawn check (no en passant, promotion complexity)
-		if isWhite {
-			if toRow <= fromRow {
-				return false // Must move forward
-			}
-			if colDiff == 0 && rowDiff <= 2 {
-				return true // Forward move (simplified)
-			}
-			if colDiff == 1 && rowDiff == 1 {
-				return true // Diagonal capture (simplified)
-			}
-		} else {
-			if toRow >= fromRow {
-				return false
-			}
-			if colDiff == 0 && rowDiff <= 2 {
-				return true
-			}
-			if colDiff == 1 && rowDiff == 1 {
-				return true
-			}
-		}
-		return false
-
-	case 1: // Knight
-		return (rowDiff == 2 && colDiff == 1) || (rowDiff == 1 && colDiff == 2)
-
-	case 2: // Bishop
-		return rowDiff == colDiff && rowDiff > 0
-
-	case 3: // Rook
-		return (rowDiff == 0 && colDiff > 0) || (colDiff == 0 && rowDiff > 0)
-
-	case 4: // Queen
-		return (rowDiff == colDiff && rowDiff > 0) ||
-			(rowDiff == 0 && colDiff > 0) ||
-			(colDiff == 0 && rowDiff > 0)
+// positionForMover rebuilds the board of a 12-plane tensor with the owner of
+// the piece on fromSquare to move
+func positionForMover(tensor [12][8][8]float32, fromSquare int) (*chess.Position, error) {
+	board, err := data.BoardFromState(data.TensorToFlatArray(tensor))
+	if err != nil {
+		return nil, err
+	}
 
-	case 5: // King
-		return rowDiff <= 1 && colDiff <= 1 && (rowDiff+colDiff) > 0
+	piece := board.Piece(chess.Square(fromSquare))
+	if piece == chess.NoPiece {
+		return nil, fmt.Errorf("no piece on square %d", fromSquare)
 	}
 
-	return true
+	aux := data.DefaultAuxState()
+	aux.WhiteToMove = piece.Color() == chess.White
+	return data.NewPosition(board, aux)
 }
 
-// FilterIllegalMoves removes obviously illegal moves from predictions
+// FilterIllegalMoves removes illegal moves from predictions (see IsLegalMovePlausible)
 func FilterIllegalMoves(predictions []MovePrediction, tensor [12][8][8]float32) []MovePrediction {
 	filtered := make([]MovePrediction, 0, len(predictions))
 
@@ -0,0 +1,343 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Run evaluates the graph on the given inputs and returns its outputs. It
+// supports the operators used by exported models (Conv, Gemm, Relu, Tanh,
+// Add, Flatten and Softmax) in float32 with float64 accumulation. It is a
+// reference implementation for checking exports, not a fast runtime.
+func Run(m *Model, inputs map[string]*Tensor) (map[string]*Tensor, error) {
+	values := make(map[string]*Tensor, len(m.Graph.Initializers)+len(m.Graph.Nodes))
+	for i := range m.Graph.Initializers {
+		t := &m.Graph.Initializers[i]
+		values[t.Name] = t
+	}
+	for _, in := range m.Graph.Inputs {
+		if _, ok := values[in.Name]; ok {
+			continue
+		}
+		t, ok := inputs[in.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %s", in.Name)
+		}
+		if len(t.Data) != t.Size() {
+			return nil, fmt.Errorf("input %s has %d values for shape %v", in.Name, len(t.Data), t.Dims)
+		}
+		values[in.Name] = t
+	}
+
+	for i := range m.Graph.Nodes {
+		n := &m.Graph.Nodes[i]
+		args := make([]*Tensor, len(n.Inputs))
+		for j, name := range n.Inputs {
+			if name == "" {
+				continue // Omitted optional input
+			}
+			t, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("node %s: undefined input %s", n.Name, name)
+			}
+			args[j] = t
+		}
+
+		out, err := evalNode(n, args)
+		if err != nil {
+			return nil, fmt.Errorf("node %s (%s): %w", n.Name, n.OpType, err)
+		}
+		if len(n.Outputs) != 1 {
+			return nil, fmt.Errorf("node %s: expected 1 output, got %d", n.Name, len(n.Outputs))
+		}
+		out.Name = n.Outputs[0]
+		values[out.Name] = out
+	}
+
+	outputs := make(map[string]*Tensor, len(m.Graph.Outputs))
+	for _, o := range m.Graph.Outputs {
+		t, ok := values[o.Name]
+		if !ok {
+			return nil, fmt.Errorf("output %s is not computed by the graph", o.Name)
+		}
+		outputs[o.Name] = t
+	}
+	return outputs, nil
+}
+
+func evalNode(n *Node, args []*Tensor) (*Tensor, error) {
+	need := map[string]int{"Conv": 2, "Gemm": 2, "Add": 2, "Relu": 1, "Tanh": 1, "Flatten": 1, "Softmax": 1}
+	min, ok := need[n.OpType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported operator")
+	}
+	if len(args) < min {
+		return nil, fmt.Errorf("expected %d inputs, got %d", min, len(args))
+	}
+	for i := 0; i < min; i++ {
+		if args[i] == nil {
+			return nil, fmt.Errorf("missing input %d", i)
+		}
+	}
+
+	switch n.OpType {
+	case "Conv":
+		var bias *Tensor
+		if len(args) > 2 {
+			bias = args[2]
+		}
+		return conv(n, args[0], args[1], bias)
+	case "Gemm":
+		var c *Tensor
+		if len(args) > 2 {
+			c = args[2]
+		}
+		return gemm(n, args[0], args[1], c)
+	case "Add":
+		return add(args[0], args[1])
+	case "Relu":
+		return unary(args[0], func(x float64) float64 { return math.Max(x, 0) }), nil
+	case "Tanh":
+		return unary(args[0], math.Tanh), nil
+	case "Flatten":
+		return flatten(n, args[0])
+	default:
+		return softmax(n, args[0])
+	}
+}
+
+// conv computes a 2D NCHW convolution with group 1 and dilation 1
+func conv(n *Node, x, w, b *Tensor) (*Tensor, error) {
+	if len(x.Dims) != 4 || len(w.Dims) != 4 {
+		return nil, fmt.Errorf("expected 4D input and weights, got %v and %v", x.Dims, w.Dims)
+	}
+	if a, ok := n.Attribute("group"); ok && a.I != 1 {
+		return nil, fmt.Errorf("group %d is not supported", a.I)
+	}
+	if a, ok := n.Attribute("dilations"); ok {
+		for _, d := range a.Ints {
+			if d != 1 {
+				return nil, fmt.Errorf("dilations %v are not supported", a.Ints)
+			}
+		}
+	}
+
+	batch, inC, inH, inW := int(x.Dims[0]), int(x.Dims[1]), int(x.Dims[2]), int(x.Dims[3])
+	outC, kC, kH, kW := int(w.Dims[0]), int(w.Dims[1]), int(w.Dims[2]), int(w.Dims[3])
+	if kC != inC {
+		return nil, fmt.Errorf("weights expect %d channels, input has %d", kC, inC)
+	}
+	if b != nil && b.Size() != outC {
+		return nil, fmt.Errorf("bias has %d values for %d channels", b.Size(), outC)
+	}
+
+	strides, pads := []int64{1, 1}, []int64{0, 0, 0, 0}
+	if a, ok := n.Attribute("strides"); ok {
+		strides = a.Ints
+	}
+	if a, ok := n.Attribute("pads"); ok {
+		pads = a.Ints
+	}
+	if len(strides) != 2 || len(pads) != 4 {
+		return nil, fmt.Errorf("invalid strides %v or pads %v", strides, pads)
+	}
+	padT, padL := int(pads[0]), int(pads[1])
+	outH := (inH+padT+int(pads[2])-kH)/int(strides[0]) + 1
+	outW := (inW+padL+int(pads[3])-kW)/int(strides[1]) + 1
+
+	out := &Tensor{Dims: []int64{int64(batch), int64(outC), int64(outH), int64(outW)}}
+	out.Data = make([]float32, out.Size())
+	for bi := 0; bi < batch; bi++ {
+		for oc := 0; oc < outC; oc++ {
+			for oy := 0; oy < outH; oy++ {
+				for ox := 0; ox < outW; ox++ {
+					sum := 0.0
+					if b != nil {
+						sum = float64(b.Data[oc])
+					}
+					for ic := 0; ic < inC; ic++ {
+						for ky := 0; ky < kH; ky++ {
+							iy := oy*int(strides[0]) - padT + ky
+							if iy < 0 || iy >= inH {
+								continue
+							}
+							for kx := 0; kx < kW; kx++ {
+								ix := ox*int(strides[1]) - padL + kx
+								if ix < 0 || ix >= inW {
+									continue
+								}
+								xv := x.Data[((bi*inC+ic)*inH+iy)*inW+ix]
+								wv := w.Data[((oc*kC+ic)*kH+ky)*kW+kx]
+								sum += float64(xv) * float64(wv)
+							}
+						}
+					}
+					out.Data[((bi*outC+oc)*outH+oy)*outW+ox] = float32(sum)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// gemm computes alpha*A'*B' + beta*C with C broadcast over rows
+func gemm(n *Node, a, b, c *Tensor) (*Tensor, error) {
+	if len(a.Dims) != 2 || len(b.Dims) != 2 {
+		return nil, fmt.Errorf("expected 2D inputs, got %v and %v", a.Dims, b.Dims)
+	}
+	alpha, beta := 1.0, 1.0
+	if attr, ok := n.Attribute("alpha"); ok {
+		alpha = float64(attr.F)
+	}
+	if attr, ok := n.Attribute("beta"); ok {
+		beta = float64(attr.F)
+	}
+	transA, transB := false, false
+	if attr, ok := n.Attribute("transA"); ok {
+		transA = attr.I != 0
+	}
+	if attr, ok := n.Attribute("transB"); ok {
+		transB = attr.I != 0
+	}
+
+	m, k := int(a.Dims[0]), int(a.Dims[1])
+	if transA {
+		m, k = k, m
+	}
+	kb, cols := int(b.Dims[0]), int(b.Dims[1])
+	if transB {
+		kb, cols = cols, kb
+	}
+	if k != kb {
+		return nil, fmt.Errorf("inner dimensions %d and %d differ", k, kb)
+	}
+	if c != nil && c.Size() != cols && c.Size() != m*cols {
+		return nil, fmt.Errorf("C has shape %v for a %dx%d result", c.Dims, m, cols)
+	}
+
+	aAt := func(i, j int) float64 {
+		if transA {
+			return float64(a.Data[j*m+i])
+		}
+		return float64(a.Data[i*k+j])
+	}
+	bAt := func(i, j int) float64 {
+		if transB {
+			return float64(b.Data[j*k+i])
+		}
+		return float64(b.Data[i*cols+j])
+	}
+
+	out := &Tensor{Dims: []int64{int64(m), int64(cols)}, Data: make([]float32, m*cols)}
+	for i := 0; i < m; i++ {
+		for j := 0; j < cols; j++ {
+			sum := 0.0
+			for p := 0; p < k; p++ {
+				sum += aAt(i, p) * bAt(p, j)
+			}
+			sum *= alpha
+			if c != nil {
+				if c.Size() == cols {
+					sum += beta * float64(c.Data[j])
+				} else {
+					sum += beta * float64(c.Data[i*cols+j])
+				}
+			}
+			out.Data[i*cols+j] = float32(sum)
+		}
+	}
+	return out, nil
+}
+
+// add adds two tensors of the same shape
+func add(a, b *Tensor) (*Tensor, error) {
+	if !sameDims(a.Dims, b.Dims) {
+		return nil, fmt.Errorf("shapes %v and %v differ", a.Dims, b.Dims)
+	}
+	out := &Tensor{Dims: append([]int64(nil), a.Dims...), Data: make([]float32, len(a.Data))}
+	for i := range a.Data {
+		out.Data[i] = a.Data[i] + b.Data[i]
+	}
+	return out, nil
+}
+
+func unary(x *Tensor, fn func(float64) float64) *Tensor {
+	out := &Tensor{Dims: append([]int64(nil), x.Dims...), Data: make([]float32, len(x.Data))}
+	for i, v := range x.Data {
+		out.Data[i] = float32(fn(float64(v)))
+	}
+	return out
+}
+
+// flatten reshapes the input to 2D, splitting the dimensions at axis
+func flatten(n *Node, x *Tensor) (*Tensor, error) {
+	axis := 1
+	if a, ok := n.Attribute("axis"); ok {
+		axis = int(a.I)
+	}
+	if axis < 0 {
+		axis += len(x.Dims)
+	}
+	if axis < 0 || axis > len(x.Dims) {
+		return nil, fmt.Errorf("axis %d out of range for shape %v", axis, x.Dims)
+	}
+	rows := int64(1)
+	for _, d := range x.Dims[:axis] {
+		rows *= d
+	}
+	return &Tensor{Dims: []int64{rows, int64(x.Size()) / rows}, Data: x.Data}, nil
+}
+
+// softmax normalizes along the last axis, the only axis used by exports
+func softmax(n *Node, x *Tensor) (*Tensor, error) {
+	axis := int64(-1)
+	if a, ok := n.Attribute("axis"); ok {
+		axis = a.I
+	}
+	if axis < 0 {
+		axis += int64(len(x.Dims))
+	}
+	if axis != int64(len(x.Dims))-1 {
+		return nil, fmt.Errorf("softmax over axis %d of shape %v is not supported", axis, x.Dims)
+	}
+
+	width := int(x.Dims[len(x.Dims)-1])
+	out := &Tensor{Dims: append([]int64(nil), x.Dims...), Data: make([]float32, len(x.Data))}
+	for start := 0; start < len(x.Data); start += width {
+		row := x.Data[start : start+width]
+		maxV := math.Inf(-1)
+		for _, v := range row {
+			maxV = math.Max(maxV, float64(v))
+		}
+		sum := 0.0
+		for _, v := range row {
+			sum += math.Exp(float64(v) - maxV)
+		}
+		for i, v := range row {
+			out.Data[start+i] = float32(math.Exp(float64(v)-maxV) / sum)
+		}
+	}
+	return out, nil
+}
+
+func sameDims(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,579 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Versions written to exported models
+const (
+	IRVersion       = 7  // ONNX IR version 1.8
+	OpsetVersion    = 13 // Default domain operator set
+	ProducerName    = "partner"
+	ProducerVersion = "1.0"
+	DataTypeFloat   = 1 // TensorProto.FLOAT
+)
+
+// Attribute types (AttributeProto.AttributeType)
+const (
+	AttributeFloat  = 1
+	AttributeInt    = 2
+	AttributeString = 3
+	AttributeInts   = 7
+)
+
+// Model is the subset of an ONNX ModelProto used by P.A.R.T.N.E.R exports
+type Model struct {
+	IRVersion       int64
+	OpsetVersion    int64
+	ProducerName    string
+	ProducerVersion string
+	DocString       string
+	Metadata        map[string]string
+	Graph           Graph
+}
+
+// Graph is an ONNX GraphProto: nodes in topological order, weights stored
+// as initializers and the typed graph inputs and outputs
+type Graph struct {
+	Name         string
+	Nodes        []Node
+	Initializers []Tensor
+	Inputs       []ValueInfo
+	Outputs      []ValueInfo
+}
+
+// Node is a single operator application
+type Node struct {
+	Name       string
+	OpType     string
+	Inputs     []string
+	Outputs    []string
+	Attributes []Attribute
+}
+
+// Attribute is a named operator attribute. Only the field matching Type is set.
+type Attribute struct {
+	Name string
+	Type int
+	F    float32
+	I    int64
+	S    string
+	Ints []int64
+}
+
+// Tensor is a named float32 tensor
+type Tensor struct {
+	Name string
+	Dims []int64
+	Data []float32
+}
+
+// ValueInfo describes a float tensor graph input or output. A Dims entry
+// below zero is a symbolic dimension named by the matching DimParams entry.
+type ValueInfo struct {
+	Name      string
+	Dims      []int64
+	DimParams []string
+}
+
+// IntAttr returns an integer attribute
+func IntAttr(name string, v int64) Attribute {
+	return Attribute{Name: name, Type: AttributeInt, I: v}
+}
+
+// IntsAttr returns an integer list attribute
+func IntsAttr(name string, v ...int64) Attribute {
+	return Attribute{Name: name, Type: AttributeInts, Ints: v}
+}
+
+// FloatAttr returns a float attribute
+func FloatAttr(name string, v float32) Attribute {
+	return Attribute{Name: name, Type: AttributeFloat, F: v}
+}
+
+// Attribute returns the attribute with the given name
+func (n *Node) Attribute(name string) (Attribute, bool) {
+	for _, a := range n.Attributes {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// Size returns the number of elements of the tensor
+func (t *Tensor) Size() int {
+	size := 1
+	for _, d := range t.Dims {
+		size *= int(d)
+	}
+	return size
+}
+
+// WriteFile serializes the model to an .onnx file
+func WriteFile(path string, m *Model) error {
+	if err := os.WriteFile(path, Marshal(m), 0644); err != nil {
+		return fmt.Errorf("failed to write model: %w", err)
+	}
+	return nil
+}
+
+// ReadFile parses an .onnx file
+func ReadFile(path string) (*Model, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model: %w", err)
+	}
+	return Unmarshal(b)
+}
+
+// Marshal encodes the model as an ONNX ModelProto
+func Marshal(m *Model) []byte {
+	var b []byte
+	b = appendInt(b, 1, m.IRVersion)
+	b = appendString(b, 2, m.ProducerName)
+	b = appendString(b, 3, m.ProducerVersion)
+	b = appendString(b, 6, m.DocString)
+	b = appendMessage(b, 7, marshalGraph(&m.Graph))
+
+	var opset []byte
+	opset = appendInt(opset, 2, m.OpsetVersion)
+	b = appendMessage(b, 8, opset)
+
+	for _, key := range sortedKeys(m.Metadata) {
+		var entry []byte
+		entry = appendString(entry, 1, key)
+		entry = appendString(entry, 2, m.Metadata[key])
+		b = appendMessage(b, 14, entry)
+	}
+	return b
+}
+
+func marshalGraph(g *Graph) []byte {
+	var b []byte
+	for i := range g.Nodes {
+		b = appendMessage(b, 1, marshalNode(&g.Nodes[i]))
+	}
+	b = appendString(b, 2, g.Name)
+	for i := range g.Initializers {
+		b = appendMessage(b, 5, marshalTensor(&g.Initializers[i]))
+	}
+	for i := range g.Inputs {
+		b = appendMessage(b, 11, marshalValueInfo(&g.Inputs[i]))
+	}
+	for i := range g.Outputs {
+		b = appendMessage(b, 12, marshalValueInfo(&g.Outputs[i]))
+	}
+	return b
+}
+
+func marshalNode(n *Node) []byte {
+	var b []byte
+	for _, in := range n.Inputs {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, in)
+	}
+	for _, out := range n.Outputs {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, out)
+	}
+	b = appendString(b, 3, n.Name)
+	b = appendString(b, 4, n.OpType)
+	for i := range n.Attributes {
+		b = appendMessage(b, 5, marshalAttribute(&n.Attributes[i]))
+	}
+	return b
+}
+
+func marshalAttribute(a *Attribute) []byte {
+	var b []byte
+	b = appendString(b, 1, a.Name)
+	switch a.Type {
+	case AttributeFloat:
+		b = protowire.AppendTag(b, 2, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(a.F))
+	case AttributeInt:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(a.I))
+	case AttributeString:
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, a.S)
+	case AttributeInts:
+		var packed []byte
+		for _, v := range a.Ints {
+			packed = protowire.AppendVarint(packed, uint64(v))
+		}
+		b = appendMessage(b, 8, packed)
+	}
+	b = protowire.AppendTag(b, 20, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(a.Type))
+	return b
+}
+
+func marshalTensor(t *Tensor) []byte {
+	var b []byte
+	if len(t.Dims) > 0 {
+		var packed []byte
+		for _, d := range t.Dims {
+			packed = protowire.AppendVarint(packed, uint64(d))
+		}
+		b = appendMessage(b, 1, packed)
+	}
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, DataTypeFloat)
+	b = appendString(b, 8, t.Name)
+
+	raw := make([]byte, 4*len(t.Data))
+	for i, v := range t.Data {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(v))
+	}
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	b = protowire.AppendBytes(b, raw)
+	return b
+}
+
+func marshalValueInfo(v *ValueInfo) []byte {
+	var shape []byte
+	for i, d := range v.Dims {
+		var dim []byte
+		if d < 0 {
+			dim = appendString(dim, 2, v.DimParams[i])
+		} else {
+			dim = protowire.AppendTag(dim, 1, protowire.VarintType)
+			dim = protowire.AppendVarint(dim, uint64(d))
+		}
+		shape = appendMessage(shape, 1, dim)
+	}
+
+	var tensorType []byte
+	tensorType = protowire.AppendTag(tensorType, 1, protowire.VarintType)
+	tensorType = protowire.AppendVarint(tensorType, DataTypeFloat)
+	tensorType = appendMessage(tensorType, 2, shape)
+
+	var typ []byte
+	typ = appendMessage(typ, 1, tensorType)
+
+	var b []byte
+	b = appendString(b, 1, v.Name)
+	b = appendMessage(b, 2, typ)
+	return b
+}
+
+// appendInt appends a non-zero varint field
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendString appends a non-empty string field
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendMessage appends an embedded message or packed field
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// Unmarshal decodes an ONNX ModelProto. Fields that P.A.R.T.N.E.R does not
+// use are skipped; tensors must be float32 in raw_data or float_data.
+func Unmarshal(b []byte) (*Model, error) {
+	m := &Model{Metadata: make(map[string]string)}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v uint64, field []byte) error {
+		switch num {
+		case 1:
+			m.IRVersion = int64(v)
+		case 2:
+			m.ProducerName = string(field)
+		case 3:
+			m.ProducerVersion = string(field)
+		case 6:
+			m.DocString = string(field)
+		case 7:
+			g, err := unmarshalGraph(field)
+			if err != nil {
+				return fmt.Errorf("graph: %w", err)
+			}
+			m.Graph = *g
+		case 8:
+			var domain string
+			var version int64
+			err := walkFields(field, func(num protowire.Number, _ protowire.Type, v uint64, field []byte) error {
+				switch num {
+				case 1:
+					domain = string(field)
+				case 2:
+					version = int64(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if domain == "" || domain == "ai.onnx" {
+				m.OpsetVersion = version
+			}
+		case 14:
+			var key, value string
+			err := walkFields(field, func(num protowire.Number, _ protowire.Type, _ uint64, field []byte) error {
+				switch num {
+				case 1:
+					key = string(field)
+				case 2:
+					value = string(field)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			m.Metadata[key] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ONNX model: %w", err)
+	}
+	return m, nil
+}
+
+func unmarshalGraph(b []byte) (*Graph, error) {
+	g := &Graph{}
+	err := walkFields(b, func(num protowire.Number, _ protowire.Type, _ uint64, field []byte) error {
+		switch num {
+		case 1:
+			n, err := unmarshalNode(field)
+			if err != nil {
+				return err
+			}
+			g.Nodes = append(g.Nodes, *n)
+		case 2:
+			g.Name = string(field)
+		case 5:
+			t, err := unmarshalTensor(field)
+			if err != nil {
+				return err
+			}
+			g.Initializers = append(g.Initializers, *t)
+		case 11, 12:
+			v, err := unmarshalValueInfo(field)
+			if err != nil {
+				return err
+			}
+			if num == 11 {
+				g.Inputs = append(g.Inputs, *v)
+			} else {
+				g.Outputs = append(g.Outputs, *v)
+			}
+		}
+		return nil
+	})
+	return g, err
+}
+
+func unmarshalNode(b []byte) (*Node, error) {
+	n := &Node{}
+	err := walkFields(b, func(num protowire.Number, _ protowire.Type, _ uint64, field []byte) error {
+		switch num {
+		case 1:
+			n.Inputs = append(n.Inputs, string(field))
+		case 2:
+			n.Outputs = append(n.Outputs, string(field))
+		case 3:
+			n.Name = string(field)
+		case 4:
+			n.OpType = string(field)
+		case 5:
+			a, err := unmarshalAttribute(field)
+			if err != nil {
+				return err
+			}
+			n.Attributes = append(n.Attributes, *a)
+		}
+		return nil
+	})
+	return n, err
+}
+
+func unmarshalAttribute(b []byte) (*Attribute, error) {
+	a := &Attribute{}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v uint64, field []byte) error {
+		switch num {
+		case 1:
+			a.Name = string(field)
+		case 2:
+			a.F = math.Float32frombits(uint32(v))
+		case 3:
+			a.I = int64(v)
+		case 4:
+			a.S = string(field)
+		case 8:
+			ints, err := varints(typ, v, field)
+			if err != nil {
+				return err
+			}
+			a.Ints = append(a.Ints, ints...)
+		case 20:
+			a.Type = int(v)
+		}
+		return nil
+	})
+	return a, err
+}
+
+func unmarshalTensor(b []byte) (*Tensor, error) {
+	t := &Tensor{}
+	dataType := int64(DataTypeFloat)
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v uint64, field []byte) error {
+		switch num {
+		case 1:
+			dims, err := varints(typ, v, field)
+			if err != nil {
+				return err
+			}
+			t.Dims = append(t.Dims, dims...)
+		case 2:
+			dataType = int64(v)
+		case 4:
+			if typ == protowire.Fixed32Type {
+				t.Data = append(t.Data, math.Float32frombits(uint32(v)))
+				return nil
+			}
+			for len(field) >= 4 {
+				t.Data = append(t.Data, math.Float32frombits(binary.LittleEndian.Uint32(field)))
+				field = field[4:]
+			}
+		case 8:
+			t.Name = string(field)
+		case 9:
+			if len(field)%4 != 0 {
+				return fmt.Errorf("tensor raw data length %d is not a multiple of 4", len(field))
+			}
+			t.Data = make([]float32, len(field)/4)
+			for i := range t.Data {
+				t.Data[i] = math.Float32frombits(binary.LittleEndian.Uint32(field[4*i:]))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dataType != DataTypeFloat {
+		return nil, fmt.Errorf("tensor %s has unsupported data type %d", t.Name, dataType)
+	}
+	if len(t.Data) != t.Size() {
+		return nil, fmt.Errorf("tensor %s has %d values for shape %v", t.Name, len(t.Data), t.Dims)
+	}
+	return t, nil
+}
+
+func unmarshalValueInfo(b []byte) (*ValueInfo, error) {
+	v := &ValueInfo{}
+	err := walkFields(b, func(num protowire.Number, _ protowire.Type, _ uint64, field []byte) error {
+		switch num {
+		case 1:
+			v.Name = string(field)
+		case 2:
+			// TypeProto.tensor_type.shape.dim
+			return walkFields(field, func(num protowire.Number, _ protowire.Type, _ uint64, field []byte) error {
+				if num != 1 {
+					return nil
+				}
+				return walkFields(field, func(num protowire.Number, _ protowire.Type, _ uint64, field []byte) error {
+					if num != 2 {
+						return nil
+					}
+					return walkFields(field, func(num protowire.Number, _ protowire.Type, _ uint64, field []byte) error {
+						if num != 1 {
+							return nil
+						}
+						dim, param := int64(-1), ""
+						err := walkFields(field, func(num protowire.Number, _ protowire.Type, val uint64, field []byte) error {
+							switch num {
+							case 1:
+								dim = int64(val)
+							case 2:
+								param = string(field)
+							}
+							return nil
+						})
+						v.Dims = append(v.Dims, dim)
+						v.DimParams = append(v.DimParams, param)
+						return err
+					})
+				})
+			})
+		}
+		return nil
+	})
+	return v, err
+}
+
+// walkFields calls fn for each field of a message with the varint or fixed
+// value for scalar fields and the contents for length-delimited fields
+func walkFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, field []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v uint64
+		var field []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			v = uint64(v32)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			field, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// varints decodes a repeated int64 field in either packed or unpacked form
+func varints(typ protowire.Type, v uint64, field []byte) ([]int64, error) {
+	if typ == protowire.VarintType {
+		return []int64{int64(v)}, nil
+	}
+	var values []int64
+	for len(field) > 0 {
+		x, n := protowire.ConsumeVarint(field)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		values = append(values, int64(x))
+		field = field[n:]
+	}
+	return values, nil
+}
@@ -0,0 +1,77 @@
+package onnx
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testModel computes softmax(relu(conv(x)) flattened * W + b) for a
+// [batch, 1, 2, 2] input with a 1x1 kernel of weight 2
+func testModel() *Model {
+	return &Model{
+		IRVersion:    IRVersion,
+		OpsetVersion: OpsetVersion,
+		ProducerName: ProducerName,
+		Metadata:     map[string]string{"model_type": "test"},
+		Graph: Graph{
+			Name: "test",
+			Nodes: []Node{
+				{Name: "conv", OpType: "Conv", Inputs: []string{"x", "k"}, Outputs: []string{"conv"},
+					Attributes: []Attribute{IntsAttr("kernel_shape", 1, 1), IntsAttr("pads", 0, 0, 0, 0)}},
+				{Name: "relu", OpType: "Relu", Inputs: []string{"conv"}, Outputs: []string{"relu"}},
+				{Name: "flat", OpType: "Flatten", Inputs: []string{"relu"}, Outputs: []string{"flat"},
+					Attributes: []Attribute{IntAttr("axis", 1)}},
+				{Name: "fc", OpType: "Gemm", Inputs: []string{"flat", "w", "b"}, Outputs: []string{"logits"},
+					Attributes: []Attribute{FloatAttr("alpha", 1), FloatAttr("beta", 1)}},
+				{Name: "softmax", OpType: "Softmax", Inputs: []string{"logits"}, Outputs: []string{"probs"},
+					Attributes: []Attribute{IntAttr("axis", 1)}},
+			},
+			Initializers: []Tensor{
+				{Name: "k", Dims: []int64{1, 1, 1, 1}, Data: []float32{2}},
+				{Name: "w", Dims: []int64{4, 2}, Data: []float32{1, 0, 0, 1, 1, 0, 0, 1}},
+				{Name: "b", Dims: []int64{2}, Data: []float32{0, 1}},
+			},
+			Inputs:  []ValueInfo{{Name: "x", Dims: []int64{-1, 1, 2, 2}, DimParams: []string{"batch", "", "", ""}}},
+			Outputs: []ValueInfo{{Name: "logits", Dims: []int64{-1, 2}, DimParams: []string{"batch", ""}}, {Name: "probs", Dims: []int64{-1, 2}, DimParams: []string{"batch", ""}}},
+		},
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	m := testModel()
+	decoded, err := Unmarshal(Marshal(m))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, m) {
+		t.Errorf("Decoded model differs:\n got %+v\nwant %+v", decoded, m)
+	}
+
+	if _, err := Unmarshal([]byte{0x0a, 0x05, 0x01}); err == nil {
+		t.Error("Expected error for truncated model")
+	}
+}
+
+func TestRun(t *testing.T) {
+	// Second sample has negative pixels that the ReLU clears
+	x := &Tensor{Dims: []int64{2, 1, 2, 2}, Data: []float32{1, 2, 3, 4, -1, 1, -1, 1}}
+	outputs, err := Run(testModel(), map[string]*Tensor{"x": x})
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+
+	// Logits: [2*(1+3), 2*(2+4)+1] and [0, 2*(1+1)+1]
+	want := []float32{8, 13, 0, 5}
+	if got := outputs["logits"].Data; !reflect.DeepEqual(got, want) {
+		t.Errorf("Logits = %v; want %v", got, want)
+	}
+	probs := outputs["probs"].Data
+	if p := float64(probs[1]); math.Abs(p-1/(1+math.Exp(-5))) > 1e-6 {
+		t.Errorf("Probability = %v; want %v", p, 1/(1+math.Exp(-5)))
+	}
+
+	if _, err := Run(testModel(), nil); err == nil {
+		t.Error("Expected error for missing input")
+	}
+}
@@ -0,0 +1,137 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/model"
+)
+
+// Evaluation is the network's view of a position
+type Evaluation struct {
+	Priors []float64 // Prior of each move, in pos.ValidMoves() order
+	Value  float64   // Side to move's evaluation in [-1, 1]
+}
+
+// Evaluator scores the positions the search expands. It is called from
+// every search worker at once.
+type Evaluator interface {
+	Evaluate(ctx context.Context, pos *chess.Position) (Evaluation, error)
+}
+
+// NetworkEvaluator takes priors from a model's policy and the value from its
+// value head. Models without a value head fall back to the material balance.
+type NetworkEvaluator struct {
+	runtime *model.Runtime
+	forward func(ctx context.Context, state []float32, pos *chess.Position) ([]float64, float64, error)
+}
+
+// NewRuntimeEvaluator evaluates positions one at a time with a Runtime
+func NewRuntimeEvaluator(r *model.Runtime) *NetworkEvaluator {
+	return &NetworkEvaluator{
+		runtime: r,
+		forward: func(_ context.Context, state []float32, pos *chess.Position) ([]float64, float64, error) {
+			return r.ForwardLegal(state, pos)
+		},
+	}
+}
+
+// NewBatcherEvaluator evaluates positions through a Batcher, so that the
+// leaves of parallel search workers share forward passes
+func NewBatcherEvaluator(b *model.Batcher) *NetworkEvaluator {
+	return &NetworkEvaluator{runtime: b.Runtime(), forward: b.ForwardLegal}
+}
+
+// HasValueHead reports whether values come from the network rather than
+// the material balance
+func (e *NetworkEvaluator) HasValueHead() bool {
+	return e.runtime.HasValueHead()
+}
+
+// Evaluate implements Evaluator
+func (e *NetworkEvaluator) Evaluate(ctx context.Context, pos *chess.Position) (Evaluation, error) {
+	state, err := data.TensorizePosition(pos, e.runtime.InputChannels())
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("failed to tensorize position: %w", err)
+	}
+	probs, value, err := e.forward(ctx, state, pos)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("inference failed: %w", err)
+	}
+
+	moves := pos.ValidMoves()
+	priors := make([]float64, len(moves))
+	encoding := e.runtime.MoveEncoding()
+	for i, move := range moves {
+		index, err := encoding.EncodeMoveIndex(int(move.S1()), int(move.S2()), move.Promo())
+		if err == nil {
+			priors[i] = probs[index]
+		}
+	}
+	normalizePriors(priors)
+
+	if !e.runtime.HasValueHead() {
+		value = MaterialValue(pos)
+	}
+	return Evaluation{Priors: priors, Value: value}, nil
+}
+
+// normalizePriors scales priors to sum to 1. Promotions that share a policy
+// index count once per piece, and an all-zero policy becomes uniform.
+func normalizePriors(priors []float64) {
+	sum := 0.0
+	for _, p := range priors {
+		sum += p
+	}
+	for i := range priors {
+		if sum > 0 {
+			priors[i] /= sum
+		} else {
+			priors[i] = 1 / float64(len(priors))
+		}
+	}
+}
+
+// pieceValues are the centipawn values of the material fallback
+var pieceValues = map[chess.PieceType]int{
+	chess.Pawn:   100,
+	chess.Knight: 320,
+	chess.Bishop: 330,
+	chess.Rook:   500,
+	chess.Queen:  900,
+}
+
+// MaterialBalance is the side to move's material advantage in centipawns
+func MaterialBalance(pos *chess.Position) int {
+	balance := 0
+	for _, piece := range pos.Board().SquareMap() {
+		if piece.Color() == pos.Turn() {
+			balance += pieceValues[piece.Type()]
+		} else {
+			balance -= pieceValues[piece.Type()]
+		}
+	}
+	return balance
+}
+
+// MaterialValue is the material balance as a value in [-1, 1]
+func MaterialValue(pos *chess.Position) float64 {
+	return CentipawnsToValue(MaterialBalance(pos))
+}
+
+// ValueToCentipawns converts a value in [-1, 1] to centipawns with the
+// logistic Elo curve, so that a value of 0.5 (a 75% expected score) is
+// about 190cp
+func ValueToCentipawns(value float64) int {
+	value = math.Max(-0.999, math.Min(0.999, value))
+	return int(math.Round(400 * math.Log10((1+value)/(1-value))))
+}
+
+// CentipawnsToValue is the inverse of ValueToCentipawns
+func CentipawnsToValue(cp int) float64 {
+	return math.Tanh(float64(cp) * math.Ln10 / 800)
+}
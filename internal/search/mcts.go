@@ -0,0 +1,366 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// ErrGameOver is returned when the searched position has no legal moves
+var ErrGameOver = errors.New("position has no legal moves")
+
+// Config controls a PUCT search
+type Config struct {
+	Playouts    int           // Playouts per search, 0 for no limit
+	TimeBudget  time.Duration // Search time, 0 for no limit
+	Workers     int           // Goroutines running playouts in parallel
+	CPuct       float64       // Weight of the prior against the value
+	VirtualLoss float64       // Value a worker charges to the nodes it is exploring
+}
+
+// DefaultConfig returns the default search configuration
+func DefaultConfig() Config {
+	return Config{
+		Playouts:    800,
+		Workers:     1,
+		CPuct:       1.5,
+		VirtualLoss: 1,
+	}
+}
+
+// MoveStat is the search's view of one root move
+type MoveStat struct {
+	Move   string   // UCI notation
+	Visits int      // Playouts through the move
+	Share  float64  // Fraction of the root's playouts
+	Value  float64  // Mean value for the side to move, 0 before the first visit
+	Prior  float64  // Policy prior
+	PV     []string // Principal variation starting with the move
+}
+
+// Result is the outcome of a search
+type Result struct {
+	Moves    []MoveStat // Root moves, most visited first
+	Playouts int
+	Nodes    int // Positions evaluated
+	Depth    int // Deepest playout
+	Value    float64
+	Elapsed  time.Duration
+}
+
+// Best returns the most visited move
+func (r *Result) Best() MoveStat {
+	return r.Moves[0]
+}
+
+// Node states
+const (
+	unexpanded = iota
+	pending    // Being evaluated by a worker
+	expanded
+	terminal
+)
+
+// node is a position in the search tree. Visits and values are stored from
+// the view of the side that played the move into the node.
+type node struct {
+	move     *chess.Move
+	pos      *chess.Position // Set once the node is expanded
+	prior    float64
+	state    int
+	visits   int
+	inFlight int // Workers currently below the node
+	valueSum float64
+	terminal float64 // Side to move's value of a terminal node
+	children []*node
+	ready    chan struct{} // Closed when a pending node is expanded
+}
+
+// Searcher runs PUCT (MCTS with policy priors) over the legal moves of a
+// position. Workers share one tree; a worker exploring a node charges it a
+// virtual loss so that the others spread out instead of evaluating the
+// same leaf.
+type Searcher struct {
+	evaluator Evaluator
+	config    Config
+}
+
+// tree is the state of one search
+type tree struct {
+	config    Config
+	evaluator Evaluator
+
+	mu       sync.Mutex
+	root     *node
+	started  int // Playouts started, including terminal ones
+	nodes    int
+	maxDepth int
+	err      error
+}
+
+// NewSearcher creates a searcher. With neither Playouts nor TimeBudget set
+// a search runs until its context is cancelled.
+func NewSearcher(evaluator Evaluator, config Config) *Searcher {
+	defaults := DefaultConfig()
+	if config.Workers < 1 {
+		config.Workers = defaults.Workers
+	}
+	if config.CPuct <= 0 {
+		config.CPuct = defaults.CPuct
+	}
+	if config.VirtualLoss < 0 {
+		config.VirtualLoss = 0
+	}
+	return &Searcher{evaluator: evaluator, config: config}
+}
+
+// Config returns the searcher's configuration
+func (s *Searcher) Config() Config {
+	return s.config
+}
+
+// Search runs playouts from pos until the playout count or time budget is
+// reached, or ctx is cancelled, and ranks the root moves by visit count
+func (s *Searcher) Search(ctx context.Context, pos *chess.Position) (*Result, error) {
+	start := time.Now()
+	if len(pos.ValidMoves()) == 0 {
+		return nil, ErrGameOver
+	}
+	if s.config.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.TimeBudget)
+		defer cancel()
+	}
+
+	// The root is evaluated even when ctx is done, so that a search stopped
+	// early still ranks the moves by their priors
+	t := &tree{config: s.config, evaluator: s.evaluator, root: &node{}}
+	eval, err := s.evaluator.Evaluate(context.WithoutCancel(ctx), pos)
+	if err != nil {
+		return nil, err
+	}
+	t.root.pos = pos
+	t.root.visits, t.root.valueSum = 1, -eval.Value
+	t.expand(t.root, eval)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t.result(time.Since(start)), nil
+}
+
+// work runs playouts until the search is done
+func (t *tree) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		t.mu.Lock()
+		if t.err != nil || (t.config.Playouts > 0 && t.started >= t.config.Playouts) {
+			t.mu.Unlock()
+			return
+		}
+		path := t.selectPath()
+		leaf := path[len(path)-1]
+
+		switch leaf.state {
+		case terminal:
+			t.started++
+			t.backup(path, leaf.terminal)
+			t.mu.Unlock()
+			continue
+		case pending:
+			// Another worker is evaluating the leaf; wait for it
+			ready := leaf.ready
+			t.release(path)
+			t.mu.Unlock()
+			select {
+			case <-ready:
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		t.started++
+		leaf.state = pending
+		leaf.ready = make(chan struct{})
+		parent := path[len(path)-2]
+		t.mu.Unlock()
+
+		pos := parent.pos.Update(leaf.move)
+		var eval Evaluation
+		var err error
+		if len(pos.ValidMoves()) > 0 {
+			eval, err = t.evaluator.Evaluate(ctx, pos)
+		}
+
+		t.mu.Lock()
+		leaf.pos = pos
+		switch {
+		case err != nil:
+			// Abandon the playout; a cancelled search is not an error
+			if ctx.Err() == nil && t.err == nil {
+				t.err = err
+			}
+			leaf.state = unexpanded
+			t.started--
+			t.release(path)
+		case len(pos.ValidMoves()) == 0:
+			leaf.state = terminal
+			if pos.Status() == chess.Checkmate {
+				leaf.terminal = -1
+			}
+			t.backup(path, leaf.terminal)
+		default:
+			t.expand(leaf, eval)
+			t.backup(path, eval.Value)
+		}
+		close(leaf.ready)
+		t.mu.Unlock()
+	}
+}
+
+// selectPath descends from the root by PUCT to an unexpanded, pending or
+// terminal node and charges a virtual loss to the nodes on the way
+func (t *tree) selectPath() []*node {
+	path := []*node{t.root}
+	n := t.root
+	n.inFlight++
+	for n.state == expanded {
+		n = t.selectChild(n)
+		n.inFlight++
+		path = append(path, n)
+	}
+	if len(path)-1 > t.maxDepth {
+		t.maxDepth = len(path) - 1
+	}
+	return path
+}
+
+// selectChild returns the child maximizing Q + U, where Q counts the
+// workers below a child as losses and U favors likely, rarely visited moves.
+// Unvisited children start from the node's own value.
+func (t *tree) selectChild(n *node) *node {
+	sqrtN := math.Sqrt(math.Max(1, float64(n.visits+n.inFlight)))
+	fpu := -n.valueSum / float64(n.visits)
+	var best *node
+	bestScore := math.Inf(-1)
+	for _, child := range n.children {
+		if child.state == terminal && child.terminal < 0 {
+			return child // A move that mates needs no comparison
+		}
+		visits := float64(child.visits + child.inFlight)
+		q := fpu
+		if visits > 0 {
+			q = (child.valueSum - t.config.VirtualLoss*float64(child.inFlight)) / visits
+		}
+		score := q + t.config.CPuct*child.prior*sqrtN/(1+visits)
+		if score > bestScore {
+			best, bestScore = child, score
+		}
+	}
+	return best
+}
+
+// expand adds a child for each legal move of an evaluated node
+func (t *tree) expand(n *node, eval Evaluation) {
+	moves := n.pos.ValidMoves()
+	n.children = make([]*node, len(moves))
+	for i, move := range moves {
+		n.children[i] = &node{move: move, prior: eval.Priors[i]}
+	}
+	n.state = expanded
+	t.nodes++
+}
+
+// backup adds a playout's value, given for the side to move at the leaf, to
+// the nodes on its path and removes their virtual loss
+func (t *tree) backup(path []*node, value float64) {
+	for i := len(path) - 1; i >= 0; i-- {
+		value = -value
+		path[i].visits++
+		path[i].valueSum += value
+		path[i].inFlight--
+	}
+}
+
+// release removes the virtual loss of an abandoned playout
+func (t *tree) release(path []*node) {
+	for _, n := range path {
+		n.inFlight--
+	}
+}
+
+// result ranks the root moves by visits, then value and prior
+func (t *tree) result(elapsed time.Duration) *Result {
+	root := t.root
+	result := &Result{
+		Playouts: root.visits - 1,
+		Nodes:    t.nodes,
+		Depth:    t.maxDepth,
+		Value:    -root.valueSum / float64(root.visits),
+		Elapsed:  elapsed,
+	}
+
+	for _, child := range root.children {
+		stat := MoveStat{Move: child.move.String(), Visits: child.visits, Prior: child.prior}
+		if child.visits > 0 {
+			stat.Value = child.valueSum / float64(child.visits)
+		}
+		if result.Playouts > 0 {
+			stat.Share = float64(child.visits) / float64(result.Playouts)
+		}
+		stat.PV = append([]string{stat.Move}, principalVariation(child)...)
+		result.Moves = append(result.Moves, stat)
+	}
+	sort.SliceStable(result.Moves, func(i, j int) bool {
+		a, b := result.Moves[i], result.Moves[j]
+		if a.Visits != b.Visits {
+			return a.Visits > b.Visits
+		}
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return a.Prior > b.Prior
+	})
+	return result
+}
+
+// principalVariation follows the most visited replies below a node
+func principalVariation(n *node) []string {
+	var pv []string
+	for n.state == expanded {
+		var best *node
+		for _, child := range n.children {
+			if child.visits > 0 && (best == nil || child.visits > best.visits) {
+				best = child
+			}
+		}
+		if best == nil {
+			break
+		}
+		pv = append(pv, best.move.String())
+		n = best
+	}
+	return pv
+}
+
+// String summarizes the result for logs
+func (r *Result) String() string {
+	best := r.Best()
+	return fmt.Sprintf("%s (%d/%d playouts, value %+.3f, depth %d, %v)",
+		best.Move, best.Visits, r.Playouts, best.Value, r.Depth, r.Elapsed.Round(time.Millisecond))
+}
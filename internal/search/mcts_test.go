@@ -0,0 +1,158 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/model"
+)
+
+// materialEvaluator gives every legal move the same prior and scores
+// positions by material, so that the search alone finds tactics
+type materialEvaluator struct {
+	err error
+}
+
+func (e *materialEvaluator) Evaluate(ctx context.Context, pos *chess.Position) (Evaluation, error) {
+	if e.err != nil {
+		return Evaluation{}, e.err
+	}
+	priors := make([]float64, len(pos.ValidMoves()))
+	normalizePriors(priors)
+	return Evaluation{Priors: priors, Value: MaterialValue(pos)}, nil
+}
+
+func position(t *testing.T, fen string) *chess.Position {
+	t.Helper()
+	opt, err := chess.FEN(fen)
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	return chess.NewGame(opt).Position()
+}
+
+func TestSearchTactics(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		want    string // Expected best move, or "" to only check avoid
+		avoid   string
+		workers int
+	}{
+		{"wins hanging queen", "6k1/8/8/3q4/8/8/8/3R2K1 w - - 0 1", "d1d5", "", 1},
+		{"mate in one", "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", "a1a8", "", 1},
+		{"avoids defended pawn", "6k1/8/4p3/3p4/3Q4/8/8/6K1 w - - 0 1", "", "d4d5", 1},
+		{"parallel workers", "6k1/8/4p3/3p4/3Q4/8/8/6K1 w - - 0 1", "", "d4d5", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Playouts = 400
+			config.Workers = tt.workers
+			result, err := NewSearcher(&materialEvaluator{}, config).Search(context.Background(), position(t, tt.fen))
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			best := result.Best()
+			if tt.want != "" && best.Move != tt.want {
+				t.Errorf("Best move %s, want %s (%v)", best.Move, tt.want, result.Moves[:3])
+			}
+			if tt.avoid != "" && best.Move == tt.avoid {
+				t.Errorf("Best move is the blunder %s (%v)", best.Move, result.Moves[:3])
+			}
+
+			visits := 0
+			for i, move := range result.Moves {
+				visits += move.Visits
+				if i > 0 && move.Visits > result.Moves[i-1].Visits {
+					t.Errorf("Moves are not ranked by visits: %v", result.Moves)
+				}
+			}
+			if result.Playouts != config.Playouts || visits != config.Playouts {
+				t.Errorf("%d playouts with %d root visits, want %d", result.Playouts, visits, config.Playouts)
+			}
+			if len(best.PV) == 0 || best.PV[0] != best.Move || math.Abs(best.Share-float64(best.Visits)/400) > 1e-9 {
+				t.Errorf("Best move stats: %+v", best)
+			}
+		})
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	pos := chess.NewGame().Position()
+
+	// Without a playout limit the time budget ends the search
+	config := DefaultConfig()
+	config.Playouts = 0
+	config.TimeBudget = 50 * time.Millisecond
+	config.Workers = 2
+	start := time.Now()
+	result, err := NewSearcher(&materialEvaluator{}, config).Search(context.Background(), pos)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || result.Playouts == 0 {
+		t.Errorf("Time budget search ran %v for %d playouts", elapsed, result.Playouts)
+	}
+
+	failing := &materialEvaluator{err: errors.New("evaluator failed")}
+	if _, err := NewSearcher(failing, DefaultConfig()).Search(context.Background(), pos); err == nil {
+		t.Error("Expected evaluator error")
+	}
+	mated := position(t, "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
+	if _, err := NewSearcher(&materialEvaluator{}, DefaultConfig()).Search(context.Background(), mated); !errors.Is(err, ErrGameOver) {
+		t.Errorf("Got %v, want ErrGameOver", err)
+	}
+}
+
+func TestNetworkEvaluator(t *testing.T) {
+	cnn, err := model.NewChessCNN()
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer cnn.Close()
+	r, err := model.NewRuntime(cnn)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+
+	pos := position(t, "6k1/8/8/3q4/8/8/8/3R2K1 w - - 0 1")
+	eval, err := NewRuntimeEvaluator(r).Evaluate(context.Background(), pos)
+	if err != nil {
+		t.Fatalf("Failed to evaluate: %v", err)
+	}
+	sum := 0.0
+	for _, p := range eval.Priors {
+		sum += p
+	}
+	if len(eval.Priors) != len(pos.ValidMoves()) || math.Abs(sum-1) > 1e-9 {
+		t.Errorf("%d priors summing to %v for %d moves", len(eval.Priors), sum, len(pos.ValidMoves()))
+	}
+	// The policy-only CNN falls back to material: a rook against a queen
+	if eval.Value != MaterialValue(pos) || eval.Value >= 0 {
+		t.Errorf("Value %v, want material value %v", eval.Value, MaterialValue(pos))
+	}
+
+	batcher := model.NewBatcher(r, model.DefaultBatcherConfig())
+	defer batcher.Close()
+	config := DefaultConfig()
+	config.Playouts = 64
+	config.Workers = 4
+	result, err := NewSearcher(NewBatcherEvaluator(batcher), config).Search(context.Background(), pos)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Playouts != 64 || result.Nodes == 0 || result.Best().Move != "d1d5" {
+		t.Errorf("Search result: %v", result)
+	}
+	if got := ValueToCentipawns(CentipawnsToValue(250)); got != 250 {
+		t.Errorf("Centipawn round trip gave %d, want 250", got)
+	}
+}
@@ -0,0 +1,459 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+	"go.uber.org/zap"
+
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/decision"
+	"github.com/thyrook/partner/internal/model"
+)
+
+// maxBodyBytes limits request bodies; a batch of PGN games fits easily
+const maxBodyBytes = 8 << 20
+
+// Config controls the analysis server
+type Config struct {
+	Addr                string
+	ModelPath           string
+	DefaultTopK         int     // Moves returned when a request has no top_k
+	MaxTopK             int     // Largest top_k accepted
+	MaxBatchPositions   int     // Largest batch analysis request
+	ConfidenceThreshold float64 // Below it the explanations flag the top move as uncertain
+	Batcher             model.BatcherConfig
+}
+
+// DefaultConfig returns the default server configuration
+func DefaultConfig() Config {
+	return Config{
+		Addr:                "localhost:8080",
+		ModelPath:           "data/models/chess_cnn.gob",
+		DefaultTopK:         5,
+		MaxTopK:             50,
+		MaxBatchPositions:   256,
+		ConfidenceThreshold: 0.3,
+		Batcher:             model.DefaultBatcherConfig(),
+	}
+}
+
+// Server answers analysis requests over HTTP/JSON. Concurrent requests are
+// batched through a model.Batcher, and the model can be replaced while the
+// server runs.
+type Server struct {
+	config  Config
+	engine  *decision.DecisionEngine
+	mux     *http.ServeMux
+	started time.Time
+
+	// Requests hold mu for reading while they use the batcher, so a reload
+	// can close the previous batcher once it holds mu for writing
+	mu      sync.RWMutex
+	batcher *model.Batcher
+	info    ModelInfo
+}
+
+// AnalyzeRequest selects a position by FEN, or by PGN and a ply. Without a
+// ply the final position of the (first) PGN game is analyzed.
+type AnalyzeRequest struct {
+	FEN  string `json:"fen,omitempty"`
+	PGN  string `json:"pgn,omitempty"`
+	Ply  *int   `json:"ply,omitempty"` // Half moves played from the start of the PGN game
+	TopK int    `json:"top_k,omitempty"`
+}
+
+// AnalyzeResponse is the analysis of one position
+type AnalyzeResponse struct {
+	FEN         string         `json:"fen"`
+	SideToMove  string         `json:"side_to_move"`
+	Status      string         `json:"status,omitempty"` // Checkmate, Stalemate, ... when the game is over
+	LegalMoves  int            `json:"legal_moves"`
+	Value       *float64       `json:"value,omitempty"` // Side to move's evaluation in [-1, 1], value head models only
+	Moves       []MoveAnalysis `json:"moves"`
+	InferenceMs float64        `json:"inference_ms"`
+}
+
+// MoveAnalysis is one ranked move with the decision engine's explanation
+type MoveAnalysis struct {
+	Rank        int     `json:"rank"`
+	UCI         string  `json:"uci"`
+	SAN         string  `json:"san"`
+	Probability float64 `json:"probability"`
+	Category    string  `json:"category"`
+	Explanation string  `json:"explanation"`
+}
+
+// BatchRequest analyzes several positions in one call
+type BatchRequest struct {
+	Positions []AnalyzeRequest `json:"positions"`
+}
+
+// BatchResult is the analysis of one batch position, or its error
+type BatchResult struct {
+	*AnalyzeResponse
+	Error string `json:"error,omitempty"`
+}
+
+// BatchResponse holds the results in request order
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// ReloadRequest names the checkpoint to load; empty reloads the current path
+type ReloadRequest struct {
+	Path string `json:"path,omitempty"`
+}
+
+// ModelInfo describes the loaded model
+type ModelInfo struct {
+	Path          string    `json:"path"`
+	ModelType     string    `json:"model_type"`
+	InputChannels int       `json:"input_channels"`
+	MoveEncoding  string    `json:"move_encoding"`
+	PolicySize    int       `json:"policy_size"`
+	ValueHead     bool      `json:"value_head"`
+	LoadedAt      time.Time `json:"loaded_at"`
+}
+
+// HealthResponse reports the server state and batching counters
+type HealthResponse struct {
+	Status         string        `json:"status"`
+	UptimeSec      float64       `json:"uptime_sec"`
+	Model          ModelInfo     `json:"model"`
+	Requests       int64         `json:"requests"`
+	Failed         int64         `json:"failed"`
+	Batches        int64         `json:"batches"`
+	AvgBatchSize   float64       `json:"avg_batch_size"`
+	BatchSizes     map[int]int64 `json:"batch_sizes"`
+	QueueDepth     int           `json:"queue_depth"`
+	MaxQueueDepth  int           `json:"max_queue_depth"`
+	AvgQueueWaitMs float64       `json:"avg_queue_wait_ms"`
+	LatencyP50Ms   float64       `json:"latency_p50_ms"`
+	LatencyP99Ms   float64       `json:"latency_p99_ms"`
+}
+
+// requestError is an error caused by the request rather than the server
+type requestError struct {
+	err error
+}
+
+func (e requestError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return requestError{fmt.Errorf(format, args...)}
+}
+
+// NewServer loads the configured model and sets up the routes
+func NewServer(config Config) (*Server, error) {
+	defaults := DefaultConfig()
+	if config.DefaultTopK <= 0 {
+		config.DefaultTopK = defaults.DefaultTopK
+	}
+	if config.MaxTopK < config.DefaultTopK {
+		config.MaxTopK = config.DefaultTopK
+	}
+	if config.MaxBatchPositions <= 0 {
+		config.MaxBatchPositions = defaults.MaxBatchPositions
+	}
+
+	s := &Server{
+		config:  config,
+		engine:  decision.NewDecisionEngine(nil, nil, config.ConfidenceThreshold, config.DefaultTopK, zap.NewNop()),
+		mux:     http.NewServeMux(),
+		started: time.Now(),
+	}
+	if _, err := s.Reload(config.ModelPath); err != nil {
+		return nil, err
+	}
+
+	s.mux.HandleFunc("POST /api/analyze", s.handleAnalyze)
+	s.mux.HandleFunc("POST /api/analyze/batch", s.handleBatch)
+	s.mux.HandleFunc("GET /api/model", s.handleModel)
+	s.mux.HandleFunc("POST /api/model/reload", s.handleReload)
+	s.mux.HandleFunc("GET /api/health", s.handleHealth)
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Reload loads a checkpoint and swaps it in once the requests using the
+// previous model have finished. An empty path reloads the current one.
+func (s *Server) Reload(path string) (ModelInfo, error) {
+	if path == "" {
+		s.mu.RLock()
+		path = s.info.Path
+		s.mu.RUnlock()
+	}
+
+	runtime, err := model.LoadRuntime(path)
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	metadata := runtime.Metadata()
+	info := ModelInfo{
+		Path:          path,
+		ModelType:     metadata.ModelType,
+		InputChannels: runtime.InputChannels(),
+		MoveEncoding:  string(runtime.MoveEncoding()),
+		PolicySize:    runtime.PolicySize(),
+		ValueHead:     runtime.HasValueHead(),
+		LoadedAt:      time.Now(),
+	}
+	batcher := model.NewBatcher(runtime, s.config.Batcher)
+
+	s.mu.Lock()
+	previous := s.batcher
+	s.batcher, s.info = batcher, info
+	s.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return info, nil
+}
+
+// Close stops the batcher
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batcher != nil {
+		s.batcher.Close()
+		s.batcher = nil
+	}
+}
+
+// Analyze ranks the moves of the requested position
+func (s *Server) Analyze(ctx context.Context, req AnalyzeRequest) (*AnalyzeResponse, error) {
+	topK := req.TopK
+	if topK == 0 {
+		topK = s.config.DefaultTopK
+	}
+	if topK < 0 || topK > s.config.MaxTopK {
+		return nil, badRequest("top_k must be between 1 and %d", s.config.MaxTopK)
+	}
+	pos, err := parsePosition(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &AnalyzeResponse{
+		FEN:        pos.String(),
+		SideToMove: strings.ToLower(pos.Turn().Name()),
+		LegalMoves: len(pos.ValidMoves()),
+		Moves:      []MoveAnalysis{},
+	}
+	if pos.Status() != chess.NoMethod {
+		resp.Status = pos.Status().String()
+	}
+	if resp.LegalMoves == 0 {
+		return resp, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.batcher == nil {
+		return nil, fmt.Errorf("no model loaded")
+	}
+	runtime := s.batcher.Runtime()
+
+	state, err := data.TensorizePosition(pos, runtime.InputChannels())
+	if err != nil {
+		return nil, badRequest("failed to tensorize position: %v", err)
+	}
+	start := time.Now()
+	probs, value, err := s.batcher.ForwardLegal(ctx, state, pos)
+	if err != nil {
+		return nil, fmt.Errorf("inference failed: %w", err)
+	}
+	resp.InferenceMs = float64(time.Since(start).Microseconds()) / 1000.0
+	if runtime.HasValueHead() {
+		resp.Value = &value
+	}
+
+	for _, ranked := range s.engine.RankPolicy(probs, pos, topK) {
+		// The ranked move names only the squares; resolve the index against
+		// the position so promotions carry their piece
+		move, err := data.MoveFromIndex(pos, ranked.MoveIndex)
+		if err != nil {
+			continue
+		}
+		resp.Moves = append(resp.Moves, MoveAnalysis{
+			Rank:        ranked.Rank,
+			UCI:         move.String(),
+			SAN:         chess.AlgebraicNotation{}.Encode(pos, move),
+			Probability: ranked.Confidence,
+			Category:    ranked.Category,
+			Explanation: strings.TrimSpace(ranked.Explanation),
+		})
+	}
+	return resp, nil
+}
+
+// parsePosition returns the position a request selects
+func parsePosition(req AnalyzeRequest) (*chess.Position, error) {
+	switch {
+	case req.FEN != "" && req.PGN != "":
+		return nil, badRequest("request has both fen and pgn")
+	case req.FEN != "":
+		if req.Ply != nil {
+			return nil, badRequest("ply applies to pgn requests only")
+		}
+		fen, err := chess.FEN(req.FEN)
+		if err != nil {
+			return nil, badRequest("invalid fen: %v", err)
+		}
+		return chess.NewGame(fen).Position(), nil
+	case req.PGN != "":
+		games, err := data.NewPGNParser("").ParsePGNReader(strings.NewReader(req.PGN))
+		if err != nil {
+			return nil, badRequest("invalid pgn: %v", err)
+		}
+		if len(games) == 0 {
+			return nil, badRequest("pgn has no games")
+		}
+		positions := games[0].Positions()
+		ply := len(positions) - 1
+		if req.Ply != nil {
+			ply = *req.Ply
+		}
+		if ply < 0 || ply >= len(positions) {
+			return nil, badRequest("ply %d outside the game's 0..%d", ply, len(positions)-1)
+		}
+		return positions[ply], nil
+	default:
+		return nil, badRequest("request needs a fen or pgn")
+	}
+}
+
+func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	var req AnalyzeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	resp, err := s.Analyze(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleBatch analyzes the positions concurrently so they share batches
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if len(req.Positions) == 0 || len(req.Positions) > s.config.MaxBatchPositions {
+		writeError(w, badRequest("batch needs 1 to %d positions", s.config.MaxBatchPositions))
+		return
+	}
+
+	resp := BatchResponse{Results: make([]BatchResult, len(req.Positions))}
+	var wg sync.WaitGroup
+	for i := range req.Positions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			analysis, err := s.Analyze(r.Context(), req.Positions[i])
+			if err != nil {
+				resp.Results[i].Error = err.Error()
+				return
+			}
+			resp.Results[i].AnalyzeResponse = analysis
+		}(i)
+	}
+	wg.Wait()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleModel(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	info := s.info
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	var req ReloadRequest
+	if r.ContentLength != 0 && !decodeRequest(w, r, &req) {
+		return
+	}
+	info, err := s.Reload(req.Path)
+	if err != nil {
+		writeError(w, badRequest("failed to reload model: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	resp := HealthResponse{Status: "ok", UptimeSec: time.Since(s.started).Seconds(), Model: s.info}
+	if s.batcher == nil {
+		resp.Status = "no model"
+	} else {
+		stats := s.batcher.Stats()
+		resp.Requests = stats.Requests
+		resp.Failed = stats.Failed
+		resp.Batches = stats.Batches
+		resp.AvgBatchSize = stats.AvgBatchSize
+		resp.BatchSizes = stats.BatchSizes
+		resp.QueueDepth = stats.QueueDepth
+		resp.MaxQueueDepth = stats.MaxQueueDepth
+		resp.AvgQueueWaitMs = durationMs(stats.AvgQueueWait)
+		resp.LatencyP50Ms = durationMs(stats.P50Latency)
+		resp.LatencyP99Ms = durationMs(stats.P99Latency)
+	}
+	s.mu.RUnlock()
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000.0
+}
+
+// decodeRequest reads a JSON body, writing a 400 response on failure
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, badRequest("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeError answers 400 for request errors and 500 otherwise
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thyrook/partner/internal/model"
+)
+
+// saveModel writes a freshly initialized model of the given architecture
+func saveModel(t *testing.T, arch model.Architecture) string {
+	t.Helper()
+	m, err := model.NewChessModel(arch, model.DefaultCNNConfig())
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer m.Close()
+
+	path := filepath.Join(t.TempDir(), string(arch)+".gob")
+	if err := m.SaveModel(path); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+	return path
+}
+
+// call sends a JSON request and decodes the response into out
+func call(t *testing.T, handler http.Handler, method, path string, body, out interface{}) int {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, path, &payload))
+	if out != nil {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode %s response: %v", path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAnalyze(t *testing.T) {
+	config := DefaultConfig()
+	config.ModelPath = saveModel(t, model.ArchitectureCNN)
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer s.Close()
+
+	var resp AnalyzeResponse
+	fen := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	if code := call(t, s, "POST", "/api/analyze", AnalyzeRequest{FEN: fen, TopK: 3}, &resp); code != http.StatusOK {
+		t.Fatalf("Analyze returned %d", code)
+	}
+	if resp.SideToMove != "black" || resp.LegalMoves != 20 || len(resp.Moves) != 3 || resp.Value != nil {
+		t.Errorf("Analysis: %+v", resp)
+	}
+	for i, move := range resp.Moves {
+		if move.Rank != i+1 || move.SAN == "" || move.Explanation == "" || move.Category == "" {
+			t.Errorf("Move %d: %+v", i, move)
+		}
+		if i > 0 && move.Probability > resp.Moves[i-1].Probability {
+			t.Errorf("Moves are not sorted: %+v", resp.Moves)
+		}
+	}
+
+	// A PGN position equals the FEN of the same position
+	var fromPGN AnalyzeResponse
+	ply := 1
+	// Move text without tag pairs is accepted
+	pgn := "1. e4 e5 2. Nf3 *\n"
+	if code := call(t, s, "POST", "/api/analyze", AnalyzeRequest{PGN: pgn, Ply: &ply, TopK: 3}, &fromPGN); code != http.StatusOK {
+		t.Fatalf("Analyze PGN returned %d", code)
+	}
+	if fromPGN.FEN != resp.FEN || fromPGN.Moves[0].UCI != resp.Moves[0].UCI {
+		t.Errorf("PGN analysis %s %v, want %s %v", fromPGN.FEN, fromPGN.Moves[0], resp.FEN, resp.Moves[0])
+	}
+
+	var mate AnalyzeResponse
+	fools := "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"
+	if code := call(t, s, "POST", "/api/analyze", AnalyzeRequest{FEN: fools}, &mate); code != http.StatusOK {
+		t.Fatalf("Analyze checkmate returned %d", code)
+	}
+	if mate.Status != "Checkmate" || mate.LegalMoves != 0 || len(mate.Moves) != 0 {
+		t.Errorf("Checkmate analysis: %+v", mate)
+	}
+
+	// Promotions are returned as legal UCI moves with their piece
+	var promotion AnalyzeResponse
+	if code := call(t, s, "POST", "/api/analyze", AnalyzeRequest{FEN: "7k/4P3/8/8/8/8/8/K7 w - - 0 1", TopK: 10}, &promotion); code != http.StatusOK {
+		t.Fatalf("Analyze promotion returned %d", code)
+	}
+	legal := map[string]string{"a1a2": "Ka2", "a1b1": "Kb1", "a1b2": "Kb2", "e7e8q": "e8=Q+", "e7e8r": "e8=R+", "e7e8b": "e8=B", "e7e8n": "e8=N"}
+	queen := false
+	for _, move := range promotion.Moves {
+		if san, ok := legal[move.UCI]; !ok || move.SAN != san {
+			t.Errorf("Promotion position move %+v", move)
+		}
+		queen = queen || move.UCI == "e7e8q"
+	}
+	if !queen {
+		t.Errorf("Queen promotion missing from %+v", promotion.Moves)
+	}
+
+	tests := []struct {
+		name string
+		req  AnalyzeRequest
+	}{
+		{"empty", AnalyzeRequest{}},
+		{"invalid fen", AnalyzeRequest{FEN: "not a fen"}},
+		{"fen and pgn", AnalyzeRequest{FEN: fen, PGN: pgn}},
+		{"ply out of range", AnalyzeRequest{PGN: pgn, Ply: new(int)}},
+		{"top_k too large", AnalyzeRequest{FEN: fen, TopK: 1000}},
+	}
+	*tests[3].req.Ply = 10
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errResp map[string]string
+			if code := call(t, s, "POST", "/api/analyze", tt.req, &errResp); code != http.StatusBadRequest || errResp["error"] == "" {
+				t.Errorf("Got %d %v, want 400 with an error", code, errResp)
+			}
+		})
+	}
+}
+
+func TestBatchHealthAndReload(t *testing.T) {
+	config := DefaultConfig()
+	config.ModelPath = saveModel(t, model.ArchitectureCNN)
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer s.Close()
+
+	batch := BatchRequest{Positions: []AnalyzeRequest{
+		{FEN: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{FEN: "invalid"},
+		{PGN: "1. d4 d5 2. c4 *", TopK: 2},
+	}}
+	var resp BatchResponse
+	if code := call(t, s, "POST", "/api/analyze/batch", batch, &resp); code != http.StatusOK {
+		t.Fatalf("Batch returned %d", code)
+	}
+	// The invalid position fails on its own; the PGN has no tag pairs
+	if len(resp.Results) != 3 || resp.Results[1].Error == "" || resp.Results[1].AnalyzeResponse != nil {
+		t.Fatalf("Batch results: %+v", resp.Results)
+	}
+	for i, want := range map[int]int{0: 5, 2: 2} {
+		if r := resp.Results[i]; r.AnalyzeResponse == nil || len(r.Moves) != want {
+			t.Errorf("Batch result %d: %+v, want %d moves", i, r, want)
+		}
+	}
+
+	var health HealthResponse
+	if code := call(t, s, "GET", "/api/health", nil, &health); code != http.StatusOK {
+		t.Fatalf("Health returned %d", code)
+	}
+	if health.Status != "ok" || health.Requests != 2 || health.Batches == 0 || health.Model.ModelType == "" {
+		t.Errorf("Health: %+v", health)
+	}
+
+	// Reload a value head model from a new path
+	resnet := saveModel(t, model.ArchitectureResNet)
+	var info ModelInfo
+	if code := call(t, s, "POST", "/api/model/reload", ReloadRequest{Path: resnet}, &info); code != http.StatusOK {
+		t.Fatalf("Reload returned %d", code)
+	}
+	if info.Path != resnet || !info.ValueHead {
+		t.Errorf("Reloaded model: %+v", info)
+	}
+	if code := call(t, s, "GET", "/api/model", nil, &info); code != http.StatusOK || info.Path != resnet {
+		t.Errorf("Model info after reload: %d %+v", code, info)
+	}
+
+	var analysis AnalyzeResponse
+	if code := call(t, s, "POST", "/api/analyze", AnalyzeRequest{FEN: batch.Positions[0].FEN}, &analysis); code != http.StatusOK {
+		t.Fatalf("Analyze returned %d", code)
+	}
+	if analysis.Value == nil || *analysis.Value < -1 || *analysis.Value > 1 {
+		t.Errorf("Value head analysis: %+v", analysis)
+	}
+
+	// A failed reload keeps the current model
+	var errResp map[string]string
+	missing := filepath.Join(t.TempDir(), "missing.gob")
+	if code := call(t, s, "POST", "/api/model/reload", ReloadRequest{Path: missing}, &errResp); code != http.StatusBadRequest {
+		t.Errorf("Reload of a missing file returned %d", code)
+	}
+	if code := call(t, s, "GET", "/api/model", nil, &info); code != http.StatusOK || info.Path != resnet {
+		t.Errorf("Model info after failed reload: %+v", info)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("POST", "/api/analyze", strings.NewReader(`{"fen": 1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Malformed body returned %d", rec.Code)
+	}
+}
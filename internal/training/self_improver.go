@@ -13,7 +13,7 @@ import (
 
 // SelfImprover manages the self-improving training loop
 type SelfImprover struct {
-	model   *model.ChessCNN
+	model   model.ChessModel
 	trainer *model.Trainer
 	buffer  *ReplayBuffer
 	storage *ReplayStorage
@@ -48,6 +48,9 @@ type ImproverConfig struct {
 	EvalBatchSize     int     `json:"eval_batch_size"`
 	AccuracyThreshold float64 `json:"accuracy_threshold"`
 
+	// Seed of the trainer's shuffling and augmentation (0 = time based)
+	Seed int64 `json:"seed"`
+
 	// Storage
 	DBPath   string `json:"db_path"`
 	JSONLDir string `json:"jsonl_dir"`
@@ -89,7 +92,7 @@ func DefaultImproverConfig() ImproverConfig {
 }
 
 // NewSelfImprover creates a new self-improver
-func NewSelfImprover(cnn *model.ChessCNN, config ImproverConfig) (*SelfImprover, error) {
+func NewSelfImprover(cnn model.ChessModel, config ImproverConfig) (*SelfImprover, error) {
 	// Create replay buffer
 	buffer := NewReplayBuffer(config.BufferSize)
 
@@ -115,10 +118,12 @@ func NewSelfImprover(cnn *model.ChessCNN, config ImproverConfig) (*SelfImprover,
 		Epochs:          1,
 		BatchSize:       config.BatchSize,
 		LearningRate:    config.LearningRate,
-		LRDecayRate:     1.0,
-		LRDecaySteps:    1,
 		GradientClipMax: 5.0,
 		Verbose:         false,
+		InputChannels:   cnn.InputChannels(),
+		MoveEncoding:    cnn.MoveEncoding(),
+		Architecture:    cnn.Architecture(),
+		Seed:            config.Seed,
 	}
 
 	trainer, err := model.NewTrainer(trainerConfig)
@@ -241,14 +246,23 @@ func (si *SelfImprover) Train() error {
 	log.Printf("Training model on %d samples (correct: %d, incorrect: %d)",
 		len(sample), countCorrect(sample), len(sample)-countCorrect(sample))
 
-	entries := make([]*data.DataEntry, len(sample))
-	for i, entry := range sample {
-		flatTensor := data.TensorToFlatArray(entry.StateTensor)
-		entries[i] = &data.DataEntry{
-			StateTensor: flatTensor,
-			FromSquare:  entry.ActualMove.Index / 64,
-			ToSquare:    entry.ActualMove.Index % 64,
+	entries := make([]*data.DataEntry, 0, len(sample))
+	for _, entry := range sample {
+		fromSquare, toSquare, promo, err := data.DecodeMoveIndex(entry.ActualMove.Index)
+		if err != nil {
+			continue
 		}
+		// Replay entries hold piece planes only; extended models see the default aux state
+		flatTensor, err := data.ExpandInputChannels(data.TensorToFlatArray(entry.StateTensor), si.trainer.GetModel().InputChannels())
+		if err != nil {
+			continue
+		}
+		entries = append(entries, &data.DataEntry{
+			StateTensor: flatTensor,
+			FromSquare:  fromSquare,
+			ToSquare:    toSquare,
+			Promotion:   data.PromotionToString(promo),
+		})
 	}
 
 	// Train on this batch using the persistent trainer
@@ -0,0 +1,621 @@
+package uci
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/data"
+	"github.com/thyrook/partner/internal/model"
+	"github.com/thyrook/partner/internal/search"
+)
+
+// Engine identification sent in reply to "uci"
+const (
+	EngineName   = "P.A.R.T.N.E.R"
+	EngineAuthor = "P.A.R.T.N.E.R Project"
+)
+
+// Option limits
+const (
+	MaxTopK     = 50
+	MaxPlayouts = 1000000
+	MaxThreads  = 64
+)
+
+// Options are the engine settings exposed as UCI options
+type Options struct {
+	ModelPath   string
+	Temperature float64 // 0 plays the best move; above 0 samples the top-K policy moves
+	TopK        int     // Policy moves considered as candidates
+	ValueSearch bool    // Score the candidates with the value head when the model has one
+	Playouts    int     // MCTS playouts per move, 0 to pick from the candidates directly
+	Threads     int     // MCTS workers
+}
+
+// DefaultOptions returns the default engine options
+func DefaultOptions() Options {
+	return Options{
+		ModelPath:   "data/models/chess_cnn.gob",
+		Temperature: 0,
+		TopK:        5,
+		ValueSearch: true,
+		Playouts:    0,
+		Threads:     1,
+	}
+}
+
+// Limits are the parameters of a "go" command. Without playouts the policy
+// answers immediately, so only Infinite and Ponder change when bestmove is
+// sent; MCTS also stops at the node limit and the time budget.
+type Limits struct {
+	WTime, BTime time.Duration
+	WInc, BInc   time.Duration
+	MovesToGo    int
+	MoveTime     time.Duration
+	Depth        int
+	Nodes        int
+	Infinite     bool
+	Ponder       bool
+}
+
+// Engine speaks the UCI protocol: it reads commands with Run and writes its
+// replies to the output. Searches run in the background so that "stop" and
+// "isready" are answered while a search waits.
+type Engine struct {
+	options Options
+	out     io.Writer
+	outMu   sync.Mutex
+	rng     *rand.Rand
+
+	runtime  *model.Runtime
+	loaded   string // Path the runtime was loaded from
+	position *chess.Position
+
+	// The running search; closing stop releases an infinite or ponder search
+	// after cancel has ended its playouts
+	stop   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// searchResult is the outcome of one search
+type searchResult struct {
+	move  *chess.Move
+	pv    []string
+	score string // "cp N" or "mate N"
+	nodes int
+}
+
+// NewEngine creates an engine writing to out. The model is loaded on the
+// first "isready" or "go".
+func NewEngine(options Options, out io.Writer) *Engine {
+	if options.TopK <= 0 {
+		options.TopK = DefaultOptions().TopK
+	}
+	if options.Threads <= 0 {
+		options.Threads = DefaultOptions().Threads
+	}
+	return &Engine{
+		options:  options,
+		out:      out,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		position: chess.NewGame().Position(),
+	}
+}
+
+// Run executes commands from in until "quit" or the end of the input
+func (e *Engine) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if !e.Execute(scanner.Text()) {
+			return nil
+		}
+	}
+	e.stopSearch()
+	return scanner.Err()
+}
+
+// Execute runs one command and reports whether the engine should continue
+func (e *Engine) Execute(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	switch fields[0] {
+	case "uci":
+		e.send("id name %s", EngineName)
+		e.send("id author %s", EngineAuthor)
+		e.send("option name ModelPath type string default %s", e.options.ModelPath)
+		e.send("option name Temperature type string default %s", formatFloat(e.options.Temperature))
+		e.send("option name TopK type spin default %d min 1 max %d", e.options.TopK, MaxTopK)
+		e.send("option name ValueSearch type check default %t", e.options.ValueSearch)
+		e.send("option name Playouts type spin default %d min 0 max %d", e.options.Playouts, MaxPlayouts)
+		e.send("option name Threads type spin default %d min 1 max %d", e.options.Threads, MaxThreads)
+		e.send("uciok")
+	case "isready":
+		if err := e.loadModel(); err != nil {
+			e.send("info string %v", err)
+		}
+		e.send("readyok")
+	case "setoption":
+		if err := e.setOption(fields[1:]); err != nil {
+			e.send("info string %v", err)
+		}
+	case "ucinewgame":
+		e.stopSearch()
+		e.position = chess.NewGame().Position()
+	case "position":
+		pos, err := parsePosition(fields[1:])
+		if err != nil {
+			e.send("info string %v", err)
+			break
+		}
+		e.position = pos
+	case "go":
+		e.stopSearch()
+		e.startSearch(parseLimits(fields[1:]))
+	case "stop", "ponderhit":
+		e.stopSearch()
+	case "quit":
+		e.stopSearch()
+		return false
+	case "debug", "register":
+	default:
+		e.send("info string unknown command: %s", fields[0])
+	}
+	return true
+}
+
+// send writes one line of output
+func (e *Engine) send(format string, args ...interface{}) {
+	e.outMu.Lock()
+	defer e.outMu.Unlock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+}
+
+// loadModel loads the ModelPath option unless it is already loaded
+func (e *Engine) loadModel() error {
+	if e.runtime != nil && e.loaded == e.options.ModelPath {
+		return nil
+	}
+	runtime, err := model.LoadRuntime(e.options.ModelPath)
+	if err != nil {
+		return fmt.Errorf("failed to load model: %w", err)
+	}
+	e.runtime, e.loaded = runtime, e.options.ModelPath
+	return nil
+}
+
+// setOption applies "setoption name <id> [value <x>]"
+func (e *Engine) setOption(args []string) error {
+	if len(args) < 2 || args[0] != "name" {
+		return fmt.Errorf("expected: setoption name <id> [value <x>]")
+	}
+	name, value := strings.Join(args[1:], " "), ""
+	for i, arg := range args {
+		if arg == "value" {
+			name, value = strings.Join(args[1:i], " "), strings.Join(args[i+1:], " ")
+			break
+		}
+	}
+
+	switch strings.ToLower(name) {
+	case "modelpath":
+		if value == "" {
+			return fmt.Errorf("ModelPath needs a value")
+		}
+		e.options.ModelPath = value
+	case "temperature":
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 {
+			return fmt.Errorf("invalid Temperature %q", value)
+		}
+		e.options.Temperature = temperature
+	case "topk":
+		topK, err := strconv.Atoi(value)
+		if err != nil || topK < 1 || topK > MaxTopK {
+			return fmt.Errorf("invalid TopK %q: expected 1..%d", value, MaxTopK)
+		}
+		e.options.TopK = topK
+	case "valuesearch":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid ValueSearch %q", value)
+		}
+		e.options.ValueSearch = enabled
+	case "playouts":
+		playouts, err := strconv.Atoi(value)
+		if err != nil || playouts < 0 || playouts > MaxPlayouts {
+			return fmt.Errorf("invalid Playouts %q: expected 0..%d", value, MaxPlayouts)
+		}
+		e.options.Playouts = playouts
+	case "threads":
+		threads, err := strconv.Atoi(value)
+		if err != nil || threads < 1 || threads > MaxThreads {
+			return fmt.Errorf("invalid Threads %q: expected 1..%d", value, MaxThreads)
+		}
+		e.options.Threads = threads
+	default:
+		return fmt.Errorf("unknown option %q", name)
+	}
+	return nil
+}
+
+// parsePosition parses "startpos | fen <fen> [moves <m1> ...]"
+func parsePosition(args []string) (*chess.Position, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected: position [startpos | fen <fen>] moves <m1> ...")
+	}
+
+	moves := len(args)
+	for i, arg := range args {
+		if arg == "moves" {
+			moves = i
+			break
+		}
+	}
+
+	var pos *chess.Position
+	switch args[0] {
+	case "startpos":
+		pos = chess.NewGame().Position()
+	case "fen":
+		fen, err := chess.FEN(strings.Join(args[1:moves], " "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fen: %w", err)
+		}
+		pos = chess.NewGame(fen).Position()
+	default:
+		return nil, fmt.Errorf("unknown position type %q", args[0])
+	}
+
+	if moves < len(args) {
+		for _, uci := range args[moves+1:] {
+			move := findMove(pos, uci)
+			if move == nil {
+				return nil, fmt.Errorf("illegal move %s in position %s", uci, pos)
+			}
+			pos = pos.Update(move)
+		}
+	}
+	return pos, nil
+}
+
+// findMove returns the legal move with the given UCI notation, or nil
+func findMove(pos *chess.Position, uci string) *chess.Move {
+	for _, move := range pos.ValidMoves() {
+		if move.String() == uci {
+			return move
+		}
+	}
+	return nil
+}
+
+// parseLimits parses the arguments of "go"; unknown tokens are ignored
+func parseLimits(args []string) Limits {
+	var limits Limits
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "infinite":
+			limits.Infinite = true
+			continue
+		case "ponder":
+			limits.Ponder = true
+			continue
+		}
+		if i+1 >= len(args) {
+			break
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			continue
+		}
+		ms := time.Duration(n) * time.Millisecond
+		switch args[i] {
+		case "wtime":
+			limits.WTime = ms
+		case "btime":
+			limits.BTime = ms
+		case "winc":
+			limits.WInc = ms
+		case "binc":
+			limits.BInc = ms
+		case "movetime":
+			limits.MoveTime = ms
+		case "movestogo":
+			limits.MovesToGo = n
+		case "depth":
+			limits.Depth = n
+		case "nodes":
+			limits.Nodes = n
+		default:
+			continue
+		}
+		i++
+	}
+	return limits
+}
+
+// Budget returns the time to spend on a move for the given side: the move
+// time, or an even share of the remaining clock plus most of the increment.
+// It is 0, no limit, when the command sets no time.
+func (l Limits) Budget(color chess.Color) time.Duration {
+	if l.MoveTime > 0 {
+		return l.MoveTime
+	}
+	remaining, increment := l.WTime, l.WInc
+	if color == chess.Black {
+		remaining, increment = l.BTime, l.BInc
+	}
+	if remaining <= 0 {
+		return 0
+	}
+	moves := l.MovesToGo
+	if moves <= 0 {
+		moves = 30
+	}
+	budget := remaining/time.Duration(moves) + increment*3/4
+	if budget > remaining/2 {
+		budget = remaining / 2
+	}
+	return budget
+}
+
+// startSearch searches the current position in the background and sends
+// bestmove when it is done, or after "stop" for infinite and ponder searches
+func (e *Engine) startSearch(limits Limits) {
+	stop, done := make(chan struct{}), make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stop, e.cancel, e.done = stop, cancel, done
+
+	loadErr := e.loadModel()
+	runtime, pos, options := e.runtime, e.position, e.options
+	go func() {
+		defer close(done)
+		start := time.Now()
+
+		best := "0000"
+		switch {
+		case len(pos.ValidMoves()) == 0:
+			e.send("info string no legal moves (%s)", pos.Status())
+		case loadErr != nil:
+			e.send("info string %v", loadErr)
+			best = pos.ValidMoves()[0].String()
+		default:
+			result, err := e.search(ctx, runtime, pos, options, limits)
+			if err != nil {
+				e.send("info string search failed: %v", err)
+				best = pos.ValidMoves()[0].String()
+				break
+			}
+			elapsed := time.Since(start)
+			e.send("info depth 1 seldepth %d score %s nodes %d nps %d time %d pv %s",
+				len(result.pv), result.score, result.nodes,
+				int(float64(result.nodes)/math.Max(elapsed.Seconds(), 1e-3)),
+				elapsed.Milliseconds(), strings.Join(result.pv, " "))
+			best = result.move.String()
+		}
+
+		if limits.Infinite || limits.Ponder {
+			<-stop
+		}
+		e.send("bestmove %s", best)
+	}()
+}
+
+// stopSearch releases the running search and waits for its bestmove
+func (e *Engine) stopSearch() {
+	if e.done == nil {
+		return
+	}
+	e.cancel()
+	close(e.stop)
+	<-e.done
+	e.stop, e.cancel, e.done = nil, nil, nil
+}
+
+// search picks a move with MCTS when Playouts is set, and otherwise from the
+// policy's top-K legal moves. With a value head and ValueSearch each
+// candidate is scored by the evaluation of the position it leads to;
+// otherwise the most likely move is played, or one is sampled when the
+// temperature is above 0.
+func (e *Engine) search(ctx context.Context, runtime *model.Runtime, pos *chess.Position, options Options, limits Limits) (*searchResult, error) {
+	if options.Playouts > 0 {
+		return treeSearch(ctx, runtime, pos, options, limits)
+	}
+
+	state, err := data.TensorizePosition(pos, runtime.InputChannels())
+	if err != nil {
+		return nil, fmt.Errorf("failed to tensorize position: %w", err)
+	}
+	probs, value, err := runtime.ForwardLegal(state, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*chess.Move
+	var weights []float64
+	for _, prediction := range model.TopKPredictions(probs, options.TopK) {
+		if prediction.Probability == 0 {
+			break
+		}
+		move, err := data.MoveFromIndex(pos, prediction.MoveIndex)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, move)
+		weights = append(weights, prediction.Probability)
+	}
+	if len(candidates) == 0 {
+		candidates, weights = pos.ValidMoves()[:1], []float64{1}
+	}
+
+	if options.ValueSearch && runtime.HasValueHead() {
+		return valueSearch(runtime, pos, candidates)
+	}
+
+	choice := 0
+	if options.Temperature > 0 {
+		choice = e.sample(weights, options.Temperature)
+	}
+	result := &searchResult{
+		move:  candidates[choice],
+		pv:    []string{candidates[choice].String()},
+		nodes: 1,
+	}
+	if runtime.HasValueHead() {
+		result.score = fmt.Sprintf("cp %d", search.ValueToCentipawns(value))
+	} else {
+		result.score = fmt.Sprintf("cp %d", search.MaterialBalance(pos))
+	}
+	return result, nil
+}
+
+// treeSearch runs MCTS within the playout, node and time limits. Infinite
+// and ponder searches run until "stop".
+func treeSearch(ctx context.Context, runtime *model.Runtime, pos *chess.Position, options Options, limits Limits) (*searchResult, error) {
+	config := search.DefaultConfig()
+	config.Playouts = options.Playouts
+	config.Workers = options.Threads
+	if limits.Nodes > 0 && limits.Nodes < config.Playouts {
+		config.Playouts = limits.Nodes
+	}
+	config.TimeBudget = limits.Budget(pos.Turn())
+	if limits.Infinite || limits.Ponder {
+		config.Playouts, config.TimeBudget = 0, 0
+	}
+
+	var evaluator search.Evaluator = search.NewRuntimeEvaluator(runtime)
+	if options.Threads > 1 {
+		batcher := model.NewBatcher(runtime, model.BatcherConfig{MaxBatchSize: options.Threads, MaxWait: time.Millisecond})
+		defer batcher.Close()
+		evaluator = search.NewBatcherEvaluator(batcher)
+	}
+	result, err := search.NewSearcher(evaluator, config).Search(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	best := result.Best()
+	move := findMove(pos, best.Move)
+	if move == nil {
+		return nil, fmt.Errorf("search returned illegal move %s", best.Move)
+	}
+	score := fmt.Sprintf("cp %d", search.ValueToCentipawns(best.Value))
+	if best.Value == 1 && len(best.PV) == 1 {
+		score = "mate 1"
+	}
+	return &searchResult{move: move, pv: best.PV, score: score, nodes: result.Nodes}, nil
+}
+
+// valueSearch evaluates the position after each candidate in one batch and
+// plays the candidate that leaves the opponent the lowest value. The
+// principal variation continues with the opponent's most likely reply.
+func valueSearch(runtime *model.Runtime, pos *chess.Position, candidates []*chess.Move) (*searchResult, error) {
+	children := make([]*chess.Position, len(candidates))
+	scores := make([]float64, len(candidates))
+	var states [][]float32
+	var evaluated []int
+	for i, move := range candidates {
+		children[i] = pos.Update(move)
+		switch children[i].Status() {
+		case chess.Checkmate:
+			return &searchResult{move: move, pv: []string{move.String()}, score: "mate 1", nodes: 1}, nil
+		case chess.NoMethod:
+			state, err := data.TensorizePosition(children[i], runtime.InputChannels())
+			if err != nil {
+				return nil, fmt.Errorf("failed to tensorize position: %w", err)
+			}
+			states = append(states, state)
+			evaluated = append(evaluated, i)
+		default:
+			scores[i] = 0 // Stalemate and other draws
+		}
+	}
+
+	policies := make([][]float64, len(states))
+	for i := range policies {
+		policies[i] = make([]float64, runtime.PolicySize())
+	}
+	values := make([]float64, len(states))
+	if err := runtime.ForwardBatch(states, policies, values); err != nil {
+		return nil, err
+	}
+	replies := make([]string, len(candidates))
+	for j, i := range evaluated {
+		scores[i] = -values[j]
+		replies[i] = bestReply(children[i], policies[j])
+	}
+
+	best := 0
+	for i := range scores {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	result := &searchResult{
+		move:  candidates[best],
+		pv:    []string{candidates[best].String()},
+		score: fmt.Sprintf("cp %d", search.ValueToCentipawns(scores[best])),
+		nodes: 1 + len(states),
+	}
+	if replies[best] != "" {
+		result.pv = append(result.pv, replies[best])
+	}
+	return result, nil
+}
+
+// bestReply returns the most likely legal move of a policy, or ""
+func bestReply(pos *chess.Position, policy []float64) string {
+	legal := model.LegalMask(pos, len(policy))
+	if legal == nil {
+		return ""
+	}
+	masked := model.MaskPolicy(policy, legal)
+	best := -1
+	for i, p := range masked {
+		if legal[i] && (best < 0 || p > masked[best]) {
+			best = i
+		}
+	}
+	move, err := data.MoveFromIndex(pos, best)
+	if err != nil {
+		return ""
+	}
+	return move.String()
+}
+
+// sample draws an index with probability proportional to weight^(1/temperature)
+func (e *Engine) sample(weights []float64, temperature float64) int {
+	scaled := make([]float64, len(weights))
+	sum := 0.0
+	for i, w := range weights {
+		scaled[i] = math.Pow(w, 1/temperature)
+		sum += scaled[i]
+	}
+	r := e.rng.Float64() * sum
+	for i, w := range scaled {
+		r -= w
+		if r < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// formatFloat formats an option value without trailing zeros
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
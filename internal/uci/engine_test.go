@@ -0,0 +1,189 @@
+package uci
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+
+	"github.com/thyrook/partner/internal/model"
+)
+
+// saveModel writes a freshly initialized model of the given architecture
+func saveModel(t *testing.T, arch model.Architecture) string {
+	t.Helper()
+	m, err := model.NewChessModel(arch, model.DefaultCNNConfig())
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	defer m.Close()
+
+	path := filepath.Join(t.TempDir(), string(arch)+".gob")
+	if err := m.SaveModel(path); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+	return path
+}
+
+// session runs a UCI command script and returns the output lines
+func session(t *testing.T, options Options, script ...string) []string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := NewEngine(options, &out).Run(strings.NewReader(strings.Join(script, "\n"))); err != nil {
+		t.Fatalf("Failed to run session: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+// lastWithPrefix returns the last output line starting with prefix
+func lastWithPrefix(lines []string, prefix string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], prefix) {
+			return lines[i]
+		}
+	}
+	return ""
+}
+
+func TestSession(t *testing.T) {
+	options := DefaultOptions()
+	options.ModelPath = saveModel(t, model.ArchitectureCNN)
+
+	lines := session(t, options,
+		"uci",
+		"setoption name TopK value 3",
+		"isready",
+		"position startpos moves e2e4 e7e5 g1f3",
+		"go wtime 60000 btime 60000",
+		"quit",
+	)
+	for _, want := range []string{"id name " + EngineName, "option name TopK type spin default 5", "uciok", "readyok"} {
+		if lastWithPrefix(lines, want) == "" {
+			t.Errorf("Missing %q in %v", want, lines)
+		}
+	}
+
+	info := lastWithPrefix(lines, "info depth")
+	best := strings.TrimPrefix(lastWithPrefix(lines, "bestmove "), "bestmove ")
+	if !strings.Contains(info, " score cp ") || !strings.HasSuffix(info, " pv "+best) {
+		t.Errorf("Info %q for bestmove %q", info, best)
+	}
+	pos, err := parsePosition(strings.Fields("startpos moves e2e4 e7e5 g1f3"))
+	if err != nil {
+		t.Fatalf("Failed to parse position: %v", err)
+	}
+	if findMove(pos, best) == nil {
+		t.Errorf("Bestmove %q is not legal", best)
+	}
+
+	// Errors are reported as info strings and leave the engine running
+	lines = session(t, options,
+		"setoption name TopK value 500",
+		"setoption name Bogus value 1",
+		"position startpos moves e2e5",
+		"go infinite",
+		"isready",
+		"stop",
+	)
+	if len(lines) != 6 || !strings.HasPrefix(lines[2], "info string illegal move e2e5") ||
+		lastWithPrefix(lines, "readyok") == "" || !strings.HasPrefix(lines[5], "bestmove ") {
+		t.Errorf("Unexpected output: %v", lines)
+	}
+
+	lines = session(t, options, "position fen rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", "go")
+	if lastWithPrefix(lines, "bestmove") != "bestmove 0000" {
+		t.Errorf("Checkmated side got %v", lines)
+	}
+}
+
+func TestValueSearch(t *testing.T) {
+	options := DefaultOptions()
+	options.ModelPath = saveModel(t, model.ArchitectureResNet)
+
+	// Mate in one is found whatever the untrained network prefers
+	mateIn1 := "position fen 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1"
+	lines := session(t, options, "setoption name TopK value 50", mateIn1, "go movetime 100")
+	if info := lastWithPrefix(lines, "info depth"); !strings.Contains(info, "score mate 1") {
+		t.Errorf("Info %q, want mate 1", info)
+	}
+	if best := lastWithPrefix(lines, "bestmove"); best != "bestmove a1a8" {
+		t.Errorf("Got %q, want bestmove a1a8", best)
+	}
+
+	// The principal variation continues with a legal reply
+	lines = session(t, options, "position startpos", "go")
+	pv := strings.Fields(lastWithPrefix(lines, "info depth"))
+	if len(pv) < 2 || pv[len(pv)-3] != "pv" {
+		t.Fatalf("Expected a two move pv, got %v", pv)
+	}
+	pos := chess.NewGame().Position()
+	for _, uci := range pv[len(pv)-2:] {
+		move := findMove(pos, uci)
+		if move == nil {
+			t.Fatalf("PV move %s is not legal", uci)
+		}
+		pos = pos.Update(move)
+	}
+
+	// Without value search the move is sampled from the policy
+	lines = session(t, options, "setoption name ValueSearch value false", "setoption name Temperature value 1.5", "go")
+	if best := lastWithPrefix(lines, "bestmove "); findMove(chess.NewGame().Position(), strings.TrimPrefix(best, "bestmove ")) == nil {
+		t.Errorf("Sampled %q is not legal", best)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits := parseLimits(strings.Fields("wtime 1000 btime 2000 winc 10 binc 20 movestogo 30 depth 4 nodes 800 movetime 500 infinite"))
+	want := Limits{WTime: 1e9, BTime: 2e9, WInc: 1e7, BInc: 2e7, MovesToGo: 30, Depth: 4, Nodes: 800, MoveTime: 5e8, Infinite: true}
+	if limits != want {
+		t.Errorf("Got %+v, want %+v", limits, want)
+	}
+
+	budgets := []struct {
+		args  string
+		color chess.Color
+		want  time.Duration
+	}{
+		{"movetime 500 wtime 1000", chess.White, 500 * time.Millisecond},
+		{"wtime 60000 btime 30000 movestogo 10", chess.Black, 3 * time.Second},
+		{"wtime 60000 winc 1000", chess.White, 2750 * time.Millisecond},
+		{"wtime 100 winc 1000", chess.White, 50 * time.Millisecond},
+		{"infinite", chess.White, 0},
+	}
+	for _, tt := range budgets {
+		if got := parseLimits(strings.Fields(tt.args)).Budget(tt.color); got != tt.want {
+			t.Errorf("Budget(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestTreeSearch(t *testing.T) {
+	options := DefaultOptions()
+	options.ModelPath = saveModel(t, model.ArchitectureCNN)
+	options.Playouts = 300
+	options.Threads = 2
+
+	// Let the search finish before the end of the input stops it
+	var out bytes.Buffer
+	e := NewEngine(options, &out)
+	e.Execute("position fen 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1")
+	e.Execute("go nodes 100")
+	<-e.done
+	e.Execute("quit")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if info := lastWithPrefix(lines, "info depth"); !strings.Contains(info, "score mate 1") {
+		t.Errorf("Info %q, want mate 1", info)
+	}
+	if best := lastWithPrefix(lines, "bestmove"); best != "bestmove a1a8" {
+		t.Errorf("Got %q, want bestmove a1a8", best)
+	}
+
+	// An infinite search runs until stop
+	lines = session(t, options, "position startpos", "go infinite", "isready", "stop")
+	if lastWithPrefix(lines, "readyok") == "" || !strings.HasPrefix(lines[len(lines)-1], "bestmove ") {
+		t.Errorf("Unexpected output: %v", lines)
+	}
+}